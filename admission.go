@@ -0,0 +1,62 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"sync"
+)
+
+// Admission decides whether new keys are admitted into the cache when it is full.
+// It can be used to experiment with admission policies like TinyLFU on top of the S3-FIFO eviction policy.
+//
+// Its methods are called by the cache under the eviction lock, so implementations don't need to be thread-safe
+// but must not call the cache.
+type Admission[K comparable] interface {
+	// Record records an access of the key. Reads are sampled, so not every read is recorded.
+	Record(key K)
+	// Admit reports whether the candidate should be admitted at the cost of evicting the victim,
+	// which is the next item the eviction policy is going to evict.
+	Admit(candidate, victim K) bool
+}
+
+// SharedAdmission is an Admission that can be shared by several caches,
+// for example, shards of one logical dataset, so they don't split the access history.
+//
+// It serializes the calls of the wrapped Admission, since the caches call it concurrently.
+type SharedAdmission[K comparable] struct {
+	mutex     sync.Mutex
+	admission Admission[K]
+}
+
+// NewSharedAdmission creates a SharedAdmission wrapping the given admission.
+func NewSharedAdmission[K comparable](admission Admission[K]) *SharedAdmission[K] {
+	return &SharedAdmission[K]{
+		admission: admission,
+	}
+}
+
+// Record records an access of the key.
+func (s *SharedAdmission[K]) Record(key K) {
+	s.mutex.Lock()
+	s.admission.Record(key)
+	s.mutex.Unlock()
+}
+
+// Admit reports whether the candidate should be admitted at the cost of evicting the victim.
+func (s *SharedAdmission[K]) Admit(candidate, victim K) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.admission.Admit(candidate, victim)
+}
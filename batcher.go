@@ -0,0 +1,140 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BulkLoader computes or retrieves the values corresponding to the keys.
+//
+// Keys missing from the returned map are reported to the callers as ErrNotLoaded.
+type BulkLoader[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+// WithBatchWindow makes the cache delay loads by up to the given window
+// to batch distinct missing keys into a single call of the BulkLoader.
+//
+// The option can be used only with NewBulkLoadingCache.
+func WithBatchWindow(window time.Duration) LoadingOption {
+	return func(o *loadingOptions) {
+		o.batchWindow = window
+		if window == 0 {
+			// zero window would silently disable the batching.
+			o.batchWindow = -1
+		}
+	}
+}
+
+// NewBulkLoadingCache creates a cache that loads missing values into the given cache with the bulk loader.
+//
+// Without the WithBatchWindow option each key is loaded by a separate call of the bulk loader.
+// Batched loads are not bound to the context of any caller, so the bulk loader gets a background context.
+func NewBulkLoadingCache[K comparable, V any](
+	cache Interface[K, V],
+	loader BulkLoader[K, V],
+	opts ...LoadingOption,
+) (*LoadingCache[K, V], error) {
+	if loader == nil {
+		return nil, ErrNilLoader
+	}
+
+	o, err := applyLoadingOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.batchWindow == 0 {
+		return newLoadingCache(cache, func(ctx context.Context, key K) (V, error) {
+			values, err := loader(ctx, []K{key})
+			return lookupLoaded(values, err, key)
+		}, o)
+	}
+
+	b := &batcher[K, V]{
+		loader: loader,
+		window: o.batchWindow,
+	}
+	return newLoadingCache(cache, b.load, o)
+}
+
+type batch[K comparable, V any] struct {
+	keys   []K
+	done   chan struct{}
+	values map[K]V
+	err    error
+}
+
+type batcher[K comparable, V any] struct {
+	loader  BulkLoader[K, V]
+	window  time.Duration
+	mutex   sync.Mutex
+	pending *batch[K, V]
+}
+
+func (b *batcher[K, V]) load(ctx context.Context, key K) (V, error) {
+	b.mutex.Lock()
+	bt := b.pending
+	if bt == nil {
+		bt = &batch[K, V]{
+			done: make(chan struct{}),
+		}
+		b.pending = bt
+		time.AfterFunc(b.window, func() {
+			b.flush(bt)
+		})
+	}
+	bt.keys = append(bt.keys, key)
+	b.mutex.Unlock()
+
+	select {
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	case <-bt.done:
+		return lookupLoaded(bt.values, bt.err, key)
+	}
+}
+
+func (b *batcher[K, V]) flush(bt *batch[K, V]) {
+	b.mutex.Lock()
+	if b.pending == bt {
+		b.pending = nil
+	}
+	b.mutex.Unlock()
+
+	defer close(bt.done)
+	defer func() {
+		if r := recover(); r != nil {
+			bt.values = nil
+			bt.err = newPanicError(r)
+		}
+	}()
+
+	bt.values, bt.err = b.loader(context.Background(), bt.keys)
+}
+
+func lookupLoaded[K comparable, V any](values map[K]V, err error, key K) (V, error) {
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	v, ok := values[key]
+	if !ok {
+		return v, ErrNotLoaded
+	}
+	return v, nil
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulkLoadingCache_BatchWindow(t *testing.T) {
+	c, err := MustBuilder[int, int](100).WithTTL(time.Hour).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+
+	var (
+		mutex   sync.Mutex
+		batches [][]int
+	)
+	lc, err := NewBulkLoadingCache[int, int](c, func(ctx context.Context, keys []int) (map[int]int, error) {
+		mutex.Lock()
+		batches = append(batches, keys)
+		mutex.Unlock()
+
+		values := make(map[int]int, len(keys))
+		for _, k := range keys {
+			if k%2 == 0 {
+				values[k] = k * 10
+			}
+		}
+		return values, nil
+	}, WithBatchWindow(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("can not create loading cache: %v", err)
+	}
+	defer lc.Close()
+
+	const size = 10
+	var wg sync.WaitGroup
+	for i := 0; i < size; i++ {
+		wg.Add(1)
+		go func(key int) {
+			defer wg.Done()
+			v, err := lc.Get(context.Background(), key)
+			if key%2 == 0 && (err != nil || v != key*10) {
+				t.Errorf("lc.Get(%d) = %d/%v, want %d/nil", key, v, err, key*10)
+			}
+			if key%2 != 0 && !errors.Is(err, ErrNotLoaded) {
+				t.Errorf("should fail with an error %v, but got %v", ErrNotLoaded, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(batches) != 1 || len(batches[0]) != size {
+		t.Fatalf("keys should be loaded by a single call, but got %v", batches)
+	}
+	sort.Ints(batches[0])
+	for i, k := range batches[0] {
+		if k != i {
+			t.Fatalf("got unexpected keys: %v", batches[0])
+		}
+	}
+}
+
+func TestBulkLoadingCache_Errors(t *testing.T) {
+	c, err := MustBuilder[int, int](100).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	errBackend := errors.New("backend is unavailable")
+	lc, err := NewBulkLoadingCache[int, int](c, func(ctx context.Context, keys []int) (map[int]int, error) {
+		if keys[0] < 0 {
+			panic("negative key")
+		}
+		return nil, errBackend
+	})
+	if err != nil {
+		t.Fatalf("can not create loading cache: %v", err)
+	}
+	if _, err := lc.Get(context.Background(), 1); !errors.Is(err, errBackend) {
+		t.Fatalf("should fail with an error %v, but got %v", errBackend, err)
+	}
+	var panicErr *PanicError
+	if _, err := lc.Get(context.Background(), -1); !errors.As(err, &panicErr) {
+		t.Fatalf("panic should be turned into an error, but got %v", err)
+	}
+
+	if _, err := NewBulkLoadingCache[int, int](c, nil); !errors.Is(err, ErrNilLoader) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrNilLoader, err)
+	}
+	loader := func(ctx context.Context, key int) (int, error) {
+		return key, nil
+	}
+	if _, err := NewLoadingCache[int, int](c, loader, WithBatchWindow(time.Millisecond)); !errors.Is(err, ErrIllegalBatchWindow) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalBatchWindow, err)
+	}
+}
@@ -16,15 +16,20 @@ package otter
 
 import (
 	"errors"
+	"io"
 	"time"
 
 	"github.com/maypok86/otter/internal/core"
+	"github.com/maypok86/otter/internal/xruntime"
 )
 
 const (
-	unsetCapacity = -1
+	unsetCapacity   = -1
+	unsetShardCount = -1
 )
 
+// The builder reports invalid parameters as a *ConfigError wrapping one of these errors,
+// so they should be checked with errors.Is.
 var (
 	// ErrIllegalCapacity means that a non-positive capacity has been passed to the NewBuilder.
 	ErrIllegalCapacity = errors.New("capacity should be positive")
@@ -32,8 +37,100 @@ var (
 	ErrIllegalInitialCapacity = errors.New("initial capacity should be positive")
 	// ErrNilCostFunc means that a nil cost func has been passed to the Builder.Cost.
 	ErrNilCostFunc = errors.New("setCostFunc func should not be nil")
+	// ErrIllegalCostByLen means that the Builder.CostByLen has been used with values other than string or []byte,
+	// or with keys other than string when the keys are counted.
+	ErrIllegalCostByLen = errors.New("cost by length requires string or []byte values and string keys if they are counted")
 	// ErrIllegalTTL means that a non-positive ttl has been passed to the Builder.WithTTL.
 	ErrIllegalTTL = errors.New("ttl should be positive")
+	// ErrIllegalTTLBounds means that a negative bound or a min ttl greater than the max one
+	// has been passed to the VariableTTLBuilder.MinTTL or VariableTTLBuilder.MaxTTL.
+	ErrIllegalTTLBounds = errors.New("ttl bounds should not be negative and min ttl should not exceed max ttl")
+	// ErrIllegalMaintenanceRate means that a negative rate has been passed to the Builder.MaintenanceRate.
+	ErrIllegalMaintenanceRate = errors.New("maintenance rate should not be negative")
+	// ErrIllegalEventsCapacity means that a negative capacity has been passed to the Builder.Events.
+	ErrIllegalEventsCapacity = errors.New("events capacity should not be negative")
+	// ErrIllegalShardCount means that a non-positive shard count has been passed to the Builder.ShardCount.
+	ErrIllegalShardCount = errors.New("shard count should be positive")
+	// ErrIllegalBackpressure means that an unknown mode has been passed to the Builder.WriteBackpressure.
+	ErrIllegalBackpressure = errors.New("backpressure mode is unknown")
+	// ErrIllegalTopKeysCapacity means that a negative capacity has been passed to the Builder.TrackTopKeys.
+	ErrIllegalTopKeysCapacity = errors.New("top keys capacity should not be negative")
+	// ErrIllegalWatermarks means that illegal watermarks have been passed to the Builder.EvictionWatermarks.
+	ErrIllegalWatermarks = errors.New("watermarks should be in the range (0, 100] and low should not exceed high")
+	// ErrIllegalEvictionBatchSize means that a non-positive size has been passed to the Builder.EvictionBatchSize.
+	ErrIllegalEvictionBatchSize = errors.New("eviction batch size should be positive")
+	// ErrIllegalSmallQueueRatio means that a ratio out of the range (0, 100) has been passed to the Builder.SmallQueueRatio.
+	ErrIllegalSmallQueueRatio = errors.New("small queue ratio should be in the range (0, 100)")
+	// ErrIllegalGhostQueueFactor means that a non-positive factor has been passed to the Builder.GhostQueueFactor.
+	ErrIllegalGhostQueueFactor = errors.New("ghost queue factor should be positive")
+	// ErrNilFetchCostFunc means that nil fetch cost func has been passed to the Builder.CostAwareEviction.
+	ErrNilFetchCostFunc = errors.New("fetch cost func should not be nil")
+	// ErrIllegalDoorkeeperResetInterval means that a non-positive interval has been passed
+	// to the Builder.DoorkeeperResetInterval or the doorkeeper is disabled.
+	ErrIllegalDoorkeeperResetInterval = errors.New("doorkeeper reset interval should be positive and used only with the doorkeeper")
+	// ErrIllegalWAL means that invalid parameters have been passed to the Builder.WAL or it is used with the Builder.Journal.
+	ErrIllegalWAL = errors.New("wal dir should not be empty, compaction interval should be positive and wal can't be used with journal")
+	// ErrIllegalMaxEntryCost means that a zero cost has been passed to the Builder.MaxEntryCost.
+	ErrIllegalMaxEntryCost = errors.New("max entry cost should be positive")
+	// ErrIllegalExpirationStrategy means that an unknown strategy has been passed to the Builder.ExpirationStrategy
+	// or the lazy strategy is used with the Builder.PreciseExpiration.
+	ErrIllegalExpirationStrategy = errors.New("expiration strategy is unknown or lazy with precise expiration")
+	// ErrNilMemoryPressure means that a nil func has been passed to the Builder.MemoryPressure.
+	ErrNilMemoryPressure = errors.New("memory pressure func should not be nil")
+	// ErrIllegalWeakValues means that the Builder.WeakValues has been used with a value type other than Weak.
+	ErrIllegalWeakValues = errors.New("weak values require the Weak value type")
+	// ErrIllegalReadBuffers means that a non-positive count or capacity has been passed to the Builder.ReadBuffers.
+	ErrIllegalReadBuffers = errors.New("read buffers count and capacity should be positive")
+	// ErrIllegalReadBuffersScaling means that illegal bounds have been passed to the Builder.ScaleReadBuffers.
+	ErrIllegalReadBuffersScaling = errors.New("read buffers scaling bounds should be positive and min should not exceed max")
+	// ErrIllegalAmortizedMaintenance means that the Builder.AmortizedMaintenance has been used with an option
+	// which needs a background goroutine: memory pressure, read buffers scaling or wal.
+	ErrIllegalAmortizedMaintenance = errors.New("amortized maintenance can not be used with background options")
+	// ErrIllegalParallelGetThreshold means that a non-positive threshold has been passed to the Builder.ParallelGetThreshold.
+	ErrIllegalParallelGetThreshold = errors.New("parallel get threshold should be positive")
+	// ErrIllegalHashTableTuning means that a load factor out of (0, 1] or a growth factor less than 2
+	// has been passed to the Builder.HashTableTuning.
+	ErrIllegalHashTableTuning = errors.New("hash table load factor should be in (0, 1] and growth factor should be at least 2")
+	// ErrIllegalInternKeys means that the Builder.InternKeys has been used with a key type other than string.
+	ErrIllegalInternKeys = errors.New("key interning requires a string key type")
+	// ErrIllegalOffHeapSize means that a non-positive size has been passed to the Builder.BuildOffHeap.
+	ErrIllegalOffHeapSize = errors.New("off-heap size should be positive")
+	// ErrNilCodec means that a nil codec has been passed to the Builder.BuildOffHeap.
+	ErrNilCodec = errors.New("codec should not be nil")
+	// ErrIllegalOffHeapOption means that the Builder.BuildOffHeap has been used with an option
+	// which needs values on the Go heap: events, journal, wal, weak values or fetch cost.
+	ErrIllegalOffHeapOption = errors.New("option is not supported by the off-heap cache")
+	// ErrMismatchedExpiration means that an option has been used with a cache which doesn't expire the items
+	// the way the option needs, e.g. WithExpireAfterAccess without a ttl or WithDefaultTTL with a constant ttl.
+	ErrMismatchedExpiration = errors.New("option doesn't match the expiration of the cache")
+)
+
+// ExpirationStrategy determines when expired items are removed from the cache.
+type ExpirationStrategy int
+
+const (
+	// ExpireLazilyAndProactively removes expired items both on access and in the background.
+	ExpireLazilyAndProactively ExpirationStrategy = iota
+	// ExpireLazily removes expired items only on access, so no background goroutine competes
+	// with the callers for the CPU and the eviction lock. Expired items that are never accessed again
+	// occupy memory until they are evicted.
+	ExpireLazily
+	// ExpireProactively removes expired items only in the background, so reads never write to the hash table.
+	// Reads still treat expired items as missing.
+	ExpireProactively
+)
+
+// Backpressure determines what writes do when the write buffer is full.
+type Backpressure int
+
+const (
+	// BlockWrites makes writes wait until the maintenance frees a slot in the write buffer,
+	// so no write is lost at the cost of latency.
+	BlockWrites Backpressure = iota
+	// RejectWrites makes writes fail without changing the cache when the write buffer is full,
+	// so callers can retry or shed load instead of waiting. Use TrySet to see whether a write
+	// has been rejected because of the full write buffer.
+	RejectWrites
 )
 
 type baseOptions[K comparable, V any] struct {
@@ -41,6 +138,73 @@ type baseOptions[K comparable, V any] struct {
 	initialCapacity int
 	statsEnabled    bool
 	costFunc        func(key K, value V) uint32
+	costByLenFailed bool
+	maintenanceRate int
+	stableRange     bool
+	latencies       bool
+	eventsCapacity  int
+	shardCount      int
+	nodePooling     bool
+	backpressure    Backpressure
+	synchronous     bool
+	journal         io.Writer
+	ignoreHas       bool
+	accessTTL       time.Duration
+	withAccessTTL   bool
+	staleTTL        time.Duration
+	withStaleTTL    bool
+	entryStats      bool
+	topKeys         int
+	doorkeeper      bool
+	admission       Admission[K]
+	// zero means the default S3-FIFO settings.
+	smallQueueRatio  int
+	ghostQueueFactor float64
+	withQueueRatio   bool
+	withGhostFactor  bool
+	fetchCostFunc    func(key K, value V) uint32
+	withFetchCost    bool
+	soonestExpiring  bool
+	// zero means the capacity of the cache.
+	doorkeeperReset     int
+	withDoorkeeperReset bool
+	logger              core.Logger
+	maxEntryCost        uint32
+	withMaxEntryCost    bool
+	versioned           bool
+	precise             bool
+	expirationStrategy  ExpirationStrategy
+	memoryPressure      func() bool
+	withMemoryPressure  bool
+	weakValues          bool
+	internKey           func(key K) K
+	withInternKeys      bool
+	readBuffersCount    int
+	readBufferCapacity  int
+	withReadBuffers     bool
+	minReadBuffers      int
+	maxReadBuffers      int
+	withScaling         bool
+	amortized           bool
+	walDir              string
+	walInterval         time.Duration
+	withWAL             bool
+	parallelGets        int
+	withParallelGets    bool
+	lowWatermark        int
+	highWatermark       int
+	withWatermarks      bool
+	evictionBatch       int
+	withEvictionBatch   bool
+	hashLoadFactor      float64
+	hashGrowthFactor    int
+	withHashTuning      bool
+	// the variable ttl settings are kept here, so the functional options can set them before WithVariableTTL.
+	defaultTTL     time.Duration
+	withDefaultTTL bool
+	timerWheel     bool
+	minTTL         time.Duration
+	maxTTL         time.Duration
 }
 
 func (o *baseOptions[K, V]) collectStats() {
@@ -49,18 +213,317 @@ func (o *baseOptions[K, V]) collectStats() {
 
 func (o *baseOptions[K, V]) setCostFunc(costFunc func(key K, value V) uint32) {
 	o.costFunc = costFunc
+	o.costByLenFailed = false
+}
+
+func (o *baseOptions[K, V]) setCostByLen(withKeys bool) {
+	costFunc, ok := costByLen[K, V](withKeys)
+	if !ok {
+		o.costByLenFailed = true
+		return
+	}
+	o.setCostFunc(costFunc)
 }
 
 func (o *baseOptions[K, V]) setInitialCapacity(initialCapacity int) {
 	o.initialCapacity = initialCapacity
 }
 
+func (o *baseOptions[K, V]) setMaintenanceRate(maintenanceRate int) {
+	o.maintenanceRate = maintenanceRate
+}
+
+func (o *baseOptions[K, V]) setEventsCapacity(eventsCapacity int) {
+	o.eventsCapacity = eventsCapacity
+}
+
+func (o *baseOptions[K, V]) setShardCount(shardCount int) {
+	o.shardCount = shardCount
+}
+
+func (o *baseOptions[K, V]) setJournal(w io.Writer) {
+	o.journal = w
+}
+
+func (o *baseOptions[K, V]) collectLatencies() {
+	o.latencies = true
+}
+
+func (o *baseOptions[K, V]) enableNodePooling() {
+	o.nodePooling = true
+}
+
+func (o *baseOptions[K, V]) enableSynchronousEviction() {
+	o.synchronous = true
+}
+
+func (o *baseOptions[K, V]) ignoreHasInStats() {
+	o.ignoreHas = true
+}
+
+func (o *baseOptions[K, V]) setBackpressure(mode Backpressure) {
+	o.backpressure = mode
+}
+
+func (o *baseOptions[K, V]) setExpireAfterAccess(accessTTL time.Duration) {
+	o.accessTTL = accessTTL
+	o.withAccessTTL = true
+}
+
+func (o *baseOptions[K, V]) setAllowStale(staleTTL time.Duration) {
+	o.staleTTL = staleTTL
+	o.withStaleTTL = true
+}
+
+func (o *baseOptions[K, V]) collectEntryStats() {
+	o.entryStats = true
+}
+
+func (o *baseOptions[K, V]) trackTopKeys(capacity int) {
+	o.topKeys = capacity
+}
+
+func (o *baseOptions[K, V]) enableDoorkeeper() {
+	o.doorkeeper = true
+}
+
+func (o *baseOptions[K, V]) setAdmission(admission Admission[K]) {
+	o.admission = admission
+}
+
+func (o *baseOptions[K, V]) setSmallQueueRatio(percent int) {
+	o.smallQueueRatio = percent
+	o.withQueueRatio = true
+}
+
+func (o *baseOptions[K, V]) setWatermarks(lowPercent, highPercent int) {
+	o.lowWatermark = lowPercent
+	o.highWatermark = highPercent
+	o.withWatermarks = true
+}
+
+func (o *baseOptions[K, V]) setEvictionBatchSize(size int) {
+	o.evictionBatch = size
+	o.withEvictionBatch = true
+}
+
+func (o *baseOptions[K, V]) setHashTableTuning(loadFactor float64, growthFactor int) {
+	o.hashLoadFactor = loadFactor
+	o.hashGrowthFactor = growthFactor
+	o.withHashTuning = true
+}
+
+func (o *baseOptions[K, V]) setGhostQueueFactor(factor float64) {
+	o.ghostQueueFactor = factor
+	o.withGhostFactor = true
+}
+
+func (o *baseOptions[K, V]) setFetchCostFunc(fetchCost func(key K, value V) uint32) {
+	o.fetchCostFunc = fetchCost
+	o.withFetchCost = true
+}
+
+func (o *baseOptions[K, V]) evictSoonestExpiringFirst() {
+	o.soonestExpiring = true
+}
+
+func (o *baseOptions[K, V]) setDoorkeeperResetInterval(keys int) {
+	o.doorkeeperReset = keys
+	o.withDoorkeeperReset = true
+}
+
+func (o *baseOptions[K, V]) setMaxEntryCost(c uint32) {
+	o.maxEntryCost = c
+	o.withMaxEntryCost = true
+}
+
+func (o *baseOptions[K, V]) setWAL(dir string, compactionInterval time.Duration) {
+	o.walDir = dir
+	o.walInterval = compactionInterval
+	o.withWAL = true
+}
+
+func (o *baseOptions[K, V]) setLogger(logger core.Logger) {
+	o.logger = logger
+}
+
+func (o *baseOptions[K, V]) setMemoryPressure(pressured func() bool) {
+	o.memoryPressure = pressured
+	o.withMemoryPressure = true
+}
+
+// reclaimable is implemented by the values which may be reclaimed by the garbage collector while cached.
+type reclaimable interface {
+	onReclaim(f func())
+}
+
+func (o *baseOptions[K, V]) enableWeakValues() {
+	o.weakValues = true
+}
+
+func (o *baseOptions[K, V]) setInternKey(internKey func(key K) K) {
+	o.internKey = internKey
+	o.withInternKeys = true
+}
+
+func (o *baseOptions[K, V]) setReadBuffers(count, capacity int) {
+	o.readBuffersCount = count
+	o.readBufferCapacity = capacity
+	o.withReadBuffers = true
+}
+
+func (o *baseOptions[K, V]) setReadBuffersScaling(minCount, maxCount int) {
+	o.minReadBuffers = minCount
+	o.maxReadBuffers = maxCount
+	o.withScaling = true
+}
+
+func (o *baseOptions[K, V]) enableAmortizedMaintenance() {
+	o.amortized = true
+}
+
+func (o *baseOptions[K, V]) setParallelGetThreshold(threshold int) {
+	o.parallelGets = threshold
+	o.withParallelGets = true
+}
+
+func (o *baseOptions[K, V]) setExpirationStrategy(strategy ExpirationStrategy) {
+	o.expirationStrategy = strategy
+}
+
+func (o *baseOptions[K, V]) enablePreciseExpiration() {
+	o.precise = true
+}
+
+func (o *baseOptions[K, V]) enableVersions() {
+	o.versioned = true
+}
+
+func (o *baseOptions[K, V]) enableStableRange() {
+	o.stableRange = true
+}
+
+func (o *baseOptions[K, V]) setDefaultTTL(ttl time.Duration) {
+	o.defaultTTL = ttl
+	o.withDefaultTTL = true
+}
+
+// ttlOption returns the name and the value of the first option which needs a ttl or an empty name.
+func (o *baseOptions[K, V]) ttlOption() (string, any) {
+	switch {
+	case o.withAccessTTL:
+		return "ExpireAfterAccess", o.accessTTL
+	case o.withStaleTTL:
+		return "AllowStale", o.staleTTL
+	case o.soonestExpiring:
+		return "EvictSoonestExpiringFirst", true
+	case o.expirationStrategy != ExpireLazilyAndProactively:
+		return "ExpirationStrategy", o.expirationStrategy
+	case o.precise:
+		return "PreciseExpiration", true
+	}
+	return "", nil
+}
+
+// variableTTLOption returns the name and the value of the first option which needs the variable ttl or an empty name.
+func (o *baseOptions[K, V]) variableTTLOption() (string, any) {
+	switch {
+	case o.withDefaultTTL:
+		return "DefaultTTL", o.defaultTTL
+	case o.minTTL != 0 || o.maxTTL != 0:
+		return "MinTTL/MaxTTL", []time.Duration{o.minTTL, o.maxTTL}
+	case o.timerWheel:
+		return "TimerWheel", true
+	}
+	return "", nil
+}
+
 func (o *baseOptions[K, V]) validate() error {
 	if o.initialCapacity <= 0 && o.initialCapacity != unsetCapacity {
-		return ErrIllegalInitialCapacity
+		return newConfigError("InitialCapacity", o.initialCapacity, ErrIllegalInitialCapacity)
 	}
 	if o.costFunc == nil {
-		return ErrNilCostFunc
+		return newConfigError("Cost", nil, ErrNilCostFunc)
+	}
+	if o.costByLenFailed {
+		return newConfigError("CostByLen", typeName[V](), ErrIllegalCostByLen)
+	}
+	if o.maintenanceRate < 0 {
+		return newConfigError("MaintenanceRate", o.maintenanceRate, ErrIllegalMaintenanceRate)
+	}
+	if o.eventsCapacity < 0 {
+		return newConfigError("Events", o.eventsCapacity, ErrIllegalEventsCapacity)
+	}
+	if o.shardCount <= 0 && o.shardCount != unsetShardCount {
+		return newConfigError("ShardCount", o.shardCount, ErrIllegalShardCount)
+	}
+	if o.topKeys < 0 {
+		return newConfigError("TrackTopKeys", o.topKeys, ErrIllegalTopKeysCapacity)
+	}
+	if o.withQueueRatio && (o.smallQueueRatio <= 0 || o.smallQueueRatio >= 100) {
+		return newConfigError("SmallQueueRatio", o.smallQueueRatio, ErrIllegalSmallQueueRatio)
+	}
+	if o.withWatermarks && (o.lowWatermark <= 0 || o.lowWatermark > o.highWatermark || o.highWatermark > 100) {
+		return newConfigError("EvictionWatermarks", []int{o.lowWatermark, o.highWatermark}, ErrIllegalWatermarks)
+	}
+	if o.withEvictionBatch && o.evictionBatch <= 0 {
+		return newConfigError("EvictionBatchSize", o.evictionBatch, ErrIllegalEvictionBatchSize)
+	}
+	if o.withGhostFactor && !(o.ghostQueueFactor > 0) {
+		return newConfigError("GhostQueueFactor", o.ghostQueueFactor, ErrIllegalGhostQueueFactor)
+	}
+	if o.withFetchCost && o.fetchCostFunc == nil {
+		return newConfigError("CostAwareEviction", nil, ErrNilFetchCostFunc)
+	}
+	if o.withDoorkeeperReset && (o.doorkeeperReset <= 0 || !o.doorkeeper) {
+		return newConfigError("DoorkeeperResetInterval", o.doorkeeperReset, ErrIllegalDoorkeeperResetInterval)
+	}
+	if o.withMaxEntryCost && o.maxEntryCost == 0 {
+		return newConfigError("MaxEntryCost", o.maxEntryCost, ErrIllegalMaxEntryCost)
+	}
+	if o.expirationStrategy < ExpireLazilyAndProactively || o.expirationStrategy > ExpireProactively ||
+		(o.expirationStrategy == ExpireLazily && o.precise) {
+		return newConfigError("ExpirationStrategy", o.expirationStrategy, ErrIllegalExpirationStrategy)
+	}
+	if o.withMemoryPressure && o.memoryPressure == nil {
+		return newConfigError("MemoryPressure", nil, ErrNilMemoryPressure)
+	}
+	if o.withReadBuffers && (o.readBuffersCount <= 0 || o.readBufferCapacity <= 0) {
+		return newConfigError("ReadBuffers", []int{o.readBuffersCount, o.readBufferCapacity}, ErrIllegalReadBuffers)
+	}
+	if o.withScaling && (o.minReadBuffers <= 0 || o.minReadBuffers > o.maxReadBuffers) {
+		return newConfigError("ScaleReadBuffers", []int{o.minReadBuffers, o.maxReadBuffers}, ErrIllegalReadBuffersScaling)
+	}
+	// WebAssembly runtimes always use the amortized maintenance.
+	if (o.amortized || xruntime.WASM) && (o.withMemoryPressure || o.withScaling || o.withWAL) {
+		return newConfigError("AmortizedMaintenance", o.amortized, ErrIllegalAmortizedMaintenance)
+	}
+	if o.withParallelGets && o.parallelGets <= 0 {
+		return newConfigError("ParallelGetThreshold", o.parallelGets, ErrIllegalParallelGetThreshold)
+	}
+	if o.withHashTuning && (!(o.hashLoadFactor > 0 && o.hashLoadFactor <= 1) || o.hashGrowthFactor < 2) {
+		return newConfigError("HashTableTuning", []any{o.hashLoadFactor, o.hashGrowthFactor}, ErrIllegalHashTableTuning)
+	}
+	if o.withInternKeys && o.internKey == nil {
+		return newConfigError("InternKeys", typeName[K](), ErrIllegalInternKeys)
+	}
+	if o.weakValues {
+		var zero V
+		if _, ok := any(zero).(reclaimable); !ok {
+			return newConfigError("WeakValues", typeName[V](), ErrIllegalWeakValues)
+		}
+	}
+	if o.withWAL && (o.walDir == "" || o.walInterval <= 0 || o.journal != nil) {
+		return newConfigError("WAL", []any{o.walDir, o.walInterval}, ErrIllegalWAL)
+	}
+	if o.withAccessTTL && o.accessTTL <= 0 {
+		return newConfigError("ExpireAfterAccess", o.accessTTL, ErrIllegalTTL)
+	}
+	if o.backpressure < BlockWrites || o.backpressure > RejectWrites {
+		return newConfigError("WriteBackpressure", o.backpressure, ErrIllegalBackpressure)
+	}
+	if o.withStaleTTL && o.staleTTL <= 0 {
+		return newConfigError("AllowStale", o.staleTTL, ErrIllegalTTL)
 	}
 	return nil
 }
@@ -70,11 +533,60 @@ func (o *baseOptions[K, V]) toConfig() core.Config[K, V] {
 	if o.initialCapacity != unsetCapacity {
 		initialCapacity = &o.initialCapacity
 	}
+	var shardCount int
+	if o.shardCount != unsetShardCount {
+		shardCount = o.shardCount
+	}
+	var weakValues func(value V, reclaimed func())
+	if o.weakValues {
+		weakValues = func(value V, reclaimed func()) {
+			any(value).(reclaimable).onReclaim(reclaimed)
+		}
+	}
 	return core.Config[K, V]{
-		Capacity:        o.capacity,
-		InitialCapacity: initialCapacity,
-		StatsEnabled:    o.statsEnabled,
-		CostFunc:        o.costFunc,
+		Capacity:                o.capacity,
+		InitialCapacity:         initialCapacity,
+		StatsEnabled:            o.statsEnabled,
+		CostFunc:                o.costFunc,
+		MaintenanceRate:         o.maintenanceRate,
+		StableRange:             o.stableRange,
+		LatenciesEnabled:        o.latencies,
+		ShardCount:              shardCount,
+		NodePooling:             o.nodePooling,
+		RejectOnFullBuffer:      o.backpressure == RejectWrites,
+		SynchronousEviction:     o.synchronous,
+		IgnoreHasInStats:        o.ignoreHas,
+		ExpireAfterAccess:       o.accessTTL,
+		StaleTTL:                o.staleTTL,
+		EntryStats:              o.entryStats,
+		TopKeysCapacity:         o.topKeys,
+		Doorkeeper:              o.doorkeeper,
+		Admission:               o.admission,
+		SmallQueueRatio:         o.smallQueueRatio,
+		LowWatermark:            o.lowWatermark,
+		HighWatermark:           o.highWatermark,
+		EvictionBatchSize:       o.evictionBatch,
+		GhostQueueFactor:        o.ghostQueueFactor,
+		FetchCostFunc:           o.fetchCostFunc,
+		EvictSoonestExpiring:    o.soonestExpiring,
+		DoorkeeperResetInterval: o.doorkeeperReset,
+		Logger:                  o.logger,
+		MaxEntryCost:            o.maxEntryCost,
+		Versioned:               o.versioned,
+		PreciseExpiration:       o.precise,
+		NoLazyExpiration:        o.expirationStrategy == ExpireProactively,
+		NoProactiveExpiration:   o.expirationStrategy == ExpireLazily,
+		MemoryPressure:          o.memoryPressure,
+		WeakValues:              weakValues,
+		InternKey:               o.internKey,
+		ReadBuffersCount:        o.readBuffersCount,
+		ReadBufferCapacity:      o.readBufferCapacity,
+		MinReadBuffersCount:     o.minReadBuffers,
+		MaxReadBuffersCount:     o.maxReadBuffers,
+		AmortizedMaintenance:    o.amortized || xruntime.WASM,
+		ParallelGetThreshold:    o.parallelGets,
+		HashTableLoadFactor:     o.hashLoadFactor,
+		HashTableGrowthFactor:   o.hashGrowthFactor,
 	}
 }
 
@@ -85,7 +597,10 @@ type constTTLOptions[K comparable, V any] struct {
 
 func (o *constTTLOptions[K, V]) validate() error {
 	if o.ttl <= 0 {
-		return ErrIllegalTTL
+		return newConfigError("WithTTL", o.ttl, ErrIllegalTTL)
+	}
+	if field, value := o.variableTTLOption(); field != "" {
+		return newConfigError(field, value, ErrMismatchedExpiration)
 	}
 	return o.baseOptions.validate()
 }
@@ -100,9 +615,25 @@ type variableTTLOptions[K comparable, V any] struct {
 	baseOptions[K, V]
 }
 
+func (o *variableTTLOptions[K, V]) validate() error {
+	if o.withDefaultTTL && o.defaultTTL <= 0 {
+		return newConfigError("DefaultTTL", o.defaultTTL, ErrIllegalTTL)
+	}
+	if o.minTTL < 0 || o.maxTTL < 0 || (o.maxTTL > 0 && o.minTTL > o.maxTTL) {
+		return newConfigError("MinTTL/MaxTTL", []time.Duration{o.minTTL, o.maxTTL}, ErrIllegalTTLBounds)
+	}
+	return o.baseOptions.validate()
+}
+
 func (o *variableTTLOptions[K, V]) toConfig() core.Config[K, V] {
 	c := o.baseOptions.toConfig()
 	c.WithVariableTTL = true
+	c.TimerWheel = o.timerWheel
+	c.MinTTL = o.minTTL
+	c.MaxTTL = o.maxTTL
+	if o.withDefaultTTL {
+		c.TTL = &o.defaultTTL
+	}
 	return c
 }
 
@@ -111,6 +642,17 @@ type Builder[K comparable, V any] struct {
 	baseOptions[K, V]
 }
 
+func (b *Builder[K, V]) validate() error {
+	// the options of the ttl builders can still be set by the functional options and Config.
+	if field, value := b.ttlOption(); field != "" {
+		return newConfigError(field, value, ErrMismatchedExpiration)
+	}
+	if field, value := b.variableTTLOption(); field != "" {
+		return newConfigError(field, value, ErrMismatchedExpiration)
+	}
+	return b.baseOptions.validate()
+}
+
 // MustBuilder creates a builder and sets the future cache capacity.
 //
 // Panics if capacity <= 0.
@@ -127,13 +669,14 @@ func MustBuilder[K comparable, V any](capacity int) *Builder[K, V] {
 // Returns an error if capacity <= 0.
 func NewBuilder[K comparable, V any](capacity int) (*Builder[K, V], error) {
 	if capacity <= 0 {
-		return nil, ErrIllegalCapacity
+		return nil, newConfigError("NewBuilder", capacity, ErrIllegalCapacity)
 	}
 
 	return &Builder[K, V]{
 		baseOptions: baseOptions[K, V]{
 			capacity:        capacity,
 			initialCapacity: unsetCapacity,
+			shardCount:      unsetShardCount,
 			statsEnabled:    false,
 			costFunc: func(key K, value V) uint32 {
 				return 1
@@ -166,6 +709,15 @@ func (b *Builder[K, V]) Cost(costFunc func(key K, value V) uint32) *Builder[K, V
 	return b
 }
 
+// CostByLen makes the cost of an item equal to the length of its value, and if withKeys is true,
+// plus the length of its key. Empty items cost 1.
+//
+// It requires V to be a string or a []byte and K to be a string if the keys are counted.
+func (b *Builder[K, V]) CostByLen(withKeys bool) *Builder[K, V] {
+	b.setCostByLen(withKeys)
+	return b
+}
+
 // WithTTL specifies that each item should be automatically removed from the cache once a fixed duration
 // has elapsed after the item's creation.
 func (b *Builder[K, V]) WithTTL(ttl time.Duration) *ConstTTLBuilder[K, V] {
@@ -189,84 +741,1221 @@ func (b *Builder[K, V]) WithVariableTTL() *VariableTTLBuilder[K, V] {
 	}
 }
 
-// Build creates a configured cache or
-// returns an error if invalid parameters were passed to the builder.
-func (b *Builder[K, V]) Build() (Cache[K, V], error) {
-	if err := b.validate(); err != nil {
-		return Cache[K, V]{}, err
-	}
+// MaintenanceRate sets the maximum number of operations per second that the background maintenance
+// (applying writes to the eviction policy and removing expired items) may perform.
+// When the limit is reached, the maintenance goroutines are suspended, and the time spent waiting
+// is reported by Stats.ThrottledTime.
+//
+// NOTE: if the maintenance can't keep up with the writes, then the write buffer fills up and writes are blocked
+// until there is free space in it.
+//
+// By default, the maintenance is not limited.
+func (b *Builder[K, V]) MaintenanceRate(opsPerSecond int) *Builder[K, V] {
+	b.setMaintenanceRate(opsPerSecond)
+	return b
+}
 
-	return newCache(b.toConfig()), nil
+// StableRange makes Range iterate over items in the order in which they were last written,
+// so the iteration order doesn't change between runs with the same sequence of writes.
+// It is useful for debugging and golden-file tests of cache contents.
+//
+// NOTE: this option makes Range much slower, since all items must be collected and sorted before the iteration.
+//
+// By default, the iteration order is not specified.
+func (b *Builder[K, V]) StableRange() *Builder[K, V] {
+	b.enableStableRange()
+	return b
 }
 
-// ConstTTLBuilder is a one-shot builder for creating a cache instance.
-type ConstTTLBuilder[K comparable, V any] struct {
-	constTTLOptions[K, V]
+// CollectLatencies determines whether the latencies of Get, Set and Delete operations should be measured.
+// The measured latencies are available through Stats.
+//
+// NOTE: measuring requires reading the clock twice per operation, which noticeably slows down the cache.
+//
+// By default, latencies are not measured.
+func (b *Builder[K, V]) CollectLatencies() *Builder[K, V] {
+	b.collectLatencies()
+	return b
 }
 
-// CollectStats determines whether statistics should be calculated when the cache is running.
+// Events enables the stream of changes of the cache contents (insertions, updates, deletions, evictions
+// and expirations) available through the Events method of the cache.
+// The capacity bounds the number of events that haven't been received yet, zero capacity disables events.
 //
-// By default, statistics calculating is disabled.
-func (b *ConstTTLBuilder[K, V]) CollectStats() *ConstTTLBuilder[K, V] {
-	b.collectStats()
+// By default, events are not emitted.
+func (b *Builder[K, V]) Events(capacity int) *Builder[K, V] {
+	b.setEventsCapacity(capacity)
 	return b
 }
 
-// InitialCapacity sets the minimum total size for the internal data structures. Providing a large enough estimate
-// at construction time avoids the need for expensive resizing operations later, but setting this
-// value unnecessarily high wastes memory.
-func (b *ConstTTLBuilder[K, V]) InitialCapacity(initialCapacity int) *ConstTTLBuilder[K, V] {
-	b.setInitialCapacity(initialCapacity)
+// ShardCount sets the number of shards used by the internal concurrent structures of the cache:
+// the striped size counters of the hash table and the read/write buffers.
+// The value is rounded up to the nearest power of two.
+//
+// It is useful inside CPU-limited containers, where GOMAXPROCS doesn't reflect the real parallelism,
+// and for workloads with extreme key skew.
+//
+// By default, the number of shards is detected automatically based on GOMAXPROCS.
+func (b *Builder[K, V]) ShardCount(n int) *Builder[K, V] {
+	b.setShardCount(n)
 	return b
 }
 
-// Cost sets a function to dynamically calculate the cost of an item.
+// NodePooling enables reusing of internal entry nodes to reduce allocations.
 //
-// By default, this function always returns 1.
-func (b *ConstTTLBuilder[K, V]) Cost(costFunc func(key K, value V) uint32) *ConstTTLBuilder[K, V] {
-	b.setCostFunc(costFunc)
+// Only nodes that have never been visible to readers are reused, for example, when SetIfAbsent or GetOrSet
+// find an existing entry. Nodes of evicted and expired entries are left to the garbage collector,
+// since concurrent lock-free readers may still use them.
+//
+// By default, a new node is allocated for every write.
+func (b *Builder[K, V]) NodePooling() *Builder[K, V] {
+	b.enableNodePooling()
 	return b
 }
 
-// Build creates a configured cache or
-// returns an error if invalid parameters were passed to the builder.
-func (b *ConstTTLBuilder[K, V]) Build() (Cache[K, V], error) {
-	if err := b.validate(); err != nil {
-		return Cache[K, V]{}, err
+// WriteBackpressure sets what writes do when the write buffer is full because the maintenance can't keep up:
+// wait for a free slot (BlockWrites, the default) or be rejected (RejectWrites).
+// Rejected writes return false just like the writes dropped because of their cost,
+// so use TrySet to tell a full write buffer apart: it returns ErrWriteBufferFull.
+func (b *Builder[K, V]) WriteBackpressure(mode Backpressure) *Builder[K, V] {
+	b.setBackpressure(mode)
+	return b
+}
+
+// SynchronousEviction makes writes update the eviction policy inline, in the calling goroutine,
+// instead of via the asynchronous write buffer. So the cache doesn't exceed its capacity
+// by more than the number of concurrently running writes.
+//
+// NOTE: writes become slower and contend with each other on the policy lock.
+//
+// By default, writes are applied to the eviction policy asynchronously.
+func (b *Builder[K, V]) SynchronousEviction() *Builder[K, V] {
+	b.enableSynchronousEviction()
+	return b
+}
+
+// Journal makes the cache write all user mutations (sets and deletes) with their timestamps and expiration times
+// to w, so the state of the cache can be restored by ReplayJournal after a restart
+// or replicated to other caches. Evictions and expirations are not written, since they are local decisions of every cache.
+//
+// Writes to w are serialized, but they are performed synchronously by writers, so w should be fast (e.g. buffered).
+// Failed writes are reported by Stats.DroppedEvents.
+//
+// By default, the journal is disabled.
+func (b *Builder[K, V]) Journal(w io.Writer) *Builder[K, V] {
+	b.setJournal(w)
+	return b
+}
+
+// IgnoreHasInStats makes Has calls not affect the hit and miss statistics,
+// so probes like health checks don't skew the hit ratio. Has still counts as an access for the eviction policy.
+//
+// By default, Has is recorded in the statistics as Get.
+func (b *Builder[K, V]) IgnoreHasInStats() *Builder[K, V] {
+	b.ignoreHasInStats()
+	return b
+}
+
+// CollectEntryStats enables tracking of the number of hits and the time of the last access for each entry.
+// The statistics are exposed via GetEntry and Hottest.
+// Together with CollectStats, they also feed Stats.Lifetime and Stats.LastHitAge.
+func (b *Builder[K, V]) CollectEntryStats() *Builder[K, V] {
+	b.collectEntryStats()
+	return b
+}
+
+// TrackTopKeys enables tracking of the approximately hottest keys with a fixed number of counters.
+// The keys are exposed via TopKeys. Keys outside of the top capacity are not reported reliably.
+func (b *Builder[K, V]) TrackTopKeys(capacity int) *Builder[K, V] {
+	b.trackTopKeys(capacity)
+	return b
+}
+
+// Doorkeeper enables a bloom filter in front of the eviction policy that rejects keys written for the first time
+// while the cache is full, so one-hit wonders don't pollute the cache. A rejected item is evicted right after
+// the write, and the next write of the same key is admitted.
+//
+// It improves the hit ratio of workloads with many keys accessed only once, like CDN traces.
+func (b *Builder[K, V]) Doorkeeper() *Builder[K, V] {
+	b.enableDoorkeeper()
+	return b
+}
+
+// Admission sets the admission policy consulted for new keys when the cache is full.
+// If it rejects a key, the item is evicted right after the write.
+func (b *Builder[K, V]) Admission(admission Admission[K]) *Builder[K, V] {
+	b.setAdmission(admission)
+	return b
+}
+
+// SmallQueueRatio sets the share of the S3-FIFO small queue in percent of the capacity. The default is 10%.
+//
+// A larger small queue favors recency, so it may suit workloads where new items are re-read soon after the write.
+func (b *Builder[K, V]) SmallQueueRatio(percent int) *Builder[K, V] {
+	b.setSmallQueueRatio(percent)
+	return b
+}
+
+// GhostQueueFactor sets the max length of the S3-FIFO ghost queue relative to the number of items in the cache.
+// The default is 1.
+func (b *Builder[K, V]) GhostQueueFactor(factor float64) *Builder[K, V] {
+	b.setGhostQueueFactor(factor)
+	return b
+}
+
+// CostAwareEviction makes the eviction policy factor the cost of each item and the expense of fetching it again
+// into eviction decisions, similar to GreedyDual-Size. Among several candidates for eviction,
+// the item with the lowest fetch cost per unit of its cost is evicted first,
+// so cheap to recompute large items are evicted before expensive small ones.
+func (b *Builder[K, V]) CostAwareEviction(fetchCost func(key K, value V) uint32) *Builder[K, V] {
+	b.setFetchCostFunc(fetchCost)
+	return b
+}
+
+// DoorkeeperResetInterval sets the number of distinct keys after which the doorkeeper forgets all seen keys.
+// The default is the capacity of the cache.
+//
+// A shorter interval makes the doorkeeper adapt faster to shifts of the workload, for example daily periodicity,
+// at the cost of rejecting more keys. It can only be used with Doorkeeper.
+func (b *Builder[K, V]) DoorkeeperResetInterval(keys int) *Builder[K, V] {
+	b.setDoorkeeperResetInterval(keys)
+	return b
+}
+
+// SharedAdmission sets the admission policy shared with other caches.
+// It is the same as Admission, but makes the sharing explicit.
+func (b *Builder[K, V]) SharedAdmission(admission *SharedAdmission[K]) *Builder[K, V] {
+	// avoid a non-nil interface holding a nil pointer.
+	var a Admission[K]
+	if admission != nil {
+		a = admission
 	}
+	b.setAdmission(a)
+	return b
+}
+
+// WAL makes the cache persist all user mutations to a write-ahead log in dir and compact it into a snapshot
+// every compactionInterval, so the cache is restored by Build after a restart without a full dump on shutdown.
+//
+// The compaction writes the snapshot in the background while the writers append to a new log segment.
+// Writes to the log are buffered and flushed every second and on Close, so the last second of mutations
+// may be lost on a crash. Like ReplayJournal, the restore skips expired items. It can't be used with Journal.
+//
+// By default, the write-ahead log is disabled.
+func (b *Builder[K, V]) WAL(dir string, compactionInterval time.Duration) *Builder[K, V] {
+	b.setWAL(dir, compactionInterval)
+	return b
+}
 
-	return newCache(b.toConfig()), nil
+// MaxEntryCost sets the max cost of a single item regardless of the capacity of the cache.
+// Items with a larger cost are rejected by writes and counted by Stats.RejectedSets,
+// so a single accidentally huge value can't evict the whole cache.
+//
+// By default, an item is rejected only if its cost exceeds the capacity available to the eviction policy.
+func (b *Builder[K, V]) MaxEntryCost(c uint32) *Builder[K, V] {
+	b.setMaxEntryCost(c)
+	return b
 }
 
-// VariableTTLBuilder is a one-shot builder for creating a cache instance.
-type VariableTTLBuilder[K comparable, V any] struct {
-	variableTTLOptions[K, V]
+// Versioned makes the cache assign a monotonically increasing version to the item on every write.
+// The version is returned by Entry.Version and enables optimistic concurrency with SetIfVersion.
+//
+// By default, items have no versions.
+func (b *Builder[K, V]) Versioned() *Builder[K, V] {
+	b.enableVersions()
+	return b
 }
 
-// CollectStats determines whether statistics should be calculated when the cache is running.
+// MemoryPressure makes the cache check the given func every second and halve its capacity on every check
+// while it reports that the process is short of memory, down to 1/16 of the capacity, evicting the items which don't fit.
+// Once the pressure has been gone for five checks in a row, the capacity is doubled back on every check until it is restored.
+// SoftMemoryLimitPressure reports the pressure relative to the Go soft memory limit.
 //
-// By default, statistics calculating is disabled.
-func (b *VariableTTLBuilder[K, V]) CollectStats() *VariableTTLBuilder[K, V] {
-	b.collectStats()
+// By default, the capacity of the cache never changes.
+func (b *Builder[K, V]) MemoryPressure(pressured func() bool) *Builder[K, V] {
+	b.setMemoryPressure(pressured)
 	return b
 }
 
-// InitialCapacity sets the minimum total size for the internal data structures. Providing a large enough estimate
-// at construction time avoids the need for expensive resizing operations later, but setting this
-// value unnecessarily high wastes memory.
-func (b *VariableTTLBuilder[K, V]) InitialCapacity(initialCapacity int) *VariableTTLBuilder[K, V] {
-	b.setInitialCapacity(initialCapacity)
+// ReadBuffers sets the number of the striped lossy buffers recording reads for the eviction policy
+// and the capacity of each buffer, both are rounded up to a power of two.
+// Larger buffers drop fewer reads under heavy contention, see Stats.ReadBufferDrops, at the cost of memory.
+//
+// By default, there are 4 buffers per available CPU with 16 slots each.
+func (b *Builder[K, V]) ReadBuffers(count, capacity int) *Builder[K, V] {
+	b.setReadBuffers(count, capacity)
 	return b
 }
 
-// Cost sets a function to dynamically calculate the cost of an item.
+// ScaleReadBuffers makes the cache check the drop rate of the read buffers every second, doubling their number
+// while they drop more than 5% of reads and halving it after 10 seconds without drops.
+// The number stays within the given bounds, which are rounded up to a power of two.
 //
-// By default, this function always returns 1.
-func (b *VariableTTLBuilder[K, V]) Cost(costFunc func(key K, value V) uint32) *VariableTTLBuilder[K, V] {
-	b.setCostFunc(costFunc)
+// By default, the number of the read buffers is fixed, see ReadBuffers.
+func (b *Builder[K, V]) ScaleReadBuffers(minCount, maxCount int) *Builder[K, V] {
+	b.setReadBuffersScaling(minCount, maxCount)
+	return b
+}
+
+// AmortizedMaintenance makes the cache run without background goroutines, so it can be used
+// where they are forbidden. The writes are applied to the eviction policy by the calling goroutines,
+// which also remove the expired items at most once a second, and the clock is read lazily.
+//
+// It can't be used with the options requiring background goroutines: MemoryPressure, ScaleReadBuffers and WAL.
+// It is always enabled on WebAssembly (GOOS=js or wasip1).
+func (b *Builder[K, V]) AmortizedMaintenance() *Builder[K, V] {
+	b.enableAmortizedMaintenance()
 	return b
 }
 
+// ParallelGetThreshold sets the number of keys from which GetAll and GetEntries look them up
+// in parallel on up to the available number of CPUs. Smaller batches are looked up by the calling goroutine.
+//
+// By default, the batches are never looked up in parallel.
+func (b *Builder[K, V]) ParallelGetThreshold(threshold int) *Builder[K, V] {
+	b.setParallelGetThreshold(threshold)
+	return b
+}
+
+// EvictionWatermarks makes the cache start the eviction when the total cost exceeds highPercent of the capacity
+// and evict the items in a batch until it drops to lowPercent of the capacity, so bursty writers don't pay
+// for an eviction on every write once the cache is full. By default, both watermarks are 100%.
+func (b *Builder[K, V]) EvictionWatermarks(lowPercent, highPercent int) *Builder[K, V] {
+	b.setWatermarks(lowPercent, highPercent)
+	return b
+}
+
+// EvictionBatchSize limits the number of items evicted per maintenance cycle, so a write of a huge item
+// doesn't stall the maintenance with a long chain of evictions. The items which don't fit after that
+// are evicted by the following cycles, hence the cache can temporarily exceed its capacity.
+//
+// By default, the number of evictions per cycle isn't limited.
+func (b *Builder[K, V]) EvictionBatchSize(size int) *Builder[K, V] {
+	b.setEvictionBatchSize(size)
+	return b
+}
+
+// HashTableTuning sets the load factor, the fraction of the hash table slots which can be occupied
+// before the table grows, and the factor by which it grows, rounded up to a power of two.
+// A lower load factor trades memory for shorter bucket chains, and a higher growth factor means fewer rehashes.
+// The table is presized by InitialCapacity to hold that many items under the load factor without rehashing.
+//
+// By default, the load factor is 0.75 and the growth factor is 2.
+func (b *Builder[K, V]) HashTableTuning(loadFactor float64, growthFactor int) *Builder[K, V] {
+	b.setHashTableTuning(loadFactor, growthFactor)
+	return b
+}
+
+// Clone returns a copy of the builder, so the copy can be changed and built independently of the original.
+//
+// The builder isn't safe for concurrent use, so a shared base configuration should be cloned
+// before it is customized in different places.
+func (b *Builder[K, V]) Clone() *Builder[K, V] {
+	clone := *b
+	return &clone
+}
+
+// Validate performs all the checks of Build without creating the cache,
+// so the configuration can be checked before memory is committed.
+//
+// The write-ahead log directory specified by WAL is opened only by Build, so its errors aren't reported.
+func (b *Builder[K, V]) Validate() error {
+	return b.validate()
+}
+
+// Build creates a configured cache or
+// returns an error if invalid parameters were passed to the builder.
+func (b *Builder[K, V]) Build() (Cache[K, V], error) {
+	if err := b.validate(); err != nil {
+		return Cache[K, V]{}, err
+	}
+
+	return newCache(b.toConfig(), &b.baseOptions)
+}
+
+// BuildOffHeap creates a configured cache keeping the values encoded by the codec in size bytes
+// of memory allocated outside of the Go heap.
+//
+// Events, journal, wal, weak values and fetch cost are not supported by the off-heap cache.
+func (b *Builder[K, V]) BuildOffHeap(size int, codec Codec[V]) (*OffHeapCache[K, V], error) {
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+
+	return newOffHeapCache(&b.baseOptions, size, codec)
+}
+
+// ConstTTLBuilder is a one-shot builder for creating a cache instance.
+type ConstTTLBuilder[K comparable, V any] struct {
+	constTTLOptions[K, V]
+}
+
+// CollectStats determines whether statistics should be calculated when the cache is running.
+//
+// By default, statistics calculating is disabled.
+func (b *ConstTTLBuilder[K, V]) CollectStats() *ConstTTLBuilder[K, V] {
+	b.collectStats()
+	return b
+}
+
+// InitialCapacity sets the minimum total size for the internal data structures. Providing a large enough estimate
+// at construction time avoids the need for expensive resizing operations later, but setting this
+// value unnecessarily high wastes memory.
+func (b *ConstTTLBuilder[K, V]) InitialCapacity(initialCapacity int) *ConstTTLBuilder[K, V] {
+	b.setInitialCapacity(initialCapacity)
+	return b
+}
+
+// Cost sets a function to dynamically calculate the cost of an item.
+//
+// By default, this function always returns 1.
+func (b *ConstTTLBuilder[K, V]) Cost(costFunc func(key K, value V) uint32) *ConstTTLBuilder[K, V] {
+	b.setCostFunc(costFunc)
+	return b
+}
+
+// CostByLen makes the cost of an item equal to the length of its value, and if withKeys is true,
+// plus the length of its key. Empty items cost 1.
+//
+// It requires V to be a string or a []byte and K to be a string if the keys are counted.
+func (b *ConstTTLBuilder[K, V]) CostByLen(withKeys bool) *ConstTTLBuilder[K, V] {
+	b.setCostByLen(withKeys)
+	return b
+}
+
+// MaintenanceRate sets the maximum number of operations per second that the background maintenance
+// (applying writes to the eviction policy and removing expired items) may perform.
+// When the limit is reached, the maintenance goroutines are suspended, and the time spent waiting
+// is reported by Stats.ThrottledTime.
+//
+// NOTE: if the maintenance can't keep up with the writes, then the write buffer fills up and writes are blocked
+// until there is free space in it.
+//
+// By default, the maintenance is not limited.
+func (b *ConstTTLBuilder[K, V]) MaintenanceRate(opsPerSecond int) *ConstTTLBuilder[K, V] {
+	b.setMaintenanceRate(opsPerSecond)
+	return b
+}
+
+// StableRange makes Range iterate over items in the order in which they were last written,
+// so the iteration order doesn't change between runs with the same sequence of writes.
+// It is useful for debugging and golden-file tests of cache contents.
+//
+// NOTE: this option makes Range much slower, since all items must be collected and sorted before the iteration.
+//
+// By default, the iteration order is not specified.
+func (b *ConstTTLBuilder[K, V]) StableRange() *ConstTTLBuilder[K, V] {
+	b.enableStableRange()
+	return b
+}
+
+// CollectLatencies determines whether the latencies of Get, Set and Delete operations should be measured.
+// The measured latencies are available through Stats.
+//
+// NOTE: measuring requires reading the clock twice per operation, which noticeably slows down the cache.
+//
+// By default, latencies are not measured.
+func (b *ConstTTLBuilder[K, V]) CollectLatencies() *ConstTTLBuilder[K, V] {
+	b.collectLatencies()
+	return b
+}
+
+// Events enables the stream of changes of the cache contents (insertions, updates, deletions, evictions
+// and expirations) available through the Events method of the cache.
+// The capacity bounds the number of events that haven't been received yet, zero capacity disables events.
+//
+// By default, events are not emitted.
+func (b *ConstTTLBuilder[K, V]) Events(capacity int) *ConstTTLBuilder[K, V] {
+	b.setEventsCapacity(capacity)
+	return b
+}
+
+// ShardCount sets the number of shards used by the internal concurrent structures of the cache:
+// the striped size counters of the hash table and the read/write buffers.
+// The value is rounded up to the nearest power of two.
+//
+// It is useful inside CPU-limited containers, where GOMAXPROCS doesn't reflect the real parallelism,
+// and for workloads with extreme key skew.
+//
+// By default, the number of shards is detected automatically based on GOMAXPROCS.
+func (b *ConstTTLBuilder[K, V]) ShardCount(n int) *ConstTTLBuilder[K, V] {
+	b.setShardCount(n)
+	return b
+}
+
+// NodePooling enables reusing of internal entry nodes to reduce allocations.
+//
+// Only nodes that have never been visible to readers are reused, for example, when SetIfAbsent or GetOrSet
+// find an existing entry. Nodes of evicted and expired entries are left to the garbage collector,
+// since concurrent lock-free readers may still use them.
+//
+// By default, a new node is allocated for every write.
+func (b *ConstTTLBuilder[K, V]) NodePooling() *ConstTTLBuilder[K, V] {
+	b.enableNodePooling()
+	return b
+}
+
+// WriteBackpressure sets what writes do when the write buffer is full because the maintenance can't keep up:
+// wait for a free slot (BlockWrites, the default) or be rejected (RejectWrites).
+// Rejected writes return false just like the writes dropped because of their cost,
+// so use TrySet to tell a full write buffer apart: it returns ErrWriteBufferFull.
+func (b *ConstTTLBuilder[K, V]) WriteBackpressure(mode Backpressure) *ConstTTLBuilder[K, V] {
+	b.setBackpressure(mode)
+	return b
+}
+
+// SynchronousEviction makes writes update the eviction policy inline, in the calling goroutine,
+// instead of via the asynchronous write buffer. So the cache doesn't exceed its capacity
+// by more than the number of concurrently running writes.
+//
+// NOTE: writes become slower and contend with each other on the policy lock.
+//
+// By default, writes are applied to the eviction policy asynchronously.
+func (b *ConstTTLBuilder[K, V]) SynchronousEviction() *ConstTTLBuilder[K, V] {
+	b.enableSynchronousEviction()
+	return b
+}
+
+// Journal makes the cache write all user mutations (sets and deletes) with their timestamps and expiration times
+// to w, so the state of the cache can be restored by ReplayJournal after a restart
+// or replicated to other caches. Evictions and expirations are not written, since they are local decisions of every cache.
+//
+// Writes to w are serialized, but they are performed synchronously by writers, so w should be fast (e.g. buffered).
+// Failed writes are reported by Stats.DroppedEvents.
+//
+// By default, the journal is disabled.
+func (b *ConstTTLBuilder[K, V]) Journal(w io.Writer) *ConstTTLBuilder[K, V] {
+	b.setJournal(w)
+	return b
+}
+
+// IgnoreHasInStats makes Has calls not affect the hit and miss statistics,
+// so probes like health checks don't skew the hit ratio. Has still counts as an access for the eviction policy.
+//
+// By default, Has is recorded in the statistics as Get.
+func (b *ConstTTLBuilder[K, V]) IgnoreHasInStats() *ConstTTLBuilder[K, V] {
+	b.ignoreHasInStats()
+	return b
+}
+
+// ExpireAfterAccess specifies that each item should be automatically removed from the cache once a fixed duration
+// has elapsed after the item's creation or the most recent read. It is combined with the ttl of the item,
+// so the item expires when either of the deadlines passes. For example, sessions can have
+// a hard max lifetime set by the ttl plus an idle timeout set by this option.
+//
+// Items expired because of inactivity are removed lazily: on access or by the periodic probing of the cleanup,
+// but no later than their ttl.
+func (b *ConstTTLBuilder[K, V]) ExpireAfterAccess(ttl time.Duration) *ConstTTLBuilder[K, V] {
+	b.setExpireAfterAccess(ttl)
+	return b
+}
+
+// AllowStale specifies that expired items should be kept in the cache for the given duration,
+// so a LoadingCache can serve them while a background reload is in flight.
+// Regular reads still treat such items as missing.
+func (b *ConstTTLBuilder[K, V]) AllowStale(d time.Duration) *ConstTTLBuilder[K, V] {
+	b.setAllowStale(d)
+	return b
+}
+
+// CollectEntryStats enables tracking of the number of hits and the time of the last access for each entry.
+// The statistics are exposed via GetEntry and Hottest.
+// Together with CollectStats, they also feed Stats.Lifetime and Stats.LastHitAge.
+func (b *ConstTTLBuilder[K, V]) CollectEntryStats() *ConstTTLBuilder[K, V] {
+	b.collectEntryStats()
+	return b
+}
+
+// TrackTopKeys enables tracking of the approximately hottest keys with a fixed number of counters.
+// The keys are exposed via TopKeys. Keys outside of the top capacity are not reported reliably.
+func (b *ConstTTLBuilder[K, V]) TrackTopKeys(capacity int) *ConstTTLBuilder[K, V] {
+	b.trackTopKeys(capacity)
+	return b
+}
+
+// Doorkeeper enables a bloom filter in front of the eviction policy that rejects keys written for the first time
+// while the cache is full, so one-hit wonders don't pollute the cache. A rejected item is evicted right after
+// the write, and the next write of the same key is admitted.
+//
+// It improves the hit ratio of workloads with many keys accessed only once, like CDN traces.
+func (b *ConstTTLBuilder[K, V]) Doorkeeper() *ConstTTLBuilder[K, V] {
+	b.enableDoorkeeper()
+	return b
+}
+
+// Admission sets the admission policy consulted for new keys when the cache is full.
+// If it rejects a key, the item is evicted right after the write.
+func (b *ConstTTLBuilder[K, V]) Admission(admission Admission[K]) *ConstTTLBuilder[K, V] {
+	b.setAdmission(admission)
+	return b
+}
+
+// SmallQueueRatio sets the share of the S3-FIFO small queue in percent of the capacity. The default is 10%.
+//
+// A larger small queue favors recency, so it may suit workloads where new items are re-read soon after the write.
+func (b *ConstTTLBuilder[K, V]) SmallQueueRatio(percent int) *ConstTTLBuilder[K, V] {
+	b.setSmallQueueRatio(percent)
+	return b
+}
+
+// GhostQueueFactor sets the max length of the S3-FIFO ghost queue relative to the number of items in the cache.
+// The default is 1.
+func (b *ConstTTLBuilder[K, V]) GhostQueueFactor(factor float64) *ConstTTLBuilder[K, V] {
+	b.setGhostQueueFactor(factor)
+	return b
+}
+
+// CostAwareEviction makes the eviction policy factor the cost of each item and the expense of fetching it again
+// into eviction decisions, similar to GreedyDual-Size. Among several candidates for eviction,
+// the item with the lowest fetch cost per unit of its cost is evicted first,
+// so cheap to recompute large items are evicted before expensive small ones.
+func (b *ConstTTLBuilder[K, V]) CostAwareEviction(fetchCost func(key K, value V) uint32) *ConstTTLBuilder[K, V] {
+	b.setFetchCostFunc(fetchCost)
+	return b
+}
+
+// EvictSoonestExpiringFirst makes the eviction policy prefer, among several candidates for eviction,
+// the items which are going to expire soon anyway. It reduces the amount of useful data destroyed
+// when the capacity pressure and the expiration interact. It can be combined with CostAwareEviction.
+func (b *ConstTTLBuilder[K, V]) EvictSoonestExpiringFirst() *ConstTTLBuilder[K, V] {
+	b.evictSoonestExpiringFirst()
+	return b
+}
+
+// DoorkeeperResetInterval sets the number of distinct keys after which the doorkeeper forgets all seen keys.
+// The default is the capacity of the cache.
+//
+// A shorter interval makes the doorkeeper adapt faster to shifts of the workload, for example daily periodicity,
+// at the cost of rejecting more keys. It can only be used with Doorkeeper.
+func (b *ConstTTLBuilder[K, V]) DoorkeeperResetInterval(keys int) *ConstTTLBuilder[K, V] {
+	b.setDoorkeeperResetInterval(keys)
+	return b
+}
+
+// SharedAdmission sets the admission policy shared with other caches.
+// It is the same as Admission, but makes the sharing explicit.
+func (b *ConstTTLBuilder[K, V]) SharedAdmission(admission *SharedAdmission[K]) *ConstTTLBuilder[K, V] {
+	// avoid a non-nil interface holding a nil pointer.
+	var a Admission[K]
+	if admission != nil {
+		a = admission
+	}
+	b.setAdmission(a)
+	return b
+}
+
+// WAL makes the cache persist all user mutations to a write-ahead log in dir and compact it into a snapshot
+// every compactionInterval, so the cache is restored by Build after a restart without a full dump on shutdown.
+//
+// The compaction writes the snapshot in the background while the writers append to a new log segment.
+// Writes to the log are buffered and flushed every second and on Close, so the last second of mutations
+// may be lost on a crash. Like ReplayJournal, the restore skips expired items. It can't be used with Journal.
+//
+// By default, the write-ahead log is disabled.
+func (b *ConstTTLBuilder[K, V]) WAL(dir string, compactionInterval time.Duration) *ConstTTLBuilder[K, V] {
+	b.setWAL(dir, compactionInterval)
+	return b
+}
+
+// MaxEntryCost sets the max cost of a single item regardless of the capacity of the cache.
+// Items with a larger cost are rejected by writes and counted by Stats.RejectedSets,
+// so a single accidentally huge value can't evict the whole cache.
+//
+// By default, an item is rejected only if its cost exceeds the capacity available to the eviction policy.
+func (b *ConstTTLBuilder[K, V]) MaxEntryCost(c uint32) *ConstTTLBuilder[K, V] {
+	b.setMaxEntryCost(c)
+	return b
+}
+
+// Versioned makes the cache assign a monotonically increasing version to the item on every write.
+// The version is returned by Entry.Version and enables optimistic concurrency with SetIfVersion.
+//
+// By default, items have no versions.
+func (b *ConstTTLBuilder[K, V]) Versioned() *ConstTTLBuilder[K, V] {
+	b.enableVersions()
+	return b
+}
+
+// PreciseExpiration makes the cache remove expired items and emit their EventExpire within a couple
+// of seconds of the expiration time, rather than whenever they are next read or found by the background scan.
+// New items reach the expiration policy as soon as the write buffer is drained instead of in batches,
+// and the policy is the hierarchical timer wheel. It is useful when work is scheduled off the expiration events.
+//
+// NOTE: it applies to the write ttl only, items expired by ExpireAfterAccess are still removed lazily.
+//
+// By default, expired items may stay in the cache until they are read or the background scan finds them.
+func (b *ConstTTLBuilder[K, V]) PreciseExpiration() *ConstTTLBuilder[K, V] {
+	b.enablePreciseExpiration()
+	return b
+}
+
+// ExpirationStrategy sets when expired items are removed from the cache: on access, in the background or both.
+// The lazy strategy suits latency-sensitive deployments, the proactive one suits memory-tight ones.
+//
+// NOTE: the background expiration is driven by the write ttl, so with the proactive strategy
+// items expired by ExpireAfterAccess may stay until their write ttl passes or they are evicted.
+//
+// By default, expired items are removed both on access and in the background.
+func (b *ConstTTLBuilder[K, V]) ExpirationStrategy(strategy ExpirationStrategy) *ConstTTLBuilder[K, V] {
+	b.setExpirationStrategy(strategy)
+	return b
+}
+
+// MemoryPressure makes the cache check the given func every second and halve its capacity on every check
+// while it reports that the process is short of memory, down to 1/16 of the capacity, evicting the items which don't fit.
+// Once the pressure has been gone for five checks in a row, the capacity is doubled back on every check until it is restored.
+// SoftMemoryLimitPressure reports the pressure relative to the Go soft memory limit.
+//
+// By default, the capacity of the cache never changes.
+func (b *ConstTTLBuilder[K, V]) MemoryPressure(pressured func() bool) *ConstTTLBuilder[K, V] {
+	b.setMemoryPressure(pressured)
+	return b
+}
+
+// ReadBuffers sets the number of the striped lossy buffers recording reads for the eviction policy
+// and the capacity of each buffer, both are rounded up to a power of two.
+// Larger buffers drop fewer reads under heavy contention, see Stats.ReadBufferDrops, at the cost of memory.
+//
+// By default, there are 4 buffers per available CPU with 16 slots each.
+func (b *ConstTTLBuilder[K, V]) ReadBuffers(count, capacity int) *ConstTTLBuilder[K, V] {
+	b.setReadBuffers(count, capacity)
+	return b
+}
+
+// ScaleReadBuffers makes the cache check the drop rate of the read buffers every second, doubling their number
+// while they drop more than 5% of reads and halving it after 10 seconds without drops.
+// The number stays within the given bounds, which are rounded up to a power of two.
+//
+// By default, the number of the read buffers is fixed, see ReadBuffers.
+func (b *ConstTTLBuilder[K, V]) ScaleReadBuffers(minCount, maxCount int) *ConstTTLBuilder[K, V] {
+	b.setReadBuffersScaling(minCount, maxCount)
+	return b
+}
+
+// AmortizedMaintenance makes the cache run without background goroutines, so it can be used
+// where they are forbidden. The writes are applied to the eviction policy by the calling goroutines,
+// which also remove the expired items at most once a second, and the clock is read lazily.
+//
+// It can't be used with the options requiring background goroutines: MemoryPressure, ScaleReadBuffers and WAL.
+// It is always enabled on WebAssembly (GOOS=js or wasip1).
+func (b *ConstTTLBuilder[K, V]) AmortizedMaintenance() *ConstTTLBuilder[K, V] {
+	b.enableAmortizedMaintenance()
+	return b
+}
+
+// ParallelGetThreshold sets the number of keys from which GetAll and GetEntries look them up
+// in parallel on up to the available number of CPUs. Smaller batches are looked up by the calling goroutine.
+//
+// By default, the batches are never looked up in parallel.
+func (b *ConstTTLBuilder[K, V]) ParallelGetThreshold(threshold int) *ConstTTLBuilder[K, V] {
+	b.setParallelGetThreshold(threshold)
+	return b
+}
+
+// EvictionWatermarks makes the cache start the eviction when the total cost exceeds highPercent of the capacity
+// and evict the items in a batch until it drops to lowPercent of the capacity, so bursty writers don't pay
+// for an eviction on every write once the cache is full. By default, both watermarks are 100%.
+func (b *ConstTTLBuilder[K, V]) EvictionWatermarks(lowPercent, highPercent int) *ConstTTLBuilder[K, V] {
+	b.setWatermarks(lowPercent, highPercent)
+	return b
+}
+
+// EvictionBatchSize limits the number of items evicted per maintenance cycle, so a write of a huge item
+// doesn't stall the maintenance with a long chain of evictions. The items which don't fit after that
+// are evicted by the following cycles, hence the cache can temporarily exceed its capacity.
+//
+// By default, the number of evictions per cycle isn't limited.
+func (b *ConstTTLBuilder[K, V]) EvictionBatchSize(size int) *ConstTTLBuilder[K, V] {
+	b.setEvictionBatchSize(size)
+	return b
+}
+
+// HashTableTuning sets the load factor, the fraction of the hash table slots which can be occupied
+// before the table grows, and the factor by which it grows, rounded up to a power of two.
+// A lower load factor trades memory for shorter bucket chains, and a higher growth factor means fewer rehashes.
+// The table is presized by InitialCapacity to hold that many items under the load factor without rehashing.
+//
+// By default, the load factor is 0.75 and the growth factor is 2.
+func (b *ConstTTLBuilder[K, V]) HashTableTuning(loadFactor float64, growthFactor int) *ConstTTLBuilder[K, V] {
+	b.setHashTableTuning(loadFactor, growthFactor)
+	return b
+}
+
+// Clone returns a copy of the builder, so the copy can be changed and built independently of the original.
+//
+// The builder isn't safe for concurrent use, so a shared base configuration should be cloned
+// before it is customized in different places.
+func (b *ConstTTLBuilder[K, V]) Clone() *ConstTTLBuilder[K, V] {
+	clone := *b
+	return &clone
+}
+
+// Validate performs all the checks of Build without creating the cache,
+// so the configuration can be checked before memory is committed.
+//
+// The write-ahead log directory specified by WAL is opened only by Build, so its errors aren't reported.
+func (b *ConstTTLBuilder[K, V]) Validate() error {
+	return b.validate()
+}
+
+// Build creates a configured cache or
+// returns an error if invalid parameters were passed to the builder.
+func (b *ConstTTLBuilder[K, V]) Build() (Cache[K, V], error) {
+	if err := b.validate(); err != nil {
+		return Cache[K, V]{}, err
+	}
+
+	return newCache(b.toConfig(), &b.baseOptions)
+}
+
+// VariableTTLBuilder is a one-shot builder for creating a cache instance.
+type VariableTTLBuilder[K comparable, V any] struct {
+	variableTTLOptions[K, V]
+}
+
+// CollectStats determines whether statistics should be calculated when the cache is running.
+//
+// By default, statistics calculating is disabled.
+func (b *VariableTTLBuilder[K, V]) CollectStats() *VariableTTLBuilder[K, V] {
+	b.collectStats()
+	return b
+}
+
+// InitialCapacity sets the minimum total size for the internal data structures. Providing a large enough estimate
+// at construction time avoids the need for expensive resizing operations later, but setting this
+// value unnecessarily high wastes memory.
+func (b *VariableTTLBuilder[K, V]) InitialCapacity(initialCapacity int) *VariableTTLBuilder[K, V] {
+	b.setInitialCapacity(initialCapacity)
+	return b
+}
+
+// Cost sets a function to dynamically calculate the cost of an item.
+//
+// By default, this function always returns 1.
+func (b *VariableTTLBuilder[K, V]) Cost(costFunc func(key K, value V) uint32) *VariableTTLBuilder[K, V] {
+	b.setCostFunc(costFunc)
+	return b
+}
+
+// CostByLen makes the cost of an item equal to the length of its value, and if withKeys is true,
+// plus the length of its key. Empty items cost 1.
+//
+// It requires V to be a string or a []byte and K to be a string if the keys are counted.
+func (b *VariableTTLBuilder[K, V]) CostByLen(withKeys bool) *VariableTTLBuilder[K, V] {
+	b.setCostByLen(withKeys)
+	return b
+}
+
+// MaintenanceRate sets the maximum number of operations per second that the background maintenance
+// (applying writes to the eviction policy and removing expired items) may perform.
+// When the limit is reached, the maintenance goroutines are suspended, and the time spent waiting
+// is reported by Stats.ThrottledTime.
+//
+// NOTE: if the maintenance can't keep up with the writes, then the write buffer fills up and writes are blocked
+// until there is free space in it.
+//
+// By default, the maintenance is not limited.
+func (b *VariableTTLBuilder[K, V]) MaintenanceRate(opsPerSecond int) *VariableTTLBuilder[K, V] {
+	b.setMaintenanceRate(opsPerSecond)
+	return b
+}
+
+// StableRange makes Range iterate over items in the order in which they were last written,
+// so the iteration order doesn't change between runs with the same sequence of writes.
+// It is useful for debugging and golden-file tests of cache contents.
+//
+// NOTE: this option makes Range much slower, since all items must be collected and sorted before the iteration.
+//
+// By default, the iteration order is not specified.
+func (b *VariableTTLBuilder[K, V]) StableRange() *VariableTTLBuilder[K, V] {
+	b.enableStableRange()
+	return b
+}
+
+// CollectLatencies determines whether the latencies of Get, Set and Delete operations should be measured.
+// The measured latencies are available through Stats.
+//
+// NOTE: measuring requires reading the clock twice per operation, which noticeably slows down the cache.
+//
+// By default, latencies are not measured.
+func (b *VariableTTLBuilder[K, V]) CollectLatencies() *VariableTTLBuilder[K, V] {
+	b.collectLatencies()
+	return b
+}
+
+// Events enables the stream of changes of the cache contents (insertions, updates, deletions, evictions
+// and expirations) available through the Events method of the cache.
+// The capacity bounds the number of events that haven't been received yet, zero capacity disables events.
+//
+// By default, events are not emitted.
+func (b *VariableTTLBuilder[K, V]) Events(capacity int) *VariableTTLBuilder[K, V] {
+	b.setEventsCapacity(capacity)
+	return b
+}
+
+// ShardCount sets the number of shards used by the internal concurrent structures of the cache:
+// the striped size counters of the hash table and the read/write buffers.
+// The value is rounded up to the nearest power of two.
+//
+// It is useful inside CPU-limited containers, where GOMAXPROCS doesn't reflect the real parallelism,
+// and for workloads with extreme key skew.
+//
+// By default, the number of shards is detected automatically based on GOMAXPROCS.
+func (b *VariableTTLBuilder[K, V]) ShardCount(n int) *VariableTTLBuilder[K, V] {
+	b.setShardCount(n)
+	return b
+}
+
+// NodePooling enables reusing of internal entry nodes to reduce allocations.
+//
+// Only nodes that have never been visible to readers are reused, for example, when SetIfAbsent or GetOrSet
+// find an existing entry. Nodes of evicted and expired entries are left to the garbage collector,
+// since concurrent lock-free readers may still use them.
+//
+// By default, a new node is allocated for every write.
+func (b *VariableTTLBuilder[K, V]) NodePooling() *VariableTTLBuilder[K, V] {
+	b.enableNodePooling()
+	return b
+}
+
+// WriteBackpressure sets what writes do when the write buffer is full because the maintenance can't keep up:
+// wait for a free slot (BlockWrites, the default) or be rejected (RejectWrites).
+// Rejected writes return false just like the writes dropped because of their cost,
+// so use TrySet to tell a full write buffer apart: it returns ErrWriteBufferFull.
+func (b *VariableTTLBuilder[K, V]) WriteBackpressure(mode Backpressure) *VariableTTLBuilder[K, V] {
+	b.setBackpressure(mode)
+	return b
+}
+
+// SynchronousEviction makes writes update the eviction policy inline, in the calling goroutine,
+// instead of via the asynchronous write buffer. So the cache doesn't exceed its capacity
+// by more than the number of concurrently running writes.
+//
+// NOTE: writes become slower and contend with each other on the policy lock.
+//
+// By default, writes are applied to the eviction policy asynchronously.
+func (b *VariableTTLBuilder[K, V]) SynchronousEviction() *VariableTTLBuilder[K, V] {
+	b.enableSynchronousEviction()
+	return b
+}
+
+// Journal makes the cache write all user mutations (sets and deletes) with their timestamps and expiration times
+// to w, so the state of the cache can be restored by ReplayJournal after a restart
+// or replicated to other caches. Evictions and expirations are not written, since they are local decisions of every cache.
+//
+// Writes to w are serialized, but they are performed synchronously by writers, so w should be fast (e.g. buffered).
+// Failed writes are reported by Stats.DroppedEvents.
+//
+// By default, the journal is disabled.
+func (b *VariableTTLBuilder[K, V]) Journal(w io.Writer) *VariableTTLBuilder[K, V] {
+	b.setJournal(w)
+	return b
+}
+
+// IgnoreHasInStats makes Has calls not affect the hit and miss statistics,
+// so probes like health checks don't skew the hit ratio. Has still counts as an access for the eviction policy.
+//
+// By default, Has is recorded in the statistics as Get.
+func (b *VariableTTLBuilder[K, V]) IgnoreHasInStats() *VariableTTLBuilder[K, V] {
+	b.ignoreHasInStats()
+	return b
+}
+
+// DefaultTTL sets the ttl used by CacheWithVariableTTL.SetWithDefaultTTL and
+// CacheWithVariableTTL.SetIfAbsentWithDefaultTTL, so callers don't have to pass the ttl to every write.
+//
+// By default, items written without a ttl never expire.
+func (b *VariableTTLBuilder[K, V]) DefaultTTL(ttl time.Duration) *VariableTTLBuilder[K, V] {
+	b.setDefaultTTL(ttl)
+	return b
+}
+
+// MinTTL sets the lower bound of the ttl passed to the writes, so shorter ttls are raised to it.
+//
+// By default, the ttl isn't bounded.
+func (b *VariableTTLBuilder[K, V]) MinTTL(ttl time.Duration) *VariableTTLBuilder[K, V] {
+	b.minTTL = ttl
+	return b
+}
+
+// MaxTTL sets the upper bound of the ttl passed to the writes, so longer ttls are lowered to it.
+//
+// By default, the ttl isn't bounded.
+func (b *VariableTTLBuilder[K, V]) MaxTTL(ttl time.Duration) *VariableTTLBuilder[K, V] {
+	b.maxTTL = ttl
+	return b
+}
+
+// TimerWheel makes the cache expire items with a hierarchical timer wheel, which adds, removes and expires
+// items in amortized O(1) time without periodically scanning them. It is recommended for millions of items
+// with diverse ttls, at the cost of two extra pointers per item.
+//
+// By default, the cache uses a hybrid of coarse buckets and random sampling of items.
+func (b *VariableTTLBuilder[K, V]) TimerWheel() *VariableTTLBuilder[K, V] {
+	b.timerWheel = true
+	return b
+}
+
+// ExpireAfterAccess specifies that each item should be automatically removed from the cache once a fixed duration
+// has elapsed after the item's creation or the most recent read. It is combined with the ttl of the item,
+// so the item expires when either of the deadlines passes. For example, sessions can have
+// a hard max lifetime set by the ttl plus an idle timeout set by this option.
+//
+// Items expired because of inactivity are removed lazily: on access or by the periodic probing of the cleanup,
+// but no later than their ttl.
+func (b *VariableTTLBuilder[K, V]) ExpireAfterAccess(ttl time.Duration) *VariableTTLBuilder[K, V] {
+	b.setExpireAfterAccess(ttl)
+	return b
+}
+
+// AllowStale specifies that expired items should be kept in the cache for the given duration,
+// so a LoadingCache can serve them while a background reload is in flight.
+// Regular reads still treat such items as missing.
+func (b *VariableTTLBuilder[K, V]) AllowStale(d time.Duration) *VariableTTLBuilder[K, V] {
+	b.setAllowStale(d)
+	return b
+}
+
+// CollectEntryStats enables tracking of the number of hits and the time of the last access for each entry.
+// The statistics are exposed via GetEntry and Hottest.
+// Together with CollectStats, they also feed Stats.Lifetime and Stats.LastHitAge.
+func (b *VariableTTLBuilder[K, V]) CollectEntryStats() *VariableTTLBuilder[K, V] {
+	b.collectEntryStats()
+	return b
+}
+
+// TrackTopKeys enables tracking of the approximately hottest keys with a fixed number of counters.
+// The keys are exposed via TopKeys. Keys outside of the top capacity are not reported reliably.
+func (b *VariableTTLBuilder[K, V]) TrackTopKeys(capacity int) *VariableTTLBuilder[K, V] {
+	b.trackTopKeys(capacity)
+	return b
+}
+
+// Doorkeeper enables a bloom filter in front of the eviction policy that rejects keys written for the first time
+// while the cache is full, so one-hit wonders don't pollute the cache. A rejected item is evicted right after
+// the write, and the next write of the same key is admitted.
+//
+// It improves the hit ratio of workloads with many keys accessed only once, like CDN traces.
+func (b *VariableTTLBuilder[K, V]) Doorkeeper() *VariableTTLBuilder[K, V] {
+	b.enableDoorkeeper()
+	return b
+}
+
+// Admission sets the admission policy consulted for new keys when the cache is full.
+// If it rejects a key, the item is evicted right after the write.
+func (b *VariableTTLBuilder[K, V]) Admission(admission Admission[K]) *VariableTTLBuilder[K, V] {
+	b.setAdmission(admission)
+	return b
+}
+
+// SmallQueueRatio sets the share of the S3-FIFO small queue in percent of the capacity. The default is 10%.
+//
+// A larger small queue favors recency, so it may suit workloads where new items are re-read soon after the write.
+func (b *VariableTTLBuilder[K, V]) SmallQueueRatio(percent int) *VariableTTLBuilder[K, V] {
+	b.setSmallQueueRatio(percent)
+	return b
+}
+
+// GhostQueueFactor sets the max length of the S3-FIFO ghost queue relative to the number of items in the cache.
+// The default is 1.
+func (b *VariableTTLBuilder[K, V]) GhostQueueFactor(factor float64) *VariableTTLBuilder[K, V] {
+	b.setGhostQueueFactor(factor)
+	return b
+}
+
+// CostAwareEviction makes the eviction policy factor the cost of each item and the expense of fetching it again
+// into eviction decisions, similar to GreedyDual-Size. Among several candidates for eviction,
+// the item with the lowest fetch cost per unit of its cost is evicted first,
+// so cheap to recompute large items are evicted before expensive small ones.
+func (b *VariableTTLBuilder[K, V]) CostAwareEviction(fetchCost func(key K, value V) uint32) *VariableTTLBuilder[K, V] {
+	b.setFetchCostFunc(fetchCost)
+	return b
+}
+
+// EvictSoonestExpiringFirst makes the eviction policy prefer, among several candidates for eviction,
+// the items which are going to expire soon anyway. It reduces the amount of useful data destroyed
+// when the capacity pressure and the expiration interact. It can be combined with CostAwareEviction.
+func (b *VariableTTLBuilder[K, V]) EvictSoonestExpiringFirst() *VariableTTLBuilder[K, V] {
+	b.evictSoonestExpiringFirst()
+	return b
+}
+
+// DoorkeeperResetInterval sets the number of distinct keys after which the doorkeeper forgets all seen keys.
+// The default is the capacity of the cache.
+//
+// A shorter interval makes the doorkeeper adapt faster to shifts of the workload, for example daily periodicity,
+// at the cost of rejecting more keys. It can only be used with Doorkeeper.
+func (b *VariableTTLBuilder[K, V]) DoorkeeperResetInterval(keys int) *VariableTTLBuilder[K, V] {
+	b.setDoorkeeperResetInterval(keys)
+	return b
+}
+
+// SharedAdmission sets the admission policy shared with other caches.
+// It is the same as Admission, but makes the sharing explicit.
+func (b *VariableTTLBuilder[K, V]) SharedAdmission(admission *SharedAdmission[K]) *VariableTTLBuilder[K, V] {
+	// avoid a non-nil interface holding a nil pointer.
+	var a Admission[K]
+	if admission != nil {
+		a = admission
+	}
+	b.setAdmission(a)
+	return b
+}
+
+// WAL makes the cache persist all user mutations to a write-ahead log in dir and compact it into a snapshot
+// every compactionInterval, so the cache is restored by Build after a restart without a full dump on shutdown.
+//
+// The compaction writes the snapshot in the background while the writers append to a new log segment.
+// Writes to the log are buffered and flushed every second and on Close, so the last second of mutations
+// may be lost on a crash. Like ReplayJournal, the restore skips expired items. It can't be used with Journal.
+//
+// By default, the write-ahead log is disabled.
+func (b *VariableTTLBuilder[K, V]) WAL(dir string, compactionInterval time.Duration) *VariableTTLBuilder[K, V] {
+	b.setWAL(dir, compactionInterval)
+	return b
+}
+
+// MaxEntryCost sets the max cost of a single item regardless of the capacity of the cache.
+// Items with a larger cost are rejected by writes and counted by Stats.RejectedSets,
+// so a single accidentally huge value can't evict the whole cache.
+//
+// By default, an item is rejected only if its cost exceeds the capacity available to the eviction policy.
+func (b *VariableTTLBuilder[K, V]) MaxEntryCost(c uint32) *VariableTTLBuilder[K, V] {
+	b.setMaxEntryCost(c)
+	return b
+}
+
+// Versioned makes the cache assign a monotonically increasing version to the item on every write.
+// The version is returned by Entry.Version and enables optimistic concurrency with SetIfVersion.
+//
+// By default, items have no versions.
+func (b *VariableTTLBuilder[K, V]) Versioned() *VariableTTLBuilder[K, V] {
+	b.enableVersions()
+	return b
+}
+
+// PreciseExpiration makes the cache remove expired items and emit their EventExpire within a couple
+// of seconds of the expiration time, rather than whenever they are next read or found by the background scan.
+// New items reach the expiration policy as soon as the write buffer is drained instead of in batches,
+// and the policy is the hierarchical timer wheel. It is useful when work is scheduled off the expiration events.
+//
+// NOTE: it applies to the write ttl only, items expired by ExpireAfterAccess are still removed lazily.
+//
+// By default, expired items may stay in the cache until they are read or the background scan finds them.
+func (b *VariableTTLBuilder[K, V]) PreciseExpiration() *VariableTTLBuilder[K, V] {
+	b.enablePreciseExpiration()
+	return b
+}
+
+// ExpirationStrategy sets when expired items are removed from the cache: on access, in the background or both.
+// The lazy strategy suits latency-sensitive deployments, the proactive one suits memory-tight ones.
+//
+// NOTE: the background expiration is driven by the write ttl, so with the proactive strategy
+// items expired by ExpireAfterAccess may stay until their write ttl passes or they are evicted.
+//
+// By default, expired items are removed both on access and in the background.
+func (b *VariableTTLBuilder[K, V]) ExpirationStrategy(strategy ExpirationStrategy) *VariableTTLBuilder[K, V] {
+	b.setExpirationStrategy(strategy)
+	return b
+}
+
+// MemoryPressure makes the cache check the given func every second and halve its capacity on every check
+// while it reports that the process is short of memory, down to 1/16 of the capacity, evicting the items which don't fit.
+// Once the pressure has been gone for five checks in a row, the capacity is doubled back on every check until it is restored.
+// SoftMemoryLimitPressure reports the pressure relative to the Go soft memory limit.
+//
+// By default, the capacity of the cache never changes.
+func (b *VariableTTLBuilder[K, V]) MemoryPressure(pressured func() bool) *VariableTTLBuilder[K, V] {
+	b.setMemoryPressure(pressured)
+	return b
+}
+
+// ReadBuffers sets the number of the striped lossy buffers recording reads for the eviction policy
+// and the capacity of each buffer, both are rounded up to a power of two.
+// Larger buffers drop fewer reads under heavy contention, see Stats.ReadBufferDrops, at the cost of memory.
+//
+// By default, there are 4 buffers per available CPU with 16 slots each.
+func (b *VariableTTLBuilder[K, V]) ReadBuffers(count, capacity int) *VariableTTLBuilder[K, V] {
+	b.setReadBuffers(count, capacity)
+	return b
+}
+
+// ScaleReadBuffers makes the cache check the drop rate of the read buffers every second, doubling their number
+// while they drop more than 5% of reads and halving it after 10 seconds without drops.
+// The number stays within the given bounds, which are rounded up to a power of two.
+//
+// By default, the number of the read buffers is fixed, see ReadBuffers.
+func (b *VariableTTLBuilder[K, V]) ScaleReadBuffers(minCount, maxCount int) *VariableTTLBuilder[K, V] {
+	b.setReadBuffersScaling(minCount, maxCount)
+	return b
+}
+
+// AmortizedMaintenance makes the cache run without background goroutines, so it can be used
+// where they are forbidden. The writes are applied to the eviction policy by the calling goroutines,
+// which also remove the expired items at most once a second, and the clock is read lazily.
+//
+// It can't be used with the options requiring background goroutines: MemoryPressure, ScaleReadBuffers and WAL.
+// It is always enabled on WebAssembly (GOOS=js or wasip1).
+func (b *VariableTTLBuilder[K, V]) AmortizedMaintenance() *VariableTTLBuilder[K, V] {
+	b.enableAmortizedMaintenance()
+	return b
+}
+
+// ParallelGetThreshold sets the number of keys from which GetAll and GetEntries look them up
+// in parallel on up to the available number of CPUs. Smaller batches are looked up by the calling goroutine.
+//
+// By default, the batches are never looked up in parallel.
+func (b *VariableTTLBuilder[K, V]) ParallelGetThreshold(threshold int) *VariableTTLBuilder[K, V] {
+	b.setParallelGetThreshold(threshold)
+	return b
+}
+
+// EvictionWatermarks makes the cache start the eviction when the total cost exceeds highPercent of the capacity
+// and evict the items in a batch until it drops to lowPercent of the capacity, so bursty writers don't pay
+// for an eviction on every write once the cache is full. By default, both watermarks are 100%.
+func (b *VariableTTLBuilder[K, V]) EvictionWatermarks(lowPercent, highPercent int) *VariableTTLBuilder[K, V] {
+	b.setWatermarks(lowPercent, highPercent)
+	return b
+}
+
+// EvictionBatchSize limits the number of items evicted per maintenance cycle, so a write of a huge item
+// doesn't stall the maintenance with a long chain of evictions. The items which don't fit after that
+// are evicted by the following cycles, hence the cache can temporarily exceed its capacity.
+//
+// By default, the number of evictions per cycle isn't limited.
+func (b *VariableTTLBuilder[K, V]) EvictionBatchSize(size int) *VariableTTLBuilder[K, V] {
+	b.setEvictionBatchSize(size)
+	return b
+}
+
+// HashTableTuning sets the load factor, the fraction of the hash table slots which can be occupied
+// before the table grows, and the factor by which it grows, rounded up to a power of two.
+// A lower load factor trades memory for shorter bucket chains, and a higher growth factor means fewer rehashes.
+// The table is presized by InitialCapacity to hold that many items under the load factor without rehashing.
+//
+// By default, the load factor is 0.75 and the growth factor is 2.
+func (b *VariableTTLBuilder[K, V]) HashTableTuning(loadFactor float64, growthFactor int) *VariableTTLBuilder[K, V] {
+	b.setHashTableTuning(loadFactor, growthFactor)
+	return b
+}
+
+// Clone returns a copy of the builder, so the copy can be changed and built independently of the original.
+//
+// The builder isn't safe for concurrent use, so a shared base configuration should be cloned
+// before it is customized in different places.
+func (b *VariableTTLBuilder[K, V]) Clone() *VariableTTLBuilder[K, V] {
+	clone := *b
+	return &clone
+}
+
+// Validate performs all the checks of Build without creating the cache,
+// so the configuration can be checked before memory is committed.
+//
+// The write-ahead log directory specified by WAL is opened only by Build, so its errors aren't reported.
+func (b *VariableTTLBuilder[K, V]) Validate() error {
+	return b.validate()
+}
+
 // Build creates a configured cache or
 // returns an error if invalid parameters were passed to the builder.
 func (b *VariableTTLBuilder[K, V]) Build() (CacheWithVariableTTL[K, V], error) {
@@ -274,5 +1963,5 @@ func (b *VariableTTLBuilder[K, V]) Build() (CacheWithVariableTTL[K, V], error) {
 		return CacheWithVariableTTL[K, V]{}, err
 	}
 
-	return newCacheWithVariableTTL(b.toConfig()), nil
+	return newCacheWithVariableTTL(b.toConfig(), &b.baseOptions)
 }
@@ -0,0 +1,66 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+
+package otter
+
+import "log/slog"
+
+// WithLogger sets the logger for notable internal events,
+// such as the write buffer saturation, rejected oversize items or the wall clock going backwards.
+//
+// Warnings of the same kind are rate limited, so a misbehaving cache does not flood the log.
+func (b *Builder[K, V]) WithLogger(logger *slog.Logger) *Builder[K, V] {
+	b.setSlogLogger(logger)
+	return b
+}
+
+// WithLogger sets the logger for notable internal events,
+// such as the write buffer saturation, rejected oversize items or the wall clock going backwards.
+//
+// Warnings of the same kind are rate limited, so a misbehaving cache does not flood the log.
+func (b *ConstTTLBuilder[K, V]) WithLogger(logger *slog.Logger) *ConstTTLBuilder[K, V] {
+	b.setSlogLogger(logger)
+	return b
+}
+
+// WithLogger sets the logger for notable internal events,
+// such as the write buffer saturation, rejected oversize items or the wall clock going backwards.
+//
+// Warnings of the same kind are rate limited, so a misbehaving cache does not flood the log.
+func (b *VariableTTLBuilder[K, V]) WithLogger(logger *slog.Logger) *VariableTTLBuilder[K, V] {
+	b.setSlogLogger(logger)
+	return b
+}
+
+func (o *baseOptions[K, V]) setSlogLogger(logger *slog.Logger) {
+	// avoid storing a typed nil in the interface.
+	if logger == nil {
+		o.setLogger(nil)
+		return
+	}
+	o.setLogger(logger)
+}
+
+// WithLogger is the functional equivalent of Builder.WithLogger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		// avoid storing a typed nil in the interface.
+		o.logger = nil
+		if logger != nil {
+			o.logger = logger
+		}
+	}
+}
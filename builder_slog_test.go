@@ -0,0 +1,56 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+
+package otter
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestBuilder_WithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	c, err := MustBuilder[int, int](10).
+		Cost(func(key int, value int) uint32 {
+			return uint32(value)
+		}).
+		WithLogger(slog.New(slog.NewTextHandler(&buf, nil))).
+		Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		if c.Set(i, 100) {
+			t.Fatal("oversize item should be rejected")
+		}
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "level=WARN") || !strings.Contains(out, "cost=100") {
+		t.Fatalf("oversize item should be logged, but got %q", out)
+	}
+	if n := strings.Count(out, "\n"); n != 1 {
+		t.Fatalf("warnings should be rate limited, but got %d lines", n)
+	}
+
+	if _, err := MustBuilder[int, int](10).WithLogger(nil).Build(); err != nil {
+		t.Fatalf("nil logger should disable logging, but got %v", err)
+	}
+}
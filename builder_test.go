@@ -66,6 +66,126 @@ func TestBuilder_NewFailed(t *testing.T) {
 	if err == nil || !errors.Is(err, ErrNilCostFunc) {
 		t.Fatalf("should fail with an error %v, but got %v", ErrNilCostFunc, err)
 	}
+
+	// non-positive read buffers
+	_, err = MustBuilder[int, int](capacity).ReadBuffers(0, 16).Build()
+	if err == nil || !errors.Is(err, ErrIllegalReadBuffers) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalReadBuffers, err)
+	}
+
+	// illegal read buffers scaling bounds
+	_, err = MustBuilder[int, int](capacity).ScaleReadBuffers(8, 4).Build()
+	if err == nil || !errors.Is(err, ErrIllegalReadBuffersScaling) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalReadBuffersScaling, err)
+	}
+
+	// amortized maintenance with background options
+	_, err = MustBuilder[int, int](capacity).AmortizedMaintenance().ScaleReadBuffers(1, 4).Build()
+	if err == nil || !errors.Is(err, ErrIllegalAmortizedMaintenance) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalAmortizedMaintenance, err)
+	}
+
+	// non-positive parallel get threshold
+	_, err = MustBuilder[int, int](capacity).ParallelGetThreshold(0).Build()
+	if err == nil || !errors.Is(err, ErrIllegalParallelGetThreshold) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalParallelGetThreshold, err)
+	}
+
+	// low watermark above the high one
+	_, err = MustBuilder[int, int](capacity).EvictionWatermarks(90, 80).Build()
+	if err == nil || !errors.Is(err, ErrIllegalWatermarks) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalWatermarks, err)
+	}
+
+	// non-positive eviction batch size
+	_, err = MustBuilder[int, int](capacity).EvictionBatchSize(0).Build()
+	if err == nil || !errors.Is(err, ErrIllegalEvictionBatchSize) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalEvictionBatchSize, err)
+	}
+
+	// load factor out of (0, 1]
+	_, err = MustBuilder[int, int](capacity).HashTableTuning(1.5, 2).Build()
+	if err == nil || !errors.Is(err, ErrIllegalHashTableTuning) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalHashTableTuning, err)
+	}
+
+	// growth factor less than 2
+	_, err = MustBuilder[int, int](capacity).HashTableTuning(0.5, 1).Build()
+	if err == nil || !errors.Is(err, ErrIllegalHashTableTuning) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalHashTableTuning, err)
+	}
+
+	// cost by length of values other than strings
+	_, err = MustBuilder[int, int](capacity).CostByLen(false).Build()
+	if err == nil || !errors.Is(err, ErrIllegalCostByLen) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalCostByLen, err)
+	}
+
+	// cost by length of keys other than strings
+	_, err = MustBuilder[int, string](capacity).CostByLen(true).Build()
+	if err == nil || !errors.Is(err, ErrIllegalCostByLen) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalCostByLen, err)
+	}
+
+	// min ttl above the max one
+	_, err = MustBuilder[int, int](capacity).WithVariableTTL().MinTTL(time.Hour).MaxTTL(time.Minute).Build()
+	if err == nil || !errors.Is(err, ErrIllegalTTLBounds) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalTTLBounds, err)
+	}
+
+	// nil memory pressure func
+	_, err = MustBuilder[int, int](capacity).MemoryPressure(nil).Build()
+	if err == nil || !errors.Is(err, ErrNilMemoryPressure) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrNilMemoryPressure, err)
+	}
+
+	// negative maintenance rate
+	_, err = MustBuilder[int, int](capacity).WithTTL(time.Hour).MaintenanceRate(-1).Build()
+	if err == nil || !errors.Is(err, ErrIllegalMaintenanceRate) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalMaintenanceRate, err)
+	}
+
+	// non-positive shard count
+	_, err = MustBuilder[int, int](capacity).WithVariableTTL().ShardCount(0).Build()
+	if err == nil || !errors.Is(err, ErrIllegalShardCount) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalShardCount, err)
+	}
+
+	// unknown backpressure mode
+	_, err = MustBuilder[int, int](capacity).WriteBackpressure(RejectWrites + 1).Build()
+	if err == nil || !errors.Is(err, ErrIllegalBackpressure) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalBackpressure, err)
+	}
+
+	// illegal small queue ratio
+	_, err = MustBuilder[int, int](capacity).SmallQueueRatio(100).Build()
+	if err == nil || !errors.Is(err, ErrIllegalSmallQueueRatio) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalSmallQueueRatio, err)
+	}
+
+	// illegal ghost queue factor
+	_, err = MustBuilder[int, int](capacity).WithTTL(time.Hour).GhostQueueFactor(0).Build()
+	if err == nil || !errors.Is(err, ErrIllegalGhostQueueFactor) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalGhostQueueFactor, err)
+	}
+
+	// nil fetch cost func
+	_, err = MustBuilder[int, int](capacity).CostAwareEviction(nil).Build()
+	if err == nil || !errors.Is(err, ErrNilFetchCostFunc) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrNilFetchCostFunc, err)
+	}
+
+	// zero max entry cost
+	_, err = MustBuilder[int, int](capacity).WithTTL(time.Hour).MaxEntryCost(0).Build()
+	if err == nil || !errors.Is(err, ErrIllegalMaxEntryCost) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalMaxEntryCost, err)
+	}
+
+	// doorkeeper reset interval without the doorkeeper
+	_, err = MustBuilder[int, int](capacity).DoorkeeperResetInterval(10).Build()
+	if err == nil || !errors.Is(err, ErrIllegalDoorkeeperResetInterval) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalDoorkeeperResetInterval, err)
+	}
 }
 
 func TestBuilder_BuildSuccess(t *testing.T) {
@@ -112,3 +232,70 @@ func TestBuilder_BuildSuccess(t *testing.T) {
 		t.Fatalf("builder returned a different type of cache: %v", err)
 	}
 }
+
+func TestBuilder_Clone(t *testing.T) {
+	b := MustBuilder[int, int](100)
+	clone := b.Clone().Cost(func(key int, value int) uint32 {
+		return 10
+	})
+
+	c, err := b.Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	cc, err := clone.Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer cc.Close()
+
+	c.Set(1, 1)
+	cc.Set(1, 1)
+	if e, ok := c.GetEntry(1); !ok || e.Cost() != 1 {
+		t.Fatalf("changes of the clone shouldn't affect the original builder, but got cost %d %v", e.Cost(), ok)
+	}
+	if e, ok := cc.GetEntry(1); !ok || e.Cost() != 10 {
+		t.Fatalf("cost of the clone should be 10, but got %d %v", e.Cost(), ok)
+	}
+
+	vb := MustBuilder[int, int](100).WithVariableTTL()
+	if vb.Clone().DefaultTTL(time.Hour); vb.withDefaultTTL {
+		t.Fatal("changes of the clone shouldn't affect the original variable ttl builder")
+	}
+}
+
+func TestBuilder_Validate(t *testing.T) {
+	if err := MustBuilder[int, int](100).Cost(nil).Validate(); !errors.Is(err, ErrNilCostFunc) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrNilCostFunc, err)
+	}
+	if err := MustBuilder[int, int](100).WithTTL(0).Validate(); !errors.Is(err, ErrIllegalTTL) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalTTL, err)
+	}
+	if err := MustBuilder[int, int](100).WithVariableTTL().MinTTL(time.Hour).MaxTTL(time.Minute).Validate(); !errors.Is(err, ErrIllegalTTLBounds) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalTTLBounds, err)
+	}
+	if err := MustBuilder[int, int](100).WithTTL(time.Hour).Validate(); err != nil {
+		t.Fatalf("valid configuration shouldn't fail, but got %v", err)
+	}
+}
+
+func TestBuilder_ConfigError(t *testing.T) {
+	_, err := MustBuilder[int, int](100).MaxEntryCost(0).Build()
+	var cfgErr *ConfigError
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("should fail with a config error, but got %v", err)
+	}
+	if cfgErr.Field != "MaxEntryCost" || cfgErr.Value != uint32(0) || !errors.Is(err, ErrIllegalMaxEntryCost) {
+		t.Fatalf("unexpected config error %+v", cfgErr)
+	}
+	if want := "invalid MaxEntryCost(0): " + ErrIllegalMaxEntryCost.Error(); err.Error() != want {
+		t.Fatalf("err.Error() = %q, want %q", err.Error(), want)
+	}
+
+	_, err = NewBuilder[int, int](-1)
+	if !errors.As(err, &cfgErr) || cfgErr.Field != "NewBuilder" || cfgErr.Value != -1 {
+		t.Fatalf("should fail with a config error of the capacity, but got %v", err)
+	}
+}
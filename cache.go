@@ -15,19 +15,74 @@
 package otter
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/maypok86/otter/internal/core"
+	"github.com/maypok86/otter/internal/node"
 	"github.com/maypok86/otter/internal/stats"
 )
 
 // Stats is a thread-safe statistics collector.
 type Stats struct {
-	s *stats.Stats
+	s       *stats.Stats
+	l       *stats.Latencies
+	expired func() (count int, cost uint64)
+	size    func() int
 }
 
-func newStats(s *stats.Stats) Stats {
-	return Stats{s: s}
+func newStats(s *stats.Stats, l *stats.Latencies, expired func() (int, uint64), size func() int) Stats {
+	return Stats{s: s, l: l, expired: expired, size: size}
+}
+
+// Latencies is a summary of the latency distribution of a cache operation.
+//
+// The quantiles are approximate, their relative error doesn't exceed 12.5%.
+type Latencies struct {
+	P50 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+}
+
+func (s Stats) latencies(op stats.Operation) Latencies {
+	return Latencies{
+		P50: s.l.Quantile(op, 0.5),
+		P95: s.l.Quantile(op, 0.95),
+		P99: s.l.Quantile(op, 0.99),
+	}
+}
+
+// GetLatencies returns the latency distribution of read operations (Get, GetEntry).
+//
+// If the cache was built without the CollectLatencies option, then all quantiles are 0.
+func (s Stats) GetLatencies() Latencies {
+	return s.latencies(stats.GetOperation)
+}
+
+// SetLatencies returns the latency distribution of write operations (Set, SetIfAbsent, SetWithMaxReads, SetIfVersion).
+//
+// If the cache was built without the CollectLatencies option, then all quantiles are 0.
+func (s Stats) SetLatencies() Latencies {
+	return s.latencies(stats.SetOperation)
+}
+
+// DeleteLatencies returns the latency distribution of Delete operations.
+//
+// If the cache was built without the CollectLatencies option, then all quantiles are 0.
+func (s Stats) DeleteLatencies() Latencies {
+	return s.latencies(stats.DeleteOperation)
+}
+
+// HasLatencies returns the latency distribution of Has operations.
+//
+// If the cache was built without the CollectLatencies option, then all quantiles are 0.
+func (s Stats) HasLatencies() Latencies {
+	return s.latencies(stats.HasOperation)
 }
 
 // Hits returns the number of cache hits.
@@ -40,94 +95,848 @@ func (s Stats) Misses() int64 {
 	return s.s.Misses()
 }
 
-// Ratio returns the cache hit ratio.
+// Ratio returns the cache hit ratio of all the read operations.
+//
+// Use RatioOf(ReadGet) for the hit ratio of the lookups of values alone.
 func (s Stats) Ratio() float64 {
 	return s.s.Ratio()
 }
 
+// ReadOperation is a kind of read whose hits and misses are counted separately,
+// so existence checks and loads don't skew the effectiveness of the lookups.
+//
+// Hits and Misses are the totals of all the operations.
+type ReadOperation uint8
+
+const (
+	// ReadGet covers the lookups of values: Get, GetEntry, GetAll, GetEntries and GetOrSet.
+	ReadGet ReadOperation = iota
+	// ReadHas covers Has, unless the cache is built with IgnoreHasInStats.
+	ReadHas
+	// ReadLoad covers the lookups of the LoadingCache.
+	ReadLoad
+)
+
+// HitsOf returns the number of hits of the read operation.
+func (s Stats) HitsOf(op ReadOperation) int64 {
+	return s.s.ReadHits(stats.ReadOperation(op))
+}
+
+// MissesOf returns the number of misses of the read operation.
+func (s Stats) MissesOf(op ReadOperation) int64 {
+	return s.s.ReadMisses(stats.ReadOperation(op))
+}
+
+// RatioOf returns the hit ratio of the read operation.
+func (s Stats) RatioOf(op ReadOperation) float64 {
+	hits := s.HitsOf(op)
+	misses := s.MissesOf(op)
+	if hits == 0 && misses == 0 {
+		return 0.0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// RejectedAdmissions returns the number of new items rejected by the doorkeeper or the admission policy
+// when the cache was full.
+//
+// Many rejections compared to EvictingAdmissions mean that the admission is too strict,
+// while many evicting admissions with a low hit ratio mean that the cache is too small.
+func (s Stats) RejectedAdmissions() int64 {
+	return s.s.RejectedAdmissions()
+}
+
+// EvictingAdmissions returns the number of new items admitted at the cost of evicting other items.
+func (s Stats) EvictingAdmissions() int64 {
+	return s.s.EvictingAdmissions()
+}
+
+// Uptime returns the time elapsed since the creation of the cache.
+func (s Stats) Uptime() time.Duration {
+	return s.s.Uptime()
+}
+
+// RequestRate returns the average number of hits and misses per second since the creation of the cache
+// or the last Clear.
+func (s Stats) RequestRate() float64 {
+	return s.s.RequestRate()
+}
+
+// HitRate1m returns the one-minute exponentially weighted moving average of the number of hits per second.
+//
+// The rolling rates are updated when they are read, so they are the most accurate when read regularly,
+// e.g. by a metrics exporter.
+func (s Stats) HitRate1m() float64 {
+	return s.s.HitRates()[0]
+}
+
+// HitRate5m returns the five-minute exponentially weighted moving average of the number of hits per second.
+func (s Stats) HitRate5m() float64 {
+	return s.s.HitRates()[1]
+}
+
+// HitRate15m returns the fifteen-minute exponentially weighted moving average of the number of hits per second.
+func (s Stats) HitRate15m() float64 {
+	return s.s.HitRates()[2]
+}
+
+// Lifetime returns the approximate q-quantile of how long the evicted and expired items lived in the cache.
+// The lifetimes much shorter than the ttl mean that the capacity is too small.
+//
+// The lifetimes are measured in seconds and collected only if the cache was built with both
+// CollectStats and CollectEntryStats, otherwise Lifetime returns 0.
+func (s Stats) Lifetime(q float64) time.Duration {
+	return s.s.LifetimeQuantile(q)
+}
+
+// LastHitAge returns the approximate q-quantile of how old the evicted and expired items were at their last hit.
+// The ages much shorter than the ttl mean that the ttl is too long.
+//
+// Items that were never hit aren't counted. It has the same requirements as Lifetime.
+func (s Stats) LastHitAge(q float64) time.Duration {
+	return s.s.HitAgeQuantile(q)
+}
+
+// Evictions returns the number of items evicted by the eviction policy.
+// Expired items removed by the policy aren't counted.
+func (s Stats) Evictions() int64 {
+	return s.s.Evictions()
+}
+
+// Size returns the number of items in the cache without waiting for the pending writes,
+// like EstimatedSize of the cache. It is available even without CollectStats.
+func (s Stats) Size() int {
+	if s.size == nil {
+		return 0
+	}
+	return s.size()
+}
+
+// ReadBufferDrops returns the number of read records dropped by the read buffers due to contention.
+//
+// A large number of dropped records means that the eviction policy receives less information about reads.
+func (s Stats) ReadBufferDrops() int64 {
+	return s.s.ReadBufferDrops()
+}
+
+// WriteBufferContentions returns the number of writes that had to wait for a free slot in the write buffer.
+func (s Stats) WriteBufferContentions() int64 {
+	return s.s.WriteBufferContentions()
+}
+
+// RejectedSets returns the number of items rejected because their cost exceeded the Builder.MaxEntryCost
+// or the capacity of the cache.
+func (s Stats) RejectedSets() int64 {
+	return s.s.RejectedSets()
+}
+
+// DroppedEvents returns the number of events dropped because the channel returned by Events was full
+// or the write to the journal failed.
+func (s Stats) DroppedEvents() int64 {
+	return s.s.DroppedEvents()
+}
+
+// ExpiredResident returns the number and the total cost of items that are past their expiration time
+// but haven't been removed from the cache yet. Such items count towards Size, but never produce hits.
+//
+// Unlike the other statistics, it is computed on each call by iterating over all items,
+// so it is collected even without CollectStats and should not be called on hot paths.
+func (s Stats) ExpiredResident() (count int, cost uint64) {
+	if s.expired == nil {
+		return 0, 0
+	}
+	return s.expired()
+}
+
+// ThrottledTime returns the total time for which the background maintenance was suspended
+// because of the Builder.MaintenanceRate limit.
+func (s Stats) ThrottledTime() time.Duration {
+	return s.s.ThrottledTime()
+}
+
+type statsJSON struct {
+	Hits                   int64   `json:"hits"`
+	Misses                 int64   `json:"misses"`
+	Ratio                  float64 `json:"ratio"`
+	Evictions              int64   `json:"evictions"`
+	Size                   int     `json:"size"`
+	RejectedSets           int64   `json:"rejected_sets"`
+	RejectedAdmissions     int64   `json:"rejected_admissions"`
+	EvictingAdmissions     int64   `json:"evicting_admissions"`
+	DroppedEvents          int64   `json:"dropped_events"`
+	ReadBufferDrops        int64   `json:"read_buffer_drops"`
+	WriteBufferContentions int64   `json:"write_buffer_contentions"`
+	ThrottledTime          string  `json:"throttled_time"`
+	Uptime                 string  `json:"uptime"`
+	RequestRate            float64 `json:"request_rate"`
+	HitRate1m              float64 `json:"hit_rate_1m"`
+	HitRate5m              float64 `json:"hit_rate_5m"`
+	HitRate15m             float64 `json:"hit_rate_15m"`
+}
+
+// MarshalJSON implements the json.Marshaler interface, so the statistics can be logged or served as is.
+//
+// ExpiredResident and the latencies aren't included, since they are expensive or optional.
+func (s Stats) MarshalJSON() ([]byte, error) {
+	hitRates := s.s.HitRates()
+	return json.Marshal(statsJSON{
+		Hits:                   s.Hits(),
+		Misses:                 s.Misses(),
+		Ratio:                  s.Ratio(),
+		Evictions:              s.Evictions(),
+		Size:                   s.Size(),
+		RejectedSets:           s.RejectedSets(),
+		RejectedAdmissions:     s.RejectedAdmissions(),
+		EvictingAdmissions:     s.EvictingAdmissions(),
+		DroppedEvents:          s.DroppedEvents(),
+		ReadBufferDrops:        s.ReadBufferDrops(),
+		WriteBufferContentions: s.WriteBufferContentions(),
+		ThrottledTime:          s.ThrottledTime().String(),
+		Uptime:                 s.Uptime().String(),
+		RequestRate:            s.RequestRate(),
+		HitRate1m:              hitRates[0],
+		HitRate5m:              hitRates[1],
+		HitRate15m:             hitRates[2],
+	})
+}
+
+// String returns a short human-readable summary of the statistics.
+func (s Stats) String() string {
+	return fmt.Sprintf("hits=%d misses=%d ratio=%.4f evictions=%d size=%d",
+		s.Hits(), s.Misses(), s.Ratio(), s.Evictions(), s.Size())
+}
+
 type baseCache[K comparable, V any] struct {
-	cache *core.Cache[K, V]
+	cache   *core.Cache[K, V]
+	events  *eventStream[K, V]
+	journal *journal[K, V]
+	wal     *wal[K, V]
 }
 
-func newBaseCache[K comparable, V any](c core.Config[K, V]) baseCache[K, V] {
-	return baseCache[K, V]{
-		cache: core.NewCache(c),
+// ErrWriteBufferFull means that the write has been rejected because the write buffer is full.
+var ErrWriteBufferFull = errors.New("write buffer is full")
+
+// ErrUninitialized is the panic value of the methods called on the zero value of a cache,
+// which means that the cache hasn't been created by a builder.
+var ErrUninitialized = errors.New("cache is not initialized, it must be created by a builder")
+
+// core returns the underlying cache and panics with ErrUninitialized if the cache is the zero value.
+func (bs baseCache[K, V]) core() *core.Cache[K, V] {
+	if bs.cache == nil {
+		panic(ErrUninitialized)
 	}
+	return bs.cache
+}
+
+func newBaseCache[K comparable, V any](c core.Config[K, V], o *baseOptions[K, V]) (baseCache[K, V], error) {
+	var events *eventStream[K, V]
+	if o.eventsCapacity > 0 {
+		events = newEventStream[K, V](o.eventsCapacity)
+		c.EventHandler = events.emit
+	}
+	var (
+		j *journal[K, V]
+		w *wal[K, V]
+	)
+	if o.journal != nil {
+		j = newJournal[K, V](o.journal)
+	}
+	if o.walDir != "" {
+		w = newWAL[K, V](o.walDir, o.walInterval, o.logger)
+		j = w.journal
+	}
+	if j != nil {
+		c.Sequenced = true
+		if events == nil {
+			c.EventHandler = j.emit
+		} else {
+			c.EventHandler = func(kind core.EventKind, n *node.Node[K, V]) bool {
+				ok := j.emit(kind, n)
+				return events.emit(kind, n) && ok
+			}
+		}
+	}
+
+	bs := baseCache[K, V]{
+		cache:   core.NewCache(c),
+		events:  events,
+		journal: j,
+	}
+	if w != nil {
+		if err := w.open(bs); err != nil {
+			bs.Close()
+			return baseCache[K, V]{}, err
+		}
+		bs.wal = w
+	}
+	return bs, nil
 }
 
 // Has checks if there is an item with the given key in the cache.
 func (bs baseCache[K, V]) Has(key K) bool {
-	return bs.cache.Has(key)
+	return bs.core().Has(key)
 }
 
 // Get returns the value associated with the key in this cache.
 func (bs baseCache[K, V]) Get(key K) (V, bool) {
-	return bs.cache.Get(key)
+	return bs.core().Get(key)
+}
+
+// GetEntry returns the entry associated with the key in this cache.
+func (bs baseCache[K, V]) GetEntry(key K) (Entry[K, V], bool) {
+	n, ok := bs.core().GetNode(key)
+	if !ok {
+		return Entry[K, V]{}, false
+	}
+
+	return newEntry(n), true
+}
+
+// KeyCount is an approximate number of reads of the key.
+type KeyCount[K comparable] struct {
+	Key   K
+	Count uint64
+}
+
+// TopKeys returns at most k approximately hottest keys with their estimated read counts,
+// ordered by the count descending. It returns nil if the cache has been built without TrackTopKeys.
+//
+// The counts are estimated from the reads sampled by the eviction policy, so they may be lower than the real ones.
+func (bs baseCache[K, V]) TopKeys(k int) []KeyCount[K] {
+	counters := bs.core().TopKeys(k)
+	if counters == nil {
+		return nil
+	}
+
+	top := make([]KeyCount[K], 0, len(counters))
+	for _, c := range counters {
+		top = append(top, KeyCount[K]{Key: c.Key, Count: c.Count})
+	}
+	return top
+}
+
+// Hottest returns at most n entries with the largest number of hits, ordered by the number of hits descending.
+// It returns nil if the cache has been built without CollectEntryStats.
+//
+// NOTE: this operation iterates over all items in the cache.
+func (bs baseCache[K, V]) Hottest(n int) []Entry[K, V] {
+	nodes := bs.core().Hottest(n)
+	if nodes == nil {
+		return nil
+	}
+
+	entries := make([]Entry[K, V], 0, len(nodes))
+	for _, n := range nodes {
+		entries = append(entries, newEntry(n))
+	}
+	return entries
+}
+
+// Entries returns a weakly consistent snapshot of the entries of all items in this cache
+// with their metadata: cost, expiration and, with CollectEntryStats, the times of the last write and read.
+//
+// NOTE: this operation iterates over all items in the cache.
+func (bs baseCache[K, V]) Entries() []Entry[K, V] {
+	entries := make([]Entry[K, V], 0, bs.core().Size())
+	bs.core().RangeWhere(func(K) bool { return true }, func(n *node.Node[K, V]) bool {
+		entries = append(entries, newEntry(n))
+		return true
+	})
+	return entries
+}
+
+// Sample returns the entries of at most n random items in this cache, which can be used to estimate
+// the distribution of values or their staleness without a full scan.
+//
+// The sample is uniform: every set of n items is equally likely to be returned. The random slots
+// of the hash table are read until n items are found, so Sample is cheap while the table is well filled.
+// When most of the slots are empty or expired, e.g. after mass deletions, Sample can cost as much as a full scan.
+func (bs baseCache[K, V]) Sample(n int) []Entry[K, V] {
+	if n <= 0 {
+		return nil
+	}
+
+	size := bs.core().Size()
+	if n > size {
+		n = size
+	}
+	entries := make([]Entry[K, V], 0, n)
+	bs.core().Sample(n, func(got *node.Node[K, V]) {
+		entries = append(entries, newEntry(got))
+	})
+	return entries
+}
+
+// GetEntries returns the entries associated with the given keys in this cache.
+//
+// Keys that are not present in the cache are not included in the result.
+// Unlike the sequence of GetEntry calls, the eviction policy is updated only once for the whole batch.
+func (bs baseCache[K, V]) GetEntries(keys []K) map[K]Entry[K, V] {
+	entries := make(map[K]Entry[K, V], len(keys))
+	bs.core().GetNodes(keys, func(n *node.Node[K, V]) {
+		entries[n.Key()] = newEntry(n)
+	})
+	return entries
+}
+
+// GetAll returns the values associated with the given keys in this cache
+// and the keys that are not present in the cache in the order of the given keys.
+//
+// Unlike the sequence of Get calls, the eviction policy is updated only once for the whole batch.
+func (bs baseCache[K, V]) GetAll(keys []K) (found map[K]V, missing []K) {
+	found = make(map[K]V, len(keys))
+	bs.core().GetNodes(keys, func(n *node.Node[K, V]) {
+		found[n.Key()] = n.Value()
+	})
+	if len(found) == len(keys) {
+		return found, nil
+	}
+
+	missing = make([]K, 0, len(keys)-len(found))
+	for _, key := range keys {
+		if _, ok := found[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	return found, missing
 }
 
 // Delete removes the association for this key from the cache.
 func (bs baseCache[K, V]) Delete(key K) {
-	bs.cache.Delete(key)
+	bs.core().Delete(key)
+}
+
+// DeleteAndGet removes the association for this key from the cache and returns the removed value,
+// so resources held by the value can be released without a racy Get before Delete.
+//
+// The ok result is false if the key wasn't present in the cache or its item had already expired.
+func (bs baseCache[K, V]) DeleteAndGet(key K) (value V, ok bool) {
+	return bs.core().DeleteAndGet(key)
 }
 
 // DeleteByFunc removes the association for this key from the cache when the given function returns true.
 func (bs baseCache[K, V]) DeleteByFunc(f func(key K, value V) bool) {
-	bs.cache.DeleteByFunc(f)
+	bs.core().DeleteByFunc(f)
 }
 
 // Range iterates over all items in the cache.
 //
 // Iteration stops early when the given function returns false.
+//
+// If the cache was built with the StableRange option, items are iterated in the order in which they were last written.
 func (bs baseCache[K, V]) Range(f func(key K, value V) bool) {
-	bs.cache.Range(f)
+	bs.core().Range(f)
+}
+
+// RangeWhile calls f sequentially for each item in the cache that matches pred.
+// Iteration stops early when f returns false, and pred isn't called for the remaining items.
+//
+// It has the same consistency and ordering guarantees as Range.
+func (bs baseCache[K, V]) RangeWhile(pred func(key K, value V) bool, f func(key K, value V) bool) {
+	bs.core().Range(func(key K, value V) bool {
+		if !pred(key, value) {
+			return true
+		}
+		return f(key, value)
+	})
+}
+
+// RangeSnapshot iterates over a snapshot of all items in the cache taken before the iteration.
+//
+// Unlike Range, every key is observed at most once, and items inserted, updated or deleted during the iteration
+// are not observed. The snapshot is weakly consistent: items changed while it is being taken may or may not be included.
+// Iteration stops early when the given function returns false.
+//
+// NOTE: the snapshot holds references to all items, so it requires memory proportional to the size of the cache.
+func (bs baseCache[K, V]) RangeSnapshot(f func(key K, value V) bool) {
+	bs.core().RangeSnapshot(f)
+}
+
+// CopyTo copies all items of this cache into dst, so a new cache can replace this one without a cold start.
+//
+// If dst is an otter cache, the items keep their remaining ttl, and with keepHotness they also keep
+// their frequency and queue in the eviction policy. Otherwise, the items are set with the default ttl of dst.
+// Already expired items are skipped. The copy is weakly consistent like Range.
+func (bs baseCache[K, V]) CopyTo(dst Interface[K, V], keepHotness bool) {
+	rs, isOtter := dst.(interface {
+		replaySet(record journalRecord[K, V])
+	})
+	bs.core().RangeNodes(func(n *node.Node[K, V], frequency uint8, main bool) bool {
+		if !isOtter {
+			dst.SetWithDefaultTTL(n.Key(), n.Value())
+			return true
+		}
+
+		record, _ := newJournalRecord(core.InsertEvent, n)
+		if keepHotness {
+			record.Policy = &journalPolicy{
+				Frequency: frequency,
+				Main:      main,
+			}
+		}
+		rs.replaySet(record)
+		return true
+	})
+}
+
+// ClearOption configures Clear and ClearAsync.
+type ClearOption func(o *clearOptions)
+
+type clearOptions struct {
+	events bool
+}
+
+// WithClearEvents makes Clear publish EventClear to Events for every removed item.
+// The journal gets a single record of Clear with or without it.
+//
+// NOTE: it requires memory proportional to the size of the cache to remember the removed items.
+func WithClearEvents() ClearOption {
+	return func(o *clearOptions) {
+		o.events = true
+	}
 }
 
 // Clear clears the hash table, all policies, buffers, etc.
 //
 // NOTE: this operation must be performed when no requests are made to the cache otherwise the behavior is undefined.
-func (bs baseCache[K, V]) Clear() {
-	bs.cache.Clear()
+func (bs baseCache[K, V]) Clear(opts ...ClearOption) {
+	var o clearOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	bs.core().Clear(o.events)
+	if bs.journal != nil {
+		bs.journal.clear()
+	}
+}
+
+// ClearAsync is like Clear, but it clears the cache in the background, so clearing a large cache
+// doesn't block the calling goroutine. The returned channel is closed when the cache is cleared.
+//
+// NOTE: no requests should be made to the cache until the channel is closed otherwise the behavior is undefined.
+func (bs baseCache[K, V]) ClearAsync(opts ...ClearOption) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bs.Clear(opts...)
+	}()
+	return done
 }
 
 // Close clears the hash table, all policies, buffers, etc and stop all goroutines.
 //
+// Unlike the other methods, Close and Shutdown of the zero value of a cache do nothing.
+//
 // NOTE: this operation must be performed when no requests are made to the cache otherwise the behavior is undefined.
 func (bs baseCache[K, V]) Close() {
-	bs.cache.Close()
+	_ = bs.Shutdown(context.Background())
+}
+
+// Shutdown applies all pending writes, clears the hash table, all policies, buffers, etc
+// and waits for all goroutines to stop.
+//
+// If the context is done before the shutdown is complete, Shutdown returns the context's error,
+// but the shutdown still completes in the background.
+//
+// NOTE: this operation must be performed when no requests are made to the cache otherwise the behavior is undefined.
+func (bs baseCache[K, V]) Shutdown(ctx context.Context) error {
+	if bs.cache == nil {
+		return nil
+	}
+	if err := bs.core().Shutdown(ctx); err != nil {
+		return err
+	}
+
+	if bs.events != nil {
+		bs.events.close()
+	}
+	if bs.wal != nil {
+		return bs.wal.close()
+	}
+	return nil
+}
+
+// Events returns the channel of changes of the cache contents.
+//
+// The channel is bounded by the capacity passed to the Builder.Events. If the channel is full,
+// new events are dropped and counted by Stats.DroppedEvents. The channel is closed when the cache is closed.
+//
+// If the cache was built without the Events option, then Events returns nil.
+func (bs baseCache[K, V]) Events() <-chan Event[K, V] {
+	if bs.events == nil {
+		return nil
+	}
+
+	return bs.events.events
+}
+
+// Freeze makes all subsequent writes (sets, deletes and clears) no-ops while the reads continue,
+// for example to stop the cache from diverging from a new source of truth during a live migration.
+// Writes that return a result report that nothing has been stored or deleted, and ReplayJournal returns ErrFrozen.
+//
+// Expired items are still removed, and the writes in progress when Freeze is called may still take effect.
+func (bs baseCache[K, V]) Freeze() {
+	bs.core().Freeze()
+}
+
+// Unfreeze makes the writes take effect again after Freeze.
+func (bs baseCache[K, V]) Unfreeze() {
+	bs.core().Unfreeze()
+}
+
+// IsFrozen returns true if the cache is frozen by Freeze.
+func (bs baseCache[K, V]) IsFrozen() bool {
+	return bs.core().IsFrozen()
+}
+
+// LockKey locks the key and returns the function that unlocks it,
+// so callers can serialize external side effects with the cache mutations of the key.
+//
+// The lock is advisory: it doesn't block any cache operation, including ones on the key itself.
+// Keys are striped over a fixed set of mutexes, so don't hold several keys at once, it may deadlock.
+func (bs baseCache[K, V]) LockKey(key K) (unlock func()) {
+	return bs.core().LockKey(key)
+}
+
+// Mutation is a single change of the batch applied by Apply: it deletes the key if Delete is true
+// and associates the value with the key otherwise.
+//
+// Apply makes the whole batch visible atomically only within a bucket of the hash table:
+// a concurrent Range never observes the mutations of keys sharing a bucket partially applied,
+// but it may observe the mutations of one bucket applied and of another one not yet.
+// Keys are spread over the buckets by their hashes and the buckets change as the table resizes,
+// so callers can't control which keys share one and shouldn't rely on the atomicity across keys.
+// Mutations of the same key are applied in the batch order, and sets of items with too much cost are dropped.
+type Mutation[K comparable, V any] struct {
+	Key   K
+	Value V
+	// TTL is the custom ttl of the set item. It is used only by CacheWithVariableTTL.
+	TTL    time.Duration
+	Delete bool
+}
+
+func (bs baseCache[K, V]) apply(batch []Mutation[K, V], withTTL bool) {
+	mutations := make([]core.Mutation[K, V], 0, len(batch))
+	for _, m := range batch {
+		cm := core.Mutation[K, V]{
+			Key:    m.Key,
+			Value:  m.Value,
+			Delete: m.Delete,
+		}
+		if withTTL {
+			cm.TTL = m.TTL
+		}
+		mutations = append(mutations, cm)
+	}
+	bs.core().Apply(mutations)
+}
+
+// ReadOnly returns a read-only view of the cache.
+func (bs baseCache[K, V]) ReadOnly() ReadCache[K, V] {
+	return readOnly[K, V]{cache: bs}
+}
+
+func (bs baseCache[K, V]) peek(key K) (V, bool) {
+	return bs.core().Peek(key)
+}
+
+func (bs baseCache[K, V]) frequency(key K) (uint8, bool) {
+	return bs.core().Frequency(key)
+}
+
+func (bs baseCache[K, V]) getStale(key K) (e Entry[K, V], stale, ok bool) {
+	n, stale, ok := bs.core().GetStaleNode(key)
+	if !ok {
+		return Entry[K, V]{}, false, false
+	}
+
+	return newEntry(n), stale, true
 }
 
 // Size returns the current number of items in the cache.
+//
+// It waits until the pending writes are applied to the eviction policy, so the result doesn't exceed the capacity
+// because of the evictions which haven't been done yet, unless they are deferred by EvictionBatchSize.
+// Use EstimatedSize for frequent calls like metrics.
 func (bs baseCache[K, V]) Size() int {
-	return bs.cache.Size()
+	bs.core().Flush()
+	return bs.core().Size()
+}
+
+// EstimatedSize returns the current number of items in the hash table without waiting for the pending writes.
+//
+// It is cheap, but it may temporarily exceed the capacity because the evictions are applied asynchronously.
+func (bs baseCache[K, V]) EstimatedSize() int {
+	return bs.core().Size()
+}
+
+// CostUsed returns the total cost of the items applied to the eviction policy.
+//
+// Unlike Size, it shows how full the cache is when the costs of the items vary.
+func (bs baseCache[K, V]) CostUsed() uint64 {
+	used, _ := bs.core().Cost()
+	return uint64(used)
+}
+
+// Utilization returns the ratio of CostUsed to the maximum cost of the cache in the range [0, 1].
+//
+// The maximum cost is the capacity unless the cache is shrunk under memory pressure.
+func (bs baseCache[K, V]) Utilization() float64 {
+	used, maxCost := bs.core().Cost()
+	if maxCost == 0 {
+		return 0
+	}
+	return float64(used) / float64(maxCost)
+}
+
+// SetAdmissionEnabled turns the doorkeeper and the admission policy configured with Builder.Doorkeeper
+// and Builder.Admission on or off at runtime. While they are off, all new items are admitted,
+// which is useful to measure their effect in benchmarks.
+func (bs baseCache[K, V]) SetAdmissionEnabled(enabled bool) {
+	bs.core().SetAdmissionEnabled(enabled)
 }
 
 // Capacity returns the cache capacity.
 func (bs baseCache[K, V]) Capacity() int {
-	return bs.cache.Capacity()
+	return bs.core().Capacity()
+}
+
+// EstimatedMemoryUsage returns the estimated number of bytes used by the cache: the item nodes,
+// the hash table buckets, the read and write buffers, the ghost queue, the doorkeeper and the expiration policy,
+// plus the total cost of the items. The memory referenced by the keys and values is accounted only through the cost,
+// so the estimate is precise when the cost function returns the size of the item in bytes.
+func (bs baseCache[K, V]) EstimatedMemoryUsage() int64 {
+	return bs.core().EstimatedMemoryUsage()
 }
 
 // Stats returns a current snapshot of this cache's cumulative statistics.
 func (bs baseCache[K, V]) Stats() Stats {
-	return newStats(bs.cache.Stats())
+	return newStats(bs.core().Stats(), bs.core().Latencies(), bs.core().ExpiredResident, bs.core().Size)
+}
+
+// HashTableStatus describes the state of the hash table of the cache.
+type HashTableStatus struct {
+	// BucketCount is the number of buckets in the table.
+	BucketCount int
+	// Size is the number of items in the table.
+	Size int
+	// Load is the current fraction of the occupied slots, the table grows when it exceeds LoadFactor.
+	Load float64
+	// LoadFactor is the fraction of the slots which can be occupied before the table grows.
+	LoadFactor float64
+	// GrowthFactor is the factor by which the table grows.
+	GrowthFactor int
+	// Resizes is the number of grows and shrinks of the table since the creation of the cache.
+	Resizes int64
+	// Migrating is the number of buckets of the previous table whose items aren't moved yet after the last resize.
+	// The items are moved incrementally, so the resizes don't block the writes.
+	Migrating int
+}
+
+// Compact shrinks the hash table to the smallest size holding twice the current items under the load factor,
+// but not below the initial capacity, so the memory of the mass deletions is released.
+// DeleteByFunc compacts the table automatically.
+//
+// Compact returns true if the table was shrunk.
+func (bs baseCache[K, V]) Compact() bool {
+	return bs.core().Compact()
+}
+
+// HashTableStatus returns the current state of the hash table, which helps to tune Builder.HashTableTuning
+// and Builder.InitialCapacity.
+func (bs baseCache[K, V]) HashTableStatus() HashTableStatus {
+	info := bs.core().HashTableInfo()
+	return HashTableStatus{
+		BucketCount:  info.BucketCount,
+		Size:         info.Size,
+		Load:         info.Load,
+		LoadFactor:   info.LoadFactor,
+		GrowthFactor: info.GrowthFactor,
+		Resizes:      info.Resizes,
+		Migrating:    info.Migrating,
+	}
+}
+
+// Dump writes a human-readable description of the cache's internal state to w:
+// policy queue sizes, ghost entries, frequency distribution, buffer fill levels and table counters.
+//
+// The output is intended for debugging only and its format may change at any time.
+func (bs baseCache[K, V]) Dump(w io.Writer) error {
+	return bs.core().Dump(w)
+}
+
+// DebugString returns the output of Dump as a string.
+func (bs baseCache[K, V]) DebugString() string {
+	var sb strings.Builder
+	_ = bs.Dump(&sb)
+	return sb.String()
+}
+
+// SetOptions configures a single write of SetWithOptions.
+type SetOptions struct {
+	// ForceAdmit makes the new item bypass the doorkeeper and the admission policy,
+	// so items the caller knows to be valuable aren't rejected when the cache is full.
+	ForceAdmit bool
 }
 
 // Cache is a structure performs a best-effort bounding of a hash table using eviction algorithm
 // to determine which entries to evict when the capacity is exceeded.
+//
+// The zero value isn't usable: its methods panic with ErrUninitialized, except Close and Shutdown.
 type Cache[K comparable, V any] struct {
 	baseCache[K, V]
 }
 
-func newCache[K comparable, V any](c core.Config[K, V]) Cache[K, V] {
-	return Cache[K, V]{
-		baseCache: newBaseCache(c),
+func newCache[K comparable, V any](c core.Config[K, V], o *baseOptions[K, V]) (Cache[K, V], error) {
+	bs, err := newBaseCache(c, o)
+	if err != nil {
+		return Cache[K, V]{}, err
 	}
+
+	return Cache[K, V]{
+		baseCache: bs,
+	}, nil
 }
 
 // Set associates the value with the key in this cache.
 //
 // If it returns false, then the key-value item had too much setCostFunc and the Set was dropped.
+//
+// If the write buffer is full, Set waits until the background maintenance frees space in it,
+// such waits are reported by Stats.WriteBufferContentions. With the RejectWrites backpressure
+// Set returns false instead, use TrySet to tell this case apart from a dropped item.
 func (c Cache[K, V]) Set(key K, value V) bool {
-	return c.cache.Set(key, value)
+	return c.core().Set(key, value)
+}
+
+// TrySet is like Set, but it returns ErrWriteBufferFull instead of waiting when the write buffer is full,
+// whatever the backpressure of the cache is. The cache isn't changed in this case.
+//
+// Many goroutines racing for the last free slots may still wait briefly.
+func (c Cache[K, V]) TrySet(key K, value V) (bool, error) {
+	set, full := c.core().TrySet(key, value, 0)
+	if full {
+		return false, ErrWriteBufferFull
+	}
+	return set, nil
+}
+
+// SetWithOptions is like Set, but the write is configured with the given options.
+func (c Cache[K, V]) SetWithOptions(key K, value V, opts SetOptions) bool {
+	if opts.ForceAdmit {
+		return c.core().SetForceAdmit(key, value)
+	}
+	return c.Set(key, value)
+}
+
+// SetWithMaxReads is like Set, but the item is removed after maxReads successful reads,
+// which is useful for one-time tokens and similar values. Zero maxReads means no limit.
+//
+// Reads are the successful lookups returning the value such as Get, GetEntry and the hits of GetOrSet.
+// Has doesn't consume the reads, but it reports the item as absent once they are exhausted.
+// The removal after the last read is reported as an expiration.
+func (c Cache[K, V]) SetWithMaxReads(key K, value V, maxReads uint32) bool {
+	return c.core().SetWithMaxReads(key, value, 0, maxReads)
 }
 
 // SetIfAbsent if the specified key is not already associated with a value associates it with the given value.
@@ -136,26 +945,115 @@ func (c Cache[K, V]) Set(key K, value V) bool {
 //
 // Also, it returns false if the key-value item had too much setCostFunc and the SetIfAbsent was dropped.
 func (c Cache[K, V]) SetIfAbsent(key K, value V) bool {
-	return c.cache.SetIfAbsent(key, value)
+	return c.core().SetIfAbsent(key, value)
+}
+
+// SetWithDefaultTTL is the same as Set. It allows Cache to implement Interface.
+func (c Cache[K, V]) SetWithDefaultTTL(key K, value V) bool {
+	return c.Set(key, value)
+}
+
+// SetIfAbsentWithDefaultTTL is the same as SetIfAbsent. It allows Cache to implement Interface.
+func (c Cache[K, V]) SetIfAbsentWithDefaultTTL(key K, value V) bool {
+	return c.SetIfAbsent(key, value)
+}
+
+// SetIfVersion associates the value with the key only if the version of the current item,
+// as returned by Entry.Version, is the given one. Zero version means that the key must be absent.
+//
+// If it returns false, then the version didn't match or the key-value item had too much cost.
+// It requires the cache to be built with Versioned.
+func (c Cache[K, V]) SetIfVersion(key K, value V, version uint64) bool {
+	return c.core().SetIfVersion(key, value, version, 0)
+}
+
+// GetOrSet returns the existing value for the key if present.
+// Otherwise, it associates the given value with the key and returns it.
+// The loaded result is true if the value was loaded, false if stored.
+//
+// If the key-value item had too much cost, then it isn't stored and the given value is returned.
+func (c Cache[K, V]) GetOrSet(key K, value V) (actual V, loaded bool) {
+	return c.core().GetOrSet(key, value)
+}
+
+// Apply applies the batch of sets and deletes, the sets use the ttl of the cache.
+//
+// See Mutation for the atomicity guarantees.
+func (c Cache[K, V]) Apply(batch []Mutation[K, V]) {
+	c.apply(batch, false)
+}
+
+// SetAll associates the values with the keys of the entries in this cache, the items use the ttl of the cache.
+// It takes the lock of every bucket once and passes all writes to the eviction policy in a single slot
+// of the write buffer, so warming up the cache doesn't compete with other writers for the write buffer.
+// It isn't faster than the sets in a loop though, since grouping the writes by bucket has its cost,
+// see BenchmarkCache_SetAll.
+//
+// The costs and the expiration times of the entries are ignored, the items with too much cost aren't stored.
+func (c Cache[K, V]) SetAll(entries []Entry[K, V]) {
+	batch := make([]Mutation[K, V], 0, len(entries))
+	for _, e := range entries {
+		batch = append(batch, Mutation[K, V]{Key: e.Key(), Value: e.Value()})
+	}
+	c.apply(batch, false)
 }
 
 // CacheWithVariableTTL is a structure performs a best-effort bounding of a hash table using eviction algorithm
 // to determine which entries to evict when the capacity is exceeded.
+//
+// The zero value isn't usable: its methods panic with ErrUninitialized, except Close and Shutdown.
 type CacheWithVariableTTL[K comparable, V any] struct {
 	baseCache[K, V]
 }
 
-func newCacheWithVariableTTL[K comparable, V any](c core.Config[K, V]) CacheWithVariableTTL[K, V] {
-	return CacheWithVariableTTL[K, V]{
-		baseCache: newBaseCache(c),
+func newCacheWithVariableTTL[K comparable, V any](c core.Config[K, V], o *baseOptions[K, V]) (CacheWithVariableTTL[K, V], error) {
+	bs, err := newBaseCache(c, o)
+	if err != nil {
+		return CacheWithVariableTTL[K, V]{}, err
 	}
+
+	return CacheWithVariableTTL[K, V]{
+		baseCache: bs,
+	}, nil
 }
 
 // Set associates the value with the key in this cache and sets the custom ttl for this key-value item.
 //
 // If it returns false, then the key-value item had too much setCostFunc and the Set was dropped.
+//
+// If the write buffer is full, Set waits until the background maintenance frees space in it,
+// such waits are reported by Stats.WriteBufferContentions. With the RejectWrites backpressure
+// Set returns false instead, use TrySet to tell this case apart from a dropped item.
 func (c CacheWithVariableTTL[K, V]) Set(key K, value V, ttl time.Duration) bool {
-	return c.cache.SetWithTTL(key, value, ttl)
+	return c.core().SetWithTTL(key, value, ttl)
+}
+
+// TrySet is like Set, but it returns ErrWriteBufferFull instead of waiting when the write buffer is full,
+// whatever the backpressure of the cache is. The cache isn't changed in this case.
+//
+// Many goroutines racing for the last free slots may still wait briefly.
+func (c CacheWithVariableTTL[K, V]) TrySet(key K, value V, ttl time.Duration) (bool, error) {
+	set, full := c.core().TrySet(key, value, ttl)
+	if full {
+		return false, ErrWriteBufferFull
+	}
+	return set, nil
+}
+
+// SetWithOptions is like Set, but the write is configured with the given options.
+func (c CacheWithVariableTTL[K, V]) SetWithOptions(key K, value V, ttl time.Duration, opts SetOptions) bool {
+	if opts.ForceAdmit {
+		return c.core().SetWithTTLForceAdmit(key, value, ttl)
+	}
+	return c.Set(key, value, ttl)
+}
+
+// SetWithMaxReads is like Set, but the item is removed after maxReads successful reads.
+// Zero maxReads means no limit.
+//
+// See Cache.SetWithMaxReads for the details.
+func (c CacheWithVariableTTL[K, V]) SetWithMaxReads(key K, value V, ttl time.Duration, maxReads uint32) bool {
+	return c.core().SetWithMaxReads(key, value, ttl, maxReads)
 }
 
 // SetIfAbsent if the specified key is not already associated with a value associates it with the given value
@@ -165,5 +1063,77 @@ func (c CacheWithVariableTTL[K, V]) Set(key K, value V, ttl time.Duration) bool
 //
 // Also, it returns false if the key-value item had too much setCostFunc and the SetIfAbsent was dropped.
 func (c CacheWithVariableTTL[K, V]) SetIfAbsent(key K, value V, ttl time.Duration) bool {
-	return c.cache.SetIfAbsentWithTTL(key, value, ttl)
+	return c.core().SetIfAbsentWithTTL(key, value, ttl)
+}
+
+// SetWithDefaultTTL associates the value with the key in this cache and sets the ttl
+// specified by VariableTTLBuilder.DefaultTTL for this key-value item.
+// If the default ttl isn't specified, then the item never expires.
+//
+// If it returns false, then the key-value item had too much cost and the Set was dropped.
+func (c CacheWithVariableTTL[K, V]) SetWithDefaultTTL(key K, value V) bool {
+	return c.core().Set(key, value)
+}
+
+// SetIfAbsentWithDefaultTTL if the specified key is not already associated with a value associates it
+// with the given value and sets the ttl specified by VariableTTLBuilder.DefaultTTL for this key-value item.
+// If the default ttl isn't specified, then the item never expires.
+//
+// If the specified key is not already associated with a value, then it returns false.
+//
+// Also, it returns false if the key-value item had too much cost and the SetIfAbsent was dropped.
+func (c CacheWithVariableTTL[K, V]) SetIfAbsentWithDefaultTTL(key K, value V) bool {
+	return c.core().SetIfAbsent(key, value)
+}
+
+// SetIfVersion associates the value with the key and sets the custom ttl for this key-value item
+// only if the version of the current item, as returned by Entry.Version, is the given one.
+// Zero version means that the key must be absent.
+//
+// If it returns false, then the version didn't match or the key-value item had too much cost.
+// It requires the cache to be built with Versioned.
+func (c CacheWithVariableTTL[K, V]) SetIfVersion(key K, value V, version uint64, ttl time.Duration) bool {
+	return c.core().SetIfVersion(key, value, version, ttl)
+}
+
+// GetOrSet returns the existing value for the key if present.
+// Otherwise, it associates the given value with the key, sets the custom ttl for this key-value item and returns the value.
+// The loaded result is true if the value was loaded, false if stored.
+//
+// If the key-value item had too much cost, then it isn't stored and the given value is returned.
+func (c CacheWithVariableTTL[K, V]) GetOrSet(key K, value V, ttl time.Duration) (actual V, loaded bool) {
+	return c.core().GetOrSetWithTTL(key, value, ttl)
+}
+
+// Apply applies the batch of sets and deletes, the sets use the ttl of the mutation
+// or the ttl specified by VariableTTLBuilder.DefaultTTL if it is zero.
+//
+// See Mutation for the atomicity guarantees.
+func (c CacheWithVariableTTL[K, V]) Apply(batch []Mutation[K, V]) {
+	c.apply(batch, true)
+}
+
+// SetAll associates the values with the keys of the entries in this cache, the items use the ttl of the entry.
+// The entries without expiration time use the ttl specified by VariableTTLBuilder.DefaultTTL,
+// or never expire if the cache has no default ttl.
+// It takes the lock of every bucket once and passes all writes to the eviction policy in a single slot
+// of the write buffer, so warming up the cache doesn't compete with other writers for the write buffer.
+// It isn't faster than the sets in a loop though, since grouping the writes by bucket has its cost,
+// see BenchmarkCache_SetAll.
+//
+// The costs of the entries are ignored, the expired entries and the items with too much cost aren't stored.
+func (c CacheWithVariableTTL[K, V]) SetAll(entries []Entry[K, V]) {
+	batch := make([]Mutation[K, V], 0, len(entries))
+	for _, e := range entries {
+		ttl := e.TTL()
+		if ttl == 0 {
+			continue
+		}
+		if ttl < 0 {
+			// the entry has no expiration time, so it gets the default one.
+			ttl = 0
+		}
+		batch = append(batch, Mutation[K, V]{Key: e.Key(), Value: e.Value(), TTL: ttl})
+	}
+	c.apply(batch, true)
 }
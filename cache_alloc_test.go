@@ -0,0 +1,61 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !race
+
+package otter
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCache_GetZeroAllocs(t *testing.T) {
+	const size = 1 << 10
+
+	builders := map[string]*Builder[string, int]{
+		"default": MustBuilder[string, int](size),
+		"stats":   MustBuilder[string, int](size).CollectStats(),
+		"all":     MustBuilder[string, int](size).CollectStats().CollectLatencies().StableRange(),
+	}
+	for name, b := range builders {
+		t.Run(name, func(t *testing.T) {
+			c, err := b.Build()
+			if err != nil {
+				t.Fatalf("can not create cache: %v", err)
+			}
+			defer c.Close()
+
+			keys := make([]string, 0, 2*size)
+			for i := 0; i < 2*size; i++ {
+				keys = append(keys, strconv.Itoa(i))
+			}
+			for i := 0; i < size; i++ {
+				c.Set(keys[i], i)
+			}
+			time.Sleep(10 * time.Millisecond)
+
+			i := 0
+			allocs := testing.AllocsPerRun(10*size, func() {
+				// half of the requests are misses.
+				c.Get(keys[i&(2*size-1)])
+				i++
+			})
+			if allocs != 0 {
+				t.Fatalf("Get should not allocate, but got %f allocations per run", allocs)
+			}
+		})
+	}
+}
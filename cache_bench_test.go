@@ -0,0 +1,125 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+const benchSize = 1 << 10
+
+func newBenchCache(b *testing.B, builder *Builder[int, int]) Cache[int, int] {
+	b.Helper()
+
+	c, err := builder.Build()
+	if err != nil {
+		b.Fatalf("can not create cache: %v", err)
+	}
+	for i := 0; i < benchSize; i++ {
+		c.Set(i, i)
+	}
+	return c
+}
+
+func runBenchGet(b *testing.B, get func(i int)) {
+	b.Helper()
+	b.ResetTimer()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			get(i)
+			i++
+		}
+	})
+}
+
+func BenchmarkCache_Get(b *testing.B) {
+	c := newBenchCache(b, MustBuilder[int, int](benchSize))
+	defer c.Close()
+
+	runBenchGet(b, func(i int) {
+		c.Get(i & (benchSize - 1))
+	})
+}
+
+func BenchmarkCache_GetWithStats(b *testing.B) {
+	c := newBenchCache(b, MustBuilder[int, int](benchSize).CollectStats())
+	defer c.Close()
+
+	runBenchGet(b, func(i int) {
+		c.Get(i & (benchSize - 1))
+	})
+}
+
+func BenchmarkCache_GetMiss(b *testing.B) {
+	c := newBenchCache(b, MustBuilder[int, int](benchSize).CollectStats())
+	defer c.Close()
+
+	runBenchGet(b, func(i int) {
+		c.Get(benchSize + i&(benchSize-1))
+	})
+}
+
+func BenchmarkCache_GetStringKey(b *testing.B) {
+	c, err := MustBuilder[string, int](benchSize).WithTTL(time.Hour).CollectStats().Build()
+	if err != nil {
+		b.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	keys := make([]string, 0, benchSize)
+	for i := 0; i < benchSize; i++ {
+		key := strconv.Itoa(i)
+		keys = append(keys, key)
+		c.Set(key, i)
+	}
+
+	runBenchGet(b, func(i int) {
+		c.Get(keys[i&(benchSize-1)])
+	})
+}
+
+func BenchmarkCache_SetAll(b *testing.B) {
+	entries := make([]Entry[int, int], 0, benchSize)
+	for i := 0; i < benchSize; i++ {
+		entries = append(entries, NewEntry(i, i, 0, 1))
+	}
+
+	b.Run("loop", func(b *testing.B) {
+		c := newBenchCache(b, MustBuilder[int, int](benchSize))
+		defer c.Close()
+
+		b.ResetTimer()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, e := range entries {
+				c.Set(e.Key(), e.Value())
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		c := newBenchCache(b, MustBuilder[int, int](benchSize))
+		defer c.Close()
+
+		b.ResetTimer()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			c.SetAll(entries)
+		}
+	})
+}
@@ -16,12 +16,19 @@ package otter
 
 import (
 	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/maypok86/otter/internal/node"
 	"github.com/maypok86/otter/internal/xruntime"
 )
 
@@ -131,57 +138,1494 @@ func TestCache_SetIfAbsent(t *testing.T) {
 	cc.Close()
 }
 
+func TestCache_GetOrSet(t *testing.T) {
+	const size = 100
+	c, err := MustBuilder[int, int](size).WithTTL(time.Minute).CollectStats().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < size; i++ {
+		if actual, loaded := c.GetOrSet(i, i); loaded || actual != i {
+			t.Fatalf("value should be stored. key: %d, actual: %d, loaded: %v", i, actual, loaded)
+		}
+	}
+
+	for i := 0; i < size; i++ {
+		if actual, loaded := c.GetOrSet(i, i+1); !loaded || actual != i {
+			t.Fatalf("value should be loaded. key: %d, actual: %d, loaded: %v", i, actual, loaded)
+		}
+	}
+
+	if hits := c.Stats().Hits(); hits != size {
+		t.Fatalf("c.Stats().Hits() = %d, want = %d", hits, size)
+	}
+
+	cc, err := MustBuilder[int, int](size).WithVariableTTL().NodePooling().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer cc.Close()
+
+	if actual, loaded := cc.GetOrSet(1, 1, time.Hour); loaded || actual != 1 {
+		t.Fatalf("value should be stored. actual: %d, loaded: %v", actual, loaded)
+	}
+	if actual, loaded := cc.GetOrSet(1, 2, time.Hour); !loaded || actual != 1 {
+		t.Fatalf("value should be loaded. actual: %d, loaded: %v", actual, loaded)
+	}
+	if cc.SetIfAbsent(1, 3, time.Hour) {
+		t.Fatal("value shouldn't be stored")
+	}
+	if v, ok := cc.Get(1); !ok || v != 1 {
+		t.Fatalf("got %d/%v for key 1, want 1/true", v, ok)
+	}
+}
+
+func TestCache_SynchronousEviction(t *testing.T) {
+	const size = 100
+	c, err := MustBuilder[int, int](size).SynchronousEviction().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 10*size; i++ {
+		c.Set(i, i)
+		if c.Size() > size {
+			t.Fatalf("c.Size() = %d, want <= %d", c.Size(), size)
+		}
+	}
+	for i := 0; i < 10*size; i++ {
+		c.Delete(i)
+	}
+	if c.Size() != 0 {
+		t.Fatalf("c.Size() = %d, want = 0", c.Size())
+	}
+
+	c.Clear()
+	for i := 0; i < size; i++ {
+		c.Set(i, i)
+	}
+	if c.Size() != size {
+		t.Fatalf("c.Size() = %d, want = %d", c.Size(), size)
+	}
+}
+
+func TestCache_PreciseSize(t *testing.T) {
+	const size = 100
+	c, err := MustBuilder[int, int](size).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+
+	for i := 0; i < 10*size; i++ {
+		c.Set(i, i)
+	}
+	if got := c.EstimatedSize(); got < size {
+		t.Fatalf("c.EstimatedSize() = %d, want at least %d", got, size)
+	}
+	// the pending writes are applied first, so the evictions are done.
+	if got := c.Size(); got != size {
+		t.Fatalf("c.Size() = %d, want = %d", got, size)
+	}
+
+	c.Close()
+	if got := c.Size(); got != 0 {
+		t.Fatalf("c.Size() = %d after close, want = 0", got)
+	}
+}
+
+func TestCache_CostUsed(t *testing.T) {
+	c, err := MustBuilder[int, int](1000).
+		Cost(func(key int, value int) uint32 { return uint32(value) }).
+		SynchronousEviction().
+		Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.Set(1, 10)
+	c.Set(2, 20)
+	if got := c.CostUsed(); got != 30 {
+		t.Fatalf("c.CostUsed() = %d, want = 30", got)
+	}
+	if got := c.Utilization(); got != 0.03 {
+		t.Fatalf("c.Utilization() = %v, want = 0.03", got)
+	}
+
+	c.Delete(2)
+	if got := c.CostUsed(); got != 10 {
+		t.Fatalf("c.CostUsed() = %d after delete, want = 10", got)
+	}
+}
+
+func TestCache_Doorkeeper(t *testing.T) {
+	const size = 100
+	c, err := MustBuilder[int, int](size).Doorkeeper().SynchronousEviction().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < size; i++ {
+		c.Set(i, i)
+	}
+	if c.Size() != size {
+		t.Fatalf("c.Size() = %d, want = %d", c.Size(), size)
+	}
+
+	// the doorkeeper is a bloom filter, so a new key can rarely be a false positive.
+	rejected := 0
+	for k := size; k < size+10; k++ {
+		c.Set(k, k)
+		if c.Has(k) {
+			continue
+		}
+		rejected++
+		c.Set(k, k)
+		if !c.Has(k) {
+			t.Fatal("key written for the second time should be admitted")
+		}
+	}
+	if rejected == 0 {
+		t.Fatal("keys written for the first time should be rejected when the cache is full")
+	}
+}
+
+type rejectingAdmission struct{}
+
+func (rejectingAdmission) Record(key int) {}
+
+func (rejectingAdmission) Admit(candidate, victim int) bool {
+	return false
+}
+
+func TestStats_Admissions(t *testing.T) {
+	const size = 100
+	c, err := MustBuilder[int, int](size).
+		Admission(rejectingAdmission{}).
+		CollectStats().
+		SynchronousEviction().
+		Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < size; i++ {
+		c.Set(i, i)
+	}
+	if got := c.Stats().RejectedAdmissions() + c.Stats().EvictingAdmissions(); got != 0 {
+		t.Fatalf("admissions into the cache with free space shouldn't be counted, but got %d", got)
+	}
+
+	c.Set(size, size)
+	c.Set(size+1, size+1)
+	c.SetWithOptions(size+2, size+2, SetOptions{ForceAdmit: true})
+
+	s := c.Stats()
+	if s.RejectedAdmissions() != 2 || s.EvictingAdmissions() != 1 {
+		t.Fatalf("got %d rejected and %d evicting admissions, want 2 and 1", s.RejectedAdmissions(), s.EvictingAdmissions())
+	}
+}
+
+func TestCache_ForceAdmit(t *testing.T) {
+	const size = 100
+	c, err := MustBuilder[int, int](size).Admission(rejectingAdmission{}).SynchronousEviction().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < size; i++ {
+		c.Set(i, i)
+	}
+
+	c.Set(size, size)
+	if c.Has(size) {
+		t.Fatal("new key should be rejected by the admission when the cache is full")
+	}
+	c.SetWithOptions(size, size, SetOptions{ForceAdmit: true})
+	if !c.Has(size) {
+		t.Fatal("forced key should bypass the admission")
+	}
+
+	c.SetAdmissionEnabled(false)
+	c.Set(size+1, size+1)
+	if !c.Has(size + 1) {
+		t.Fatal("new key should be admitted while the admission is disabled")
+	}
+	c.SetAdmissionEnabled(true)
+	c.Set(size+2, size+2)
+	if c.Has(size + 2) {
+		t.Fatal("new key should be rejected once the admission is enabled again")
+	}
+}
+
+type frequencyAdmission struct {
+	frequencies map[int]int
+}
+
+func (a *frequencyAdmission) Record(key int) {
+	a.frequencies[key]++
+}
+
+func (a *frequencyAdmission) Admit(candidate, victim int) bool {
+	return a.frequencies[candidate] > a.frequencies[victim]
+}
+
+func TestCache_Admission(t *testing.T) {
+	const size = 100
+	admission := &frequencyAdmission{frequencies: make(map[int]int)}
+	c, err := MustBuilder[int, int](size).Admission(admission).SynchronousEviction().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < size; i++ {
+		c.Set(i, i)
+	}
+
+	c.Set(size, size)
+	if c.Has(size) {
+		t.Fatal("candidate should be rejected by the admission policy")
+	}
+	if c.Size() != size {
+		t.Fatalf("c.Size() = %d, want = %d", c.Size(), size)
+	}
+
+	c.Set(size, size)
+	if !c.Has(size) {
+		t.Fatal("candidate with a higher frequency should be admitted")
+	}
+}
+
+func TestCache_SharedAdmission(t *testing.T) {
+	const size = 100
+	shared := NewSharedAdmission[int](&frequencyAdmission{frequencies: make(map[int]int)})
+	caches := make([]*Cache[int, int], 0, 2)
+	for i := 0; i < 2; i++ {
+		c, err := MustBuilder[int, int](size).SharedAdmission(shared).SynchronousEviction().Build()
+		if err != nil {
+			t.Fatalf("can not create cache: %v", err)
+		}
+		defer c.Close()
+		caches = append(caches, &c)
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range caches {
+		wg.Add(1)
+		go func(c *Cache[int, int]) {
+			defer wg.Done()
+			for i := 0; i < size; i++ {
+				c.Set(i, i)
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	// the access history of the first cache is used by the second one.
+	caches[0].Set(size, size)
+	caches[0].Set(size, size)
+	caches[1].Set(size, size)
+	if !caches[1].Has(size) {
+		t.Fatal("key frequently written to the first cache should be admitted by the second one")
+	}
+}
+
+func TestCache_MaxEntryCost(t *testing.T) {
+	c, err := MustBuilder[int, int](1000).
+		Cost(func(key int, value int) uint32 {
+			return uint32(value)
+		}).
+		MaxEntryCost(100).
+		CollectStats().
+		Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	if !c.Set(1, 100) {
+		t.Fatal("item with the max entry cost should be stored")
+	}
+	if c.Set(2, 101) || c.SetIfAbsent(3, 500) {
+		t.Fatal("item exceeding the max entry cost should be rejected")
+	}
+	if _, loaded := c.GetOrSet(4, 2000); loaded || c.Has(4) {
+		t.Fatal("item exceeding the capacity should be rejected")
+	}
+	if got := c.Stats().RejectedSets(); got != 3 {
+		t.Fatalf("rejected sets = %d, want 3", got)
+	}
+}
+
+func TestCache_Freeze(t *testing.T) {
+	c, err := MustBuilder[int, int](100).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.Set(1, 1)
+	c.Set(2, 2)
+	c.Freeze()
+	if !c.IsFrozen() {
+		t.Fatal("cache should be frozen")
+	}
+
+	if c.Set(3, 3) || c.SetIfAbsent(4, 4) {
+		t.Fatal("writes to a frozen cache should be no-ops")
+	}
+	if v, loaded := c.GetOrSet(1, 10); !loaded || v != 1 {
+		t.Fatalf("existing value should be returned, but got %d/%v", v, loaded)
+	}
+	if _, loaded := c.GetOrSet(5, 5); loaded || c.Has(5) {
+		t.Fatal("GetOrSet should not store values in a frozen cache")
+	}
+	c.Delete(1)
+	if _, ok := c.DeleteAndGet(2); ok {
+		t.Fatal("deletes from a frozen cache should be no-ops")
+	}
+	c.DeleteByFunc(func(key int, value int) bool {
+		return true
+	})
+	c.Clear()
+	if c.Size() != 2 || !c.Has(1) || !c.Has(2) {
+		t.Fatalf("frozen cache should not change, but got size %d", c.Size())
+	}
+	if err := c.ReplayJournal(strings.NewReader("")); !errors.Is(err, ErrFrozen) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrFrozen, err)
+	}
+
+	c.Unfreeze()
+	if !c.Set(3, 3) || !c.Has(3) {
+		t.Fatal("writes should take effect after Unfreeze")
+	}
+}
+
+func TestCache_LockKey(t *testing.T) {
+	c, err := MustBuilder[int, int](100).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	const (
+		goroutines = 8
+		iterations = 1000
+	)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				unlock := c.LockKey(1)
+				v, _ := c.Get(1)
+				c.Set(1, v+1)
+				unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v, _ := c.Get(1); v != goroutines*iterations {
+		t.Fatalf("read-modify-write under the key lock should not lose updates, but got %d", v)
+	}
+}
+
+func TestCache_Apply(t *testing.T) {
+	c, err := MustBuilder[int, int](100).
+		Cost(func(key int, value int) uint32 {
+			return uint32(value)
+		}).
+		Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.Set(1, 1)
+	c.Set(2, 2)
+	c.Apply([]Mutation[int, int]{
+		{Key: 1, Value: 10},
+		{Key: 2, Delete: true},
+		{Key: 3, Value: 3},
+		{Key: 3, Value: 4},
+		{Key: 4, Value: 1000},
+	})
+
+	if v, ok := c.Get(1); !ok || v != 10 {
+		t.Fatalf("value for key 1 should be updated, but got %d", v)
+	}
+	if c.Has(2) {
+		t.Fatal("key 2 should be deleted")
+	}
+	if v, ok := c.Get(3); !ok || v != 4 {
+		t.Fatalf("mutations of the same key should be applied in order, but got %d", v)
+	}
+	if c.Has(4) {
+		t.Fatal("oversized item should be dropped")
+	}
+	if c.Size() != 2 {
+		t.Fatalf("size should be 2, but got %d", c.Size())
+	}
+}
+
+func TestCache_SetAll(t *testing.T) {
+	const size = 100
+	c, err := MustBuilder[int, int](size).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	entries := make([]Entry[int, int], 0, 10*size)
+	for i := 0; i < 10*size; i++ {
+		entries = append(entries, NewEntry(i, i, 0, 1))
+	}
+	c.SetAll(entries)
+
+	// the batch is applied by the eviction policy at once without waiting for more writes.
+	deadline := time.Now().Add(time.Second)
+	for c.Size() > size && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if c.Size() != size {
+		t.Fatalf("size should be %d, but got %d", size, c.Size())
+	}
+}
+
+func TestCache_ParallelGetAll(t *testing.T) {
+	const size = 1000
+	c, err := MustBuilder[int, int](size).ParallelGetThreshold(100).CollectStats().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	keys := make([]int, 0, 2*size)
+	for i := 0; i < 2*size; i++ {
+		if i%2 == 0 {
+			c.Set(i, i)
+		}
+		keys = append(keys, i)
+	}
+
+	found, missing := c.GetAll(keys)
+	if len(found) != size || len(missing) != size {
+		t.Fatalf("%d keys should be found and %d missing, but got %d and %d", size, size, len(found), len(missing))
+	}
+	for k, v := range found {
+		if k%2 != 0 || k != v {
+			t.Fatalf("unexpected found entry %d: %d", k, v)
+		}
+	}
+	for i, k := range missing {
+		if k != 2*i+1 {
+			t.Fatalf("missing keys should keep the order of the given keys, but got %d at %d", k, i)
+		}
+	}
+	if s := c.Stats(); s.Hits() != size || s.Misses() != size {
+		t.Fatalf("hits and misses should be %d, but got %d and %d", size, s.Hits(), s.Misses())
+	}
+}
+
+func TestCache_CopyTo(t *testing.T) {
+	src, err := MustBuilder[int, int](100).WithVariableTTL().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer src.Close()
+	dst, err := MustBuilder[int, int](100).WithVariableTTL().DefaultTTL(time.Hour).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer dst.Close()
+
+	src.cache.Restore(1, 1, 0, 3, true)
+	src.Set(2, 2, time.Minute)
+	src.CopyTo(dst, true)
+
+	if e, ok := dst.GetEntry(1); !ok || e.Value() != 1 || e.TTL() <= time.Minute {
+		t.Fatalf("item without ttl should get the default ttl of dst, but got %v %v", e.TTL(), ok)
+	}
+	if e, ok := dst.GetEntry(2); !ok || e.Value() != 2 || e.TTL() > time.Minute {
+		t.Fatalf("item should keep its remaining ttl, but got %v %v", e.TTL(), ok)
+	}
+	dst.cache.RangeNodes(func(n *node.Node[int, int], frequency uint8, main bool) bool {
+		if n.Key() == 1 && (frequency != 3 || !main) {
+			t.Fatalf("item should keep its hotness, but got %d %v", frequency, main)
+		}
+		return true
+	})
+}
+
+func TestCache_RangeWhile(t *testing.T) {
+	c, err := MustBuilder[int, int](100).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 50; i++ {
+		c.Set(i, i)
+	}
+
+	matched := 0
+	c.RangeWhile(func(key, value int) bool {
+		return key%2 == 0
+	}, func(key, value int) bool {
+		if key%2 != 0 {
+			t.Fatalf("key %d doesn't match the predicate", key)
+		}
+		matched++
+		return true
+	})
+	if matched != 25 {
+		t.Fatalf("25 items should match the predicate, but got %d", matched)
+	}
+
+	calls := 0
+	c.RangeWhile(func(key, value int) bool {
+		return true
+	}, func(key, value int) bool {
+		calls++
+		return calls < 3
+	})
+	if calls != 3 {
+		t.Fatalf("iteration should stop after f returns false, but f was called %d times", calls)
+	}
+}
+
+func TestCacheWithVariableTTL_TTLBounds(t *testing.T) {
+	c, err := MustBuilder[int, int](100).WithVariableTTL().MinTTL(10 * time.Second).MaxTTL(time.Hour).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.Set(1, 1, time.Nanosecond)
+	c.Set(2, 2, 365*24*time.Hour)
+	c.Set(3, 3, time.Minute)
+
+	if e, ok := c.GetEntry(1); !ok || e.TTL() < 9*time.Second || e.TTL() > 10*time.Second {
+		t.Fatalf("ttl should be raised to the min ttl, but got %v %v", e.TTL(), ok)
+	}
+	if e, ok := c.GetEntry(2); !ok || e.TTL() > time.Hour || e.TTL() < time.Hour-time.Second {
+		t.Fatalf("ttl should be lowered to the max ttl, but got %v %v", e.TTL(), ok)
+	}
+	if e, ok := c.GetEntry(3); !ok || e.TTL() > time.Minute || e.TTL() < time.Minute-time.Second {
+		t.Fatalf("ttl within the bounds shouldn't change, but got %v %v", e.TTL(), ok)
+	}
+}
+
+func TestCache_SetWithMaxReads(t *testing.T) {
+	c, err := MustBuilder[int, int](100).Events(16).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.SetWithMaxReads(1, 1, 2)
+	c.SetWithMaxReads(2, 2, 0)
+
+	for i := 0; i < 3; i++ {
+		if !c.Has(1) {
+			t.Fatal("has should not consume the reads")
+		}
+	}
+	if v, ok := c.GetOrSet(1, 10); !ok || v != 1 {
+		t.Fatalf("the hit of get or set should be the first read, but got %d %v", v, ok)
+	}
+	if v, ok := c.Get(1); !ok || v != 1 {
+		t.Fatalf("the second read should be allowed, but got %d %v", v, ok)
+	}
+	if _, ok := c.Get(1); ok {
+		t.Fatal("item should be removed after the last allowed read")
+	}
+	if c.Has(1) {
+		t.Fatal("item shouldn't be found after the last allowed read")
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok := c.Get(2); !ok {
+			t.Fatal("reads of the item without limit should be allowed")
+		}
+	}
+
+	c.SetWithMaxReads(3, 3, 1)
+	c.Get(3)
+	if v, ok := c.GetOrSet(3, 30); ok || v != 30 {
+		t.Fatalf("the item with exhausted reads should be replaced by get or set, but got %d %v", v, ok)
+	}
+
+	expected := []Event[int, int]{
+		{Type: EventInsert, Key: 1, Value: 1},
+		{Type: EventInsert, Key: 2, Value: 2},
+		{Type: EventExpire, Key: 1, Value: 1},
+		{Type: EventInsert, Key: 3, Value: 3},
+		{Type: EventExpire, Key: 3, Value: 3},
+		{Type: EventInsert, Key: 3, Value: 30},
+	}
+	for _, e := range expected {
+		if got := <-c.Events(); got != e {
+			t.Fatalf("got event %+v, want %+v", got, e)
+		}
+	}
+}
+
+func TestCacheWithVariableTTL_SetAll(t *testing.T) {
+	c, err := MustBuilder[int, int](100).WithVariableTTL().DefaultTTL(time.Hour).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	now := time.Now().Unix()
+	c.SetAll([]Entry[int, int]{
+		NewEntry(1, 1, now+60, 1),
+		NewEntry(2, 2, now-1, 1),
+		NewEntry(3, 3, 0, 1),
+	})
+
+	if e, ok := c.GetEntry(1); !ok || e.TTL() <= 0 || e.TTL() > time.Minute {
+		t.Fatalf("item 1 should have the ttl of the entry, but got %v %v", e.TTL(), ok)
+	}
+	if c.Has(2) {
+		t.Fatal("expired entry shouldn't be stored")
+	}
+	if e, ok := c.GetEntry(3); !ok || e.TTL() <= time.Minute {
+		t.Fatalf("item 3 should have the default ttl, but got %v %v", e.TTL(), ok)
+	}
+
+	withoutDefault, err := MustBuilder[int, int](100).WithVariableTTL().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer withoutDefault.Close()
+
+	withoutDefault.SetAll([]Entry[int, int]{NewEntry(1, 1, 0, 1)})
+	if e, ok := withoutDefault.GetEntry(1); !ok || e.Expiration() != 0 {
+		t.Fatalf("entry without expiration time should never expire without the default ttl, but got %v %v", e.TTL(), ok)
+	}
+}
+
+func TestCacheWithVariableTTL_Apply(t *testing.T) {
+	c, err := MustBuilder[int, int](100).WithVariableTTL().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.Apply([]Mutation[int, int]{
+		{Key: 1, Value: 1, TTL: time.Hour},
+		{Key: 2, Value: 2},
+	})
+
+	if e, ok := c.GetEntry(1); !ok || e.Expiration() == 0 {
+		t.Fatal("item should be set with the mutation ttl")
+	}
+	if e, ok := c.GetEntry(2); !ok || e.Expiration() != 0 {
+		t.Fatal("item without ttl should not expire")
+	}
+}
+
+func TestCache_SetIfVersion(t *testing.T) {
+	c, err := MustBuilder[int, int](100).Versioned().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	if c.SetIfVersion(1, 1, 1) {
+		t.Fatal("set of an absent key should require zero version")
+	}
+	if !c.SetIfVersion(1, 1, 0) {
+		t.Fatal("absent key should be set with zero version")
+	}
+	e, _ := c.GetEntry(1)
+	if e.Version() == 0 {
+		t.Fatal("entry should have a version")
+	}
+	if c.SetIfVersion(1, 2, 0) || c.SetIfVersion(1, 2, e.Version()+1) {
+		t.Fatal("set with a stale version should fail")
+	}
+
+	const (
+		goroutines = 8
+		iterations = 100
+	)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				for {
+					e, _ := c.GetEntry(1)
+					if c.SetIfVersion(1, e.Value()+1, e.Version()) {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, _ := c.GetEntry(1)
+	if got.Value() != 1+goroutines*iterations {
+		t.Fatalf("optimistic updates should not be lost, but got %d", got.Value())
+	}
+	if got.Version() <= e.Version() {
+		t.Fatalf("version should increase, but got %d after %d", got.Version(), e.Version())
+	}
+}
+
+func TestCacheWithVariableTTL_TimerWheel(t *testing.T) {
+	const size = 100
+	c, err := MustBuilder[int, int](size).WithVariableTTL().TimerWheel().SynchronousEviction().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < size; i++ {
+		ttl := time.Second
+		if i%2 == 0 {
+			ttl = time.Hour
+		}
+		c.Set(i, i, ttl)
+	}
+
+	time.Sleep(3 * time.Second)
+	if cacheSize := c.Size(); cacheSize != size/2 {
+		t.Fatalf("items with a short ttl should be removed, but got size %d", cacheSize)
+	}
+	for i := 0; i < size; i += 2 {
+		if !c.Has(i) {
+			t.Fatalf("key should not be expired: %d", i)
+		}
+	}
+}
+
+func TestCache_ExpirationStrategy(t *testing.T) {
+	const size = 10
+	c, err := MustBuilder[int, int](100).
+		WithTTL(time.Second).
+		ExpirationStrategy(ExpireLazily).
+		SynchronousEviction().
+		Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < size; i++ {
+		c.Set(i, i)
+	}
+	time.Sleep(3 * time.Second)
+	if cacheSize := c.Size(); cacheSize != size {
+		t.Fatalf("lazy expiration should not remove items in the background, but got size %d", cacheSize)
+	}
+	if c.Has(0) {
+		t.Fatal("key should be expired: 0")
+	}
+	if cacheSize := c.Size(); cacheSize != size-1 {
+		t.Fatalf("lazy expiration should remove the item on access, but got size %d", cacheSize)
+	}
+
+	_, err = MustBuilder[int, int](100).WithTTL(time.Second).ExpirationStrategy(ExpireLazily).PreciseExpiration().Build()
+	if !errors.Is(err, ErrIllegalExpirationStrategy) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalExpirationStrategy, err)
+	}
+	_, err = MustBuilder[int, int](100).WithVariableTTL().ExpirationStrategy(ExpirationStrategy(10)).Build()
+	if !errors.Is(err, ErrIllegalExpirationStrategy) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalExpirationStrategy, err)
+	}
+}
+
+func TestCache_ExpiredResident(t *testing.T) {
+	c, err := MustBuilder[int, int](100).
+		WithVariableTTL().
+		Cost(func(key int, value int) uint32 {
+			return uint32(value)
+		}).
+		ExpirationStrategy(ExpireLazily).
+		Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.Set(1, 2, time.Second)
+	c.Set(2, 3, time.Second)
+	c.Set(3, 4, time.Hour)
+	if count, cost := c.Stats().ExpiredResident(); count != 0 || cost != 0 {
+		t.Fatalf("there should be no expired items, but got %d with cost %d", count, cost)
+	}
+
+	time.Sleep(3 * time.Second)
+	if count, cost := c.Stats().ExpiredResident(); count != 2 || cost != 5 {
+		t.Fatalf("expired resident items should be 2 with cost 5, but got %d with cost %d", count, cost)
+	}
+
+	c.Has(1)
+	if count, cost := c.Stats().ExpiredResident(); count != 1 || cost != 3 {
+		t.Fatalf("expired resident items should be 1 with cost 3, but got %d with cost %d", count, cost)
+	}
+	if count, cost := (Stats{}).ExpiredResident(); count != 0 || cost != 0 {
+		t.Fatalf("zero stats should report no expired items, but got %d with cost %d", count, cost)
+	}
+}
+
+func TestCache_EstimatedMemoryUsage(t *testing.T) {
+	const (
+		size = 1000
+		cost = 100
+	)
+	c, err := MustBuilder[int, int](size * cost).
+		Cost(func(key int, value int) uint32 {
+			return cost
+		}).
+		Doorkeeper().
+		SynchronousEviction().
+		Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	empty := c.EstimatedMemoryUsage()
+	if empty <= 0 {
+		t.Fatalf("empty cache should use some memory, but got %d", empty)
+	}
+
+	for i := 0; i < size; i++ {
+		c.Set(i, i)
+	}
+	// each item takes at least its cost and a node with the key and the value.
+	if usage := c.EstimatedMemoryUsage(); usage < empty+size*(cost+16) {
+		t.Fatalf("memory usage should grow by at least %d bytes, but got %d -> %d", size*(cost+16), empty, usage)
+	}
+}
+
+func TestCache_MemoryPressure(t *testing.T) {
+	const size = 100
+	var pressured int32
+	c, err := MustBuilder[int, int](size).
+		MemoryPressure(func() bool {
+			return atomic.LoadInt32(&pressured) == 1
+		}).
+		SynchronousEviction().
+		Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < size; i++ {
+		c.Set(i, i)
+	}
+	if c.Size() != size {
+		t.Fatalf("cache should be full, but got size %d", c.Size())
+	}
+
+	atomic.StoreInt32(&pressured, 1)
+	time.Sleep(2500 * time.Millisecond)
+	if c.Size() > size/4 {
+		t.Fatalf("cache should shrink step by step under memory pressure, but got size %d", c.Size())
+	}
+	if c.Capacity() != size {
+		t.Fatalf("capacity should stay %d, but got %d", size, c.Capacity())
+	}
+
+	// the capacity is restored only after the pressure has been gone for a while.
+	atomic.StoreInt32(&pressured, 0)
+	time.Sleep(2 * time.Second)
+	for i := 0; i < size; i++ {
+		c.Set(i, i)
+	}
+	if c.Size() > size/2 {
+		t.Fatalf("cache should not grow back right after the pressure is gone, but got size %d", c.Size())
+	}
+}
+
+func TestCache_AmortizedMaintenance(t *testing.T) {
+	const size = 100
+	before := runtime.NumGoroutine()
+	c, err := MustBuilder[int, int](size).
+		WithTTL(time.Second).
+		AmortizedMaintenance().
+		Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("cache shouldn't start goroutines, but got %d -> %d", before, after)
+	}
+
+	for i := 0; i < 2*size; i++ {
+		c.Set(i, i)
+	}
+	if c.Size() != size {
+		t.Fatalf("writes should be applied by the callers, but got size %d", c.Size())
+	}
+
+	time.Sleep(2500 * time.Millisecond)
+	if _, ok := c.Get(2*size - 1); ok {
+		t.Fatal("item should expire without the background clock")
+	}
+	// the write removes the expired items.
+	c.Set(-1, -1)
+	if c.Size() != 1 {
+		t.Fatalf("expired items should be removed by the callers, but got size %d", c.Size())
+	}
+}
+
+func TestCache_HashTableMigrationGoroutines(t *testing.T) {
+	const size = 1 << 20
+	for _, amortized := range []bool{false, true} {
+		before := runtime.NumGoroutine()
+		b := MustBuilder[int, int](size)
+		if amortized {
+			b = b.AmortizedMaintenance()
+		}
+		c, err := b.Build()
+		if err != nil {
+			t.Fatalf("can not create cache: %v", err)
+		}
+
+		// the cache is closed right after a grow of the large table, while its items are being moved.
+		migrating := false
+		for i := 0; i < size && !migrating; i++ {
+			c.Set(i, i)
+			migrating = i >= size/2 && c.HashTableStatus().Migrating > 0
+		}
+		if !migrating {
+			t.Fatalf("hash table should grow, but got %+v", c.HashTableStatus())
+		}
+		if after := runtime.NumGoroutine(); amortized && after > before {
+			t.Fatalf("migration shouldn't start goroutines in the amortized mode, but got %d -> %d", before, after)
+		}
+
+		c.Close()
+		if after := runtime.NumGoroutine(); after > before {
+			t.Fatalf("close should wait for the migration goroutines (amortized: %v), but got %d -> %d", amortized, before, after)
+		}
+	}
+}
+
+func TestCacheWithVariableTTL_DefaultTTL(t *testing.T) {
+	c, err := MustBuilder[int, int](100).WithVariableTTL().DefaultTTL(time.Hour).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.SetWithDefaultTTL(1, 1)
+	if c.SetIfAbsentWithDefaultTTL(1, 2) || !c.SetIfAbsentWithDefaultTTL(2, 2) {
+		t.Fatal("SetIfAbsentWithDefaultTTL should store only absent keys")
+	}
+	c.Set(3, 3, time.Minute)
+
+	for key, want := range map[int]time.Duration{1: time.Hour, 2: time.Hour, 3: time.Minute} {
+		e, ok := c.GetEntry(key)
+		if !ok {
+			t.Fatalf("key %d should be present", key)
+		}
+		if ttl := e.TTL(); ttl <= want-2*time.Second || ttl > want+time.Second {
+			t.Fatalf("got ttl %v for key %d, want about %v", ttl, key, want)
+		}
+	}
+
+	cc, err := MustBuilder[int, int](100).WithVariableTTL().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer cc.Close()
+
+	cc.SetWithDefaultTTL(1, 1)
+	if e, ok := cc.GetEntry(1); !ok || e.TTL() != -1 {
+		t.Fatalf("item without the default ttl should never expire, but got %+v", e)
+	}
+
+	if _, err := MustBuilder[int, int](100).WithVariableTTL().DefaultTTL(0).Build(); !errors.Is(err, ErrIllegalTTL) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalTTL, err)
+	}
+}
+
+func TestCache_ExpireAfterAccess(t *testing.T) {
+	c, err := MustBuilder[int, int](100).
+		WithTTL(time.Hour).
+		ExpireAfterAccess(time.Second).
+		Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.Set(1, 1)
+	c.Set(2, 2)
+	for i := 0; i < 10; i++ {
+		time.Sleep(300 * time.Millisecond)
+		if _, ok := c.Get(1); !ok {
+			t.Fatal("key 1 is accessed regularly, so it should not expire")
+		}
+	}
+
+	if c.Has(2) {
+		t.Fatal("key 2 should expire because of inactivity")
+	}
+	if e, ok := c.GetEntry(1); !ok || e.TTL() > 2*time.Second {
+		t.Fatalf("entry should expire after the idle timeout, but got %+v", e)
+	}
+
+	_, err = MustBuilder[int, int](100).WithVariableTTL().ExpireAfterAccess(-time.Second).Build()
+	if !errors.Is(err, ErrIllegalTTL) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalTTL, err)
+	}
+}
+
 func TestCache_SetWithTTL(t *testing.T) {
 	size := 256
 	c, err := MustBuilder[int, int](size).
-		InitialCapacity(size).
-		WithTTL(time.Second).
+		InitialCapacity(size).
+		WithTTL(time.Second).
+		Build()
+	if err != nil {
+		t.Fatalf("can not create builder: %v", err)
+	}
+
+	for i := 0; i < size; i++ {
+		c.Set(i, i)
+	}
+
+	time.Sleep(3 * time.Second)
+	for i := 0; i < size; i++ {
+		if c.Has(i) {
+			t.Fatalf("key should be expired: %d", i)
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	if cacheSize := c.Size(); cacheSize != 0 {
+		t.Fatalf("c.Size() = %d, want = %d", cacheSize, 0)
+	}
+
+	cc, err := MustBuilder[int, int](size).WithVariableTTL().CollectStats().Build()
+	if err != nil {
+		t.Fatalf("can not create builder: %v", err)
+	}
+
+	for i := 0; i < size; i++ {
+		cc.Set(i, i, 5*time.Second)
+	}
+
+	time.Sleep(7 * time.Second)
+
+	for i := 0; i < size; i++ {
+		if cc.Has(i) {
+			t.Fatalf("key should be expired: %d", i)
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	if cacheSize := cc.Size(); cacheSize != 0 {
+		t.Fatalf("c.Size() = %d, want = %d", cacheSize, 0)
+	}
+	if misses := cc.Stats().Misses(); misses != int64(size) {
+		t.Fatalf("c.Stats().Misses() = %d, want = %d", misses, size)
+	}
+}
+
+func TestBaseCache_GetAll(t *testing.T) {
+	size := 100
+	c, err := MustBuilder[int, int](size).CollectStats().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	keys := make([]int, 0, size)
+	for i := 0; i < size; i++ {
+		if i%2 == 0 {
+			c.Set(i, i)
+		}
+		keys = append(keys, i)
+	}
+
+	found, missing := c.GetAll(keys)
+	if len(found) != size/2 || len(missing) != size/2 {
+		t.Fatalf("got %d found and %d missing keys, want %d and %d", len(found), len(missing), size/2, size/2)
+	}
+	for k, v := range found {
+		if k%2 != 0 || k != v {
+			t.Fatalf("got unexpected value for key %d: %d", k, v)
+		}
+	}
+	for i, k := range missing {
+		if k != 2*i+1 {
+			t.Fatalf("missing keys should keep the order of the given keys, but got %v", missing)
+		}
+	}
+	if misses := c.Stats().Misses(); misses != int64(size/2) {
+		t.Fatalf("c.Stats().Misses() = %d, want = %d", misses, size/2)
+	}
+
+	found, missing = c.GetAll(keys[:1])
+	if len(found) != 1 || missing != nil {
+		t.Fatalf("got unexpected result for a full hit: %v, %v", found, missing)
+	}
+}
+
+func TestBaseCache_RangeSnapshot(t *testing.T) {
+	size := 100
+	c, err := MustBuilder[int, int](2 * size).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < size; i++ {
+		c.Set(i, i)
+	}
+
+	seen := make(map[int]struct{}, size)
+	c.RangeSnapshot(func(key, value int) bool {
+		if _, ok := seen[key]; ok {
+			t.Fatalf("key %d was observed twice", key)
+		}
+		seen[key] = struct{}{}
+
+		// these changes should not be observed.
+		c.Delete(key)
+		c.Set(key+size, key+size)
+		return true
+	})
+	if len(seen) != size {
+		t.Fatalf("got %d keys, want %d", len(seen), size)
+	}
+	for key := range seen {
+		if key >= size {
+			t.Fatalf("key %d inserted during the iteration was observed", key)
+		}
+	}
+}
+
+func TestBaseCache_GetEntries(t *testing.T) {
+	size := 100
+	c, err := MustBuilder[int, int](size).
+		WithVariableTTL().
+		Cost(func(key int, value int) uint32 {
+			return 1
+		}).
+		CollectStats().
 		Build()
 	if err != nil {
-		t.Fatalf("can not create builder: %v", err)
+		t.Fatalf("can not create cache: %v", err)
 	}
+	defer c.Close()
 
+	keys := make([]int, 0, size)
 	for i := 0; i < size; i++ {
-		c.Set(i, i)
+		if i%2 == 0 {
+			c.Set(i, i, time.Hour)
+		}
+		keys = append(keys, i)
 	}
 
-	time.Sleep(3 * time.Second)
-	for i := 0; i < size; i++ {
-		if c.Has(i) {
-			t.Fatalf("key should be expired: %d", i)
+	entries := c.GetEntries(keys)
+	if len(entries) != size/2 {
+		t.Fatalf("len(entries) = %d, want = %d", len(entries), size/2)
+	}
+	for k, e := range entries {
+		if k%2 != 0 || e.Key() != k || e.Value() != k {
+			t.Fatalf("got unexpected entry for key %d: %+v", k, e)
+		}
+		if ttl := e.TTL(); ttl <= 0 || ttl > time.Hour+time.Second {
+			t.Fatalf("got unexpected ttl for key %d: %v", k, ttl)
+		}
+		if e.Cost() != 1 {
+			t.Fatalf("got unexpected cost for key %d: %d", k, e.Cost())
 		}
 	}
 
-	time.Sleep(10 * time.Millisecond)
+	if hits := c.Stats().Hits(); hits != int64(size/2) {
+		t.Fatalf("c.Stats().Hits() = %d, want = %d", hits, size/2)
+	}
+	if misses := c.Stats().Misses(); misses != int64(size/2) {
+		t.Fatalf("c.Stats().Misses() = %d, want = %d", misses, size/2)
+	}
 
-	if cacheSize := c.Size(); cacheSize != 0 {
-		t.Fatalf("c.Size() = %d, want = %d", cacheSize, 0)
+	if _, ok := c.GetEntry(1); ok {
+		t.Fatal("entry for key 1 shouldn't exist")
+	}
+	e, ok := c.GetEntry(2)
+	if !ok || e.Value() != 2 {
+		t.Fatalf("got unexpected entry for key 2: %+v", e)
 	}
+}
 
-	cc, err := MustBuilder[int, int](size).WithVariableTTL().CollectStats().Build()
+func TestBaseCache_Hottest(t *testing.T) {
+	size := 10
+	c, err := MustBuilder[int, int](size).CollectEntryStats().Build()
 	if err != nil {
-		t.Fatalf("can not create builder: %v", err)
+		t.Fatalf("can not create cache: %v", err)
 	}
+	defer c.Close()
 
 	for i := 0; i < size; i++ {
-		cc.Set(i, i, 5*time.Second)
+		c.Set(i, i)
+		for j := 0; j < i; j++ {
+			c.Get(i)
+		}
 	}
 
-	time.Sleep(7 * time.Second)
+	hottest := c.Hottest(3)
+	if len(hottest) != 3 {
+		t.Fatalf("got %d entries, want 3", len(hottest))
+	}
+	for i, e := range hottest {
+		if want := size - 1 - i; e.Key() != want || e.Hits() != uint32(want) {
+			t.Fatalf("got entry %d with %d hits at position %d, want %d", e.Key(), e.Hits(), i, want)
+		}
+		if since := time.Since(e.LastAccess()); since < 0 || since > 2*time.Second {
+			t.Fatalf("got unexpected last access time: %v", e.LastAccess())
+		}
+	}
+	if e, ok := c.GetEntry(0); !ok || e.Hits() != 1 {
+		t.Fatalf("got %+v for key 0, want 1 hit", e)
+	}
+
+	cc, err := MustBuilder[int, int](size).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer cc.Close()
+
+	cc.Set(1, 1)
+	if e, ok := cc.GetEntry(1); !ok || e.Hits() != 0 || !e.LastAccess().IsZero() {
+		t.Fatalf("entry stats shouldn't be collected, but got %+v", e)
+	}
+	if hottest := cc.Hottest(1); hottest != nil {
+		t.Fatalf("got %v, want nil", hottest)
+	}
+}
+
+func TestBaseCache_Entries(t *testing.T) {
+	size := 10
+	c, err := MustBuilder[int, int](size).
+		WithTTL(time.Hour).
+		Cost(func(key int, value int) uint32 { return 1 }).
+		CollectEntryStats().
+		Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < size/2; i++ {
+		c.Set(i, i)
+	}
+
+	entries := c.Entries()
+	if len(entries) != size/2 {
+		t.Fatalf("got %d entries, want %d", len(entries), size/2)
+	}
+	for _, e := range entries {
+		if e.Value() != e.Key() || e.Cost() != 1 {
+			t.Fatalf("got unexpected entry %+v", e)
+		}
+		if ttl := e.TTL(); ttl <= 0 || ttl > time.Hour {
+			t.Fatalf("got unexpected ttl %v", ttl)
+		}
+		if since := time.Since(e.LastWrite()); since < 0 || since > 2*time.Second {
+			t.Fatalf("got unexpected last write time: %v", e.LastWrite())
+		}
+	}
+
+	cc, err := MustBuilder[int, int](size).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer cc.Close()
+
+	cc.Set(1, 1)
+	if entries := cc.Entries(); len(entries) != 1 || !entries[0].LastWrite().IsZero() {
+		t.Fatalf("last write time shouldn't be recorded without entry stats, but got %+v", entries)
+	}
+}
+
+func TestBaseCache_Sample(t *testing.T) {
+	size := 1000
+	c, err := MustBuilder[int, int](size).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < size/2; i++ {
+		c.Set(i, i)
+	}
+
+	sample := c.Sample(10)
+	if len(sample) != 10 {
+		t.Fatalf("got %d entries, want 10", len(sample))
+	}
+	seen := make(map[int]bool, len(sample))
+	for _, e := range sample {
+		if e.Value() != e.Key() || seen[e.Key()] {
+			t.Fatalf("got unexpected entry %+v", e)
+		}
+		seen[e.Key()] = true
+	}
+
+	if sample := c.Sample(size); len(sample) != size/2 {
+		t.Fatalf("sample larger than the cache should contain all %d entries, but got %d", size/2, len(sample))
+	}
+	if sample := c.Sample(0); sample != nil {
+		t.Fatalf("got %v, want nil", sample)
+	}
+}
+
+func TestBaseCache_TopKeys(t *testing.T) {
+	size := 100
+	c, err := MustBuilder[int, int](size).TrackTopKeys(10).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
 
 	for i := 0; i < size; i++ {
-		if cc.Has(i) {
-			t.Fatalf("key should be expired: %d", i)
+		c.Set(i, i)
+	}
+	for i := 0; i < 1000; i++ {
+		c.Get(1)
+		if i%2 == 0 {
+			c.Get(2)
 		}
+		c.Get(10 + i%size)
 	}
 
-	time.Sleep(10 * time.Millisecond)
+	top := c.TopKeys(2)
+	if len(top) != 2 || top[0].Key != 1 || top[1].Key != 2 || top[0].Count < top[1].Count {
+		t.Fatalf("got unexpected top keys: %+v", top)
+	}
 
-	if cacheSize := cc.Size(); cacheSize != 0 {
-		t.Fatalf("c.Size() = %d, want = %d", cacheSize, 0)
+	c.Clear()
+	if top := c.TopKeys(2); len(top) != 0 {
+		t.Fatalf("top keys should be cleared, but got %+v", top)
 	}
-	if misses := cc.Stats().Misses(); misses != int64(size) {
-		t.Fatalf("c.Stats().Misses() = %d, want = %d", misses, size)
+
+	if _, err := MustBuilder[int, int](size).TrackTopKeys(-1).Build(); !errors.Is(err, ErrIllegalTopKeysCapacity) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalTopKeysCapacity, err)
+	}
+}
+
+func TestBaseCache_DeleteAndGet(t *testing.T) {
+	size := 10
+	c, err := MustBuilder[int, int](size).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.Set(1, 10)
+	if v, ok := c.DeleteAndGet(1); !ok || v != 10 {
+		t.Fatalf("c.DeleteAndGet(1) = %d/%v, want 10/true", v, ok)
+	}
+	if c.Has(1) {
+		t.Fatal("key 1 should be deleted")
+	}
+	if v, ok := c.DeleteAndGet(1); ok || v != 0 {
+		t.Fatalf("c.DeleteAndGet(1) = %d/%v, want 0/false", v, ok)
+	}
+}
+
+func TestBaseCache_IgnoreHasInStats(t *testing.T) {
+	size := 10
+	c, err := MustBuilder[int, int](size).CollectStats().IgnoreHasInStats().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.Set(1, 1)
+	if !c.Has(1) || c.Has(2) {
+		t.Fatal("Has should report the presence of keys")
+	}
+	if hits, misses := c.Stats().Hits(), c.Stats().Misses(); hits != 0 || misses != 0 {
+		t.Fatalf("Has should not affect stats, but got %d hits and %d misses", hits, misses)
+	}
+
+	c.Get(1)
+	c.Get(2)
+	if hits, misses := c.Stats().Hits(), c.Stats().Misses(); hits != 1 || misses != 1 {
+		t.Fatalf("got %d hits and %d misses, want 1 and 1", hits, misses)
+	}
+}
+
+func TestStats_ReadOperations(t *testing.T) {
+	c, err := MustBuilder[int, int](10).CollectStats().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	lc, err := NewLoadingCache[int, int](c, func(ctx context.Context, key int) (int, error) {
+		return key, nil
+	})
+	if err != nil {
+		t.Fatalf("can not create loading cache: %v", err)
+	}
+
+	c.Set(1, 1)
+	c.Get(1)
+	c.Get(2)
+	c.Has(1)
+	c.Has(2)
+	c.Has(3)
+	if _, err := lc.Get(context.Background(), 1); err != nil {
+		t.Fatalf("can not load: %v", err)
+	}
+	c.GetAll([]int{1, 4})
+	c.GetEntries([]int{1})
+	c.GetOrSet(1, 1)
+
+	s := c.Stats()
+	for _, tt := range []struct {
+		op     ReadOperation
+		hits   int64
+		misses int64
+	}{
+		{op: ReadGet, hits: 4, misses: 2},
+		{op: ReadHas, hits: 1, misses: 2},
+		{op: ReadLoad, hits: 1, misses: 0},
+	} {
+		if hits, misses := s.HitsOf(tt.op), s.MissesOf(tt.op); hits != tt.hits || misses != tt.misses {
+			t.Fatalf("operation %d: got %d hits and %d misses, want %d and %d", tt.op, hits, misses, tt.hits, tt.misses)
+		}
+	}
+	if s.Hits() != 6 || s.Misses() != 4 {
+		t.Fatalf("totals should include all operations, but got %d hits and %d misses", s.Hits(), s.Misses())
+	}
+	if ratio := s.RatioOf(ReadHas); ratio < 0.33 || ratio > 0.34 {
+		t.Fatalf("ratio of has should be 1/3, but got %v", ratio)
+	}
+	if ratio := s.RatioOf(ReadGet); ratio < 0.66 || ratio > 0.67 {
+		t.Fatalf("ratio of get should be 2/3, but got %v", ratio)
+	}
+	if ratio := s.Ratio(); ratio != 0.6 {
+		t.Fatalf("ratio should cover all operations, but got %v", ratio)
 	}
 }
 
@@ -211,6 +1655,108 @@ func TestBaseCache_DeleteByFunc(t *testing.T) {
 	})
 }
 
+func TestBaseCache_StableRange(t *testing.T) {
+	size := 256
+	c, err := MustBuilder[int, int](size).StableRange().Build()
+	if err != nil {
+		t.Fatalf("can not create builder: %v", err)
+	}
+	defer c.Close()
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	keys := r.Perm(size / 2)
+	for _, k := range keys {
+		c.Set(k, k)
+	}
+	// update moves the key to the end.
+	c.Set(keys[0], keys[0])
+	keys = append(keys[1:], keys[0])
+
+	for i := 0; i < 3; i++ {
+		j := 0
+		c.Range(func(key int, value int) bool {
+			if key != keys[j] {
+				t.Fatalf("got unexpected key for iteration %d: %d, want: %d", j, key, keys[j])
+			}
+			j++
+			return true
+		})
+		if j != len(keys) {
+			t.Fatalf("got unexpected number of iterations: %d, want: %d", j, len(keys))
+		}
+	}
+}
+
+func TestCache_CollectLatencies(t *testing.T) {
+	size := 100
+	c, err := MustBuilder[int, int](size).CollectLatencies().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < size; i++ {
+		c.Set(i, i)
+		c.Get(i)
+		c.Has(i)
+		c.Delete(i)
+	}
+
+	for name, l := range map[string]Latencies{
+		"get":    c.Stats().GetLatencies(),
+		"set":    c.Stats().SetLatencies(),
+		"delete": c.Stats().DeleteLatencies(),
+		"has":    c.Stats().HasLatencies(),
+	} {
+		if l.P50 <= 0 || l.P50 > l.P95 || l.P95 > l.P99 {
+			t.Fatalf("got unexpected %s latencies: %+v", name, l)
+		}
+	}
+
+	// each operation is recorded under its own latencies.
+	for _, tt := range []struct {
+		name string
+		op   func(c Cache[int, int])
+		got  func(s Stats) Latencies
+	}{
+		{name: "has", op: func(c Cache[int, int]) { c.Has(1) }, got: Stats.HasLatencies},
+		{name: "set with max reads", op: func(c Cache[int, int]) { c.SetWithMaxReads(1, 1, 1) }, got: Stats.SetLatencies},
+		{name: "set if version", op: func(c Cache[int, int]) { c.SetIfVersion(1, 1, 0) }, got: Stats.SetLatencies},
+	} {
+		oc, err := MustBuilder[int, int](size).CollectLatencies().Versioned().Build()
+		if err != nil {
+			t.Fatalf("can not create cache: %v", err)
+		}
+		tt.op(oc)
+		s := oc.Stats()
+		if tt.got(s).P50 <= 0 {
+			t.Fatalf("%s latency should be recorded", tt.name)
+		}
+		all := []Latencies{s.GetLatencies(), s.SetLatencies(), s.DeleteLatencies(), s.HasLatencies()}
+		recorded := 0
+		for _, l := range all {
+			if l.P50 > 0 {
+				recorded++
+			}
+		}
+		if recorded != 1 {
+			t.Fatalf("%s latency should be recorded only under its own operation, but got %+v", tt.name, all)
+		}
+		oc.Close()
+	}
+
+	cc, err := MustBuilder[int, int](size).WithTTL(time.Hour).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer cc.Close()
+
+	cc.Set(1, 1)
+	if l := cc.Stats().SetLatencies(); l != (Latencies{}) {
+		t.Fatalf("latencies shouldn't be collected, but got: %+v", l)
+	}
+}
+
 func TestCache_Ratio(t *testing.T) {
 	c, err := MustBuilder[uint64, uint64](100).CollectStats().Build()
 	if err != nil {
@@ -299,3 +1845,161 @@ func (h *optimalHeap) Pop() any {
 	*h = old[0 : n-1]
 	return x
 }
+
+func TestCache_TrySet(t *testing.T) {
+	c, err := MustBuilder[int, int](100).WriteBackpressure(RejectWrites).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	set, err := c.TrySet(1, 1)
+	if !set || err != nil {
+		t.Fatalf("try set should succeed while the write buffer has free slots, but got %v, %v", set, err)
+	}
+	if v, ok := c.Get(1); !ok || v != 1 {
+		t.Fatalf("item should be set by try set, but got %v, %v", v, ok)
+	}
+}
+
+func TestCache_ZeroValue(t *testing.T) {
+	var c Cache[int, int]
+	c.Close()
+
+	defer func() {
+		r := recover()
+		if err, ok := r.(error); !ok || !errors.Is(err, ErrUninitialized) {
+			t.Fatalf("zero cache should panic with %v, but got %v", ErrUninitialized, r)
+		}
+	}()
+	c.Set(1, 1)
+}
+
+func TestStats_MarshalJSON(t *testing.T) {
+	c, err := MustBuilder[int, int](10).CollectStats().SynchronousEviction().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 100; i++ {
+		c.Set(i, i)
+	}
+	c.Get(99)
+	c.Get(1000)
+
+	s := c.Stats()
+	if s.Evictions() == 0 {
+		t.Fatal("evictions should be counted")
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("can not marshal stats: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("can not unmarshal stats: %v", err)
+	}
+	if got["hits"] != float64(s.Hits()) || got["misses"] != float64(s.Misses()) ||
+		got["evictions"] != float64(s.Evictions()) || got["size"] != float64(s.Size()) {
+		t.Fatalf("unexpected json %s", data)
+	}
+
+	want := fmt.Sprintf("hits=%d misses=%d ratio=%.4f evictions=%d size=%d",
+		s.Hits(), s.Misses(), s.Ratio(), s.Evictions(), s.Size())
+	if s.String() != want {
+		t.Fatalf("s.String() = %q, want %q", s.String(), want)
+	}
+}
+
+func TestStats_Lifetime(t *testing.T) {
+	c, err := MustBuilder[int, int](10).
+		CollectStats().
+		CollectEntryStats().
+		SynchronousEviction().
+		Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 100; i++ {
+		c.Set(i, i)
+		c.Get(i)
+	}
+
+	s := c.Stats()
+	if s.Evictions() == 0 {
+		t.Fatal("evictions should be counted")
+	}
+	// the items were evicted within a second after their creation.
+	if got := s.Lifetime(0.99); got > time.Second {
+		t.Fatalf("lifetime should be at most a second, but got %v", got)
+	}
+	if got := s.LastHitAge(0.99); got > time.Second {
+		t.Fatalf("last hit age should be at most a second, but got %v", got)
+	}
+
+	cc, err := MustBuilder[int, int](10).CollectStats().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer cc.Close()
+
+	if got := cc.Stats().Lifetime(0.5); got != 0 {
+		t.Fatalf("lifetime without entry stats should be 0, but got %v", got)
+	}
+}
+
+func TestCache_HashTableStatus(t *testing.T) {
+	const size = 1000
+	c, err := MustBuilder[int, int](size).
+		InitialCapacity(size).
+		HashTableTuning(0.5, 4).
+		Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < size; i++ {
+		c.Set(i, i)
+	}
+
+	s := c.HashTableStatus()
+	if s.Resizes != 0 || s.LoadFactor != 0.5 || s.GrowthFactor != 4 || s.Load > 0.5 || s.Size != c.EstimatedSize() {
+		t.Fatalf("unexpected hash table status %+v", s)
+	}
+}
+
+func TestCache_Compact(t *testing.T) {
+	const size = 100000
+	c, err := MustBuilder[int, int](size).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < size; i++ {
+		c.Set(i, i)
+	}
+	grown := c.HashTableStatus().BucketCount
+
+	c.DeleteByFunc(func(key, value int) bool {
+		return key%100 != 0
+	})
+
+	s := c.HashTableStatus()
+	if s.BucketCount >= grown/8 || s.Size != size/100 {
+		t.Fatalf("table should be compacted after the mass deletion, but got %+v", s)
+	}
+	if c.Compact() {
+		t.Fatal("compacted table shouldn't be compacted again")
+	}
+	for i := 0; i < size; i += 100 {
+		if !c.Has(i) {
+			t.Fatalf("item %d should be present after compaction", i)
+		}
+	}
+}
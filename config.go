@@ -0,0 +1,285 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"fmt"
+	"time"
+)
+
+// Duration is a time.Duration that is encoded as a string like "1m30s" in text formats such as JSON or YAML.
+type Duration time.Duration
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+var expirationStrategyNames = []string{
+	ExpireLazilyAndProactively: "lazily_and_proactively",
+	ExpireLazily:               "lazily",
+	ExpireProactively:          "proactively",
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (s ExpirationStrategy) MarshalText() ([]byte, error) {
+	if s < 0 || int(s) >= len(expirationStrategyNames) {
+		return nil, fmt.Errorf("otter: unknown expiration strategy %d", int(s))
+	}
+	return []byte(expirationStrategyNames[s]), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (s *ExpirationStrategy) UnmarshalText(text []byte) error {
+	for i, name := range expirationStrategyNames {
+		if name == string(text) {
+			*s = ExpirationStrategy(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("otter: unknown expiration strategy %q", text)
+}
+
+var backpressureNames = []string{
+	BlockWrites:  "block",
+	RejectWrites: "reject",
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (b Backpressure) MarshalText() ([]byte, error) {
+	if b < 0 || int(b) >= len(backpressureNames) {
+		return nil, fmt.Errorf("otter: unknown backpressure mode %d", int(b))
+	}
+	return []byte(backpressureNames[b]), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (b *Backpressure) UnmarshalText(text []byte) error {
+	for i, name := range backpressureNames {
+		if name == string(text) {
+			*b = Backpressure(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("otter: unknown backpressure mode %q", text)
+}
+
+// Config is a declarative cache configuration that can be decoded from files, e.g. in JSON or YAML.
+//
+// Zero values mean the defaults of the corresponding Builder options. Options which depend on the key and value
+// types of the cache or take funcs, e.g. Cost or Admission, can't be decoded and are passed as Option instead.
+//
+// Caches with the variable ttl are created by NewWithVariableTTLFromConfig, which uses DefaultTTL, MinTTL, MaxTTL
+// and TimerWheel instead of TTL.
+type Config struct {
+	Capacity                  int                `json:"capacity" yaml:"capacity"`
+	InitialCapacity           int                `json:"initial_capacity,omitempty" yaml:"initial_capacity,omitempty"`
+	TTL                       Duration           `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	Stats                     bool               `json:"stats,omitempty" yaml:"stats,omitempty"`
+	Latencies                 bool               `json:"latencies,omitempty" yaml:"latencies,omitempty"`
+	MaintenanceRate           int                `json:"maintenance_rate,omitempty" yaml:"maintenance_rate,omitempty"`
+	StableRange               bool               `json:"stable_range,omitempty" yaml:"stable_range,omitempty"`
+	Events                    int                `json:"events,omitempty" yaml:"events,omitempty"`
+	ShardCount                int                `json:"shard_count,omitempty" yaml:"shard_count,omitempty"`
+	NodePooling               bool               `json:"node_pooling,omitempty" yaml:"node_pooling,omitempty"`
+	SynchronousEviction       bool               `json:"synchronous_eviction,omitempty" yaml:"synchronous_eviction,omitempty"`
+	IgnoreHasInStats          bool               `json:"ignore_has_in_stats,omitempty" yaml:"ignore_has_in_stats,omitempty"`
+	EntryStats                bool               `json:"entry_stats,omitempty" yaml:"entry_stats,omitempty"`
+	TopKeys                   int                `json:"top_keys,omitempty" yaml:"top_keys,omitempty"`
+	Doorkeeper                bool               `json:"doorkeeper,omitempty" yaml:"doorkeeper,omitempty"`
+	DoorkeeperResetInterval   int                `json:"doorkeeper_reset_interval,omitempty" yaml:"doorkeeper_reset_interval,omitempty"`
+	SmallQueueRatio           int                `json:"small_queue_ratio,omitempty" yaml:"small_queue_ratio,omitempty"`
+	GhostQueueFactor          float64            `json:"ghost_queue_factor,omitempty" yaml:"ghost_queue_factor,omitempty"`
+	MaxEntryCost              uint32             `json:"max_entry_cost,omitempty" yaml:"max_entry_cost,omitempty"`
+	Versioned                 bool               `json:"versioned,omitempty" yaml:"versioned,omitempty"`
+	ReadBuffers               int                `json:"read_buffers,omitempty" yaml:"read_buffers,omitempty"`
+	ReadBufferCapacity        int                `json:"read_buffer_capacity,omitempty" yaml:"read_buffer_capacity,omitempty"`
+	MinReadBuffers            int                `json:"min_read_buffers,omitempty" yaml:"min_read_buffers,omitempty"`
+	MaxReadBuffers            int                `json:"max_read_buffers,omitempty" yaml:"max_read_buffers,omitempty"`
+	AmortizedMaintenance      bool               `json:"amortized_maintenance,omitempty" yaml:"amortized_maintenance,omitempty"`
+	ParallelGetThreshold      int                `json:"parallel_get_threshold,omitempty" yaml:"parallel_get_threshold,omitempty"`
+	LowWatermark              int                `json:"low_watermark,omitempty" yaml:"low_watermark,omitempty"`
+	HighWatermark             int                `json:"high_watermark,omitempty" yaml:"high_watermark,omitempty"`
+	EvictionBatchSize         int                `json:"eviction_batch_size,omitempty" yaml:"eviction_batch_size,omitempty"`
+	HashTableLoadFactor       float64            `json:"hash_table_load_factor,omitempty" yaml:"hash_table_load_factor,omitempty"`
+	HashTableGrowthFactor     int                `json:"hash_table_growth_factor,omitempty" yaml:"hash_table_growth_factor,omitempty"`
+	WALDir                    string             `json:"wal_dir,omitempty" yaml:"wal_dir,omitempty"`
+	WALCompactionInterval     Duration           `json:"wal_compaction_interval,omitempty" yaml:"wal_compaction_interval,omitempty"`
+	WriteBackpressure         Backpressure       `json:"write_backpressure,omitempty" yaml:"write_backpressure,omitempty"`
+	ExpireAfterAccess         Duration           `json:"expire_after_access,omitempty" yaml:"expire_after_access,omitempty"`
+	AllowStale                Duration           `json:"allow_stale,omitempty" yaml:"allow_stale,omitempty"`
+	EvictSoonestExpiringFirst bool               `json:"evict_soonest_expiring_first,omitempty" yaml:"evict_soonest_expiring_first,omitempty"`
+	ExpirationStrategy        ExpirationStrategy `json:"expiration_strategy,omitempty" yaml:"expiration_strategy,omitempty"`
+	PreciseExpiration         bool               `json:"precise_expiration,omitempty" yaml:"precise_expiration,omitempty"`
+	DefaultTTL                Duration           `json:"default_ttl,omitempty" yaml:"default_ttl,omitempty"`
+	MinTTL                    Duration           `json:"min_ttl,omitempty" yaml:"min_ttl,omitempty"`
+	MaxTTL                    Duration           `json:"max_ttl,omitempty" yaml:"max_ttl,omitempty"`
+	TimerWheel                bool               `json:"timer_wheel,omitempty" yaml:"timer_wheel,omitempty"`
+}
+
+// Options returns the options corresponding to the configuration, except for the capacity.
+func (c Config) Options() []Option {
+	var opts []Option
+	if c.InitialCapacity != 0 {
+		opts = append(opts, WithInitialCapacity(c.InitialCapacity))
+	}
+	if c.TTL != 0 {
+		opts = append(opts, WithTTL(time.Duration(c.TTL)))
+	}
+	if c.Stats {
+		opts = append(opts, WithStats())
+	}
+	if c.Latencies {
+		opts = append(opts, WithLatencies())
+	}
+	if c.MaintenanceRate != 0 {
+		opts = append(opts, WithMaintenanceRate(c.MaintenanceRate))
+	}
+	if c.StableRange {
+		opts = append(opts, WithStableRange())
+	}
+	if c.Events != 0 {
+		opts = append(opts, WithEvents(c.Events))
+	}
+	if c.ShardCount != 0 {
+		opts = append(opts, WithShardCount(c.ShardCount))
+	}
+	if c.NodePooling {
+		opts = append(opts, WithNodePooling())
+	}
+	if c.SynchronousEviction {
+		opts = append(opts, WithSynchronousEviction())
+	}
+	if c.IgnoreHasInStats {
+		opts = append(opts, WithIgnoreHasInStats())
+	}
+	if c.EntryStats {
+		opts = append(opts, WithEntryStats())
+	}
+	if c.TopKeys != 0 {
+		opts = append(opts, WithTopKeys(c.TopKeys))
+	}
+	if c.Doorkeeper {
+		opts = append(opts, WithDoorkeeper())
+	}
+	if c.DoorkeeperResetInterval != 0 {
+		opts = append(opts, WithDoorkeeperResetInterval(c.DoorkeeperResetInterval))
+	}
+	if c.SmallQueueRatio != 0 {
+		opts = append(opts, WithSmallQueueRatio(c.SmallQueueRatio))
+	}
+	if c.GhostQueueFactor != 0 {
+		opts = append(opts, WithGhostQueueFactor(c.GhostQueueFactor))
+	}
+	if c.MaxEntryCost != 0 {
+		opts = append(opts, WithMaxEntryCost(c.MaxEntryCost))
+	}
+	if c.Versioned {
+		opts = append(opts, WithVersions())
+	}
+	if c.ReadBuffers != 0 || c.ReadBufferCapacity != 0 {
+		opts = append(opts, WithReadBuffers(c.ReadBuffers, c.ReadBufferCapacity))
+	}
+	if c.MinReadBuffers != 0 || c.MaxReadBuffers != 0 {
+		opts = append(opts, WithReadBufferScaling(c.MinReadBuffers, c.MaxReadBuffers))
+	}
+	if c.AmortizedMaintenance {
+		opts = append(opts, WithAmortizedMaintenance())
+	}
+	if c.ParallelGetThreshold != 0 {
+		opts = append(opts, WithParallelGetThreshold(c.ParallelGetThreshold))
+	}
+	if c.LowWatermark != 0 || c.HighWatermark != 0 {
+		opts = append(opts, WithEvictionWatermarks(c.LowWatermark, c.HighWatermark))
+	}
+	if c.EvictionBatchSize != 0 {
+		opts = append(opts, WithEvictionBatchSize(c.EvictionBatchSize))
+	}
+	if c.HashTableLoadFactor != 0 || c.HashTableGrowthFactor != 0 {
+		opts = append(opts, WithHashTableTuning(c.HashTableLoadFactor, c.HashTableGrowthFactor))
+	}
+	if c.WALDir != "" || c.WALCompactionInterval != 0 {
+		opts = append(opts, WithWAL(c.WALDir, time.Duration(c.WALCompactionInterval)))
+	}
+	if c.WriteBackpressure != BlockWrites {
+		opts = append(opts, WithWriteBackpressure(c.WriteBackpressure))
+	}
+	if c.ExpireAfterAccess != 0 {
+		opts = append(opts, WithExpireAfterAccess(time.Duration(c.ExpireAfterAccess)))
+	}
+	if c.AllowStale != 0 {
+		opts = append(opts, WithAllowStale(time.Duration(c.AllowStale)))
+	}
+	if c.EvictSoonestExpiringFirst {
+		opts = append(opts, WithEvictSoonestExpiringFirst())
+	}
+	if c.ExpirationStrategy != ExpireLazilyAndProactively {
+		opts = append(opts, WithExpirationStrategy(c.ExpirationStrategy))
+	}
+	if c.PreciseExpiration {
+		opts = append(opts, WithPreciseExpiration())
+	}
+	if c.DefaultTTL != 0 {
+		opts = append(opts, WithDefaultTTL(time.Duration(c.DefaultTTL)))
+	}
+	if c.MinTTL != 0 {
+		opts = append(opts, WithMinTTL(time.Duration(c.MinTTL)))
+	}
+	if c.MaxTTL != 0 {
+		opts = append(opts, WithMaxTTL(time.Duration(c.MaxTTL)))
+	}
+	if c.TimerWheel {
+		opts = append(opts, WithTimerWheel())
+	}
+	return opts
+}
+
+// NewFromConfig creates a cache configured by c. The given options are applied after the configuration,
+// so they can set what can't be decoded from files, e.g. WithCost or WithJournal.
+//
+// Returns an error if invalid parameters were passed.
+func NewFromConfig[K comparable, V any](c Config, opts ...Option) (Cache[K, V], error) {
+	return New[K, V](c.Capacity, append(c.Options(), opts...)...)
+}
+
+// NewWithVariableTTLFromConfig creates a cache with the variable ttl configured by c.
+// The given options are applied after the configuration.
+//
+// Returns an error if invalid parameters were passed.
+func NewWithVariableTTLFromConfig[K comparable, V any](c Config, opts ...Option) (CacheWithVariableTTL[K, V], error) {
+	return NewWithVariableTTL[K, V](c.Capacity, append(c.Options(), opts...)...)
+}
+
+// BuilderFromConfig creates a builder configured by c and the given options,
+// so the configuration can be extended by the builder methods before Build.
+//
+// The ttl selects the type of the builder, so it's left to the caller: if c.TTL is set,
+// call WithTTL(time.Duration(c.TTL)) on the returned builder, and call WithVariableTTL to use
+// the variable ttl settings of c. The other expiration settings of c are kept by both.
+//
+// Returns an error if invalid parameters were passed.
+func BuilderFromConfig[K comparable, V any](c Config, opts ...Option) (*Builder[K, V], error) {
+	return newBuilderWithOptions[K, V](c.Capacity, applyOptions(append(c.Options(), opts...)))
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import "fmt"
+
+// ConfigError describes an invalid parameter of the cache configuration.
+//
+// It matches the corresponding sentinel error such as ErrIllegalCapacity via errors.Is,
+// while Field and Value tell exactly which parameter was invalid.
+type ConfigError struct {
+	// Field is the name of the builder option or the function which got the invalid parameter, e.g. "MaxEntryCost".
+	Field string
+	// Value is the invalid value. Options with several parameters report all of them as a slice.
+	Value any
+	// Reason explains why the value is invalid.
+	Reason string
+
+	err error
+}
+
+func newConfigError(field string, value any, err error) *ConfigError {
+	return &ConfigError{
+		Field:  field,
+		Value:  value,
+		Reason: err.Error(),
+		err:    err,
+	}
+}
+
+// Error implements the error interface.
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s(%v): %s", e.Field, e.Value, e.Reason)
+}
+
+// Unwrap returns the sentinel error describing the reason.
+func (e *ConfigError) Unwrap() error {
+	return e.err
+}
+
+// typeName returns the name of the type used as the invalid value of the options restricted to some types.
+func typeName[T any]() string {
+	var zero T
+	return fmt.Sprintf("%T", zero)
+}
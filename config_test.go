@@ -0,0 +1,206 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfig_JSON(t *testing.T) {
+	data := []byte(`{"capacity": 100, "ttl": "1m30s", "stats": true, "shard_count": 4}`)
+
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatalf("failed to decode config: %v", err)
+	}
+	want := Config{Capacity: 100, TTL: Duration(90 * time.Second), Stats: true, ShardCount: 4}
+	if c != want {
+		t.Fatalf("got %+v, want %+v", c, want)
+	}
+
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("failed to encode config: %v", err)
+	}
+	var decoded Config
+	if err := json.Unmarshal(encoded, &decoded); err != nil || decoded != c {
+		t.Fatalf("config should survive a round trip, but got %+v (%v)", decoded, err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"ttl": "soon"}`), &c); err == nil {
+		t.Fatal("invalid duration should not be decoded")
+	}
+}
+
+func TestConfig_JSONEnums(t *testing.T) {
+	data := []byte(`{"capacity": 100, "expiration_strategy": "lazily", "write_backpressure": "reject"}`)
+
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatalf("failed to decode config: %v", err)
+	}
+	if c.ExpirationStrategy != ExpireLazily || c.WriteBackpressure != RejectWrites {
+		t.Fatalf("got unexpected enums: %v, %v", c.ExpirationStrategy, c.WriteBackpressure)
+	}
+
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("failed to encode config: %v", err)
+	}
+	var decoded Config
+	if err := json.Unmarshal(encoded, &decoded); err != nil || decoded != c {
+		t.Fatalf("config should survive a round trip, but got %+v (%v)", decoded, err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"write_backpressure": "drop"}`), &c); err == nil {
+		t.Fatal("unknown backpressure mode should not be decoded")
+	}
+	if _, err := json.Marshal(Config{ExpirationStrategy: 42}); err == nil {
+		t.Fatal("unknown expiration strategy should not be encoded")
+	}
+}
+
+func TestConfig_Coverage(t *testing.T) {
+	// the options which depend on the key and value types or take funcs can't be decoded,
+	// and the variable ttl is selected by NewWithVariableTTLFromConfig.
+	skipped := map[string]bool{
+		"Cost":              true,
+		"CostByLen":         true,
+		"CostAwareEviction": true,
+		"Admission":         true,
+		"SharedAdmission":   true,
+		"Journal":           true,
+		"MemoryPressure":    true,
+		"WithLogger":        true,
+		"WeakValues":        true,
+		"InternKeys":        true,
+		"WithVariableTTL":   true,
+	}
+	// the fields which aren't named after the option, the first one for the options with several parameters.
+	fields := map[string]string{
+		"CollectStats":       "Stats",
+		"CollectLatencies":   "Latencies",
+		"CollectEntryStats":  "EntryStats",
+		"TrackTopKeys":       "TopKeys",
+		"WithTTL":            "TTL",
+		"ScaleReadBuffers":   "MinReadBuffers",
+		"EvictionWatermarks": "LowWatermark",
+		"HashTableTuning":    "HashTableLoadFactor",
+		"WAL":                "WALDir",
+	}
+
+	typ := reflect.TypeOf(Config{})
+	for name := range builderOptionNames() {
+		if skipped[name] {
+			continue
+		}
+		want, ok := fields[name]
+		if !ok {
+			want = name
+		}
+		if _, ok := typ.FieldByName(want); !ok {
+			t.Errorf("builder option %s has no Config field %s", name, want)
+		}
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	cache, err := NewFromConfig[int, int](Config{
+		Capacity: 100,
+		TTL:      Duration(time.Hour),
+		Stats:    true,
+	})
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer cache.Close()
+
+	cache.Set(1, 1)
+	e, ok := cache.GetEntry(1)
+	if !ok || e.TTL() <= 0 {
+		t.Fatalf("got unexpected entry: %+v, %v", e, ok)
+	}
+	if hits := cache.Stats().Hits(); hits != 1 {
+		t.Fatalf("cache.Stats().Hits() = %d, want = 1", hits)
+	}
+
+	if _, err := NewFromConfig[int, int](Config{}); !errors.Is(err, ErrIllegalCapacity) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalCapacity, err)
+	}
+}
+
+func TestNewWithVariableTTLFromConfig(t *testing.T) {
+	cache, err := NewWithVariableTTLFromConfig[int, int](Config{
+		Capacity:   100,
+		DefaultTTL: Duration(time.Hour),
+		TimerWheel: true,
+	})
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer cache.Close()
+
+	cache.SetWithDefaultTTL(1, 1)
+	e, ok := cache.GetEntry(1)
+	if !ok || e.TTL() <= 0 || e.TTL() > time.Hour {
+		t.Fatalf("got unexpected entry: %+v, %v", e, ok)
+	}
+
+	if _, err := NewFromConfig[int, int](Config{Capacity: 100, TimerWheel: true}); !errors.Is(err, ErrMismatchedExpiration) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrMismatchedExpiration, err)
+	}
+}
+
+func TestBuilderFromConfig(t *testing.T) {
+	c := Config{
+		Capacity:          100,
+		TTL:               Duration(time.Hour),
+		ExpireAfterAccess: Duration(time.Minute),
+		Stats:             true,
+	}
+	b, err := BuilderFromConfig[int, int](c)
+	if err != nil {
+		t.Fatalf("can not create builder: %v", err)
+	}
+	// the access ttl needs the ttl applied by the caller.
+	if err := b.Validate(); !errors.Is(err, ErrMismatchedExpiration) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrMismatchedExpiration, err)
+	}
+
+	cache, err := b.Cost(func(key int, value int) uint32 {
+		return 2
+	}).WithTTL(time.Duration(c.TTL)).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer cache.Close()
+
+	cache.Set(1, 1)
+	e, ok := cache.GetEntry(1)
+	if !ok || e.Cost() != 2 || e.TTL() <= 0 || e.TTL() > time.Minute {
+		t.Fatalf("got unexpected entry: %+v, %v", e, ok)
+	}
+	if hits := cache.Stats().Hits(); hits != 1 {
+		t.Fatalf("cache.Stats().Hits() = %d, want = 1", hits)
+	}
+
+	if _, err := BuilderFromConfig[int, int](Config{}); !errors.Is(err, ErrIllegalCapacity) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalCapacity, err)
+	}
+}
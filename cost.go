@@ -0,0 +1,55 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import "math"
+
+// costByLen returns the cost function using the length of the value and optionally of the key.
+// It reports false if the value isn't a string or a []byte, or the key isn't a string when it is counted.
+func costByLen[K comparable, V any](withKeys bool) (func(key K, value V) uint32, bool) {
+	var (
+		zeroKey   K
+		zeroValue V
+	)
+	switch any(zeroValue).(type) {
+	case string, []byte:
+	default:
+		return nil, false
+	}
+	if _, ok := any(zeroKey).(string); withKeys && !ok {
+		return nil, false
+	}
+
+	return func(key K, value V) uint32 {
+		var size int
+		switch v := any(value).(type) {
+		case string:
+			size = len(v)
+		case []byte:
+			size = len(v)
+		}
+		if withKeys {
+			size += len(any(key).(string))
+		}
+
+		if size < 1 {
+			return 1
+		}
+		if uint64(size) > math.MaxUint32 {
+			return math.MaxUint32
+		}
+		return uint32(size)
+	}, true
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache_CostByLen(t *testing.T) {
+	c, err := MustBuilder[string, string](100).CostByLen(false).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.Set("a", "hello")
+	c.Set("b", "")
+	if e, ok := c.GetEntry("a"); !ok || e.Cost() != 5 {
+		t.Fatalf("cost should be the length of the value, but got %d %v", e.Cost(), ok)
+	}
+	if e, ok := c.GetEntry("b"); !ok || e.Cost() != 1 {
+		t.Fatalf("empty value should cost 1, but got %d %v", e.Cost(), ok)
+	}
+
+	bc, err := MustBuilder[string, []byte](100).WithTTL(time.Hour).CostByLen(true).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer bc.Close()
+
+	bc.Set("key", []byte("value"))
+	if e, ok := bc.GetEntry("key"); !ok || e.Cost() != 8 {
+		t.Fatalf("cost should be the length of the key and the value, but got %d %v", e.Cost(), ok)
+	}
+}
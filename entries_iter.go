@@ -0,0 +1,35 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.23
+
+package otter
+
+import (
+	"iter"
+
+	"github.com/maypok86/otter/internal/node"
+)
+
+// EntriesWhere returns an iterator over the entries of the items whose keys match pred.
+//
+// The entries are built only for the matching keys, so a cheap key predicate lets scans over large caches
+// skip the other items. The iteration is weakly consistent like Range, but ignores the StableRange order.
+func (bs baseCache[K, V]) EntriesWhere(pred func(key K) bool) iter.Seq[Entry[K, V]] {
+	return func(yield func(Entry[K, V]) bool) {
+		bs.core().RangeWhere(pred, func(n *node.Node[K, V]) bool {
+			return yield(newEntry(n))
+		})
+	}
+}
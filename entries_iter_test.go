@@ -0,0 +1,57 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.23
+
+package otter
+
+import (
+	"testing"
+)
+
+func TestCache_EntriesWhere(t *testing.T) {
+	c, err := MustBuilder[int, int](100).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 50; i++ {
+		c.Set(i, 2*i)
+	}
+
+	got := make(map[int]int)
+	for e := range c.EntriesWhere(func(key int) bool { return key < 10 }) {
+		got[e.Key()] = e.Value()
+	}
+	if len(got) != 10 {
+		t.Fatalf("10 entries should match the predicate, but got %d", len(got))
+	}
+	for k, v := range got {
+		if k >= 10 || v != 2*k {
+			t.Fatalf("unexpected entry %d: %d", k, v)
+		}
+	}
+
+	n := 0
+	for range c.EntriesWhere(func(int) bool { return true }) {
+		n++
+		if n == 5 {
+			break
+		}
+	}
+	if n != 5 {
+		t.Fatalf("iteration should stop on break, but got %d entries", n)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"time"
+
+	"github.com/maypok86/otter/internal/node"
+	"github.com/maypok86/otter/internal/unixtime"
+)
+
+// Entry is a key-value pair that may include policy metadata for the cached entry.
+//
+// It is an immutable snapshot of the cached data at the time of this entry's creation, and it will not reflect changes afterward.
+type Entry[K comparable, V any] struct {
+	key        K
+	value      V
+	expiration int64
+	lastAccess int64
+	lastWrite  int64
+	version    uint64
+	cost       uint32
+	hits       uint32
+}
+
+func newEntry[K comparable, V any](n *node.Node[K, V]) Entry[K, V] {
+	// the item expires when either the write or the access deadline passes.
+	deadline := n.Expiration()
+	if accessExpiration := n.AccessExpiration(); accessExpiration > 0 && (deadline == 0 || accessExpiration < deadline) {
+		deadline = accessExpiration
+	}
+
+	var expiration int64
+	if deadline > 0 {
+		expiration = unixtime.StartTime() + int64(deadline)
+	}
+
+	var lastAccess int64
+	hits := n.Hits()
+	if hits > 0 {
+		lastAccess = unixtime.StartTime() + int64(n.LastAccess())
+	}
+
+	var lastWrite int64
+	if written, ok := n.LastWrite(); ok {
+		lastWrite = unixtime.StartTime() + int64(written)
+	}
+
+	return Entry[K, V]{
+		key:        n.Key(),
+		value:      n.Value(),
+		expiration: expiration,
+		lastAccess: lastAccess,
+		lastWrite:  lastWrite,
+		version:    n.Sequence(),
+		cost:       n.Cost(),
+		hits:       hits,
+	}
+}
+
+// NewEntry creates an entry with the given expiration time as a unix time in seconds, 0 means no expiration.
+//
+// Caches create entries themselves, so it is mostly useful for fake implementations of Interface.
+func NewEntry[K comparable, V any](key K, value V, expiration int64, cost uint32) Entry[K, V] {
+	return Entry[K, V]{
+		key:        key,
+		value:      value,
+		expiration: expiration,
+		cost:       cost,
+	}
+}
+
+// Key returns the entry's key.
+func (e Entry[K, V]) Key() K {
+	return e.key
+}
+
+// Value returns the entry's value.
+func (e Entry[K, V]) Value() V {
+	return e.value
+}
+
+// Expiration returns the entry's expiration time as a unix time,
+// the number of seconds elapsed since January 1, 1970 UTC.
+//
+// If the entry has no expiration time, then this value is always 0.
+func (e Entry[K, V]) Expiration() int64 {
+	return e.expiration
+}
+
+// TTL returns the entry's ttl.
+//
+// If the entry has no expiration time, then this value is always -1.
+//
+// If the entry is expired, then this value is always 0.
+func (e Entry[K, V]) TTL() time.Duration {
+	if e.expiration == 0 {
+		return -1
+	}
+
+	now := time.Now().Unix()
+	if e.expiration <= now {
+		return 0
+	}
+
+	return time.Duration(e.expiration-now) * time.Second
+}
+
+// HasExpired returns true if the entry has expired.
+func (e Entry[K, V]) HasExpired() bool {
+	if e.expiration == 0 {
+		return false
+	}
+
+	return e.expiration <= time.Now().Unix()
+}
+
+// Cost returns the entry's cost.
+func (e Entry[K, V]) Cost() uint32 {
+	return e.cost
+}
+
+// Hits returns the number of times the entry has been read.
+//
+// It is always zero if the cache has been built without CollectEntryStats.
+func (e Entry[K, V]) Hits() uint32 {
+	return e.hits
+}
+
+// Version returns the version of the entry's item, which increases with every write to the cache.
+//
+// It is always zero if the cache has been built without Versioned.
+func (e Entry[K, V]) Version() uint64 {
+	return e.version
+}
+
+// LastWrite returns the time of the write which stored the entry's value with a one-second precision.
+//
+// It returns the zero time if the cache has been built without CollectEntryStats.
+func (e Entry[K, V]) LastWrite() time.Time {
+	if e.lastWrite == 0 {
+		return time.Time{}
+	}
+	return time.Unix(e.lastWrite, 0)
+}
+
+// LastAccess returns the time of the entry's most recent read with a one-second precision.
+//
+// It returns the zero time if the entry has never been read or the cache has been built without CollectEntryStats.
+func (e Entry[K, V]) LastAccess() time.Time {
+	if e.lastAccess == 0 {
+		return time.Time{}
+	}
+	return time.Unix(e.lastAccess, 0)
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/maypok86/otter/internal/core"
+	"github.com/maypok86/otter/internal/node"
+)
+
+// EventType is the type of change of the cache contents.
+type EventType uint8
+
+const (
+	// EventInsert means that a new item was added to the cache.
+	EventInsert EventType = iota + 1
+	// EventUpdate means that the value of an existing item was replaced.
+	EventUpdate
+	// EventDelete means that an item was removed by the user.
+	EventDelete
+	// EventEvict means that an item was removed by the eviction policy.
+	EventEvict
+	// EventExpire means that an item was removed because its ttl had expired.
+	EventExpire
+	// EventClear means that an item was removed by Clear with the WithClearEvents option.
+	EventClear
+)
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventInsert:
+		return "Insert"
+	case EventUpdate:
+		return "Update"
+	case EventDelete:
+		return "Delete"
+	case EventEvict:
+		return "Evict"
+	case EventExpire:
+		return "Expire"
+	case EventClear:
+		return "Clear"
+	default:
+		return fmt.Sprintf("EventType(%d)", uint8(t))
+	}
+}
+
+// Event is a change of the cache contents.
+//
+// For EventInsert and EventUpdate events Value is the new value,
+// for the other events Value is the removed value.
+type Event[K comparable, V any] struct {
+	Type  EventType
+	Key   K
+	Value V
+}
+
+type eventStream[K comparable, V any] struct {
+	mutex  sync.RWMutex
+	events chan Event[K, V]
+	closed bool
+}
+
+func newEventStream[K comparable, V any](capacity int) *eventStream[K, V] {
+	return &eventStream[K, V]{
+		events: make(chan Event[K, V], capacity),
+	}
+}
+
+func (s *eventStream[K, V]) emit(kind core.EventKind, n *node.Node[K, V]) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.closed {
+		return true
+	}
+
+	select {
+	case s.events <- Event[K, V]{Type: EventType(kind), Key: n.Key(), Value: n.Value()}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *eventStream[K, V]) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache_Events(t *testing.T) {
+	c, err := MustBuilder[int, int](100).Events(16).CollectStats().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+
+	c.Set(1, 1)
+	c.Set(1, 2)
+	c.SetIfAbsent(2, 2)
+	c.Delete(1)
+	c.Delete(3)
+	c.DeleteByFunc(func(key int, value int) bool {
+		return key == 2
+	})
+
+	expected := []Event[int, int]{
+		{Type: EventInsert, Key: 1, Value: 1},
+		{Type: EventUpdate, Key: 1, Value: 2},
+		{Type: EventInsert, Key: 2, Value: 2},
+		{Type: EventDelete, Key: 1, Value: 2},
+		{Type: EventDelete, Key: 2, Value: 2},
+	}
+	for i, e := range expected {
+		select {
+		case got := <-c.Events():
+			if got != e {
+				t.Fatalf("got unexpected event %d: %+v, want: %+v", i, got, e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d wasn't emitted: %+v", i, e)
+		}
+	}
+
+	c.Close()
+	if _, ok := <-c.Events(); ok {
+		t.Fatal("events channel should be closed")
+	}
+}
+
+func TestCache_EventsDropped(t *testing.T) {
+	c, err := MustBuilder[int, int](100).Events(1).CollectStats().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.Set(1, 1)
+	c.Set(2, 2)
+	if dropped := c.Stats().DroppedEvents(); dropped != 1 {
+		t.Fatalf("c.Stats().DroppedEvents() = %d, want = %d", dropped, 1)
+	}
+
+	cc, err := MustBuilder[int, int](100).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer cc.Close()
+
+	if cc.Events() != nil {
+		t.Fatal("events shouldn't be emitted by default")
+	}
+}
+
+func TestEventType_String(t *testing.T) {
+	for typ, expected := range map[EventType]string{
+		EventInsert:    "Insert",
+		EventUpdate:    "Update",
+		EventDelete:    "Delete",
+		EventEvict:     "Evict",
+		EventExpire:    "Expire",
+		EventType(100): "EventType(100)",
+	} {
+		if got := typ.String(); got != expected {
+			t.Fatalf("got unexpected string: %s, want: %s", got, expected)
+		}
+	}
+}
+
+func TestCache_ClearEvents(t *testing.T) {
+	c, err := MustBuilder[int, int](100).Events(16).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.Set(1, 1)
+	c.Set(2, 2)
+	<-c.Events()
+	<-c.Events()
+
+	c.Clear()
+	c.Set(3, 3)
+	if got := <-c.Events(); got.Type != EventInsert {
+		t.Fatalf("Clear without options should not publish events, but got %+v", got)
+	}
+
+	select {
+	case <-c.ClearAsync(WithClearEvents()):
+	case <-time.After(time.Second):
+		t.Fatal("ClearAsync should complete")
+	}
+	if c.Size() != 0 {
+		t.Fatalf("cache should be empty, but got size %d", c.Size())
+	}
+	if got := <-c.Events(); got != (Event[int, int]{Type: EventClear, Key: 3, Value: 3}) {
+		t.Fatalf("got unexpected event %+v", got)
+	}
+	if got := EventClear.String(); got != "Clear" {
+		t.Fatalf("got %s, want Clear", got)
+	}
+}
+
+func TestCache_PreciseExpirationEvents(t *testing.T) {
+	c, err := MustBuilder[int, int](100).WithTTL(time.Second).PreciseExpiration().Events(16).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	// a single write doesn't fill up the write buffer batch.
+	c.Set(1, 1)
+	if got := <-c.Events(); got.Type != EventInsert {
+		t.Fatalf("got unexpected event: %+v", got)
+	}
+
+	select {
+	case got := <-c.Events():
+		if got != (Event[int, int]{Type: EventExpire, Key: 1, Value: 1}) {
+			t.Fatalf("got unexpected event: %+v", got)
+		}
+	case <-time.After(4 * time.Second):
+		t.Fatal("expire event should be emitted without reading the item")
+	}
+}
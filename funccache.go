@@ -0,0 +1,241 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/maypok86/otter/internal/xmath"
+	"github.com/maypok86/otter/internal/xruntime"
+)
+
+var (
+	// ErrNilKeyFunc means that a nil hash or equals func has been passed to the NewFunc.
+	ErrNilKeyFunc = errors.New("hash and equals funcs should not be nil")
+	// ErrIllegalFuncOption means that WithWAL has been passed to the NewFunc,
+	// the wal can't persist the buckets of the keys with the same hash.
+	ErrIllegalFuncOption = errors.New("option is not supported by the func cache")
+)
+
+type funcEntry[K any, V any] struct {
+	key   K
+	value V
+}
+
+// FuncCache is a cache for keys that are not comparable, e.g. slices, maps or protobuf messages.
+// Keys are compared using the hash and equals functions passed to NewFunc.
+//
+// Items are stored in buckets by key hash, so keys with colliding hashes share the capacity, the ttl
+// and the eviction decisions. With a good 64-bit hash collisions are extremely rare.
+type FuncCache[K any, V any] struct {
+	cache  Cache[uint64, []funcEntry[K, V]]
+	hash   func(key K) uint64
+	equals func(a, b K) bool
+	locks  []sync.Mutex
+	mask   uint64
+}
+
+// NewFunc creates a cache for keys that are not comparable with the given capacity configured by the given options.
+//
+// WithCost must be given a func(key K, value V) uint32, WithEvents and WithJournal are not supported and ignored.
+// WithWAL is not supported and makes NewFunc return ErrIllegalFuncOption.
+// The capacity limits the number of distinct key hashes.
+//
+// Returns an error if invalid parameters were passed.
+func NewFunc[K any, V any](
+	capacity int,
+	hash func(key K) uint64,
+	equals func(a, b K) bool,
+	opts ...Option,
+) (FuncCache[K, V], error) {
+	if hash == nil {
+		return FuncCache[K, V]{}, newConfigError("NewFunc", "hash", ErrNilKeyFunc)
+	}
+	if equals == nil {
+		return FuncCache[K, V]{}, newConfigError("NewFunc", "equals", ErrNilKeyFunc)
+	}
+
+	o := applyOptions(opts)
+	if o.withWAL {
+		return FuncCache[K, V]{}, newConfigError("WithWAL", o.walDir, ErrIllegalFuncOption)
+	}
+	o.eventsCapacity = 0
+	o.journal = nil
+	if o.costFunc != nil {
+		costFunc, ok := o.costFunc.(func(key K, value V) uint32)
+		if !ok {
+			return FuncCache[K, V]{}, newConfigError("WithCost", fmt.Sprintf("%T", o.costFunc), ErrMismatchedCostFunc)
+		}
+		o.costFunc = func(_ uint64, bucket []funcEntry[K, V]) uint32 {
+			var cost uint32
+			for _, e := range bucket {
+				cost += costFunc(e.key, e.value)
+			}
+			return cost
+		}
+	}
+
+	c, err := newWithOptions[uint64, []funcEntry[K, V]](capacity, o)
+	if err != nil {
+		return FuncCache[K, V]{}, err
+	}
+
+	locksCount := 4 * xmath.RoundUpPowerOf2(xruntime.Parallelism())
+	return FuncCache[K, V]{
+		cache:  c,
+		hash:   hash,
+		equals: equals,
+		locks:  make([]sync.Mutex, locksCount),
+		mask:   uint64(locksCount - 1),
+	}, nil
+}
+
+func (c FuncCache[K, V]) lock(h uint64) *sync.Mutex {
+	m := &c.locks[h&c.mask]
+	m.Lock()
+	return m
+}
+
+func (c FuncCache[K, V]) find(bucket []funcEntry[K, V], key K) int {
+	for i, e := range bucket {
+		if c.equals(e.key, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Has checks if there is an item with the given key in the cache.
+func (c FuncCache[K, V]) Has(key K) bool {
+	_, ok := c.Get(key)
+	return ok
+}
+
+// Get returns the value associated with the key in this cache.
+func (c FuncCache[K, V]) Get(key K) (V, bool) {
+	bucket, ok := c.cache.Get(c.hash(key))
+	if ok {
+		if i := c.find(bucket, key); i >= 0 {
+			return bucket[i].value, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// Set associates the value with the key in this cache.
+//
+// If it returns false, then the key-value item had too much cost and the Set was dropped.
+func (c FuncCache[K, V]) Set(key K, value V) bool {
+	return c.set(key, value, false)
+}
+
+// SetIfAbsent if the specified key is not already associated with a value associates it with the given value.
+//
+// If the specified key is not already associated with a value, then it returns false.
+//
+// Also, it returns false if the key-value item had too much cost and the SetIfAbsent was dropped.
+func (c FuncCache[K, V]) SetIfAbsent(key K, value V) bool {
+	return c.set(key, value, true)
+}
+
+func (c FuncCache[K, V]) set(key K, value V, onlyIfAbsent bool) bool {
+	h := c.hash(key)
+	m := c.lock(h)
+	defer m.Unlock()
+
+	old, _ := c.cache.cache.Peek(h)
+	i := c.find(old, key)
+	if i >= 0 && onlyIfAbsent {
+		return false
+	}
+
+	// buckets are immutable, since they are read without locks.
+	bucket := make([]funcEntry[K, V], len(old), len(old)+1)
+	copy(bucket, old)
+	if i >= 0 {
+		bucket[i].value = value
+	} else {
+		bucket = append(bucket, funcEntry[K, V]{key: key, value: value})
+	}
+	return c.cache.Set(h, bucket)
+}
+
+// Delete removes the association for this key from the cache.
+func (c FuncCache[K, V]) Delete(key K) {
+	h := c.hash(key)
+	m := c.lock(h)
+	defer m.Unlock()
+
+	old, _ := c.cache.cache.Peek(h)
+	i := c.find(old, key)
+	if i < 0 {
+		return
+	}
+	if len(old) == 1 {
+		c.cache.Delete(h)
+		return
+	}
+
+	bucket := make([]funcEntry[K, V], 0, len(old)-1)
+	bucket = append(bucket, old[:i]...)
+	bucket = append(bucket, old[i+1:]...)
+	c.cache.Set(h, bucket)
+}
+
+// Range iterates over all items in the cache.
+//
+// Iteration stops early when the given function returns false.
+func (c FuncCache[K, V]) Range(f func(key K, value V) bool) {
+	c.cache.Range(func(_ uint64, bucket []funcEntry[K, V]) bool {
+		for _, e := range bucket {
+			if !f(e.key, e.value) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Clear clears the hash table, all policies, buffers, etc.
+//
+// NOTE: this operation must be performed when no requests are made to the cache otherwise the behavior is undefined.
+func (c FuncCache[K, V]) Clear() {
+	c.cache.Clear()
+}
+
+// Close clears the hash table, all policies, buffers, etc and stop all goroutines.
+//
+// NOTE: this operation must be performed when no requests are made to the cache otherwise the behavior is undefined.
+func (c FuncCache[K, V]) Close() {
+	c.cache.Close()
+}
+
+// Size returns the current number of distinct key hashes in the cache.
+func (c FuncCache[K, V]) Size() int {
+	return c.cache.Size()
+}
+
+// Capacity returns the cache capacity.
+func (c FuncCache[K, V]) Capacity() int {
+	return c.cache.Capacity()
+}
+
+// Stats returns a current snapshot of this cache's cumulative statistics.
+func (c FuncCache[K, V]) Stats() Stats {
+	return c.cache.Stats()
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func sliceEquals(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sumHash collides for permutations of the same numbers.
+func sumHash(key []int) uint64 {
+	var h uint64
+	for _, v := range key {
+		h += uint64(v)
+	}
+	return h
+}
+
+func TestFuncCache(t *testing.T) {
+	c, err := NewFunc[[]int, int](100, sumHash, sliceEquals, WithStats())
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.Set([]int{1, 2}, 1)
+	c.Set([]int{2, 1}, 2)
+	c.Set([]int{3}, 3)
+	if c.SetIfAbsent([]int{2, 1}, 4) {
+		t.Fatal("value shouldn't be stored for an existing key")
+	}
+	c.Set([]int{1, 2}, 5)
+
+	for _, tt := range []struct {
+		key   []int
+		value int
+	}{
+		{key: []int{1, 2}, value: 5},
+		{key: []int{2, 1}, value: 2},
+		{key: []int{3}, value: 3},
+	} {
+		if v, ok := c.Get(tt.key); !ok || v != tt.value {
+			t.Fatalf("c.Get(%v) = %d/%v, want %d/true", tt.key, v, ok, tt.value)
+		}
+	}
+	if c.Has([]int{0, 3}) {
+		t.Fatal("key with the colliding hash should not be found")
+	}
+
+	c.Delete([]int{1, 2})
+	if c.Has([]int{1, 2}) || !c.Has([]int{2, 1}) {
+		t.Fatal("only the deleted key should be removed")
+	}
+
+	count := 0
+	c.Range(func(key []int, value int) bool {
+		count++
+		return true
+	})
+	if count != 2 {
+		t.Fatalf("got %d items, want 2", count)
+	}
+}
+
+func TestFuncCache_Concurrent(t *testing.T) {
+	c, err := NewFunc[[]int, int](1000, sumHash, sliceEquals)
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			// all goroutines write to the same bucket.
+			for i := 0; i < 100; i++ {
+				c.Set([]int{g, 8 - g}, i)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for g := 0; g < 8; g++ {
+		if v, ok := c.Get([]int{g, 8 - g}); !ok || v != 99 {
+			t.Fatalf("got %d/%v for goroutine %d, want 99/true", v, ok, g)
+		}
+	}
+}
+
+func TestNewFunc_Errors(t *testing.T) {
+	var cfgErr *ConfigError
+	if _, err := NewFunc[[]int, int](10, nil, sliceEquals); !errors.Is(err, ErrNilKeyFunc) || !errors.As(err, &cfgErr) || cfgErr.Value != "hash" {
+		t.Fatalf("should fail with a config error %v, but got %v", ErrNilKeyFunc, err)
+	}
+
+	cost := WithCost(func(key int, value int) uint32 {
+		return 1
+	})
+	if _, err := NewFunc[[]int, int](10, sumHash, sliceEquals, cost); !errors.Is(err, ErrMismatchedCostFunc) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrMismatchedCostFunc, err)
+	}
+
+	wal := WithWAL(t.TempDir(), time.Hour)
+	if _, err := NewFunc[[]int, int](10, sumHash, sliceEquals, wal); !errors.Is(err, ErrIllegalFuncOption) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalFuncOption, err)
+	}
+}
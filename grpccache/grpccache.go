@@ -0,0 +1,235 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package grpccache provides a gRPC unary client interceptor that caches responses in an otter cache.
+//
+// It lives in a separate module, so otter itself doesn't depend on gRPC.
+package grpccache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maypok86/otter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Option configures an Interceptor.
+type Option func(i *Interceptor)
+
+// WithMethods makes the Interceptor cache only the given methods, for example "/pkg.Service/Method".
+//
+// By default, the methods marked with the NO_SIDE_EFFECTS idempotency level in their proto definitions are cached.
+func WithMethods(methods ...string) Option {
+	return func(i *Interceptor) {
+		if i.methods == nil {
+			i.methods = make(map[string]struct{}, len(methods))
+		}
+		for _, m := range methods {
+			i.methods[m] = struct{}{}
+		}
+	}
+}
+
+// WithMetadataKeys makes the values of the given outgoing metadata keys a part of the cache key,
+// so for example responses for different tenants or users are cached separately.
+//
+// By default, and for the calls with outgoing metadata keys other than the given ones,
+// the cache is skipped, because the response may depend on the metadata.
+func WithMetadataKeys(keys ...string) Option {
+	return func(i *Interceptor) {
+		if i.metadataKeys == nil {
+			i.metadataKeys = make(map[string]struct{}, len(keys))
+		}
+		for _, k := range keys {
+			// the metadata keys are always lowercase.
+			i.metadataKeys[strings.ToLower(k)] = struct{}{}
+		}
+	}
+}
+
+// Interceptor caches responses of idempotent unary calls keyed by the method, the target of the connection
+// and the hash of the request and the outgoing metadata.
+type Interceptor struct {
+	cache otter.Cache[string, proto.Message]
+	// methods is nil if the idempotency levels are used.
+	methods      map[string]struct{}
+	metadataKeys map[string]struct{}
+	idempotent   sync.Map
+}
+
+// New creates an Interceptor with the given capacity in bytes of cached responses and ttl of each response.
+func New(capacity int, ttl time.Duration, opts ...Option) (*Interceptor, error) {
+	b, err := otter.NewBuilder[string, proto.Message](capacity)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := b.
+		Cost(func(key string, reply proto.Message) uint32 {
+			size := len(key) + proto.Size(reply)
+			if size > math.MaxUint32 {
+				return math.MaxUint32
+			}
+			return uint32(size)
+		}).
+		WithTTL(ttl).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Interceptor{
+		cache: cache,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i, nil
+}
+
+// Unary returns the unary client interceptor.
+//
+// Calls served from the cache don't reach the server, so grpc.Header and grpc.Trailer call options
+// are not filled for them.
+func (i *Interceptor) Unary() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		reqMsg, ok := req.(proto.Message)
+		replyMsg, replyOk := reply.(proto.Message)
+		if !ok || !replyOk || !i.cacheable(method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		md, ok := i.keyMetadata(ctx)
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		key, err := cacheKey(method, cc.Target(), md, reqMsg)
+		if err != nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		if cached, ok := i.cache.Get(key); ok {
+			proto.Reset(replyMsg)
+			proto.Merge(replyMsg, cached)
+			return nil
+		}
+
+		if err := invoker(ctx, method, req, reply, cc, opts...); err != nil {
+			return err
+		}
+		i.cache.Set(key, proto.Clone(replyMsg))
+		return nil
+	}
+}
+
+// Invalidate removes all cached responses of the method.
+func (i *Interceptor) Invalidate(method string) {
+	prefix := method + "\x00"
+	i.cache.DeleteByFunc(func(key string, _ proto.Message) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
+
+// Close closes the underlying cache.
+func (i *Interceptor) Close() {
+	i.cache.Close()
+}
+
+func (i *Interceptor) cacheable(method string) bool {
+	if i.methods != nil {
+		_, ok := i.methods[method]
+		return ok
+	}
+
+	if v, ok := i.idempotent.Load(method); ok {
+		return v.(bool)
+	}
+	v := hasNoSideEffects(method)
+	i.idempotent.Store(method, v)
+	return v
+}
+
+// hasNoSideEffects checks the idempotency level of the method in the global proto registry.
+// keyMetadata returns the outgoing metadata which is a part of the cache key.
+// The ok result is false if the metadata has keys which are not a part of the cache key.
+func (i *Interceptor) keyMetadata(ctx context.Context) (md metadata.MD, ok bool) {
+	md, _ = metadata.FromOutgoingContext(ctx)
+	for k := range md {
+		if _, ok := i.metadataKeys[k]; !ok {
+			return nil, false
+		}
+	}
+	return md, true
+}
+
+func hasNoSideEffects(method string) bool {
+	name := strings.Replace(strings.TrimPrefix(method, "/"), "/", ".", 1)
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return false
+	}
+	md, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return false
+	}
+	opts, ok := md.Options().(*descriptorpb.MethodOptions)
+	return ok && opts.GetIdempotencyLevel() == descriptorpb.MethodOptions_NO_SIDE_EFFECTS
+}
+
+func cacheKey(method, target string, md metadata.MD, req proto.Message) (string, error) {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	// every part is prefixed with its length, so different parts can't produce the same input.
+	h := sha256.New()
+	writePart := func(p []byte) {
+		h.Write(binary.AppendUvarint(nil, uint64(len(p))))
+		h.Write(p)
+	}
+	writePart([]byte(target))
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writePart([]byte(k))
+		h.Write(binary.AppendUvarint(nil, uint64(len(md[k]))))
+		for _, v := range md[k] {
+			writePart([]byte(v))
+		}
+	}
+	writePart(b)
+	return method + "\x00" + string(h.Sum(nil)), nil
+}
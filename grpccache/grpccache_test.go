@@ -0,0 +1,184 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpccache
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const checkMethod = "/grpc.health.v1.Health/Check"
+
+func newTestClient(t *testing.T, i *Interceptor) (healthpb.HealthClient, *health.Server) {
+	t.Helper()
+
+	return newTestClientWithTarget(t, i, "passthrough:///bufnet")
+}
+
+func newTestClientWithTarget(t *testing.T, i *Interceptor, target string) (healthpb.HealthClient, *health.Server) {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(
+		target,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(i.Unary()),
+	)
+	if err != nil {
+		t.Fatalf("can not create client: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return healthpb.NewHealthClient(conn), hs
+}
+
+func check(t *testing.T, client healthpb.HealthClient, service string) healthpb.HealthCheckResponse_ServingStatus {
+	t.Helper()
+
+	return checkWithContext(t, context.Background(), client, service)
+}
+
+func checkWithContext(
+	t *testing.T,
+	ctx context.Context,
+	client healthpb.HealthClient,
+	service string,
+) healthpb.HealthCheckResponse_ServingStatus {
+	t.Helper()
+
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	return resp.GetStatus()
+}
+
+func TestInterceptor(t *testing.T) {
+	i, err := New(1<<20, time.Hour, WithMethods(checkMethod))
+	if err != nil {
+		t.Fatalf("can not create interceptor: %v", err)
+	}
+	defer i.Close()
+
+	client, hs := newTestClient(t, i)
+	hs.SetServingStatus("a", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus("b", healthpb.HealthCheckResponse_SERVING)
+	if got := check(t, client, "a"); got != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("got status %v, want SERVING", got)
+	}
+
+	hs.SetServingStatus("a", healthpb.HealthCheckResponse_NOT_SERVING)
+	hs.SetServingStatus("b", healthpb.HealthCheckResponse_NOT_SERVING)
+	if got := check(t, client, "a"); got != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("response should be served from the cache, but got %v", got)
+	}
+	if got := check(t, client, "b"); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("another request should not hit the cache, but got %v", got)
+	}
+
+	i.Invalidate(checkMethod)
+	if got := check(t, client, "a"); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("invalidated response should not be served, but got %v", got)
+	}
+}
+
+func TestInterceptor_Target(t *testing.T) {
+	i, err := New(1<<20, time.Hour, WithMethods(checkMethod))
+	if err != nil {
+		t.Fatalf("can not create interceptor: %v", err)
+	}
+	defer i.Close()
+
+	first, firstServer := newTestClientWithTarget(t, i, "passthrough:///first")
+	second, secondServer := newTestClientWithTarget(t, i, "passthrough:///second")
+	firstServer.SetServingStatus("a", healthpb.HealthCheckResponse_SERVING)
+	secondServer.SetServingStatus("a", healthpb.HealthCheckResponse_NOT_SERVING)
+	check(t, first, "a")
+	if got := check(t, second, "a"); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("response of another target should not be served from the cache, but got %v", got)
+	}
+}
+
+func TestInterceptor_Metadata(t *testing.T) {
+	i, err := New(1<<20, time.Hour, WithMethods(checkMethod), WithMetadataKeys("Tenant"))
+	if err != nil {
+		t.Fatalf("can not create interceptor: %v", err)
+	}
+	defer i.Close()
+
+	client, hs := newTestClient(t, i)
+	tenant := func(name string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "tenant", name)
+	}
+	hs.SetServingStatus("a", healthpb.HealthCheckResponse_SERVING)
+	checkWithContext(t, tenant("x"), client, "a")
+	checkWithContext(t, metadata.AppendToOutgoingContext(tenant("x"), "authorization", "token"), client, "a")
+
+	hs.SetServingStatus("a", healthpb.HealthCheckResponse_NOT_SERVING)
+	if got := checkWithContext(t, tenant("x"), client, "a"); got != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("response should be served from the cache, but got %v", got)
+	}
+	if got := checkWithContext(t, tenant("y"), client, "a"); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("response for other metadata should not be served from the cache, but got %v", got)
+	}
+	ctx := metadata.AppendToOutgoingContext(tenant("x"), "authorization", "token")
+	if got := checkWithContext(t, ctx, client, "a"); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("call with metadata which is not a part of the key should skip the cache, but got %v", got)
+	}
+}
+
+func TestInterceptor_IdempotencyLevel(t *testing.T) {
+	i, err := New(1<<20, time.Hour)
+	if err != nil {
+		t.Fatalf("can not create interceptor: %v", err)
+	}
+	defer i.Close()
+
+	client, hs := newTestClient(t, i)
+	hs.SetServingStatus("a", healthpb.HealthCheckResponse_SERVING)
+	check(t, client, "a")
+	hs.SetServingStatus("a", healthpb.HealthCheckResponse_NOT_SERVING)
+	if got := check(t, client, "a"); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("method without the idempotency level should not be cached, but got %v", got)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	if _, err := New(0, time.Hour); err == nil {
+		t.Fatal("invalid capacity should be rejected")
+	}
+	if _, err := New(10, -time.Hour); err == nil {
+		t.Fatal("invalid ttl should be rejected")
+	}
+}
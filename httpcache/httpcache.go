@@ -0,0 +1,362 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httpcache provides an http.RoundTripper that caches responses in an otter cache.
+//
+// The transport is a private client-side cache: it caches responses to GET requests according to
+// their Cache-Control, Expires and Vary headers and revalidates stale responses with ETag and Last-Modified.
+package httpcache
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maypok86/otter"
+)
+
+// XFromCache is the header set on responses served from the cache.
+const XFromCache = "X-From-Cache"
+
+// revalidationTTL is how long a stale response with a validator is kept for revalidation.
+const revalidationTTL = time.Hour
+
+// Transport is an http.RoundTripper that caches responses.
+type Transport struct {
+	next  http.RoundTripper
+	cache otter.CacheWithVariableTTL[string, *entry]
+	// maxBodySize is the size of the largest body which fits into the cache.
+	maxBodySize int64
+}
+
+// New creates a Transport that caches responses of the next RoundTripper.
+// If next is nil, http.DefaultTransport is used.
+//
+// The capacity is the max total size of cached responses in bytes.
+func New(next http.RoundTripper, capacity int) (*Transport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	b, err := otter.NewBuilder[string, *entry](capacity)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := b.
+		Cost(func(key string, e *entry) uint32 {
+			return e.cost(key)
+		}).
+		WithVariableTTL().
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transport{
+		next:        next,
+		cache:       cache,
+		maxBodySize: int64(capacity),
+	}, nil
+}
+
+// Client returns an http.Client that uses the Transport.
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.URL.String()
+	if req.Method != http.MethodGet {
+		resp, err := t.next.RoundTrip(req)
+		if err == nil && isUnsafe(req.Method) && resp.StatusCode < http.StatusBadRequest {
+			// the request may have changed the resource, so the cached representation is invalid.
+			t.cache.Delete(key)
+		}
+		return resp, err
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	if _, ok := reqCC["no-store"]; ok || req.Header.Get("Range") != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	cached, ok := t.cache.Get(key)
+	if ok && !cached.matches(req) {
+		cached, ok = nil, false
+	}
+	if !ok {
+		return t.fetch(req, key)
+	}
+
+	_, noCache := reqCC["no-cache"]
+	if !noCache && reqCC["max-age"] != "0" && time.Now().Before(cached.expires) {
+		return cached.response(req), nil
+	}
+	if !cached.hasValidator() {
+		return t.fetch(req, key)
+	}
+	return t.revalidate(req, key, cached)
+}
+
+func (t *Transport) fetch(req *http.Request, key string) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.store(req, key, resp)
+}
+
+func (t *Transport) revalidate(req *http.Request, key string, cached *entry) (*http.Response, error) {
+	conditional := req.Clone(req.Context())
+	if etag := cached.header.Get("ETag"); etag != "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := cached.header.Get("Last-Modified"); lastModified != "" {
+		conditional.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := t.next.RoundTrip(conditional)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusNotModified {
+		return t.store(req, key, resp)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	// the 304 response updates the stored headers and the freshness of the cached response.
+	header := cached.header.Clone()
+	for name, values := range resp.Header {
+		header[name] = values
+	}
+	updated := &entry{
+		status: cached.status,
+		header: header,
+		body:   cached.body,
+		vary:   cached.vary,
+	}
+	ttl, ok := updated.setFreshness(time.Now())
+	if ok {
+		t.cache.Set(key, updated, ttl)
+	} else {
+		t.cache.Delete(key)
+	}
+	return updated.response(req), nil
+}
+
+// store caches the response if it is cacheable and returns the response for the caller.
+func (t *Transport) store(req *http.Request, key string, resp *http.Response) (*http.Response, error) {
+	if !isCacheable(resp) {
+		return resp, nil
+	}
+
+	// a body larger than the cache is never stored, so at most one byte more than that is read.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, t.maxBodySize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > t.maxBodySize {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		t.cache.Delete(key)
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	e := &entry{
+		status: resp.StatusCode,
+		header: resp.Header.Clone(),
+		body:   body,
+		vary:   varyHeader(req, resp.Header),
+	}
+	if ttl, ok := e.setFreshness(time.Now()); ok {
+		t.cache.Set(key, e, ttl)
+	} else {
+		t.cache.Delete(key)
+	}
+	return resp, nil
+}
+
+// Close closes the underlying cache.
+func (t *Transport) Close() {
+	t.cache.Close()
+}
+
+type entry struct {
+	status  int
+	header  http.Header
+	body    []byte
+	vary    http.Header
+	expires time.Time
+}
+
+// setFreshness sets the time until which the response is fresh and returns the ttl of the entry in the cache.
+// It returns false if the response should not be cached.
+func (e *entry) setFreshness(now time.Time) (time.Duration, bool) {
+	lifetime := freshnessLifetime(e.header, now)
+	if age, err := strconv.Atoi(e.header.Get("Age")); err == nil && age > 0 {
+		lifetime -= time.Duration(age) * time.Second
+	}
+	if lifetime < 0 {
+		lifetime = 0
+	}
+	e.expires = now.Add(lifetime)
+
+	ttl := lifetime
+	if e.hasValidator() {
+		ttl += revalidationTTL
+	}
+	return ttl, ttl >= time.Second
+}
+
+func (e *entry) hasValidator() bool {
+	return e.header.Get("ETag") != "" || e.header.Get("Last-Modified") != ""
+}
+
+// matches returns true if the request has the same values of the headers listed in the Vary header.
+func (e *entry) matches(req *http.Request) bool {
+	for name, values := range e.vary {
+		if strings.Join(req.Header.Values(name), ",") != strings.Join(values, ",") {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *entry) response(req *http.Request) *http.Response {
+	header := e.header.Clone()
+	header.Set(XFromCache, "1")
+	return &http.Response{
+		Status:        strconv.Itoa(e.status) + " " + http.StatusText(e.status),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+func (e *entry) cost(key string) uint32 {
+	size := len(key) + len(e.body)
+	for name, values := range e.header {
+		size += len(name)
+		for _, v := range values {
+			size += len(v)
+		}
+	}
+	if size > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(size)
+}
+
+func isUnsafe(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func isCacheable(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent, http.StatusMultipleChoices,
+		http.StatusMovedPermanently, http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusGone,
+		http.StatusRequestURITooLong, http.StatusNotImplemented:
+	default:
+		return false
+	}
+
+	if _, ok := parseCacheControl(resp.Header)["no-store"]; ok {
+		return false
+	}
+	return resp.Header.Get("Vary") != "*"
+}
+
+// freshnessLifetime returns how long the response is fresh according to its Cache-Control and Expires headers.
+func freshnessLifetime(header http.Header, now time.Time) time.Duration {
+	cc := parseCacheControl(header)
+	if _, ok := cc["no-cache"]; ok {
+		return 0
+	}
+	if maxAge, ok := cc["max-age"]; ok {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if v := header.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return 0
+		}
+		date := now
+		if d, err := http.ParseTime(header.Get("Date")); err == nil {
+			date = d
+		}
+		return expires.Sub(date)
+	}
+	return 0
+}
+
+func varyHeader(req *http.Request, header http.Header) http.Header {
+	var vary http.Header
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if vary == nil {
+				vary = make(http.Header)
+			}
+			vary[http.CanonicalHeaderKey(name)] = req.Header.Values(name)
+		}
+	}
+	return vary
+}
+
+func parseCacheControl(header http.Header) map[string]string {
+	cc := make(map[string]string)
+	for _, v := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			name, value, _ := strings.Cut(directive, "=")
+			cc[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return cc
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
@@ -0,0 +1,185 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestTransport(t *testing.T) *Transport {
+	t.Helper()
+
+	tr, err := New(nil, 1<<20)
+	if err != nil {
+		t.Fatalf("can not create transport: %v", err)
+	}
+	t.Cleanup(tr.Close)
+	return tr
+}
+
+func get(t *testing.T, client *http.Client, url string, header ...string) (body string, fromCache bool) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("can not create request: %v", err)
+	}
+	for i := 0; i < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("can not read body: %v", err)
+	}
+	return string(b), resp.Header.Get(XFromCache) != ""
+}
+
+func TestTransport_MaxAge(t *testing.T) {
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store, max-age=60")
+		}
+		fmt.Fprint(w, n)
+	}))
+	defer srv.Close()
+
+	client := newTestTransport(t).Client()
+	if body, fromCache := get(t, client, srv.URL+"/fresh"); body != "1" || fromCache {
+		t.Fatalf("first response should come from the server, but got %s/%v", body, fromCache)
+	}
+	if body, fromCache := get(t, client, srv.URL+"/fresh"); body != "1" || !fromCache {
+		t.Fatalf("fresh response should come from the cache, but got %s/%v", body, fromCache)
+	}
+	if body, fromCache := get(t, client, srv.URL+"/fresh", "Cache-Control", "no-cache"); body != "2" || fromCache {
+		t.Fatalf("no-cache request should go to the server, but got %s/%v", body, fromCache)
+	}
+
+	get(t, client, srv.URL+"/no-store")
+	if _, fromCache := get(t, client, srv.URL+"/no-store"); fromCache {
+		t.Fatal("no-store response should not be cached")
+	}
+
+	resp, err := client.Post(srv.URL+"/fresh", "text/plain", nil)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if _, fromCache := get(t, client, srv.URL+"/fresh"); fromCache {
+		t.Fatal("unsafe request should invalidate the cached response")
+	}
+}
+
+func TestTransport_LargeBody(t *testing.T) {
+	const capacity = 1 << 10
+	large := strings.Repeat("a", 2*capacity)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprint(w, large)
+	}))
+	defer srv.Close()
+
+	tr, err := New(nil, capacity)
+	if err != nil {
+		t.Fatalf("can not create transport: %v", err)
+	}
+	defer tr.Close()
+
+	client := tr.Client()
+	if body, fromCache := get(t, client, srv.URL); body != large || fromCache {
+		t.Fatalf("the whole large body should be passed through, but got %d bytes/%v", len(body), fromCache)
+	}
+	if _, fromCache := get(t, client, srv.URL); fromCache {
+		t.Fatal("response larger than the cache should not be cached")
+	}
+}
+
+func TestTransport_Revalidate(t *testing.T) {
+	var calls, notModified atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, "payload")
+	}))
+	defer srv.Close()
+
+	client := newTestTransport(t).Client()
+	get(t, client, srv.URL)
+	if body, fromCache := get(t, client, srv.URL); body != "payload" || !fromCache {
+		t.Fatalf("revalidated response should come from the cache, but got %s/%v", body, fromCache)
+	}
+	if calls.Load() != 2 || notModified.Load() != 1 {
+		t.Fatalf("stale response should be revalidated, but got %d calls and %d 304s", calls.Load(), notModified.Load())
+	}
+}
+
+func TestTransport_Vary(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprint(w, r.Header.Get("Accept-Language"))
+	}))
+	defer srv.Close()
+
+	client := newTestTransport(t).Client()
+	get(t, client, srv.URL, "Accept-Language", "en")
+	if body, fromCache := get(t, client, srv.URL, "Accept-Language", "de"); body != "de" || fromCache {
+		t.Fatalf("response for another language should not be served, but got %s/%v", body, fromCache)
+	}
+	if body, fromCache := get(t, client, srv.URL, "Accept-Language", "de"); body != "de" || !fromCache {
+		t.Fatalf("response should come from the cache, but got %s/%v", body, fromCache)
+	}
+}
+
+func TestParseCacheControl(t *testing.T) {
+	h := http.Header{}
+	h.Add("Cache-Control", `Max-Age="30", no-cache`)
+	h.Add("Cache-Control", "private")
+	cc := parseCacheControl(h)
+	if cc["max-age"] != "30" || len(cc) != 3 {
+		t.Fatalf("invalid directives: %v", cc)
+	}
+	if _, ok := cc["private"]; !ok {
+		t.Fatalf("directive from the second header should be parsed: %v", cc)
+	}
+}
+
+func TestNew_IllegalCapacity(t *testing.T) {
+	if _, err := New(nil, 0); err == nil {
+		t.Fatal("invalid capacity should be rejected")
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"context"
+	"io"
+)
+
+// Getter is implemented by all caches and can be accepted by code that only reads values.
+type Getter[K comparable, V any] interface {
+	Get(key K) (V, bool)
+}
+
+// Setter is implemented by all caches and can be accepted by code that only writes values
+// with the ttl configured when the cache was built.
+type Setter[K comparable, V any] interface {
+	SetWithDefaultTTL(key K, value V) bool
+}
+
+// Interface is the set of methods shared by Cache and CacheWithVariableTTL,
+// so libraries can accept any otter cache without being generic over both types.
+//
+// Writes through Interface use the ttl configured when the cache was built:
+// the ttl passed to Builder.WithTTL or VariableTTLBuilder.DefaultTTL.
+type Interface[K comparable, V any] interface {
+	Has(key K) bool
+	Get(key K) (V, bool)
+	GetEntry(key K) (Entry[K, V], bool)
+	GetEntries(keys []K) map[K]Entry[K, V]
+	Entries() []Entry[K, V]
+	Sample(n int) []Entry[K, V]
+	Hottest(n int) []Entry[K, V]
+	TopKeys(k int) []KeyCount[K]
+	GetAll(keys []K) (found map[K]V, missing []K)
+	SetWithDefaultTTL(key K, value V) bool
+	SetIfAbsentWithDefaultTTL(key K, value V) bool
+	Delete(key K)
+	DeleteAndGet(key K) (value V, ok bool)
+	DeleteByFunc(f func(key K, value V) bool)
+	Range(f func(key K, value V) bool)
+	RangeWhile(pred func(key K, value V) bool, f func(key K, value V) bool)
+	RangeSnapshot(f func(key K, value V) bool)
+	CopyTo(dst Interface[K, V], keepHotness bool)
+	Clear(opts ...ClearOption)
+	Close()
+	Shutdown(ctx context.Context) error
+	Events() <-chan Event[K, V]
+	ReplayJournal(r io.Reader) error
+	Size() int
+	EstimatedSize() int
+	CostUsed() uint64
+	Utilization() float64
+	Capacity() int
+	Stats() Stats
+	Dump(w io.Writer) error
+	DebugString() string
+	ReadOnly() ReadCache[K, V]
+}
+
+// ReadCache is a read-only view of a cache.
+//
+// It can be passed to code that must not mutate the cache, like plugins.
+type ReadCache[K comparable, V any] interface {
+	Has(key K) bool
+	Get(key K) (V, bool)
+	Range(f func(key K, value V) bool)
+	Stats() Stats
+}
+
+// readOnly hides the mutating methods of the cache, so they can't be reached by a type assertion.
+type readOnly[K comparable, V any] struct {
+	cache ReadCache[K, V]
+}
+
+func (r readOnly[K, V]) Has(key K) bool {
+	return r.cache.Has(key)
+}
+
+func (r readOnly[K, V]) Get(key K) (V, bool) {
+	return r.cache.Get(key)
+}
+
+func (r readOnly[K, V]) Range(f func(key K, value V) bool) {
+	r.cache.Range(f)
+}
+
+func (r readOnly[K, V]) Stats() Stats {
+	return r.cache.Stats()
+}
+
+var (
+	_ Interface[int, int] = Cache[int, int]{}
+	_ Interface[int, int] = CacheWithVariableTTL[int, int]{}
+	_ Getter[int, int]    = Interface[int, int](nil)
+	_ Setter[int, int]    = Interface[int, int](nil)
+)
@@ -0,0 +1,73 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInterface(t *testing.T) {
+	c, err := MustBuilder[int, int](100).WithTTL(time.Hour).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	cv, err := MustBuilder[int, int](100).WithVariableTTL().DefaultTTL(time.Hour).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+
+	for _, cache := range []Interface[int, int]{c, cv} {
+		if !cache.SetWithDefaultTTL(1, 1) || cache.SetIfAbsentWithDefaultTTL(1, 2) {
+			t.Fatalf("%T: unexpected result of the write", cache)
+		}
+		e, ok := cache.GetEntry(1)
+		if !ok || e.Value() != 1 {
+			t.Fatalf("%T: got unexpected entry %+v", cache, e)
+		}
+		if ttl := e.TTL(); ttl <= 0 || ttl > time.Hour+time.Second {
+			t.Fatalf("%T: item should have the default ttl, but got %v", cache, ttl)
+		}
+		cache.Close()
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	c, err := MustBuilder[int, int](100).CollectStats().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.Set(1, 1)
+	r := c.ReadOnly()
+	if _, ok := r.(Interface[int, int]); ok {
+		t.Fatal("read-only view should not expose the mutating methods")
+	}
+	if v, ok := r.Get(1); !ok || v != 1 || !r.Has(1) || r.Has(2) {
+		t.Fatalf("r.Get(1) = %d/%v, want 1/true", v, ok)
+	}
+	count := 0
+	r.Range(func(key, value int) bool {
+		count++
+		return true
+	})
+	if count != 1 {
+		t.Fatalf("got %d items, want 1", count)
+	}
+	if hits := r.Stats().Hits(); hits != 2 {
+		t.Fatalf("r.Stats().Hits() = %d, want 2", hits)
+	}
+}
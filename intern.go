@@ -0,0 +1,74 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.23
+
+package otter
+
+import (
+	"reflect"
+	"unique"
+	"unsafe"
+)
+
+// stringInterner returns a func returning the canonical copy of the string key or nil if the key type isn't a string.
+func stringInterner[K comparable]() func(key K) K {
+	var zero K
+	if reflect.TypeOf(zero).Kind() != reflect.String {
+		return nil
+	}
+
+	return func(key K) K {
+		// the underlying type is string, so the conversion avoids boxing the key into an interface.
+		s := unique.Make(*(*string)(unsafe.Pointer(&key))).Value()
+		return *(*K)(unsafe.Pointer(&s))
+	}
+}
+
+// InternKeys makes the cache store the canonical copy of every string key returned by the unique package,
+// so equal keys of several caches or the rest of the program interned the same way share one copy.
+// The key type of the cache must be a string.
+//
+// By default, the cache stores the keys passed to it.
+func (b *Builder[K, V]) InternKeys() *Builder[K, V] {
+	b.setInternKey(stringInterner[K]())
+	return b
+}
+
+// InternKeys makes the cache store the canonical copy of every string key returned by the unique package,
+// so equal keys of several caches or the rest of the program interned the same way share one copy.
+// The key type of the cache must be a string.
+//
+// By default, the cache stores the keys passed to it.
+func (b *ConstTTLBuilder[K, V]) InternKeys() *ConstTTLBuilder[K, V] {
+	b.setInternKey(stringInterner[K]())
+	return b
+}
+
+// InternKeys makes the cache store the canonical copy of every string key returned by the unique package,
+// so equal keys of several caches or the rest of the program interned the same way share one copy.
+// The key type of the cache must be a string.
+//
+// By default, the cache stores the keys passed to it.
+func (b *VariableTTLBuilder[K, V]) InternKeys() *VariableTTLBuilder[K, V] {
+	b.setInternKey(stringInterner[K]())
+	return b
+}
+
+// WithInternKeys is the functional equivalent of Builder.InternKeys.
+func WithInternKeys() Option {
+	return func(o *options) {
+		o.internKeys = true
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.23
+
+package otter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+type stringKey string
+
+func TestCache_InternKeys(t *testing.T) {
+	c, err := MustBuilder[stringKey, int](100).InternKeys().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	// the keys are built at runtime, so they don't share the memory.
+	c.Set(stringKey(strings.Repeat("k", 2)), 1)
+	c.Set(stringKey(strings.Repeat("l", 2)), 2)
+
+	var keys []stringKey
+	c.Range(func(key stringKey, value int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != 2 {
+		t.Fatalf("cache should have 2 keys, but got %d", len(keys))
+	}
+	for _, key := range keys {
+		canonical := stringInterner[stringKey]()(stringKey(strings.Clone(string(key))))
+		if unsafe.StringData(string(key)) != unsafe.StringData(string(canonical)) {
+			t.Fatalf("key %q should be interned", key)
+		}
+	}
+}
+
+func TestBuilder_InternKeys(t *testing.T) {
+	_, err := MustBuilder[int, int](100).InternKeys().Build()
+	if !errors.Is(err, ErrIllegalInternKeys) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalInternKeys, err)
+	}
+}
@@ -15,8 +15,13 @@
 package core
 
 import (
+	"context"
+	"math"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unsafe"
 
 	"github.com/maypok86/otter/internal/expire"
 	"github.com/maypok86/otter/internal/hashtable"
@@ -25,6 +30,7 @@ import (
 	"github.com/maypok86/otter/internal/queue"
 	"github.com/maypok86/otter/internal/s3fifo"
 	"github.com/maypok86/otter/internal/stats"
+	"github.com/maypok86/otter/internal/topk"
 	"github.com/maypok86/otter/internal/unixtime"
 	"github.com/maypok86/otter/internal/xmath"
 	"github.com/maypok86/otter/internal/xruntime"
@@ -40,133 +46,576 @@ func getExpiration(ttl time.Duration) uint32 {
 	return unixtime.Now() + uint32(ttlSecond)
 }
 
+// expiration returns the expiration time of the item written with the given ttl clamped to the ttl bounds.
+func (c *Cache[K, V]) expiration(ttl time.Duration) uint32 {
+	if c.minTTL > 0 && ttl < c.minTTL {
+		ttl = c.minTTL
+	}
+	if c.maxTTL > 0 && ttl > c.maxTTL {
+		ttl = c.maxTTL
+	}
+	return getExpiration(ttl)
+}
+
 // Config is a set of cache settings.
 type Config[K comparable, V any] struct {
-	Capacity        int
-	InitialCapacity *int
-	StatsEnabled    bool
-	TTL             *time.Duration
-	WithVariableTTL bool
-	CostFunc        func(key K, value V) uint32
+	Capacity         int
+	InitialCapacity  *int
+	StatsEnabled     bool
+	TTL              *time.Duration
+	WithVariableTTL  bool
+	CostFunc         func(key K, value V) uint32
+	MaintenanceRate  int
+	StableRange      bool
+	LatenciesEnabled bool
+	EventHandler     EventHandler[K, V]
+	ShardCount       int
+	NodePooling      bool
+	// RejectOnFullBuffer makes the sets fail instead of waiting when the write buffer is full.
+	RejectOnFullBuffer      bool
+	SynchronousEviction     bool
+	IgnoreHasInStats        bool
+	ExpireAfterAccess       time.Duration
+	StaleTTL                time.Duration
+	EntryStats              bool
+	TopKeysCapacity         int
+	Doorkeeper              bool
+	Admission               s3fifo.Admission[K]
+	SmallQueueRatio         int
+	LowWatermark            int
+	HighWatermark           int
+	EvictionBatchSize       int
+	MinTTL                  time.Duration
+	MaxTTL                  time.Duration
+	GhostQueueFactor        float64
+	FetchCostFunc           func(key K, value V) uint32
+	EvictSoonestExpiring    bool
+	DoorkeeperResetInterval int
+	Logger                  Logger
+	MaxEntryCost            uint32
+	Versioned               bool
+	TimerWheel              bool
+	PreciseExpiration       bool
+	NoLazyExpiration        bool
+	NoProactiveExpiration   bool
+	MemoryPressure          func() bool
+	// WeakValues registers the func to be called once the value is reclaimed by the garbage collector.
+	WeakValues func(value V, reclaimed func())
+	// InternKey returns the canonical copy of the key stored in the nodes.
+	InternKey func(key K) K
+	// ReadBuffersCount and ReadBufferCapacity override the number and the size of the lossy read buffers,
+	// zero means the defaults based on the parallelism.
+	ReadBuffersCount   int
+	ReadBufferCapacity int
+	// MinReadBuffersCount and MaxReadBuffersCount bound the number of the read buffers
+	// scaled by their drop rate, zero MaxReadBuffersCount disables the scaling.
+	MinReadBuffersCount int
+	MaxReadBuffersCount int
+	// AmortizedMaintenance makes the calling goroutines perform the maintenance instead of the background ones.
+	AmortizedMaintenance bool
+	// ParallelGetThreshold is the number of keys from which GetNodes looks them up in parallel,
+	// zero disables the parallel lookups.
+	ParallelGetThreshold int
+	// HashTableLoadFactor and HashTableGrowthFactor tune the growth of the hash table, zero means the defaults.
+	HashTableLoadFactor   float64
+	HashTableGrowthFactor int
+	// Sequenced makes the stored nodes get the write sequence numbers, which follow the order
+	// of the writes of the same key, e.g. to order the journal records.
+	Sequenced bool
+}
+
+type expirePolicy[K comparable, V any] interface {
+	Add(n *node.Node[K, V])
+	Delete(n *node.Node[K, V])
+	RemoveExpired(expired []*node.Node[K, V]) []*node.Node[K, V]
+	MemoryUsage() int64
+	Clear()
 }
 
 // Cache is a structure performs a best-effort bounding of a hash table using eviction algorithm
 // to determine which entries to evict when the capacity is exceeded.
 type Cache[K comparable, V any] struct {
-	hashmap        *hashtable.Map[K, V]
-	policy         *s3fifo.Policy[K, V]
-	expirePolicy   *expire.Policy[K, V]
-	stats          *stats.Stats
-	readBuffers    []*lossy.Buffer[node.Node[K, V]]
-	writeBuffer    *queue.MPSC[node.WriteTask[K, V]]
-	evictionMutex  sync.Mutex
-	closeOnce      sync.Once
-	doneClear      chan struct{}
-	costFunc       func(key K, value V) uint32
-	capacity       int
-	mask           uint32
-	ttl            uint32
-	withExpiration bool
-	isClosed       bool
+	hashmap         *hashtable.Map[K, V]
+	nodePool        *node.Pool[K, V]
+	weakValues      func(value V, reclaimed func())
+	internKey       func(key K) K
+	policy          *s3fifo.Policy[K, V]
+	expirePolicy    expirePolicy[K, V]
+	stats           *stats.Stats
+	latencies       *stats.Latencies
+	eventHandler    EventHandler[K, V]
+	readBuffers     atomic.Pointer[readStripes[K, V]]
+	readBufferCap   int
+	writeBuffer     *queue.MPSC[node.WriteTask[K, V]]
+	evictionMutex   sync.Mutex
+	closeOnce       sync.Once
+	doneClear       chan struct{}
+	doneSync        chan struct{}
+	syncMutex       sync.Mutex
+	doneClose       chan struct{}
+	stopCleanup     chan struct{}
+	wg              sync.WaitGroup
+	costFunc        func(key K, value V) uint32
+	capacity        int
+	maintenanceRate int
+	ttl             uint32
+	staleTTL        uint32
+	minTTL          time.Duration
+	maxTTL          time.Duration
+	accessTTL       uint32
+	withExpiration  bool
+	withClock       bool
+	entryStats      bool
+	topKeys         *topk.SpaceSaving[K]
+	logger          *logger
+	maxEntryCost    uint32
+	isClosed        bool
+	stableRange     bool
+	rejectOnFull    bool
+	versioned       bool
+	synchronous     bool
+	amortized       bool
+	proactive       bool
+	// lastMaintenance is the time of the last amortized maintenance.
+	lastMaintenance atomic.Uint32
+	precise         bool
+	lazyExpiration  bool
+	hasInStats      bool
+	frozen          atomic.Bool
+	keyLocksOnce    sync.Once
+	keyLocks        *keyLocks[K]
+	keyLocksCount   int
+	// parallelBatch is the size of the batch from which the keys are looked up in parallel.
+	parallelBatch int
 }
 
 // NewCache returns a new cache instance based on the settings from Config.
 func NewCache[K comparable, V any](c Config[K, V]) *Cache[K, V] {
 	parallelism := xruntime.Parallelism()
+	if c.ShardCount > 0 {
+		parallelism = uint32(c.ShardCount)
+	}
 	roundedParallelism := int(xmath.RoundUpPowerOf2(parallelism))
 	writeBufferCapacity := 128 * roundedParallelism
 	readBuffersCount := 4 * roundedParallelism
-
-	readBuffers := make([]*lossy.Buffer[node.Node[K, V]], 0, readBuffersCount)
-	for i := 0; i < readBuffersCount; i++ {
-		readBuffers = append(readBuffers, lossy.New[node.Node[K, V]]())
+	if c.ReadBuffersCount > 0 {
+		readBuffersCount = int(xmath.RoundUpPowerOf2(uint32(c.ReadBuffersCount)))
+	}
+	readBufferCapacity := lossy.DefaultCapacity
+	if c.ReadBufferCapacity > 0 {
+		readBufferCapacity = c.ReadBufferCapacity
 	}
 
-	var hashmap *hashtable.Map[K, V]
-	if c.InitialCapacity == nil {
-		hashmap = hashtable.New[K, V]()
-	} else {
-		hashmap = hashtable.NewWithSize[K, V](*c.InitialCapacity)
+	var minReadBuffersCount, maxReadBuffersCount int
+	if c.MaxReadBuffersCount > 0 {
+		minReadBuffersCount = int(xmath.RoundUpPowerOf2(uint32(c.MinReadBuffersCount)))
+		maxReadBuffersCount = int(xmath.RoundUpPowerOf2(uint32(c.MaxReadBuffersCount)))
+		if readBuffersCount < minReadBuffersCount {
+			readBuffersCount = minReadBuffersCount
+		}
+		if readBuffersCount > maxReadBuffersCount {
+			readBuffersCount = maxReadBuffersCount
+		}
 	}
 
+	var initialCapacity int
+	if c.InitialCapacity != nil {
+		initialCapacity = *c.InitialCapacity
+	}
 	cache := &Cache[K, V]{
-		hashmap:     hashmap,
-		policy:      s3fifo.NewPolicy[K, V](uint32(c.Capacity)),
-		readBuffers: readBuffers,
-		writeBuffer: queue.NewMPSC[node.WriteTask[K, V]](writeBufferCapacity),
-		doneClear:   make(chan struct{}),
-		mask:        uint32(readBuffersCount - 1),
-		costFunc:    c.CostFunc,
-		capacity:    c.Capacity,
+		policy:          s3fifo.NewPolicy[K, V](uint32(c.Capacity)),
+		writeBuffer:     queue.NewMPSC[node.WriteTask[K, V]](writeBufferCapacity),
+		doneClear:       make(chan struct{}),
+		doneSync:        make(chan struct{}),
+		doneClose:       make(chan struct{}),
+		stopCleanup:     make(chan struct{}),
+		costFunc:        c.CostFunc,
+		capacity:        c.Capacity,
+		maintenanceRate: c.MaintenanceRate,
+		stableRange:     c.StableRange,
+		rejectOnFull:    c.RejectOnFullBuffer,
+		versioned:       c.Versioned,
+		synchronous:     c.SynchronousEviction || c.AmortizedMaintenance,
+		amortized:       c.AmortizedMaintenance,
+		precise:         c.PreciseExpiration,
+		lazyExpiration:  !c.NoLazyExpiration,
+		hasInStats:      !c.IgnoreHasInStats,
+		entryStats:      c.EntryStats,
+		eventHandler:    c.EventHandler,
+		logger:          newLogger(c.Logger),
+		maxEntryCost:    c.MaxEntryCost,
+		keyLocksCount:   readBuffersCount,
+		weakValues:      c.WeakValues,
+		internKey:       c.InternKey,
+		parallelBatch:   c.ParallelGetThreshold,
+		minTTL:          c.MinTTL,
+		maxTTL:          c.MaxTTL,
 	}
+	cache.readBufferCap = readBufferCapacity
+	cache.readBuffers.Store(cache.newReadStripes(nil, readBuffersCount))
 
-	cache.expirePolicy = expire.NewPolicy[K, V]()
 	if c.StatsEnabled {
 		cache.stats = stats.New()
 	}
+	if c.SmallQueueRatio > 0 {
+		cache.policy.SetSmallQueueRatio(uint32(c.SmallQueueRatio))
+	}
+	if c.HighWatermark > 0 {
+		cache.policy.SetWatermarks(uint32(c.LowWatermark), uint32(c.HighWatermark))
+	}
+	if c.EvictionBatchSize > 0 {
+		cache.policy.SetMaxEvictions(c.EvictionBatchSize)
+	}
+	if c.GhostQueueFactor > 0 {
+		cache.policy.SetGhostQueueFactor(c.GhostQueueFactor)
+	}
+	if c.FetchCostFunc != nil || c.EvictSoonestExpiring {
+		cache.policy.SetRetention(newRetention(c.FetchCostFunc, c.EvictSoonestExpiring))
+	}
+	if c.Doorkeeper {
+		cache.policy.EnableDoorkeeper(uint32(c.DoorkeeperResetInterval))
+	}
+	if c.Admission != nil {
+		cache.policy.SetAdmission(c.Admission)
+	}
+	if c.TopKeysCapacity > 0 {
+		cache.topKeys = topk.New[K](c.TopKeysCapacity)
+	}
+	// a pooled node may be reused for another item before the cleanup of its old value runs.
+	if c.NodePooling && c.WeakValues == nil {
+		cache.nodePool = node.NewPool[K, V]()
+	}
+	if c.LatenciesEnabled {
+		cache.latencies = stats.NewLatencies()
+	}
 	if c.TTL != nil {
 		cache.ttl = uint32((*c.TTL + time.Second - 1) / time.Second)
 	}
+	if c.ExpireAfterAccess > 0 {
+		cache.accessTTL = uint32((c.ExpireAfterAccess + time.Second - 1) / time.Second)
+	}
+	if c.StaleTTL > 0 {
+		cache.staleTTL = uint32((c.StaleTTL + time.Second - 1) / time.Second)
+	}
 
 	cache.withExpiration = c.TTL != nil || c.WithVariableTTL
+	proactive := cache.withExpiration && !c.NoProactiveExpiration
+	switch {
+	case proactive && (c.TimerWheel || c.PreciseExpiration):
+		cache.expirePolicy = expire.NewTimerWheel[K, V](cache.staleTTL)
+	case proactive:
+		cache.expirePolicy = expire.NewPolicy[K, V](cache.staleTTL)
+	default:
+		cache.expirePolicy = expire.NewDisabled[K, V]()
+	}
+
+	hashConfig := hashtable.Config{
+		Size:         initialCapacity,
+		ShardCount:   c.ShardCount,
+		LoadFactor:   c.HashTableLoadFactor,
+		GrowthFactor: c.HashTableGrowthFactor,
+		Sequence:     c.StableRange || c.Versioned || c.Sequenced,
+	}
+	if !cache.amortized {
+		// the migrations after the resizes of the hash table are joined by Close.
+		hashConfig.Go = func(f func()) {
+			cache.wg.Add(1)
+			go func() {
+				defer cache.wg.Done()
+				f()
+			}()
+		}
+	}
+	cache.hashmap = hashtable.NewWithConfig[K, V](hashConfig)
+
+	cache.proactive = proactive
+	cache.withClock = cache.withExpiration || cache.entryStats
+	if cache.amortized {
+		// there are no goroutines at all, the callers apply the writes and remove the expired items.
+		if cache.withClock {
+			unixtime.StartLazy()
+		}
+		return cache
+	}
 
-	if cache.withExpiration {
+	if cache.withClock {
 		unixtime.Start()
+	}
+	if proactive {
+		cache.wg.Add(1)
 		go cache.cleanup()
 	}
 
+	if maxReadBuffersCount > 0 {
+		cache.wg.Add(1)
+		go cache.scaleReadBuffers(minReadBuffersCount, maxReadBuffersCount)
+	}
+
+	if c.MemoryPressure != nil {
+		cache.wg.Add(1)
+		go cache.watchMemoryPressure(c.MemoryPressure)
+	}
+
+	cache.wg.Add(1)
 	go cache.process()
 
 	return cache
 }
 
-func (c *Cache[K, V]) getReadBufferIdx() int {
-	return int(xruntime.Fastrand() & c.mask)
-}
-
 // Has checks if there is an item with the given key in the cache.
 func (c *Cache[K, V]) Has(key K) bool {
-	_, ok := c.Get(key)
+	if c.latencies == nil {
+		return c.has(key)
+	}
+
+	start := time.Now()
+	ok := c.has(key)
+	c.latencies.Record(stats.HasOperation, time.Since(start))
 	return ok
 }
 
+// has doesn't consume the reads of the read-limited nodes, so only the lookups returning the value count.
+func (c *Cache[K, V]) has(key K) bool {
+	got, ok := c.hashmap.Get(key)
+	if ok && (got.IsExpired() || got.ReadsExhausted()) {
+		c.deleteIfDead(got)
+		ok = false
+	}
+
+	if !ok {
+		if c.hasInStats {
+			c.stats.IncReadMisses(stats.HasRead)
+		}
+		return false
+	}
+
+	c.afterGet(got)
+	if c.hasInStats {
+		c.stats.IncReadHits(stats.HasRead)
+	}
+	return true
+}
+
+// Peek returns the value associated with the key in this cache
+// without updating the statistics and the eviction policy.
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	got, ok := c.hashmap.Get(key)
+	if !ok || got.IsExpired() {
+		return zeroValue[V](), false
+	}
+
+	return got.Value(), true
+}
+
 // Get returns the value associated with the key in this cache.
 func (c *Cache[K, V]) Get(key K) (V, bool) {
-	got, ok := c.hashmap.Get(key)
+	got, ok := c.GetNode(key)
 	if !ok {
-		c.stats.IncMisses()
 		return zeroValue[V](), false
 	}
 
+	return got.Value(), true
+}
+
+// Frequency returns the access frequency of the item associated with the key estimated by the eviction policy
+// without updating the statistics and the eviction policy. The frequency is in the range [0, node.MaxFrequency].
+func (c *Cache[K, V]) Frequency(key K) (uint8, bool) {
+	got, ok := c.hashmap.Get(key)
+	if !ok || got.IsExpired() {
+		return 0, false
+	}
+
+	// the frequency is updated by the policy under the lock.
+	c.evictionMutex.Lock()
+	frequency := got.Frequency()
+	c.evictionMutex.Unlock()
+	return frequency, true
+}
+
+// GetNode returns the node associated with the key in this cache.
+func (c *Cache[K, V]) GetNode(key K) (*node.Node[K, V], bool) {
+	if c.latencies == nil {
+		return c.getNode(key, stats.GetRead)
+	}
+
+	start := time.Now()
+	got, ok := c.getNode(key, stats.GetRead)
+	c.latencies.Record(stats.GetOperation, time.Since(start))
+	return got, ok
+}
+
+func (c *Cache[K, V]) getNode(key K, op stats.ReadOperation) (*node.Node[K, V], bool) {
+	got, ok := c.hashmap.Get(key)
+	if !ok {
+		c.stats.IncReadMisses(op)
+		return nil, false
+	}
+
+	if got.IsExpired() || !c.consumeRead(got) {
+		c.deleteIfDead(got)
+		c.stats.IncReadMisses(op)
+		return nil, false
+	}
+
+	c.afterGet(got)
+	c.stats.IncReadHits(op)
+
+	return got, true
+}
+
+// GetStaleNode returns the node associated with the key in this cache
+// even if it has expired, as long as it is within the stale ttl.
+//
+// It is used by the loading cache, so the reads are recorded as loads, and reads of stale nodes as misses.
+func (c *Cache[K, V]) GetStaleNode(key K) (n *node.Node[K, V], stale, ok bool) {
+	got, ok := c.hashmap.Get(key)
+	if !ok {
+		c.stats.IncReadMisses(stats.LoadRead)
+		return nil, false, false
+	}
+
 	if got.IsExpired() {
-		c.writeBuffer.Insert(node.NewDeleteTask(got))
-		c.stats.IncMisses()
-		return zeroValue[V](), false
+		c.stats.IncReadMisses(stats.LoadRead)
+		if c.deleteIfDead(got) {
+			return nil, false, false
+		}
+		return got, true, true
+	}
+
+	if !c.consumeRead(got) {
+		c.stats.IncReadMisses(stats.LoadRead)
+		return nil, false, false
 	}
 
 	c.afterGet(got)
-	c.stats.IncHits()
+	c.stats.IncReadHits(stats.LoadRead)
+
+	return got, false, true
+}
+
+// consumeRead consumes one of the reads allowed for the node, deletes the node after its last read
+// and reports whether the read is allowed.
+func (c *Cache[K, V]) consumeRead(n *node.Node[K, V]) bool {
+	ok, last := n.ConsumeRead()
+	if last {
+		c.deleteNode(n, ExpireEvent)
+	}
+	return ok
+}
+
+// deleteIfDead deletes the expired node once it is out of the stale ttl
+// and reports whether the node has been deleted.
+func (c *Cache[K, V]) deleteIfDead(n *node.Node[K, V]) bool {
+	if !c.lazyExpiration {
+		return false
+	}
+
+	now := unixtime.Now()
+	if now < c.staleTTL || !n.IsExpiredAt(now-c.staleTTL) {
+		return false
+	}
+
+	c.deleteNode(n, ExpireEvent)
+	return true
+}
+
+// GetNodes calls f for each node associated with one of the given keys in this cache.
+//
+// Unlike the sequence of GetNode calls, the eviction policy is updated only once for the whole batch.
+func (c *Cache[K, V]) GetNodes(keys []K, f func(n *node.Node[K, V])) {
+	parallelism := 1
+	if c.parallelBatch > 0 && len(keys) >= c.parallelBatch {
+		parallelism = int(xruntime.Parallelism())
+	}
+	nodes := make([]*node.Node[K, V], len(keys))
+	c.hashmap.GetAll(keys, nodes, parallelism)
+
+	hits := make([]*node.Node[K, V], 0, len(keys))
+	for _, got := range nodes {
+		if got == nil {
+			c.stats.IncReadMisses(stats.GetRead)
+			continue
+		}
+
+		if got.IsExpired() || !c.consumeRead(got) {
+			c.deleteIfDead(got)
+			c.stats.IncReadMisses(stats.GetRead)
+			continue
+		}
+
+		c.touch(got)
+		c.recordAccess(got)
+		c.stats.IncReadHits(stats.GetRead)
+		hits = append(hits, got)
+		f(got)
+	}
+
+	if len(hits) > 0 {
+		c.evictionMutex.Lock()
+		c.policy.Read(hits)
+		c.countTopKeys(hits)
+		c.evictionMutex.Unlock()
+	}
+}
+
+func (c *Cache[K, V]) insertTask(task node.WriteTask[K, V]) {
+	if c.synchronous {
+		if task.IsBatch() {
+			c.applyWrites(nil, task.Batch())
+		} else {
+			tasks := [1]node.WriteTask[K, V]{task}
+			c.applyWrites(nil, tasks[:])
+		}
+		c.maintain()
+		return
+	}
+
+	if c.writeBuffer.Insert(task) {
+		c.stats.IncWriteBufferContentions()
+		c.logger.warn(writeBufferFullWarning, "otter: write buffer is full, writes are blocked until the maintenance catches up",
+			"capacity", c.writeBuffer.Capacity())
+	}
+}
 
-	return got.Value(), ok
+// touch extends the lifetime of the node after an access.
+func (c *Cache[K, V]) touch(n *node.Node[K, V]) {
+	if c.accessTTL > 0 {
+		n.SetAccessExpiration(unixtime.Now() + c.accessTTL)
+	}
+}
+
+// recordAccess updates the per-entry statistics of the node after a hit.
+func (c *Cache[K, V]) recordAccess(n *node.Node[K, V]) {
+	if c.entryStats {
+		n.RecordAccess(unixtime.Now())
+	}
 }
 
 func (c *Cache[K, V]) afterGet(got *node.Node[K, V]) {
-	idx := c.getReadBufferIdx()
-	pb := c.readBuffers[idx].Add(got)
+	c.touch(got)
+	c.recordAccess(got)
+	rs := c.readBuffers.Load()
+	idx := int(xruntime.Fastrand() & rs.mask)
+	pb, ok := rs.buffers[idx].Add(got)
+	if !ok {
+		c.stats.IncReadBufferDrops()
+	}
 	if pb != nil {
 		c.evictionMutex.Lock()
 		c.policy.Read(pb.Returned)
+		c.countTopKeys(pb.Returned)
 		c.evictionMutex.Unlock()
 
-		c.readBuffers[idx].Free()
+		rs.buffers[idx].Free()
 	}
+	c.maintain()
 }
 
 // Set associates the value with the key in this cache.
 //
 // If it returns false, then the key-value item had too much cost and the Set was dropped.
 func (c *Cache[K, V]) Set(key K, value V) bool {
-	return c.set(key, value, c.defaultExpiration(), false)
+	return c.set(key, value, c.defaultExpiration(), false, false)
 }
 
 func (c *Cache[K, V]) defaultExpiration() uint32 {
@@ -181,7 +630,97 @@ func (c *Cache[K, V]) defaultExpiration() uint32 {
 //
 // If it returns false, then the key-value item had too much cost and the SetWithTTL was dropped.
 func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) bool {
-	return c.set(key, value, getExpiration(ttl), false)
+	return c.set(key, value, c.expiration(ttl), false, false)
+}
+
+// SetForceAdmit is like Set, but the new item bypasses the doorkeeper and the admission policy.
+func (c *Cache[K, V]) SetForceAdmit(key K, value V) bool {
+	return c.set(key, value, c.defaultExpiration(), false, true)
+}
+
+// SetWithTTLForceAdmit is like SetWithTTL, but the new item bypasses the doorkeeper and the admission policy.
+func (c *Cache[K, V]) SetWithTTLForceAdmit(key K, value V, ttl time.Duration) bool {
+	return c.set(key, value, c.expiration(ttl), false, true)
+}
+
+// SetWithMaxReads associates the value with the key in this cache and removes the item
+// after maxReads successful reads. The zero ttl means the default expiration.
+func (c *Cache[K, V]) SetWithMaxReads(key K, value V, ttl time.Duration, maxReads uint32) bool {
+	if c.latencies == nil {
+		return c.setWithMaxReads(key, value, ttl, maxReads)
+	}
+
+	start := time.Now()
+	ok := c.setWithMaxReads(key, value, ttl, maxReads)
+	c.latencies.Record(stats.SetOperation, time.Since(start))
+	return ok
+}
+
+func (c *Cache[K, V]) setWithMaxReads(key K, value V, ttl time.Duration, maxReads uint32) bool {
+	if c.frozen.Load() {
+		return false
+	}
+
+	cost := c.costFunc(key, value)
+	if c.rejectSet(cost) {
+		return false
+	}
+
+	expiration := c.defaultExpiration()
+	if ttl > 0 {
+		expiration = c.expiration(ttl)
+	}
+	if maxReads > node.MaxReads {
+		maxReads = node.MaxReads
+	}
+	n := c.newNode(key, value, expiration, cost)
+	n.SetMaxReads(maxReads)
+	return c.publish(n, false, false)
+}
+
+// SetAdmissionEnabled turns the doorkeeper and the admission policy on or off.
+func (c *Cache[K, V]) SetAdmissionEnabled(enabled bool) {
+	c.evictionMutex.Lock()
+	c.policy.SetAdmissionEnabled(enabled)
+	c.evictionMutex.Unlock()
+}
+
+// Restore is like SetWithTTL, but it places the new item into the given queue of the eviction policy
+// with the given frequency instead of admitting it as a new item. Zero ttl means the default expiration.
+//
+// It is used to restore the policy state of the persisted items.
+func (c *Cache[K, V]) Restore(key K, value V, ttl time.Duration, frequency uint8, main bool) bool {
+	if c.frozen.Load() {
+		return false
+	}
+
+	cost := c.costFunc(key, value)
+	if c.rejectOversized(cost) {
+		return false
+	}
+
+	expiration := c.defaultExpiration()
+	if ttl > 0 {
+		expiration = c.expiration(ttl)
+	}
+	n := c.newNode(key, value, expiration, cost)
+	n.SetFrequency(frequency)
+	if main {
+		n.MarkMain()
+	} else {
+		n.MarkSmall()
+	}
+
+	evicted := c.hashmap.Set(n)
+	c.watchValue(n)
+	if evicted != nil {
+		c.insertTask(node.NewUpdateTask(n, evicted))
+		c.emit(UpdateEvent, n)
+	} else {
+		c.insertTask(node.NewRestoreTask(n))
+		c.emit(InsertEvent, n)
+	}
+	return true
 }
 
 // SetIfAbsent if the specified key is not already associated with a value associates it with the given value.
@@ -190,7 +729,7 @@ func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) bool {
 //
 // Also, it returns false if the key-value item had too much cost and the SetIfAbsent was dropped.
 func (c *Cache[K, V]) SetIfAbsent(key K, value V) bool {
-	return c.set(key, value, c.defaultExpiration(), true)
+	return c.set(key, value, c.defaultExpiration(), true, false)
 }
 
 // SetIfAbsentWithTTL if the specified key is not already associated with a value associates it with the given value
@@ -200,92 +739,577 @@ func (c *Cache[K, V]) SetIfAbsent(key K, value V) bool {
 //
 // Also, it returns false if the key-value item had too much cost and the SetIfAbsent was dropped.
 func (c *Cache[K, V]) SetIfAbsentWithTTL(key K, value V, ttl time.Duration) bool {
-	return c.set(key, value, getExpiration(ttl), true)
+	return c.set(key, value, c.expiration(ttl), true, false)
+}
+
+// GetOrSet returns the existing value for the key if present.
+// Otherwise, it associates the given value with the key and returns it.
+// The loaded result is true if the value was loaded, false if stored.
+//
+// If the key-value item had too much cost, then it isn't stored and the given value is returned.
+func (c *Cache[K, V]) GetOrSet(key K, value V) (V, bool) {
+	return c.getOrSet(key, value, c.defaultExpiration())
+}
+
+// GetOrSetWithTTL is like GetOrSet, but sets the custom ttl for the stored key-value item.
+func (c *Cache[K, V]) GetOrSetWithTTL(key K, value V, ttl time.Duration) (V, bool) {
+	return c.getOrSet(key, value, c.expiration(ttl))
+}
+
+func (c *Cache[K, V]) getOrSet(key K, value V, expiration uint32) (V, bool) {
+	if c.frozen.Load() {
+		if v, ok := c.Get(key); ok {
+			return v, true
+		}
+		return value, false
+	}
+
+	cost := c.costFunc(key, value)
+	if c.rejectSet(cost) {
+		return value, false
+	}
+
+	n := c.newNode(key, value, expiration, cost)
+	for {
+		got := c.hashmap.SetIfAbsent(n)
+		if got == nil {
+			// insert
+			c.watchValue(n)
+			c.insertTask(node.NewAddTask(n))
+			c.emit(InsertEvent, n)
+			c.stats.IncReadMisses(stats.GetRead)
+			return value, false
+		}
+
+		if !got.IsExpired() && c.consumeRead(got) {
+			c.nodePool.Put(n)
+			c.afterGet(got)
+			c.stats.IncReadHits(stats.GetRead)
+			return got.Value(), true
+		}
+
+		// the current node is expired or its reads are exhausted, so remove it and try again.
+		c.deleteNode(got, ExpireEvent)
+	}
+}
+
+func (c *Cache[K, V]) newNode(key K, value V, expiration, cost uint32) *node.Node[K, V] {
+	if c.internKey != nil {
+		key = c.internKey(key)
+	}
+	n := c.nodePool.Get(key, value, expiration, cost)
+	c.touch(n)
+	if c.entryStats {
+		n.SetLastWrite(unixtime.Now())
+	}
+	return n
+}
+
+// watchValue makes the node deleted once its weak value is reclaimed.
+//
+// It is called only after the node is inserted into the hash table, since a node which isn't inserted
+// goes back to the node pool, and the cleanup would delete the node reused for another key.
+func (c *Cache[K, V]) watchValue(n *node.Node[K, V]) {
+	if c.weakValues == nil {
+		return
+	}
+	c.weakValues(n.Value(), func() {
+		c.deleteNode(n, EvictEvent)
+	})
+}
+
+func (c *Cache[K, V]) set(key K, value V, expiration uint32, onlyIfAbsent, forceAdmit bool) bool {
+	if c.latencies == nil {
+		return c.setNode(key, value, expiration, onlyIfAbsent, forceAdmit)
+	}
+
+	start := time.Now()
+	ok := c.setNode(key, value, expiration, onlyIfAbsent, forceAdmit)
+	c.latencies.Record(stats.SetOperation, time.Since(start))
+	return ok
+}
+
+// rejectSet reports whether the set of the item with the given cost has to be rejected
+// because of a full write buffer or too much cost, and records the rejection.
+func (c *Cache[K, V]) rejectSet(cost uint32) bool {
+	if c.rejectOnFull && c.WriteBufferFull() {
+		c.stats.IncRejectedSets()
+		return true
+	}
+	return c.rejectOversized(cost)
+}
+
+// WriteBufferFull reports whether the write buffer is full, so the writes wait for the maintenance.
+func (c *Cache[K, V]) WriteBufferFull() bool {
+	return !c.synchronous && c.writeBuffer.Size() >= c.writeBuffer.Capacity()
+}
+
+// TrySet is like SetWithTTL, but it doesn't wait for the maintenance when the write buffer is full
+// and reports it instead. Zero ttl means the default expiration.
+func (c *Cache[K, V]) TrySet(key K, value V, ttl time.Duration) (set, full bool) {
+	if c.WriteBufferFull() {
+		c.stats.IncRejectedSets()
+		return false, true
+	}
+
+	expiration := c.defaultExpiration()
+	if ttl > 0 {
+		expiration = c.expiration(ttl)
+	}
+	return c.set(key, value, expiration, false, false), false
+}
+
+// rejectOversized reports whether the item with the given cost exceeds the max entry cost
+// or the max available cost of the policy and records the rejection.
+func (c *Cache[K, V]) rejectOversized(cost uint32) bool {
+	maxCost := c.policy.MaxAvailableCost()
+	if c.maxEntryCost > 0 && c.maxEntryCost < maxCost {
+		maxCost = c.maxEntryCost
+	}
+	if cost <= maxCost {
+		return false
+	}
+
+	c.stats.IncRejectedSets()
+	c.logger.warn(oversizeItemWarning, "otter: item is rejected because its cost exceeds the max cost",
+		"cost", cost, "max_cost", maxCost)
+	return true
 }
 
-func (c *Cache[K, V]) set(key K, value V, expiration uint32, onlyIfAbsent bool) bool {
+func (c *Cache[K, V]) setNode(key K, value V, expiration uint32, onlyIfAbsent, forceAdmit bool) bool {
+	if c.frozen.Load() {
+		return false
+	}
+
 	cost := c.costFunc(key, value)
-	if cost > c.policy.MaxAvailableCost() {
+	if c.rejectSet(cost) {
 		return false
 	}
 
-	n := node.New(key, value, expiration, cost)
+	n := c.newNode(key, value, expiration, cost)
+	return c.publish(n, onlyIfAbsent, forceAdmit)
+}
+
+func (c *Cache[K, V]) publish(n *node.Node[K, V], onlyIfAbsent, forceAdmit bool) bool {
 	if onlyIfAbsent {
 		res := c.hashmap.SetIfAbsent(n)
 		if res == nil {
 			// insert
-			c.writeBuffer.Insert(node.NewAddTask(n))
+			c.watchValue(n)
+			c.insertTask(node.NewAddTask(n))
+			c.emit(InsertEvent, n)
 			return true
 		}
+		c.nodePool.Put(n)
 		return false
 	}
 
 	evicted := c.hashmap.Set(n)
+	c.watchValue(n)
 	if evicted != nil {
 		// update
-		c.writeBuffer.Insert(node.NewUpdateTask(n, evicted))
+		c.insertTask(node.NewUpdateTask(n, evicted))
+		c.emit(UpdateEvent, n)
 	} else {
 		// insert
-		c.writeBuffer.Insert(node.NewAddTask(n))
+		if forceAdmit {
+			c.insertTask(node.NewForceAdmitTask(n))
+		} else {
+			c.insertTask(node.NewAddTask(n))
+		}
+		c.emit(InsertEvent, n)
 	}
 
 	return true
 }
 
-// Delete removes the association for this key from the cache.
-func (c *Cache[K, V]) Delete(key K) {
-	deleted := c.hashmap.Delete(key)
-	if deleted != nil {
-		c.writeBuffer.Insert(node.NewDeleteTask(deleted))
+// SetIfVersion is like SetWithTTL, but it sets the item only if the version of the current item is the given one.
+// Zero version means that there must be no current item. Zero ttl means the default expiration.
+func (c *Cache[K, V]) SetIfVersion(key K, value V, version uint64, ttl time.Duration) bool {
+	if c.latencies == nil {
+		return c.setIfVersion(key, value, version, ttl)
 	}
+
+	start := time.Now()
+	ok := c.setIfVersion(key, value, version, ttl)
+	c.latencies.Record(stats.SetOperation, time.Since(start))
+	return ok
 }
 
-func (c *Cache[K, V]) deleteNode(n *node.Node[K, V]) {
-	deleted := c.hashmap.DeleteNode(n)
-	if deleted != nil {
-		c.writeBuffer.Insert(node.NewDeleteTask(deleted))
+func (c *Cache[K, V]) setIfVersion(key K, value V, version uint64, ttl time.Duration) bool {
+	if c.frozen.Load() {
+		return false
 	}
-}
 
-// DeleteByFunc removes the association for this key from the cache when the given function returns true.
-func (c *Cache[K, V]) DeleteByFunc(f func(key K, value V) bool) {
-	c.hashmap.Range(func(n *node.Node[K, V]) bool {
-		if n.IsExpired() {
-			return true
-		}
+	cost := c.costFunc(key, value)
+	if c.rejectSet(cost) {
+		return false
+	}
 
-		if f(n.Key(), n.Value()) {
-			c.deleteNode(n)
+	expiration := c.defaultExpiration()
+	if ttl > 0 {
+		expiration = c.expiration(ttl)
+	}
+	n := c.newNode(key, value, expiration, cost)
+	prev, ok := c.hashmap.SetIf(n, func(current *node.Node[K, V]) bool {
+		if current == nil || current.IsExpired() {
+			return version == 0
 		}
-
-		return true
+		return version != 0 && current.Sequence() == version
 	})
+	if !ok {
+		c.nodePool.Put(n)
+		return false
+	}
+	c.watchValue(n)
+
+	if prev != nil {
+		c.insertTask(node.NewUpdateTask(n, prev))
+		c.emit(UpdateEvent, n)
+	} else {
+		c.insertTask(node.NewAddTask(n))
+		c.emit(InsertEvent, n)
+	}
+	return true
+}
+
+// Mutation is a single set or delete of the batch applied by Apply.
+type Mutation[K comparable, V any] struct {
+	Key   K
+	Value V
+	// TTL is the custom ttl of the set item, zero means the default expiration.
+	TTL    time.Duration
+	Delete bool
+}
+
+// Apply applies the batch so that a concurrent Range never observes the changes
+// of keys in the same hash table bucket partially applied.
+//
+// Sets of items with too much cost are dropped.
+func (c *Cache[K, V]) Apply(batch []Mutation[K, V]) {
+	if c.frozen.Load() {
+		return
+	}
+
+	ops := make([]hashtable.Op[K, V], 0, len(batch))
+	for _, m := range batch {
+		if m.Delete {
+			ops = append(ops, hashtable.Op[K, V]{Key: m.Key})
+			continue
+		}
+
+		cost := c.costFunc(m.Key, m.Value)
+		if c.rejectOversized(cost) {
+			continue
+		}
+		expiration := c.defaultExpiration()
+		if m.TTL > 0 {
+			expiration = c.expiration(m.TTL)
+		}
+		ops = append(ops, hashtable.Op[K, V]{
+			Key:  m.Key,
+			Node: c.newNode(m.Key, m.Value, expiration, cost),
+		})
+	}
+
+	tasks := make([]node.WriteTask[K, V], 0, len(ops))
+	c.hashmap.Apply(ops, func(i int, prev *node.Node[K, V]) {
+		n := ops[i].Node
+		switch {
+		case n == nil:
+			if prev != nil {
+				tasks = append(tasks, node.NewDeleteTask(prev))
+				c.emit(DeleteEvent, prev)
+			}
+		case prev != nil:
+			c.watchValue(n)
+			tasks = append(tasks, node.NewUpdateTask(n, prev))
+			c.emit(UpdateEvent, n)
+		default:
+			c.watchValue(n)
+			tasks = append(tasks, node.NewAddTask(n))
+			c.emit(InsertEvent, n)
+		}
+	})
+
+	switch len(tasks) {
+	case 0:
+	case 1:
+		c.insertTask(tasks[0])
+	default:
+		// the whole batch takes a single slot of the write buffer.
+		c.insertTask(node.NewBatchTask(tasks))
+	}
+}
+
+// Delete removes the association for this key from the cache.
+func (c *Cache[K, V]) Delete(key K) {
+	if c.latencies == nil {
+		c.delete(key)
+		return
+	}
+
+	start := time.Now()
+	c.delete(key)
+	c.latencies.Record(stats.DeleteOperation, time.Since(start))
+}
+
+// DeleteAndGet removes the association for this key from the cache and returns the removed value.
+//
+// The ok result is false if the key wasn't present in the cache or its item had already expired.
+func (c *Cache[K, V]) DeleteAndGet(key K) (value V, ok bool) {
+	if c.latencies == nil {
+		return c.deleteAndGet(key)
+	}
+
+	start := time.Now()
+	value, ok = c.deleteAndGet(key)
+	c.latencies.Record(stats.DeleteOperation, time.Since(start))
+	return value, ok
+}
+
+func (c *Cache[K, V]) deleteAndGet(key K) (V, bool) {
+	deleted := c.delete(key)
+	if deleted == nil || deleted.IsExpired() {
+		return zeroValue[V](), false
+	}
+	return deleted.Value(), true
+}
+
+func (c *Cache[K, V]) delete(key K) *node.Node[K, V] {
+	if c.frozen.Load() {
+		return nil
+	}
+
+	deleted := c.hashmap.Delete(key)
+	if deleted != nil {
+		c.insertTask(node.NewDeleteTask(deleted))
+		c.emit(DeleteEvent, deleted)
+	}
+	return deleted
+}
+
+func (c *Cache[K, V]) deleteNode(n *node.Node[K, V], kind EventKind) {
+	deleted := c.hashmap.DeleteNode(n)
+	if deleted != nil {
+		c.insertTask(node.NewDeleteTask(deleted))
+		c.emit(kind, deleted)
+	}
+}
+
+// DeleteByFunc removes the association for this key from the cache when the given function returns true.
+func (c *Cache[K, V]) DeleteByFunc(f func(key K, value V) bool) {
+	if c.frozen.Load() {
+		return
+	}
+
+	c.hashmap.Range(func(n *node.Node[K, V]) bool {
+		if n.IsExpired() {
+			return true
+		}
+
+		if f(n.Key(), n.Value()) {
+			c.deleteNode(n, DeleteEvent)
+		}
+
+		return true
+	})
+
+	// the deletions shrink the table only when it is almost empty, so release the memory of the mass deletions.
+	c.hashmap.Compact()
 }
 
 func (c *Cache[K, V]) cleanup() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
 	expired := make([]*node.Node[K, V], 0, 128)
+	backwardJumps := unixtime.BackwardJumps()
 	for {
-		time.Sleep(time.Second)
+		select {
+		case <-c.stopCleanup:
+			return
+		case <-ticker.C:
+		}
 
+		if jumps := unixtime.BackwardJumps(); jumps != backwardJumps {
+			backwardJumps = jumps
+			c.logger.warn(clockBackwardsWarning, "otter: wall clock has gone backwards, expiration is paused until it catches up")
+		}
+
+		start := time.Now()
 		c.evictionMutex.Lock()
 		if c.isClosed {
+			c.evictionMutex.Unlock()
 			return
 		}
 
-		e := c.expirePolicy.RemoveExpired(expired)
-		c.policy.Delete(e)
+		e := c.removeExpired(expired)
 
+		c.throttle(start, len(e))
+		expired = clearBuffer(expired)
+	}
+}
+
+// removeExpired removes the expired items from the policies and the hash table.
+//
+// It must be called with the locked eviction mutex, which it unlocks.
+func (c *Cache[K, V]) removeExpired(expired []*node.Node[K, V]) []*node.Node[K, V] {
+	e := c.expirePolicy.RemoveExpired(expired)
+	c.policy.Delete(e)
+
+	c.evictionMutex.Unlock()
+
+	for _, n := range e {
+		if c.hashmap.DeleteNode(n) != nil {
+			c.emit(ExpireEvent, n)
+		}
+	}
+	return e
+}
+
+// maintain removes the expired items on the calling goroutine in the amortized mode.
+//
+// It does the work at most once a second and skips it if another goroutine holds the eviction lock.
+func (c *Cache[K, V]) maintain() {
+	if !c.amortized || !c.proactive {
+		return
+	}
+
+	now := unixtime.Now()
+	last := c.lastMaintenance.Load()
+	if now <= last || !c.lastMaintenance.CompareAndSwap(last, now) {
+		return
+	}
+	if !c.evictionMutex.TryLock() {
+		return
+	}
+	if c.isClosed {
 		c.evictionMutex.Unlock()
+		return
+	}
+
+	c.removeExpired(nil)
+}
+
+const (
+	// pressureCooldown is the number of the checks in a row without the memory pressure
+	// after which the capacity of the shrunk cache starts to grow back.
+	pressureCooldown = 5
+	// maxPressureShrink is the max number of times the capacity is halved under the memory pressure.
+	maxPressureShrink = 4
+)
+
+// memoryPressure decides the max cost of the cache from the results of the memory pressure checks.
+//
+// The max cost is halved on every check while the memory is under pressure, down to 1/16 of the capacity,
+// and it is doubled back one step per check only after pressureCooldown checks without the pressure,
+// so the cache doesn't flap between the sizes while the memory usage is around the threshold.
+type memoryPressure struct {
+	capacity uint32
+	maxCost  uint32
+	calm     int
+}
+
+func newMemoryPressure(capacity uint32) *memoryPressure {
+	return &memoryPressure{
+		capacity: capacity,
+		maxCost:  capacity,
+	}
+}
 
-		for _, n := range e {
-			c.hashmap.DeleteNode(n)
+// next returns the new max cost after the check and reports whether it has changed.
+func (p *memoryPressure) next(pressured bool) (uint32, bool) {
+	if pressured {
+		p.calm = 0
+		minCost := p.capacity >> maxPressureShrink
+		if minCost == 0 {
+			minCost = 1
 		}
+		if p.maxCost <= minCost {
+			return p.maxCost, false
+		}
+		p.maxCost /= 2
+		if p.maxCost < minCost {
+			p.maxCost = minCost
+		}
+		return p.maxCost, true
+	}
 
-		expired = clearBuffer(expired)
+	if p.maxCost == p.capacity {
+		return p.maxCost, false
+	}
+	p.calm++
+	if p.calm < pressureCooldown {
+		return p.maxCost, false
 	}
+	if p.maxCost > p.capacity/2 {
+		p.maxCost = p.capacity
+	} else {
+		p.maxCost *= 2
+	}
+	return p.maxCost, true
+}
+
+// watchMemoryPressure shrinks the capacity of the cache step by step while the memory is under pressure
+// and restores it step by step once the pressure has been gone for a while.
+func (c *Cache[K, V]) watchMemoryPressure(pressured func() bool) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	p := newMemoryPressure(uint32(c.capacity))
+	for {
+		select {
+		case <-c.stopCleanup:
+			return
+		case <-ticker.C:
+		}
+
+		maxCost, changed := p.next(pressured())
+		if !changed {
+			continue
+		}
+		if p.calm == 0 {
+			c.logger.warn(memoryPressureWarning, "otter: memory is under pressure, the capacity is temporarily reduced",
+				"capacity", c.capacity, "max_cost", maxCost)
+		}
+		if !c.resize(maxCost) {
+			return
+		}
+	}
+}
+
+// resize sets the max cost of the eviction policy and evicts the items which don't fit into it.
+//
+// It returns false if the cache is closed.
+func (c *Cache[K, V]) resize(maxCost uint32) bool {
+	c.evictionMutex.Lock()
+	if c.isClosed {
+		c.evictionMutex.Unlock()
+		return false
+	}
+
+	deleted := c.policy.Resize(nil, maxCost)
+	for _, n := range deleted {
+		c.expirePolicy.Delete(n)
+	}
+	c.evictionMutex.Unlock()
+
+	for _, n := range deleted {
+		if c.hashmap.DeleteNode(n) != nil {
+			c.emitEviction(n)
+		}
+	}
+	return true
 }
 
 func (c *Cache[K, V]) process() {
+	defer c.wg.Done()
+
 	bufferCapacity := 64
 	buffer := make([]node.WriteTask[K, V], 0, bufferCapacity)
 	deleted := make([]*node.Node[K, V], 0, bufferCapacity)
@@ -294,16 +1318,11 @@ func (c *Cache[K, V]) process() {
 		task := c.writeBuffer.Remove()
 
 		if task.IsClear() || task.IsClose() {
+			i = 0
 			buffer = clearBuffer(buffer)
 			c.writeBuffer.Clear()
 
-			c.evictionMutex.Lock()
-			c.policy.Clear()
-			c.expirePolicy.Clear()
-			if task.IsClose() {
-				c.isClosed = true
-			}
-			c.evictionMutex.Unlock()
+			c.clearPolicies(task.IsClose())
 
 			c.doneClear <- struct{}{}
 			if task.IsClose() {
@@ -312,35 +1331,36 @@ func (c *Cache[K, V]) process() {
 			continue
 		}
 
-		buffer = append(buffer, task)
-		i++
-		if i >= bufferCapacity {
-			i -= bufferCapacity
-
-			c.evictionMutex.Lock()
-
-			for _, t := range buffer {
-				switch {
-				case t.IsDelete():
-					c.expirePolicy.Delete(t.Node())
-				case t.IsAdd():
-					c.expirePolicy.Add(t.Node())
-				case t.IsUpdate():
-					c.expirePolicy.Delete(t.OldNode())
-					c.expirePolicy.Add(t.Node())
-				}
+		if task.IsBatch() || task.IsSync() {
+			// the pending writes go first to keep the order, then the batch is applied at once.
+			if len(buffer) > 0 {
+				i = 0
+				deleted = c.applyWrites(deleted, buffer)
+				buffer = clearBuffer(buffer)
+				deleted = clearBuffer(deleted)
 			}
-
-			d := c.policy.Write(deleted, buffer)
-			for _, n := range d {
-				c.expirePolicy.Delete(n)
+			if task.IsSync() {
+				c.doneSync <- struct{}{}
+				continue
 			}
 
-			c.evictionMutex.Unlock()
+			start := time.Now()
+			batch := task.Batch()
+			c.applyWrites(nil, batch)
+			c.throttle(start, len(batch))
+			continue
+		}
 
-			for _, n := range d {
-				c.hashmap.DeleteNode(n)
-			}
+		buffer = append(buffer, task)
+		i++
+		// with the precise expiration, new items must reach the expiration policy
+		// without waiting for the batch to fill up.
+		if i >= bufferCapacity || (c.precise && c.writeBuffer.Size() == 0) {
+			i = 0
+
+			start := time.Now()
+			deleted = c.applyWrites(deleted, buffer)
+			c.throttle(start, len(buffer))
 
 			buffer = clearBuffer(buffer)
 			deleted = clearBuffer(deleted)
@@ -348,10 +1368,80 @@ func (c *Cache[K, V]) process() {
 	}
 }
 
+// clearPolicies clears the eviction and expiration policies and marks the cache as closed if needed.
+func (c *Cache[K, V]) clearPolicies(closed bool) {
+	c.evictionMutex.Lock()
+	c.policy.Clear()
+	c.expirePolicy.Clear()
+	if c.topKeys != nil {
+		c.topKeys.Clear()
+	}
+	if closed {
+		c.isClosed = true
+	}
+	c.evictionMutex.Unlock()
+}
+
+// throttle suspends the maintenance goroutine so that it doesn't exceed the maintenance rate.
+func (c *Cache[K, V]) throttle(start time.Time, ops int) {
+	if c.maintenanceRate <= 0 || ops == 0 {
+		return
+	}
+
+	budget := time.Duration(ops) * time.Second / time.Duration(c.maintenanceRate)
+	if elapsed := time.Since(start); elapsed < budget {
+		d := budget - elapsed
+		time.Sleep(d)
+		c.stats.AddThrottledTime(d)
+	}
+}
+
+func (c *Cache[K, V]) applyWrites(deleted []*node.Node[K, V], buffer []node.WriteTask[K, V]) []*node.Node[K, V] {
+	c.evictionMutex.Lock()
+
+	for _, t := range buffer {
+		switch {
+		case t.IsDelete():
+			c.expirePolicy.Delete(t.Node())
+		case t.IsAdd():
+			c.expirePolicy.Add(t.Node())
+		case t.IsUpdate():
+			c.expirePolicy.Delete(t.OldNode())
+			c.expirePolicy.Add(t.Node())
+		}
+	}
+
+	d := c.policy.Write(deleted, buffer)
+	if rejected, evicting := c.policy.TakeAdmissions(); rejected > 0 || evicting > 0 {
+		c.stats.AddAdmissions(rejected, evicting)
+	}
+	for _, n := range d {
+		c.expirePolicy.Delete(n)
+	}
+
+	c.evictionMutex.Unlock()
+
+	for _, n := range d {
+		if c.hashmap.DeleteNode(n) != nil {
+			c.emitEviction(n)
+		}
+	}
+
+	return d
+}
+
 // Range iterates over all items in the cache.
 //
 // Iteration stops early when the given function returns false.
+//
+// If the stable range is enabled, items are iterated in the order in which they were last written.
 func (c *Cache[K, V]) Range(f func(key K, value V) bool) {
+	if c.stableRange {
+		// sorting requires a snapshot anyway.
+		c.RangeSnapshot(f)
+		return
+	}
+
 	c.hashmap.Range(func(n *node.Node[K, V]) bool {
 		if n.IsExpired() {
 			return true
@@ -361,52 +1451,408 @@ func (c *Cache[K, V]) Range(f func(key K, value V) bool) {
 	})
 }
 
+// RangeWhere iterates over the nodes of the items whose keys match pred without taking a snapshot.
+// The values of the other items are never read.
+//
+// Iteration stops early when the given function returns false.
+func (c *Cache[K, V]) RangeWhere(pred func(key K) bool, f func(n *node.Node[K, V]) bool) {
+	c.hashmap.Range(func(n *node.Node[K, V]) bool {
+		if n.IsExpired() || !pred(n.Key()) {
+			return true
+		}
+
+		return f(n)
+	})
+}
+
+// Sample calls f for at most n nodes of random live items chosen uniformly.
+func (c *Cache[K, V]) Sample(n int, f func(n *node.Node[K, V])) {
+	c.hashmap.Sample(n, func(got *node.Node[K, V]) bool {
+		return !got.IsExpired()
+	}, f)
+}
+
+// RangeSnapshot iterates over a snapshot of all items in the cache taken before the iteration.
+//
+// Every key is observed at most once, and changes made to the cache during the iteration are not observed.
+// Iteration stops early when the given function returns false.
+func (c *Cache[K, V]) RangeSnapshot(f func(key K, value V) bool) {
+	nodes := c.snapshot()
+	if c.stableRange {
+		sort.Slice(nodes, func(i, j int) bool {
+			return nodes[i].Sequence() < nodes[j].Sequence()
+		})
+	}
+
+	rangeNodes(nodes, f)
+}
+
+// RangeNodes iterates over the nodes of all items in the cache with their frequency and queue in the eviction policy
+// without taking a snapshot.
+//
+// Iteration stops early when the given function returns false.
+func (c *Cache[K, V]) RangeNodes(f func(n *node.Node[K, V], frequency uint8, main bool) bool) {
+	const batchSize = 256
+
+	type state struct {
+		frequency uint8
+		main      bool
+	}
+	nodes := make([]*node.Node[K, V], 0, batchSize)
+	states := make([]state, batchSize)
+	// the policy state is updated under the lock, so it is read in batches to amortize the locking.
+	flush := func() bool {
+		c.evictionMutex.Lock()
+		for i, n := range nodes {
+			states[i] = state{frequency: n.Frequency(), main: n.IsMain()}
+		}
+		c.evictionMutex.Unlock()
+
+		for i, n := range nodes {
+			if !f(n, states[i].frequency, states[i].main) {
+				return false
+			}
+		}
+		nodes = nodes[:0]
+		return true
+	}
+
+	ok := true
+	c.hashmap.Range(func(n *node.Node[K, V]) bool {
+		if n.IsExpired() {
+			return true
+		}
+
+		nodes = append(nodes, n)
+		if len(nodes) == batchSize {
+			ok = flush()
+		}
+		return ok
+	})
+	if ok {
+		flush()
+	}
+}
+
+func (c *Cache[K, V]) snapshot() []*node.Node[K, V] {
+	nodes := make([]*node.Node[K, V], 0, c.hashmap.Size())
+	c.hashmap.Range(func(n *node.Node[K, V]) bool {
+		if !n.IsExpired() {
+			nodes = append(nodes, n)
+		}
+		return true
+	})
+	return nodes
+}
+
+// newRetention creates a function estimating the value of keeping the node in the cache.
+//
+// With the fetch cost, cheap to refetch and large items have lower retention (GreedyDual-Size).
+// With the expiration preference, the retention is proportional to the remaining lifetime of the item.
+func newRetention[K comparable, V any](
+	fetchCost func(key K, value V) uint32,
+	soonestExpiring bool,
+) func(n *node.Node[K, V]) float64 {
+	return func(n *node.Node[K, V]) float64 {
+		retention := 1.0
+		if fetchCost != nil {
+			cost := n.Cost()
+			if cost == 0 {
+				cost = 1
+			}
+			retention = float64(fetchCost(n.Key(), n.Value())) / float64(cost)
+		}
+		if soonestExpiring {
+			retention *= float64(remainingLifetime(n))
+		}
+		return retention
+	}
+}
+
+// remainingLifetime returns the number of seconds the node is going to live plus one,
+// or math.MaxUint32 if the node never expires.
+func remainingLifetime[K comparable, V any](n *node.Node[K, V]) uint32 {
+	deadline := n.Expiration()
+	if accessExpiration := n.AccessExpiration(); accessExpiration > 0 && (deadline == 0 || accessExpiration < deadline) {
+		deadline = accessExpiration
+	}
+	if deadline == 0 {
+		return math.MaxUint32
+	}
+
+	now := unixtime.Now()
+	if deadline < now {
+		return 1
+	}
+	return deadline - now + 1
+}
+
+// countTopKeys records the reads of the nodes in the heavy hitters.
+//
+// NOTE: must be called under the evictionMutex.
+func (c *Cache[K, V]) countTopKeys(nodes []*node.Node[K, V]) {
+	if c.topKeys == nil {
+		return
+	}
+
+	for _, n := range nodes {
+		c.topKeys.Add(n.Key())
+	}
+}
+
+// TopKeys returns at most k approximately hottest keys with their estimated read counts,
+// ordered by the count descending. It returns nil if the tracking of top keys is disabled.
+func (c *Cache[K, V]) TopKeys(k int) []topk.Counter[K] {
+	if c.topKeys == nil || k <= 0 {
+		return nil
+	}
+
+	c.evictionMutex.Lock()
+	defer c.evictionMutex.Unlock()
+	return c.topKeys.Top(k)
+}
+
+// Hottest returns at most n nodes with the largest number of hits, ordered by the number of hits descending.
+// It returns nil if per-entry statistics are disabled.
+//
+// NOTE: this operation iterates over all items in the cache.
+func (c *Cache[K, V]) Hottest(n int) []*node.Node[K, V] {
+	if !c.entryStats || n <= 0 {
+		return nil
+	}
+
+	nodes := c.snapshot()
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Hits() > nodes[j].Hits()
+	})
+	if len(nodes) > n {
+		nodes = nodes[:n]
+	}
+	return nodes
+}
+
+func rangeNodes[K comparable, V any](nodes []*node.Node[K, V], f func(key K, value V) bool) {
+	for _, n := range nodes {
+		if !f(n.Key(), n.Value()) {
+			return
+		}
+	}
+}
+
 // Clear clears the hash table, all policies, buffers, etc.
+// If emitEvents is true, ClearEvent is emitted for every removed item.
 //
 // NOTE: this operation must be performed when no requests are made to the cache otherwise the behavior is undefined.
-func (c *Cache[K, V]) Clear() {
+func (c *Cache[K, V]) Clear(emitEvents bool) {
+	if c.frozen.Load() {
+		return
+	}
+
+	var nodes []*node.Node[K, V]
+	if emitEvents && c.eventHandler != nil {
+		nodes = c.snapshot()
+	}
 	c.clear(node.NewClearTask[K, V]())
+	for _, n := range nodes {
+		c.emit(ClearEvent, n)
+	}
 }
 
 func (c *Cache[K, V]) clear(task node.WriteTask[K, V]) {
 	c.hashmap.Clear()
-	for i := 0; i < len(c.readBuffers); i++ {
-		c.readBuffers[i].Clear()
+	for _, rb := range c.readBuffers.Load().buffers {
+		rb.Clear()
 	}
 
-	c.writeBuffer.Insert(task)
-	<-c.doneClear
+	if c.amortized {
+		// the writes have already been applied by the callers.
+		c.clearPolicies(task.IsClose())
+	} else {
+		// clear and close tasks are always handled by the maintenance goroutine.
+		c.writeBuffer.Insert(task)
+		<-c.doneClear
+	}
 
 	c.stats.Clear()
+	c.latencies.Clear()
+}
+
+// Freeze makes all subsequent writes no-ops until Unfreeze is called.
+func (c *Cache[K, V]) Freeze() {
+	c.frozen.Store(true)
+}
+
+// Unfreeze makes the writes take effect again.
+func (c *Cache[K, V]) Unfreeze() {
+	c.frozen.Store(false)
+}
+
+// IsFrozen returns true if the cache is frozen.
+func (c *Cache[K, V]) IsFrozen() bool {
+	return c.frozen.Load()
+}
+
+// LockKey locks the mutex guarding the key and returns the function that unlocks it.
+//
+// The mutexes are striped, so unrelated keys may share one and only one key should be held at a time.
+// It doesn't block cache operations on the key.
+func (c *Cache[K, V]) LockKey(key K) (unlock func()) {
+	c.keyLocksOnce.Do(func() {
+		c.keyLocks = newKeyLocks[K](c.keyLocksCount)
+	})
+	return c.keyLocks.lock(key)
 }
 
 // Close clears the hash table, all policies, buffers, etc and stop all goroutines.
 //
 // NOTE: this operation must be performed when no requests are made to the cache otherwise the behavior is undefined.
 func (c *Cache[K, V]) Close() {
+	_ = c.Shutdown(context.Background())
+}
+
+// Shutdown applies all pending writes, clears the hash table, all policies, buffers, etc
+// and waits for all goroutines to stop.
+//
+// If the context is done before the shutdown is complete, Shutdown returns the context's error,
+// but the shutdown still completes in the background. Subsequent calls wait for the same shutdown.
+//
+// NOTE: this operation must be performed when no requests are made to the cache otherwise the behavior is undefined.
+func (c *Cache[K, V]) Shutdown(ctx context.Context) error {
 	c.closeOnce.Do(func() {
-		c.clear(node.NewCloseTask[K, V]())
-		if c.withExpiration {
+		if c.amortized {
+			c.shutdown()
+			return
+		}
+		go c.shutdown()
+	})
+
+	select {
+	case <-c.doneClose:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Cache[K, V]) shutdown() {
+	// the pending writes are applied while the items are still in the hash table,
+	// so the evictions caused by them are done and their events are emitted.
+	c.Flush()
+	c.clear(node.NewCloseTask[K, V]())
+	close(c.stopCleanup)
+	c.wg.Wait()
+	if c.withClock {
+		if c.amortized {
+			unixtime.StopLazy()
+		} else {
 			unixtime.Stop()
 		}
+	}
+	close(c.doneClose)
+}
+
+// EstimatedMemoryUsage returns the estimated number of bytes used by the cache structures
+// plus the total cost of the items.
+func (c *Cache[K, V]) EstimatedMemoryUsage() int64 {
+	usage := int64(c.hashmap.Size()) * int64(unsafe.Sizeof(node.Node[K, V]{}))
+	usage += c.hashmap.MemoryUsage()
+	for _, rb := range c.readBuffers.Load().buffers {
+		usage += rb.MemoryUsage()
+	}
+	usage += int64(c.writeBuffer.Capacity()) * int64(unsafe.Sizeof(node.WriteTask[K, V]{}))
+
+	c.evictionMutex.Lock()
+	usage += c.policy.MemoryUsage() + c.expirePolicy.MemoryUsage() + int64(c.policy.Cost())
+	c.evictionMutex.Unlock()
+
+	return usage
+}
+
+// Cost returns the total cost of the items in the eviction policy and the current maximum cost of the policy,
+// which can be lower than the capacity while the cache is shrunk under memory pressure.
+func (c *Cache[K, V]) Cost() (used, maxCost uint32) {
+	c.evictionMutex.Lock()
+	defer c.evictionMutex.Unlock()
+
+	return c.policy.Cost(), c.policy.MaxCost()
+}
+
+// ExpiredResident returns the number and the total cost of expired items which haven't been removed yet.
+func (c *Cache[K, V]) ExpiredResident() (count int, cost uint64) {
+	if !c.withExpiration && c.accessTTL == 0 {
+		return 0, 0
+	}
+
+	now := unixtime.Now()
+	c.hashmap.Range(func(n *node.Node[K, V]) bool {
+		if n.IsExpiredAt(now) {
+			count++
+			cost += uint64(n.Cost())
+		}
+		return true
 	})
+	return count, cost
+}
+
+// Flush applies the writes made before the call to the eviction policy, so the evictions caused by them are done.
+func (c *Cache[K, V]) Flush() {
+	if c.synchronous {
+		// the writes are applied by the callers.
+		return
+	}
+
+	c.syncMutex.Lock()
+	defer c.syncMutex.Unlock()
+
+	select {
+	case <-c.doneClose:
+		return
+	default:
+	}
+	c.writeBuffer.Insert(node.NewSyncTask[K, V]())
+	select {
+	case <-c.doneSync:
+	case <-c.doneClose:
+	}
 }
 
-// Size returns the current number of items in the cache.
+// Size returns the current number of items in the hash table.
+//
+// Items written recently may have not been evicted yet, so it can temporarily exceed the capacity.
 func (c *Cache[K, V]) Size() int {
 	return c.hashmap.Size()
 }
 
+// Compact shrinks the hash table to the smallest size holding the current items.
+func (c *Cache[K, V]) Compact() bool {
+	return c.hashmap.Compact()
+}
+
+// HashTableInfo returns the current state of the hash table.
+func (c *Cache[K, V]) HashTableInfo() hashtable.Info {
+	return c.hashmap.Info()
+}
+
 // Capacity returns the cache capacity.
 func (c *Cache[K, V]) Capacity() int {
 	return c.capacity
 }
 
+// WithExpiration returns true if the cache supports expiration of items.
+func (c *Cache[K, V]) WithExpiration() bool {
+	return c.withExpiration
+}
+
 // Stats returns a current snapshot of this cache's cumulative statistics.
 func (c *Cache[K, V]) Stats() *stats.Stats {
 	return c.stats
 }
 
+// Latencies returns the collector of this cache's operation latencies.
+func (c *Cache[K, V]) Latencies() *stats.Latencies {
+	return c.latencies
+}
+
 func clearBuffer[T any](buffer []T) []T {
 	var zero T
 	for i := 0; i < len(buffer); i++ {
@@ -1,10 +1,15 @@
 package core
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/maypok86/otter/internal/node"
+	"github.com/maypok86/otter/internal/unixtime"
 )
 
 func TestCache_SetWithCost(t *testing.T) {
@@ -35,6 +40,138 @@ func TestCache_SetWithCost(t *testing.T) {
 	}
 }
 
+func TestCache_DisabledSubsystems(t *testing.T) {
+	newConfig := func() Config[int, int] {
+		return Config[int, int]{
+			Capacity: 100,
+			CostFunc: func(key int, value int) uint32 {
+				return 1
+			},
+		}
+	}
+	allocs := func(c Config[int, int]) float64 {
+		return testing.AllocsPerRun(10, func() {
+			NewCache[int, int](c).Close()
+		})
+	}
+
+	lean := allocs(newConfig())
+	withTTL := newConfig()
+	ttl := time.Hour
+	withTTL.TTL = &ttl
+	if got := allocs(withTTL); got <= lean {
+		t.Fatalf("cache without ttl shouldn't allocate the expiration policy: %v allocs, with ttl %v", lean, got)
+	}
+	withStats := newConfig()
+	withStats.StatsEnabled = true
+	if got := allocs(withStats); got <= lean {
+		t.Fatalf("cache without stats shouldn't allocate the stats collector: %v allocs, with stats %v", lean, got)
+	}
+
+	c := NewCache[int, int](newConfig())
+	defer c.Close()
+	for i := 0; i < 50; i++ {
+		c.Set(i, i)
+	}
+	c.evictionMutex.Lock()
+	got := c.policy.MemoryUsage() + c.expirePolicy.MemoryUsage()
+	c.evictionMutex.Unlock()
+	if got != 0 {
+		t.Fatalf("cache which hasn't evicted anything shouldn't allocate the ghost queue and the expiration policy, but got %d bytes", got)
+	}
+}
+
+func TestCache_ReadBuffers(t *testing.T) {
+	c := NewCache[int, int](Config[int, int]{
+		Capacity: 10,
+		CostFunc: func(key int, value int) uint32 {
+			return 1
+		},
+		ReadBuffersCount:   3,
+		ReadBufferCapacity: 20,
+	})
+	defer c.Close()
+
+	buffers := c.readBuffers.Load().buffers
+	if len(buffers) != 4 {
+		t.Fatalf("read buffers count should be rounded up to 4, but got %d", len(buffers))
+	}
+	for _, rb := range buffers {
+		if rb.Capacity() != 32 {
+			t.Fatalf("read buffer capacity should be rounded up to 32, but got %d", rb.Capacity())
+		}
+	}
+
+	c.Set(1, 1)
+	// a full buffer is drained into the policy.
+	for i := 0; i < 4*32; i++ {
+		if _, ok := c.Get(1); !ok {
+			t.Fatal("key 1 should exist")
+		}
+	}
+}
+
+func TestCache_ScaleReadBuffers(t *testing.T) {
+	c := NewCache[int, int](Config[int, int]{
+		Capacity: 10,
+		CostFunc: func(key int, value int) uint32 {
+			return 1
+		},
+		ReadBuffersCount:    2,
+		MinReadBuffersCount: 2,
+		MaxReadBuffersCount: 4,
+	})
+	defer c.Close()
+
+	// simulate the contention: the drained buffers aren't freed, so they fill up and drop all reads.
+	buffers := c.readBuffers.Load().buffers
+	for _, rb := range buffers {
+		for i := 0; i < 2*rb.Capacity()+100; i++ {
+			rb.Add(&node.Node[int, int]{})
+		}
+	}
+	defer func() {
+		for _, rb := range buffers {
+			rb.Free()
+		}
+	}()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for len(c.readBuffers.Load().buffers) != 4 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if count := len(c.readBuffers.Load().buffers); count != 4 {
+		t.Fatalf("read buffers should grow to 4, but got %d", count)
+	}
+}
+
+func TestCache_Dump(t *testing.T) {
+	size := 10
+	c := NewCache[int, int](Config[int, int]{
+		Capacity: size,
+		CostFunc: func(key int, value int) uint32 {
+			return 1
+		},
+	})
+	defer c.Close()
+
+	for i := 0; i < size; i++ {
+		c.Set(i, i)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	var sb strings.Builder
+	if err := c.Dump(&sb); err != nil {
+		t.Fatalf("failed to dump cache: %v", err)
+	}
+	dump := sb.String()
+	for _, want := range []string{"size: 10\n", "capacity: 10\n", "small.length:", "main.length:", "ghost.length:", "writeBuffer:"} {
+		if !strings.Contains(dump, want) {
+			t.Fatalf("dump should contain %q, but got:\n%s", want, dump)
+		}
+	}
+}
+
 func TestCache_Range(t *testing.T) {
 	size := 10
 	ttl := time.Hour
@@ -104,6 +241,184 @@ func TestCache_Close(t *testing.T) {
 	}
 }
 
+func TestCache_ClosePendingEvictions(t *testing.T) {
+	const (
+		size   = 10
+		writes = 50
+	)
+	var evicted atomic.Int64
+	c := NewCache[int, int](Config[int, int]{
+		Capacity: size,
+		CostFunc: func(key int, value int) uint32 {
+			return 1
+		},
+		EventHandler: func(kind EventKind, n *node.Node[int, int]) bool {
+			if kind == EvictEvent {
+				evicted.Add(1)
+			}
+			return true
+		},
+	})
+
+	// the writes don't fill up a batch, so they are still pending when the cache is closed.
+	for i := 0; i < writes; i++ {
+		c.Set(i, i)
+	}
+	c.Close()
+
+	if got := evicted.Load(); got != writes-size {
+		t.Fatalf("got %d eviction events, want = %d", got, writes-size)
+	}
+}
+
+func TestCache_WeakValuesInserted(t *testing.T) {
+	var watched []int
+	var reclaim []func()
+	c := NewCache[int, int](Config[int, int]{
+		Capacity:    10,
+		NodePooling: true,
+		CostFunc: func(key int, value int) uint32 {
+			return 1
+		},
+		WeakValues: func(value int, reclaimed func()) {
+			watched = append(watched, value)
+			reclaim = append(reclaim, reclaimed)
+		},
+	})
+	defer c.Close()
+
+	c.Set(1, 1)
+	// the nodes of these writes aren't inserted, so they go back to the pool without a cleanup.
+	c.SetIfAbsent(1, 2)
+	c.GetOrSet(1, 3)
+	c.SetIfVersion(1, 4, 100, 0)
+	c.GetOrSet(2, 5)
+	c.Apply([]Mutation[int, int]{{Key: 3, Value: 6}})
+	if len(watched) != 3 || watched[0] != 1 || watched[1] != 5 || watched[2] != 6 {
+		t.Fatalf("only the inserted values should be watched, but got %v", watched)
+	}
+
+	c.Set(4, 7)
+	reclaim[0]()
+	if _, ok := c.Get(1); ok {
+		t.Fatal("item with the reclaimed value should be deleted")
+	}
+	if v, ok := c.Get(4); !ok || v != 7 {
+		t.Fatalf("c.Get(4) = %d/%v, want 7/true", v, ok)
+	}
+}
+
+func TestMemoryPressure(t *testing.T) {
+	p := newMemoryPressure(100)
+	steps := []struct {
+		pressured bool
+		maxCost   uint32
+		changed   bool
+	}{
+		// the capacity is halved on every check while the pressure lasts, down to 1/16 of it.
+		{pressured: true, maxCost: 50, changed: true},
+		{pressured: true, maxCost: 25, changed: true},
+		{pressured: true, maxCost: 12, changed: true},
+		{pressured: true, maxCost: 6, changed: true},
+		{pressured: true, maxCost: 6, changed: false},
+		// the capacity isn't restored until the pressure has been gone for the cooldown.
+		{pressured: false, maxCost: 6, changed: false},
+		{pressured: false, maxCost: 6, changed: false},
+		{pressured: false, maxCost: 6, changed: false},
+		{pressured: false, maxCost: 6, changed: false},
+		{pressured: false, maxCost: 12, changed: true},
+		// the pressure is back, so the cooldown starts over.
+		{pressured: true, maxCost: 6, changed: true},
+		{pressured: false, maxCost: 6, changed: false},
+		{pressured: false, maxCost: 6, changed: false},
+		{pressured: false, maxCost: 6, changed: false},
+		{pressured: false, maxCost: 6, changed: false},
+		{pressured: false, maxCost: 12, changed: true},
+		{pressured: false, maxCost: 24, changed: true},
+		{pressured: false, maxCost: 48, changed: true},
+		{pressured: false, maxCost: 96, changed: true},
+		{pressured: false, maxCost: 100, changed: true},
+		{pressured: false, maxCost: 100, changed: false},
+	}
+	for i, step := range steps {
+		maxCost, changed := p.next(step.pressured)
+		if maxCost != step.maxCost || changed != step.changed {
+			t.Fatalf("step %d: got %d/%v, want %d/%v", i, maxCost, changed, step.maxCost, step.changed)
+		}
+	}
+
+	small := newMemoryPressure(3)
+	for i := 0; i < 10; i++ {
+		small.next(true)
+	}
+	if small.maxCost != 1 {
+		t.Fatalf("max cost should not drop below 1, but got %d", small.maxCost)
+	}
+}
+
+func TestCache_Shutdown(t *testing.T) {
+	size := 10
+	ttl := time.Hour
+	c := NewCache[int, int](Config[int, int]{
+		Capacity: size,
+		CostFunc: func(key int, value int) uint32 {
+			return 1
+		},
+		TTL: &ttl,
+	})
+
+	for i := 0; i < size; i++ {
+		c.Set(i, i)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.Shutdown(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatalf("c.Shutdown() = %v, want = %v or nil", err, context.Canceled)
+	}
+
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatalf("c.Shutdown() = %v, want = nil", err)
+	}
+	if cacheSize := c.Size(); cacheSize != 0 {
+		t.Fatalf("c.Size() = %d, want = %d", cacheSize, 0)
+	}
+	if !c.isClosed {
+		t.Fatalf("cache should be closed")
+	}
+
+	// all goroutines should be stopped and the eviction mutex should be released.
+	c.wg.Wait()
+	if !c.evictionMutex.TryLock() {
+		t.Fatalf("eviction mutex shouldn't be held after shutdown")
+	}
+	c.evictionMutex.Unlock()
+}
+
+func TestCache_MaintenanceRate(t *testing.T) {
+	size := 1000
+	c := NewCache[int, int](Config[int, int]{
+		Capacity:     size,
+		StatsEnabled: true,
+		CostFunc: func(key int, value int) uint32 {
+			return 1
+		},
+		MaintenanceRate: 640,
+	})
+	defer c.Close()
+
+	// two batches of writes should take at least 200ms.
+	for i := 0; i < 128; i++ {
+		c.Set(i, i)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if throttled := c.Stats().ThrottledTime(); throttled <= 0 {
+		t.Fatalf("maintenance should be throttled, but throttled time is %v", throttled)
+	}
+}
+
 func TestCache_Clear(t *testing.T) {
 	size := 10
 	c := NewCache[int, int](Config[int, int]{
@@ -121,7 +436,7 @@ func TestCache_Clear(t *testing.T) {
 		t.Fatalf("c.Size() = %d, want = %d", cacheSize, size)
 	}
 
-	c.Clear()
+	c.Clear(false)
 
 	time.Sleep(10 * time.Millisecond)
 
@@ -132,3 +447,67 @@ func TestCache_Clear(t *testing.T) {
 		t.Fatalf("cache shouldn't be closed")
 	}
 }
+
+func TestCache_RejectOnFullBuffer(t *testing.T) {
+	c := NewCache[int, int](Config[int, int]{
+		Capacity: 1 << 20,
+		CostFunc: func(key int, value int) uint32 {
+			return 1
+		},
+		RejectOnFullBuffer: true,
+	})
+	defer c.Close()
+
+	// the maintenance can't apply the writes, so the buffer fills up.
+	c.evictionMutex.Lock()
+	i := 0
+	for ; !c.WriteBufferFull(); i++ {
+		if !c.Set(i, i) {
+			c.evictionMutex.Unlock()
+			t.Fatalf("set %d should succeed while the write buffer has free slots", i)
+		}
+	}
+	setOK := c.Set(i, i)
+	readsOK := c.SetWithMaxReads(i, i, 0, 1)
+	_, found := c.hashmap.Get(i)
+	trySetOK, full := c.TrySet(i, i, 0)
+	c.evictionMutex.Unlock()
+
+	if setOK || readsOK || found {
+		t.Fatal("set should be rejected without changing the cache when the write buffer is full")
+	}
+	if trySetOK || !full {
+		t.Fatalf("try set should report the full write buffer, but got %v, %v", trySetOK, full)
+	}
+
+	for c.WriteBufferFull() {
+		time.Sleep(time.Millisecond)
+	}
+	if !c.Set(i, i) {
+		t.Fatal("set should succeed after the maintenance frees the write buffer")
+	}
+}
+
+func TestRetention(t *testing.T) {
+	now := unixtime.Now()
+	soon := node.New[int, int](1, 1, now+10, 1)
+	later := node.New[int, int](2, 2, now+100, 1)
+	never := node.New[int, int](3, 3, 0, 1)
+
+	retention := newRetention[int, int](nil, true)
+	if !(retention(soon) < retention(later) && retention(later) < retention(never)) {
+		t.Fatalf("items expiring sooner should have lower retention: %v, %v, %v",
+			retention(soon), retention(later), retention(never))
+	}
+
+	// the expensive item expiring soon outweighs the cheap one expiring later.
+	retention = newRetention[int, int](func(key int, value int) uint32 {
+		if key == 1 {
+			return 100
+		}
+		return 1
+	}, true)
+	if retention(soon) <= retention(later) {
+		t.Fatalf("fetch cost should be taken into account: %v, %v", retention(soon), retention(later))
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/maypok86/otter/internal/s3fifo"
+)
+
+// Dump writes a human-readable description of the cache's internal state to w.
+//
+// The output is intended for debugging only and its format may change at any time.
+// Dump briefly blocks the eviction policy, so it should not be called on hot paths.
+func (c *Cache[K, V]) Dump(w io.Writer) error {
+	c.evictionMutex.Lock()
+	policyInfo := c.policy.Info()
+	c.evictionMutex.Unlock()
+	tableInfo := c.hashmap.Info()
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "size: %d\n", c.Size())
+	fmt.Fprintf(bw, "capacity: %d\n", c.capacity)
+	dumpQueue(bw, "small", policyInfo.Small)
+	dumpQueue(bw, "main", policyInfo.Main)
+	fmt.Fprintf(bw, "ghost.length: %d\n", policyInfo.GhostLength)
+	fmt.Fprintf(bw, "table.buckets: %d\n", tableInfo.BucketCount)
+	fmt.Fprintf(bw, "table.counters: %v\n", tableInfo.CounterSizes)
+	for i, rb := range c.readBuffers.Load().buffers {
+		fmt.Fprintf(bw, "readBuffer[%d]: %d/%d\n", i, rb.Size(), rb.Capacity())
+	}
+	fmt.Fprintf(bw, "writeBuffer: %d/%d\n", c.writeBuffer.Size(), c.writeBuffer.Capacity())
+	return bw.Flush()
+}
+
+func dumpQueue(w io.Writer, name string, info s3fifo.QueueInfo) {
+	fmt.Fprintf(w, "%s.length: %d\n", name, info.Length)
+	fmt.Fprintf(w, "%s.cost: %d/%d\n", name, info.Cost, info.MaxCost)
+	fmt.Fprintf(w, "%s.frequencies: %v\n", name, info.Frequencies)
+}
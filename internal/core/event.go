@@ -0,0 +1,90 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"time"
+
+	"github.com/maypok86/otter/internal/node"
+	"github.com/maypok86/otter/internal/unixtime"
+)
+
+// EventKind is the kind of change of the cache contents.
+type EventKind uint8
+
+const (
+	// InsertEvent means that a new item was added to the cache.
+	InsertEvent EventKind = iota + 1
+	// UpdateEvent means that the value of an existing item was replaced.
+	UpdateEvent
+	// DeleteEvent means that an item was removed by the user.
+	DeleteEvent
+	// EvictEvent means that an item was removed by the eviction policy.
+	EvictEvent
+	// ExpireEvent means that an item was removed because its ttl had expired.
+	ExpireEvent
+	// ClearEvent means that an item was removed by clearing the cache.
+	ClearEvent
+)
+
+// EventHandler is called on every change of the cache contents.
+//
+// It should return false if the event was dropped.
+type EventHandler[K comparable, V any] func(kind EventKind, n *node.Node[K, V]) bool
+
+func (c *Cache[K, V]) emit(kind EventKind, n *node.Node[K, V]) {
+	if kind == EvictEvent || kind == ExpireEvent {
+		c.recordRemoval(n)
+	}
+	if c.eventHandler == nil {
+		return
+	}
+
+	if !c.eventHandler(kind, n) {
+		c.stats.IncDroppedEvents()
+	}
+}
+
+// recordRemoval records the lifetime of the evicted or expired node and its age at the last hit.
+// It requires the per-entry statistics, which hold the time of the write and the last access.
+func (c *Cache[K, V]) recordRemoval(n *node.Node[K, V]) {
+	if c.stats == nil {
+		return
+	}
+	written, ok := n.LastWrite()
+	if !ok {
+		return
+	}
+
+	lifetime := time.Duration(0)
+	if now := unixtime.Now(); now > written {
+		lifetime = time.Duration(now-written) * time.Second
+	}
+	hitAge := time.Duration(0)
+	if lastAccess := n.LastAccess(); lastAccess > written {
+		hitAge = time.Duration(lastAccess-written) * time.Second
+	}
+	c.stats.RecordRemoval(lifetime, hitAge, n.Hits() > 0)
+}
+
+func (c *Cache[K, V]) emitEviction(n *node.Node[K, V]) {
+	if n.IsExpired() {
+		c.emit(ExpireEvent, n)
+		return
+	}
+
+	c.stats.IncEvictions()
+	c.emit(EvictEvent, n)
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/dolthub/maphash"
+
+	"github.com/maypok86/otter/internal/xruntime"
+)
+
+type paddedMutex struct {
+	sync.Mutex
+	// padding prevents false sharing.
+	padding [xruntime.CacheLineSize - unsafe.Sizeof(sync.Mutex{})]byte
+}
+
+// keyLocks is a fixed set of mutexes striped by the key hash.
+//
+// Unlike the hash table buckets, the stripes don't move on resize,
+// so a key is always guarded by the same mutex.
+type keyLocks[K comparable] struct {
+	stripes []paddedMutex
+	mask    uint64
+	hasher  maphash.Hasher[K]
+}
+
+func newKeyLocks[K comparable](stripeCount int) *keyLocks[K] {
+	return &keyLocks[K]{
+		stripes: make([]paddedMutex, stripeCount),
+		mask:    uint64(stripeCount - 1),
+		hasher:  maphash.NewHasher[K](),
+	}
+}
+
+func (l *keyLocks[K]) lock(key K) func() {
+	m := &l.stripes[l.hasher.Hash(key)&l.mask]
+	m.Lock()
+	return m.Unlock
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Logger is a structured logger for notable internal events, *slog.Logger implements it.
+type Logger interface {
+	Warn(msg string, args ...any)
+}
+
+type warningKind int
+
+const (
+	writeBufferFullWarning warningKind = iota
+	oversizeItemWarning
+	clockBackwardsWarning
+	memoryPressureWarning
+	warningKindCount
+)
+
+// warningInterval is the min interval between warnings of the same kind,
+// so a misbehaving cache doesn't flood the log.
+const warningInterval = 10 * time.Second
+
+type logger struct {
+	logger   Logger
+	lastWarn [warningKindCount]atomic.Int64
+}
+
+func newLogger(l Logger) *logger {
+	if l == nil {
+		return nil
+	}
+	return &logger{logger: l}
+}
+
+// warn logs the warning unless a warning of the same kind has been logged recently.
+func (l *logger) warn(kind warningKind, msg string, args ...any) {
+	if l == nil {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	last := l.lastWarn[kind].Load()
+	if now-last < int64(warningInterval) || !l.lastWarn[kind].CompareAndSwap(last, now) {
+		return
+	}
+	l.logger.Warn(msg, args...)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"time"
+
+	"github.com/maypok86/otter/internal/lossy"
+	"github.com/maypok86/otter/internal/node"
+)
+
+const (
+	// readBuffersGrowDropRate is the share of dropped reads which makes the read buffers grow.
+	readBuffersGrowDropRate = 0.05
+	// readBuffersShrinkTicks is the number of seconds without drops after which the read buffers shrink.
+	readBuffersShrinkTicks = 10
+)
+
+// readStripes is the set of the read buffers, the index of a buffer is chosen randomly using the mask.
+type readStripes[K comparable, V any] struct {
+	buffers []*lossy.Buffer[node.Node[K, V]]
+	mask    uint32
+}
+
+// newReadStripes creates a set of count read buffers reusing the buffers of the previous set.
+func (c *Cache[K, V]) newReadStripes(prev *readStripes[K, V], count int) *readStripes[K, V] {
+	buffers := make([]*lossy.Buffer[node.Node[K, V]], 0, count)
+	if prev != nil {
+		reused := prev.buffers
+		if len(reused) > count {
+			reused = reused[:count]
+		}
+		buffers = append(buffers, reused...)
+	}
+	for len(buffers) < count {
+		buffers = append(buffers, lossy.New[node.Node[K, V]](c.readBufferCap))
+	}
+	return &readStripes[K, V]{
+		buffers: buffers,
+		mask:    uint32(count - 1),
+	}
+}
+
+// scaleReadBuffers doubles the number of the read buffers while they drop too many reads
+// and halves it once they haven't dropped any reads for a while.
+//
+// The reads in the buffers removed by shrinking are lost, which is fine for the lossy buffers.
+func (c *Cache[K, V]) scaleReadBuffers(minCount, maxCount int) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var prevWritten, prevDropped uint64
+	idleTicks := 0
+	for {
+		select {
+		case <-c.stopCleanup:
+			return
+		case <-ticker.C:
+		}
+
+		rs := c.readBuffers.Load()
+		var written, dropped uint64
+		for _, rb := range rs.buffers {
+			written += rb.Written()
+			dropped += rb.Dropped()
+		}
+		// the counters have been reset by clearing or resizing.
+		if written < prevWritten || dropped < prevDropped {
+			prevWritten, prevDropped = written, dropped
+			continue
+		}
+		deltaWritten, deltaDropped := written-prevWritten, dropped-prevDropped
+		prevWritten, prevDropped = written, dropped
+
+		count := len(rs.buffers)
+		switch {
+		case float64(deltaDropped) > readBuffersGrowDropRate*float64(deltaWritten+deltaDropped):
+			idleTicks = 0
+			if count < maxCount {
+				c.readBuffers.Store(c.newReadStripes(rs, 2*count))
+			}
+		case deltaDropped == 0:
+			idleTicks++
+			if idleTicks >= readBuffersShrinkTicks && count > minCount {
+				idleTicks = 0
+				c.readBuffers.Store(c.newReadStripes(rs, count/2))
+				// the counters of the removed buffers are gone.
+				prevWritten, prevDropped = 0, 0
+				for _, rb := range c.readBuffers.Load().buffers {
+					prevWritten += rb.Written()
+					prevDropped += rb.Dropped()
+				}
+			}
+		default:
+			idleTicks = 0
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expire
+
+import (
+	"github.com/maypok86/otter/internal/node"
+)
+
+// Disabled is an expiration policy for caches without ttl.
+//
+// It doesn't allocate any memory and all its methods are no-op.
+type Disabled[K comparable, V any] struct{}
+
+// NewDisabled creates a new Disabled policy.
+func NewDisabled[K comparable, V any]() Disabled[K, V] {
+	return Disabled[K, V]{}
+}
+
+// Add does nothing.
+func (d Disabled[K, V]) Add(n *node.Node[K, V]) {
+}
+
+// Delete does nothing.
+func (d Disabled[K, V]) Delete(n *node.Node[K, V]) {
+}
+
+// RemoveExpired returns the expired buffer as is.
+func (d Disabled[K, V]) RemoveExpired(expired []*node.Node[K, V]) []*node.Node[K, V] {
+	return expired
+}
+
+// MemoryUsage always returns 0.
+func (d Disabled[K, V]) MemoryUsage() int64 {
+	return 0
+}
+
+// Clear does nothing.
+func (d Disabled[K, V]) Clear() {
+}
@@ -94,12 +94,16 @@ type Policy[K comparable, V any] struct {
 	buckets         [numberOfBuckets]bucket[K, V]
 	expires         *swiss.Map[*node.Node[K, V], struct{}]
 	currentBucketID int
+	gracePeriod     uint32
 }
 
 // NewPolicy creates a new Policy with 128 buckets.
-func NewPolicy[K comparable, V any]() *Policy[K, V] {
+//
+// Expired nodes are removed only after the grace period (in seconds) has passed.
+func NewPolicy[K comparable, V any](gracePeriod uint32) *Policy[K, V] {
 	p := &Policy[K, V]{
-		expires: swiss.NewMap[*node.Node[K, V], struct{}](mapSize),
+		expires:     swiss.NewMap[*node.Node[K, V], struct{}](mapSize),
+		gracePeriod: gracePeriod,
 	}
 
 	for i := 0; i < numberOfBuckets; i++ {
@@ -141,12 +145,17 @@ func (p *Policy[K, V]) Delete(n *node.Node[K, V]) {
 // Buckets are checked first, and then a redis randomized algorithm is applied to lazily find the remaining expired nodes.
 func (p *Policy[K, V]) RemoveExpired(expired []*node.Node[K, V]) []*node.Node[K, V] {
 	now := unixtime.Now()
+	if now < p.gracePeriod {
+		return expired
+	}
+
+	now -= p.gracePeriod
 	for i := 0; i < numberOfBuckets; i++ {
 		expired = p.expireBucket(expired, p.currentBucketID, now)
 		p.currentBucketID = nextBucketID(p.currentBucketID)
 	}
 
-	return p.probingExpire(expired)
+	return p.probingExpire(expired, now)
 }
 
 func (p *Policy[K, V]) expireBucket(expired []*node.Node[K, V], bucketID int, now uint32) []*node.Node[K, V] {
@@ -168,11 +177,11 @@ func (p *Policy[K, V]) expireBucket(expired []*node.Node[K, V], bucketID int, no
 	return expired
 }
 
-func (p *Policy[K, V]) probingExpire(expired []*node.Node[K, V]) []*node.Node[K, V] {
+func (p *Policy[K, V]) probingExpire(expired []*node.Node[K, V], now uint32) []*node.Node[K, V] {
 	failCount := 0
 	probeCount := 0
 	p.expires.Iter(func(n *node.Node[K, V], _ struct{}) (stop bool) {
-		if n.IsExpired() {
+		if n.IsExpiredAt(now) {
 			p.expires.Delete(n)
 			expired = append(expired, n)
 			failCount = 0
@@ -191,6 +200,21 @@ func (p *Policy[K, V]) probingExpire(expired []*node.Node[K, V]) []*node.Node[K,
 	return expired
 }
 
+// MemoryUsage returns the estimated number of bytes used by the indexes of Policy.
+func (p *Policy[K, V]) MemoryUsage() int64 {
+	slots := swissSlots(p.expires)
+	for i := 0; i < numberOfBuckets; i++ {
+		slots += swissSlots(p.buckets[i].m)
+	}
+	// a node pointer and a control byte per slot.
+	return slots * 9
+}
+
+func swissSlots[K comparable, V any](m *swiss.Map[*node.Node[K, V], struct{}]) int64 {
+	// the swiss map keeps its load factor below 7/8.
+	return int64(m.Count()+m.Capacity()) * 8 / 7
+}
+
 // Clear completely clears Policy and returns it to its default state.
 func (p *Policy[K, V]) Clear() {
 	p.currentBucketID = 0
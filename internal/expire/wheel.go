@@ -0,0 +1,196 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expire
+
+import (
+	"unsafe"
+
+	"github.com/maypok86/otter/internal/node"
+	"github.com/maypok86/otter/internal/unixtime"
+)
+
+// the spans of the wheel levels are 1s, 64s (~1m), 4096s (~1.1h), 2^18s (~3d) and 2^24s (~194d).
+var (
+	wheelBuckets = [...]uint32{64, 64, 64, 64, 1}
+	wheelShifts  = [...]uint32{0, 6, 12, 18, 24}
+)
+
+// TimerWheel is an expiration policy for arbitrary TTL values based on a hierarchical timer wheel.
+//
+// Nodes are linked into the bucket of the level matching their remaining ttl and cascade down the levels
+// as the time advances, so adding, deleting and expiring a node take amortized O(1) time
+// regardless of the number of nodes and without scanning them.
+// https://ieeexplore.ieee.org/document/650142
+type TimerWheel[K comparable, V any] struct {
+	wheel       [len(wheelBuckets)][]node.Node[K, V]
+	time        uint32
+	gracePeriod uint32
+}
+
+// NewTimerWheel creates a new TimerWheel.
+//
+// Expired nodes are removed only after the grace period (in seconds) has passed.
+func NewTimerWheel[K comparable, V any](gracePeriod uint32) *TimerWheel[K, V] {
+	w := &TimerWheel[K, V]{
+		gracePeriod: gracePeriod,
+	}
+	for i := range w.wheel {
+		w.wheel[i] = make([]node.Node[K, V], wheelBuckets[i])
+		for j := range w.wheel[i] {
+			sentinel := &w.wheel[i][j]
+			sentinel.SetPrevExp(sentinel)
+			sentinel.SetNextExp(sentinel)
+		}
+	}
+	return w
+}
+
+// deadline returns the time when the node should be removed.
+func (w *TimerWheel[K, V]) deadline(n *node.Node[K, V]) uint32 {
+	// the node is expired when its expiration time is strictly less than the current time.
+	return n.Expiration() + w.gracePeriod + 1
+}
+
+// Add adds node.Node to TimerWheel if it has a TTL specified.
+func (w *TimerWheel[K, V]) Add(n *node.Node[K, V]) {
+	if n.Expiration() == 0 {
+		return
+	}
+
+	w.schedule(n)
+}
+
+func (w *TimerWheel[K, V]) schedule(n *node.Node[K, V]) {
+	sentinel := w.findBucket(w.deadline(n))
+	last := sentinel.PrevExp()
+	n.SetPrevExp(last)
+	n.SetNextExp(sentinel)
+	last.SetNextExp(n)
+	sentinel.SetPrevExp(n)
+}
+
+func (w *TimerWheel[K, V]) findBucket(deadline uint32) *node.Node[K, V] {
+	// overdue nodes go to the current bucket, otherwise they would wait for the whole rotation of the wheel.
+	if deadline < w.time {
+		deadline = w.time
+	}
+	duration := deadline - w.time
+
+	last := len(w.wheel) - 1
+	for i := 0; i < last; i++ {
+		if duration < uint32(1)<<wheelShifts[i+1] {
+			ticks := deadline >> wheelShifts[i]
+			return &w.wheel[i][ticks&(wheelBuckets[i]-1)]
+		}
+	}
+	return &w.wheel[last][0]
+}
+
+// Delete removes node.Node from TimerWheel if it has been added.
+func (w *TimerWheel[K, V]) Delete(n *node.Node[K, V]) {
+	next := n.NextExp()
+	if next == nil {
+		return
+	}
+
+	prev := n.PrevExp()
+	prev.SetNextExp(next)
+	next.SetPrevExp(prev)
+	n.SetPrevExp(nil)
+	n.SetNextExp(nil)
+}
+
+// RemoveExpired advances the wheel to the current time and removes the expired node.Node from TimerWheel.
+//
+// The buckets whose time has passed are drained, their expired nodes are removed
+// and the rest cascade down to the finer levels.
+func (w *TimerWheel[K, V]) RemoveExpired(expired []*node.Node[K, V]) []*node.Node[K, V] {
+	return w.advance(expired, unixtime.Now())
+}
+
+func (w *TimerWheel[K, V]) advance(expired []*node.Node[K, V], now uint32) []*node.Node[K, V] {
+	prev := w.time
+	if now <= prev {
+		return expired
+	}
+
+	w.time = now
+	for i := range w.wheel {
+		prevTicks := prev >> wheelShifts[i]
+		delta := (now >> wheelShifts[i]) - prevTicks
+		if delta == 0 {
+			break
+		}
+		expired = w.expire(expired, i, prevTicks, delta)
+	}
+	return expired
+}
+
+func (w *TimerWheel[K, V]) expire(expired []*node.Node[K, V], level int, prevTicks, delta uint32) []*node.Node[K, V] {
+	buckets := w.wheel[level]
+	mask := uint32(len(buckets) - 1)
+	// the bucket of prevTicks may still hold nodes scheduled for later in the same tick.
+	steps := delta + 1
+	if steps > uint32(len(buckets)) {
+		steps = uint32(len(buckets))
+	}
+
+	start := prevTicks & mask
+	for i := start; i < start+steps; i++ {
+		sentinel := &buckets[i&mask]
+		n := sentinel.NextExp()
+		sentinel.SetPrevExp(sentinel)
+		sentinel.SetNextExp(sentinel)
+		for n != sentinel {
+			next := n.NextExp()
+			n.SetPrevExp(nil)
+			n.SetNextExp(nil)
+			if w.deadline(n) <= w.time {
+				expired = append(expired, n)
+			} else {
+				w.schedule(n)
+			}
+			n = next
+		}
+	}
+	return expired
+}
+
+// MemoryUsage returns the estimated number of bytes used by the bucket sentinels of TimerWheel.
+func (w *TimerWheel[K, V]) MemoryUsage() int64 {
+	var sentinels int64
+	for i := range w.wheel {
+		sentinels += int64(len(w.wheel[i]))
+	}
+	return sentinels * int64(unsafe.Sizeof(node.Node[K, V]{}))
+}
+
+// Clear clears TimerWheel and returns it to the default state.
+func (w *TimerWheel[K, V]) Clear() {
+	for i := range w.wheel {
+		for j := range w.wheel[i] {
+			sentinel := &w.wheel[i][j]
+			n := sentinel.NextExp()
+			for n != sentinel {
+				next := n.NextExp()
+				n.SetPrevExp(nil)
+				n.SetNextExp(nil)
+				n = next
+			}
+			sentinel.SetPrevExp(sentinel)
+			sentinel.SetNextExp(sentinel)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expire
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/maypok86/otter/internal/node"
+)
+
+func TestTimerWheel_Advance(t *testing.T) {
+	const (
+		count       = 10000
+		gracePeriod = 2
+		maxTTL      = 1 << 22
+	)
+
+	w := NewTimerWheel[int, int](gracePeriod)
+	r := rand.New(rand.NewSource(42))
+	nodes := make([]*node.Node[int, int], 0, count)
+	for i := 0; i < count; i++ {
+		n := node.New(i, i, uint32(r.Intn(maxTTL))+1, 1)
+		nodes = append(nodes, n)
+		w.Add(n)
+	}
+	// deleted nodes must never be returned.
+	for _, n := range nodes[:count/10] {
+		w.Delete(n)
+	}
+
+	removedAt := make(map[int]uint32, count)
+	var (
+		expired []*node.Node[int, int]
+		prev    uint32
+	)
+	for now := uint32(1); now <= maxTTL+gracePeriod+2; now += uint32(r.Intn(700)) + 1 {
+		expired = w.advance(expired[:0], now)
+		for _, n := range expired {
+			if _, ok := removedAt[n.Key()]; ok {
+				t.Fatalf("node %d has been removed twice", n.Key())
+			}
+			if !n.IsExpiredAt(now - gracePeriod) {
+				t.Fatalf("node %d with expiration %d has been removed too early at %d", n.Key(), n.Expiration(), now)
+			}
+			if prev >= n.Expiration()+gracePeriod+1 {
+				t.Fatalf("node %d with expiration %d has been removed too late at %d", n.Key(), n.Expiration(), now)
+			}
+			removedAt[n.Key()] = now
+		}
+		prev = now
+	}
+
+	for _, n := range nodes[:count/10] {
+		if _, ok := removedAt[n.Key()]; ok {
+			t.Fatalf("deleted node %d has been removed", n.Key())
+		}
+	}
+	if len(removedAt) != count-count/10 {
+		t.Fatalf("all nodes should be removed, but got %d of %d", len(removedAt), count-count/10)
+	}
+}
+
+func TestTimerWheel_Overdue(t *testing.T) {
+	w := NewTimerWheel[int, int](0)
+	w.advance(nil, 1000)
+
+	n := node.New(1, 1, 10, 1)
+	w.Add(n)
+	if expired := w.advance(nil, 1001); len(expired) != 1 || expired[0] != n {
+		t.Fatalf("overdue node should be removed by the next advance, but got %d nodes", len(expired))
+	}
+}
+
+func TestTimerWheel_Clear(t *testing.T) {
+	w := NewTimerWheel[int, int](0)
+	n := node.New(1, 1, 10, 1)
+	w.Add(n)
+	w.Clear()
+
+	if n.NextExp() != nil || n.PrevExp() != nil {
+		t.Fatal("node should be unlinked")
+	}
+	if expired := w.advance(nil, 100); len(expired) != 0 {
+		t.Fatalf("cleared wheel should not return nodes, but got %d", len(expired))
+	}
+}
@@ -58,24 +58,3 @@ func (root *paddedBucket) isEmpty() bool {
 		b = (*paddedBucket)(b.next)
 	}
 }
-
-func (root *paddedBucket) add(h uint64, nodePtr unsafe.Pointer) {
-	b := root
-	for {
-		for i := 0; i < bucketSize; i++ {
-			if b.nodes[i] == nil {
-				b.hashes[i] = h
-				b.nodes[i] = nodePtr
-				return
-			}
-		}
-		if b.next == nil {
-			newBucket := &paddedBucket{}
-			newBucket.hashes[0] = h
-			newBucket.nodes[0] = nodePtr
-			b.next = unsafe.Pointer(newBucket)
-			return
-		}
-		b = (*paddedBucket)(b.next)
-	}
-}
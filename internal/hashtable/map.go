@@ -11,6 +11,9 @@ package hashtable
 
 import (
 	"fmt"
+	"math"
+	"math/bits"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"unsafe"
@@ -28,21 +31,26 @@ const (
 	growHint   resizeHint = 0
 	shrinkHint resizeHint = 1
 	clearHint  resizeHint = 2
+	// compactHint shrinks the table to the smallest size holding its nodes.
+	compactHint resizeHint = 3
 )
 
 const (
 	// number of entries per bucket
 	// 3 because we need to fit them into 1 cache line (64 bytes).
 	bucketSize = 3
-	// percentage at which the map will be expanded.
-	loadFactor = 0.75
+	// default percentage at which the map will be expanded.
+	defaultLoadFactor = 0.75
+	// default factor by which the map is expanded.
+	defaultGrowthFactor = 2
 	// threshold fraction of table occupation to start a table shrinking
 	// when deleting the last entry in a bucket chain.
 	shrinkFraction   = 128
 	minBucketCount   = 32
-	minNodeCount     = bucketSize * minBucketCount
 	minCounterLength = 8
 	maxCounterLength = 32
+	// number of the buckets migrated by each write when there is no background migration.
+	migrationStep = 4
 )
 
 // Map is like a Go map[K]V but is safe for concurrent
@@ -69,6 +77,22 @@ type Map[K comparable, V any] struct {
 	resizeCond sync.Cond
 	// resize in progress flag; updated atomically
 	resizing atomic.Int64
+	// fixed number of size counters; zero means autodetection
+	shardCount int
+	// fraction of the slots which can be occupied before the table grows
+	loadFactor float64
+	// log2 of the factor by which the table grows
+	growthShift uint
+	// number of completed grows and shrinks
+	resizes atomic.Int64
+	// the table is never compacted below this number of buckets
+	minTableLen int
+	// runs the background migration; nil means that the writers migrate the buckets
+	spawn func(f func())
+	// whether the stored nodes get the write sequence numbers
+	sequenced bool
+	// the last write sequence number
+	sequence atomic.Uint64
 }
 
 type table[K comparable] struct {
@@ -79,6 +103,34 @@ type table[K comparable] struct {
 	size   []paddedCounter
 	mask   uint64
 	hasher maphash.Hasher[K]
+	// the previous table whose nodes are being migrated into this one; nil when there is no migration
+	prev unsafe.Pointer
+	// *[]paddedCounter of the previous table, which still count the nodes migrated into this one.
+	// Only the counters are referenced, so the buckets of the previous table are freed after the migration.
+	prevSize unsafe.Pointer
+	// 1 for the migrated root buckets when this table is the previous one
+	migrated []uint32
+	// number of the migrated root buckets
+	migratedCount int64
+	// index of the next root bucket to migrate when this table is the previous one
+	migrationCursor int64
+	// the max number of buckets in a chain, the chains never get shorter
+	chainLen int64
+}
+
+// extendChain records that a chain of the table has got the given number of buckets.
+func (t *table[K]) extendChain(length int64) {
+	for {
+		current := atomic.LoadInt64(&t.chainLen)
+		if length <= current || atomic.CompareAndSwapInt64(&t.chainLen, current, length) {
+			return
+		}
+	}
+}
+
+// prevTable returns the table whose nodes are being migrated into t or nil.
+func (t *table[K]) prevTable() *table[K] {
+	return (*table[K])(atomic.LoadPointer(&t.prev))
 }
 
 func (t *table[K]) addSize(bucketIdx uint64, delta int) {
@@ -86,19 +138,42 @@ func (t *table[K]) addSize(bucketIdx uint64, delta int) {
 	atomic.AddInt64(&t.size[counterIdx].c, int64(delta))
 }
 
-func (t *table[K]) addSizePlain(bucketIdx uint64, delta int) {
-	counterIdx := uint64(len(t.size)-1) & bucketIdx
-	t.size[counterIdx].c += int64(delta)
+func (t *table[K]) sumSize() int64 {
+	return sumCounters(t.size)
 }
 
-func (t *table[K]) sumSize() int64 {
+func sumCounters(counters []paddedCounter) int64 {
 	sum := int64(0)
-	for i := range t.size {
-		sum += atomic.LoadInt64(&t.size[i].c)
+	for i := range counters {
+		sum += atomic.LoadInt64(&counters[i].c)
 	}
 	return sum
 }
 
+// prevCounters returns the size counters of the previous table which still count the nodes of t or nil.
+func (t *table[K]) prevCounters() []paddedCounter {
+	prevSize := (*[]paddedCounter)(atomic.LoadPointer(&t.prevSize))
+	if prevSize == nil {
+		return nil
+	}
+	return *prevSize
+}
+
+// totalSize returns the number of nodes in t. The migration doesn't move the size counts,
+// so the nodes added before the last resize are counted by the previous table
+// until the counts are folded into t by the next resize.
+func (t *table[K]) totalSize() int64 {
+	return t.sumSize() + sumCounters(t.prevCounters())
+}
+
+// foldSize moves the size counts of the previous table into t.
+func (t *table[K]) foldSize() {
+	if prevCounters := t.prevCounters(); prevCounters != nil {
+		t.addSize(0, int(sumCounters(prevCounters)))
+		atomic.StorePointer(&t.prevSize, nil)
+	}
+}
+
 func (t *table[K]) calcShiftHash(key K) uint64 {
 	// uint64(0) is a reserved value which stands for an empty slot.
 	h := t.hasher.Hash(key)
@@ -120,36 +195,97 @@ type paddedCounter struct {
 	counter
 }
 
+// Config configures the Map created by NewWithConfig.
+type Config struct {
+	// Size is the number of nodes the table should hold without growing. Zero means the minimal table.
+	Size int
+	// ShardCount is the fixed number of size counters. Zero means that it depends on the size of the table.
+	ShardCount int
+	// LoadFactor is the fraction of the slots which can be occupied before the table grows.
+	// Zero means 0.75.
+	LoadFactor float64
+	// GrowthFactor is the factor by which the table grows, it is rounded up to the nearest power of two.
+	// Zero means 2.
+	GrowthFactor int
+	// Go runs the migration of the nodes after a resize in the background, e.g. on a goroutine
+	// which the owner of the map waits for. Nil means that each write migrates a few buckets instead.
+	Go func(f func())
+	// Sequence makes the map set an increasing sequence number to every stored node under the bucket lock,
+	// so the sequence numbers of the nodes of the same key follow the order of the writes.
+	Sequence bool
+}
+
+// NewWithConfig creates a new Map instance configured by c.
+func NewWithConfig[K comparable, V any](c Config) *Map[K, V] {
+	m := &Map[K, V]{
+		loadFactor: c.LoadFactor,
+		spawn:      c.Go,
+		sequenced:  c.Sequence,
+	}
+	if m.loadFactor <= 0 {
+		m.loadFactor = defaultLoadFactor
+	}
+	growthFactor := defaultGrowthFactor
+	if c.GrowthFactor > growthFactor {
+		growthFactor = c.GrowthFactor
+	}
+	m.growthShift = uint(bits.TrailingZeros32(xmath.RoundUpPowerOf2(uint32(growthFactor))))
+	if c.ShardCount > 0 {
+		m.shardCount = int(xmath.RoundUpPowerOf2(uint32(c.ShardCount)))
+	}
+	m.resizeCond = *sync.NewCond(&m.resizeMutex)
+
+	m.minTableLen = m.bucketCountFor(c.Size)
+	t := newTable(m.minTableLen, m.shardCount, maphash.NewHasher[K]())
+	atomic.StorePointer(&m.table, unsafe.Pointer(t))
+	return m
+}
+
+// bucketCountFor returns the number of buckets needed to hold size nodes under the load factor.
+func (m *Map[K, V]) bucketCountFor(size int) int {
+	bucketCount := minBucketCount
+	if size > 0 {
+		if n := int(math.Ceil(float64(size) / (bucketSize * m.loadFactor))); n > bucketCount {
+			bucketCount = int(xmath.RoundUpPowerOf2(uint32(n)))
+		}
+	}
+	return bucketCount
+}
+
 // NewWithSize creates a new Map instance with capacity enough
 // to hold size nodes. If size is zero or negative, the value
 // is ignored.
 func NewWithSize[K comparable, V any](size int) *Map[K, V] {
-	return newMap[K, V](size)
+	return newMap[K, V](size, 0)
+}
+
+// NewWithShardCount creates a new Map instance with capacity enough
+// to hold size nodes and the fixed number of size counters.
+// If size is zero or negative, the value is ignored.
+// If shardCount is zero or negative, the number of counters depends on the size of the table.
+// Otherwise, it is rounded up to the nearest power of two.
+func NewWithShardCount[K comparable, V any](size, shardCount int) *Map[K, V] {
+	return newMap[K, V](size, shardCount)
 }
 
 // New creates a new Map instance.
 func New[K comparable, V any]() *Map[K, V] {
-	return newMap[K, V](minNodeCount)
+	return newMap[K, V](0, 0)
 }
 
-func newMap[K comparable, V any](size int) *Map[K, V] {
-	m := &Map[K, V]{}
-	m.resizeCond = *sync.NewCond(&m.resizeMutex)
-	var t *table[K]
-	if size <= minNodeCount {
-		t = newTable(minBucketCount, maphash.NewHasher[K]())
-	} else {
-		bucketCount := xmath.RoundUpPowerOf2(uint32(size / bucketSize))
-		t = newTable(int(bucketCount), maphash.NewHasher[K]())
-	}
-	atomic.StorePointer(&m.table, unsafe.Pointer(t))
-	return m
+func newMap[K comparable, V any](size, shardCount int) *Map[K, V] {
+	return NewWithConfig[K, V](Config{
+		Size:       size,
+		ShardCount: shardCount,
+	})
 }
 
-func newTable[K comparable](bucketCount int, prevHasher maphash.Hasher[K]) *table[K] {
+func newTable[K comparable](bucketCount, shardCount int, prevHasher maphash.Hasher[K]) *table[K] {
 	buckets := make([]paddedBucket, bucketCount)
 	counterLength := bucketCount >> 10
-	if counterLength < minCounterLength {
+	if shardCount > 0 {
+		counterLength = shardCount
+	} else if counterLength < minCounterLength {
 		counterLength = minCounterLength
 	} else if counterLength > maxCounterLength {
 		counterLength = maxCounterLength
@@ -157,10 +293,11 @@ func newTable[K comparable](bucketCount int, prevHasher maphash.Hasher[K]) *tabl
 	counter := make([]paddedCounter, counterLength)
 	mask := uint64(len(buckets) - 1)
 	t := &table[K]{
-		buckets: buckets,
-		size:    counter,
-		mask:    mask,
-		hasher:  maphash.NewSeed[K](prevHasher),
+		buckets:  buckets,
+		size:     counter,
+		mask:     mask,
+		hasher:   maphash.NewSeed[K](prevHasher),
+		chainLen: 1,
 	}
 	return t
 }
@@ -171,8 +308,76 @@ func newTable[K comparable](bucketCount int, prevHasher maphash.Hasher[K]) *tabl
 func (m *Map[K, V]) Get(key K) (got *node.Node[K, V], ok bool) {
 	t := (*table[K])(atomic.LoadPointer(&m.table))
 	hash := t.calcShiftHash(key)
-	bucketIdx := hash & t.mask
-	b := &t.buckets[bucketIdx]
+	got = find[K, V](t, hash, key)
+	return got, got != nil
+}
+
+// GetAll looks up the keys and stores the node found for keys[i] into nodes[i], or nil if no node is present.
+//
+// The keys are grouped by bucket, so that the lookups of the same bucket go one after another.
+// If parallelism is greater than one, the groups are split into this number of chunks
+// which are looked up in parallel.
+func (m *Map[K, V]) GetAll(keys []K, nodes []*node.Node[K, V], parallelism int) {
+	type pendingGet struct {
+		idx       int
+		bucketIdx uint64
+		hash      uint64
+	}
+
+	t := (*table[K])(atomic.LoadPointer(&m.table))
+	pending := make([]pendingGet, len(keys))
+	for i, key := range keys {
+		hash := t.calcShiftHash(key)
+		pending[i] = pendingGet{
+			idx:       i,
+			bucketIdx: hash & t.mask,
+			hash:      hash,
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].bucketIdx < pending[j].bucketIdx
+	})
+
+	get := func(chunk []pendingGet) {
+		for _, p := range chunk {
+			nodes[p.idx] = find[K, V](t, p.hash, keys[p.idx])
+		}
+	}
+	if parallelism <= 1 || len(pending) < 2*parallelism {
+		get(pending)
+		return
+	}
+
+	chunkSize := (len(pending) + parallelism - 1) / parallelism
+	var wg sync.WaitGroup
+	for start := 0; start < len(pending); start += chunkSize {
+		end := start + chunkSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		wg.Add(1)
+		go func(chunk []pendingGet) {
+			defer wg.Done()
+			get(chunk)
+		}(pending[start:end])
+	}
+	wg.Wait()
+}
+
+// find looks up the key in t, or in the previous table of t if the bucket of the key isn't migrated yet.
+// The migrated nodes are left in the previous table, so the concurrent lookups never miss them.
+func find[K comparable, V any](t *table[K], hash uint64, key K) *node.Node[K, V] {
+	if prev := t.prevTable(); prev != nil {
+		prevHash := prev.calcShiftHash(key)
+		if bucketIdx := prevHash & prev.mask; atomic.LoadUint32(&prev.migrated[bucketIdx]) == 0 {
+			return lookup[K, V](prev, prevHash, key)
+		}
+	}
+	return lookup[K, V](t, hash, key)
+}
+
+func lookup[K comparable, V any](t *table[K], hash uint64, key K) *node.Node[K, V] {
+	b := &t.buckets[hash&t.mask]
 	for {
 		for i := 0; i < bucketSize; i++ {
 			// we treat the hash code only as a hint, so there is no
@@ -192,11 +397,11 @@ func (m *Map[K, V]) Get(key K) (got *node.Node[K, V], ok bool) {
 				continue
 			}
 
-			return n, true
+			return n
 		}
 		bucketPtr := atomic.LoadPointer(&b.next)
 		if bucketPtr == nil {
-			return nil, false
+			return nil
 		}
 		b = (*paddedBucket)(bucketPtr)
 	}
@@ -223,6 +428,7 @@ func (m *Map[K, V]) set(n *node.Node[K, V], onlyIfAbsent bool) *node.Node[K, V]
 			emptyIdx    int
 		)
 		t := (*table[K])(atomic.LoadPointer(&m.table))
+		m.migrateKey(t, n.Key())
 		tableLen := len(t.buckets)
 		hash := t.calcShiftHash(n.Key())
 		bucketIdx := hash & t.mask
@@ -242,6 +448,7 @@ func (m *Map[K, V]) set(n *node.Node[K, V], onlyIfAbsent bool) *node.Node[K, V]
 			goto RETRY
 		}
 		b := rootBucket
+		chainLen := int64(1)
 		for {
 			for i := 0; i < bucketSize; i++ {
 				h := b.hashes[i]
@@ -262,13 +469,14 @@ func (m *Map[K, V]) set(n *node.Node[K, V], onlyIfAbsent bool) *node.Node[K, V]
 				if onlyIfAbsent {
 					// found node, drop set
 					rootBucket.mutex.Unlock()
-					return n
+					return prev
 				}
 				// in-place update.
 				// We get a copy of the value via an interface{} on each call,
 				// thus the live value pointers are unique. Otherwise atomic
 				// snapshot won't be correct in case of multiple Store calls
 				// using the same value.
+				m.stamp(n)
 				atomic.StorePointer(&b.nodes[i], unsafe.Pointer(n))
 				rootBucket.mutex.Unlock()
 				return prev
@@ -277,14 +485,16 @@ func (m *Map[K, V]) set(n *node.Node[K, V], onlyIfAbsent bool) *node.Node[K, V]
 				if emptyBucket != nil {
 					// insertion into an existing bucket.
 					// first we update the hash, then the entry.
+					m.stamp(n)
 					atomic.StoreUint64(&emptyBucket.hashes[emptyIdx], hash)
 					atomic.StorePointer(&emptyBucket.nodes[emptyIdx], unsafe.Pointer(n))
 					rootBucket.mutex.Unlock()
 					t.addSize(bucketIdx, 1)
 					return nil
 				}
-				growThreshold := float64(tableLen) * bucketSize * loadFactor
-				if t.sumSize() > int64(growThreshold) {
+				growThreshold := float64(tableLen) * bucketSize * m.loadFactor
+				// the table isn't grown until the running migration is finished, so the writer isn't stalled by it.
+				if t.totalSize() > int64(growThreshold) && t.prevTable() == nil {
 					// need to grow the table then go for another attempt.
 					rootBucket.mutex.Unlock()
 					m.resize(t, growHint)
@@ -292,15 +502,18 @@ func (m *Map[K, V]) set(n *node.Node[K, V], onlyIfAbsent bool) *node.Node[K, V]
 				}
 				// insertion into a new bucket.
 				// create and append the bucket.
+				m.stamp(n)
 				newBucket := &paddedBucket{}
 				newBucket.hashes[0] = hash
 				newBucket.nodes[0] = unsafe.Pointer(n)
 				atomic.StorePointer(&b.next, unsafe.Pointer(newBucket))
+				t.extendChain(chainLen + 1)
 				rootBucket.mutex.Unlock()
 				t.addSize(bucketIdx, 1)
 				return nil
 			}
 			b = (*paddedBucket)(b.next)
+			chainLen++
 		}
 	}
 }
@@ -328,6 +541,7 @@ func (m *Map[K, V]) delete(key K, cmp func(*node.Node[K, V]) bool) *node.Node[K,
 	RETRY:
 		hintNonEmpty := 0
 		t := (*table[K])(atomic.LoadPointer(&m.table))
+		m.migrateKey(t, key)
 		hash := t.calcShiftHash(key)
 		bucketIdx := hash & t.mask
 		rootBucket := &t.buckets[bucketIdx]
@@ -387,12 +601,285 @@ func (m *Map[K, V]) delete(key K, cmp func(*node.Node[K, V]) bool) *node.Node[K,
 	}
 }
 
+// pendingOp is an op of Apply waiting for the lock of its bucket.
+type pendingOp struct {
+	idx       int
+	bucketIdx uint64
+	hash      uint64
+}
+
+// byBucket orders the pending ops by bucket and then by their index in the batch.
+// Unlike sort.SliceStable, it doesn't use reflection to swap the elements.
+type byBucket []pendingOp
+
+func (p byBucket) Len() int {
+	return len(p)
+}
+
+func (p byBucket) Less(i, j int) bool {
+	if p[i].bucketIdx != p[j].bucketIdx {
+		return p[i].bucketIdx < p[j].bucketIdx
+	}
+	return p[i].idx < p[j].idx
+}
+
+func (p byBucket) Swap(i, j int) {
+	p[i], p[j] = p[j], p[i]
+}
+
+// Op is a single change of the batch applied by Apply.
+//
+// A nil Node deletes the key, otherwise the node is stored for its key.
+type Op[K comparable, V any] struct {
+	Key  K
+	Node *node.Node[K, V]
+}
+
+// Apply applies the ops so that all ops on keys of the same bucket are done under a single bucket lock,
+// hence Range never observes them partially applied. Ops on the same key are applied in order.
+//
+// The changes of different buckets are not atomic with respect to each other.
+//
+// f is called after each op with the replaced or deleted node, or nil if there was no node for the key.
+func (m *Map[K, V]) Apply(ops []Op[K, V], f func(i int, prev *node.Node[K, V])) {
+	pending := make([]pendingOp, len(ops))
+	for i := range pending {
+		pending[i].idx = i
+	}
+	prevs := make([]*node.Node[K, V], 0, bucketSize)
+	for len(pending) > 0 {
+		t := (*table[K])(atomic.LoadPointer(&m.table))
+		for i := range pending {
+			m.migrateKey(t, ops[pending[i].idx].Key)
+			pending[i].hash = t.calcShiftHash(ops[pending[i].idx].Key)
+			pending[i].bucketIdx = pending[i].hash & t.mask
+		}
+		// group the ops by bucket, keeping the order of ops on the same key.
+		sort.Sort(byBucket(pending))
+
+		var retry []pendingOp
+		for start := 0; start < len(pending); {
+			bucketIdx := pending[start].bucketIdx
+			end := start + 1
+			for end < len(pending) && pending[end].bucketIdx == bucketIdx {
+				end++
+			}
+
+			rootBucket := &t.buckets[bucketIdx]
+			rootBucket.mutex.Lock()
+			// the following two checks must go in reverse to what's
+			// in the resize method.
+			if m.resizeInProgress() || m.newerTableExists(t) {
+				// the table is being resized, retry the rest of the ops with the new one.
+				rootBucket.mutex.Unlock()
+				retry = append(retry, pending[start:]...)
+				break
+			}
+			delta := 0
+			for _, p := range pending[start:end] {
+				op := ops[p.idx]
+				var prev *node.Node[K, V]
+				if op.Node == nil {
+					prev = deleteLocked[K, V](rootBucket, p.hash, op.Key)
+					if prev != nil {
+						delta--
+					}
+				} else {
+					m.stamp(op.Node)
+					prev = setLocked(t, rootBucket, p.hash, op.Node)
+					if prev == nil {
+						delta++
+					}
+				}
+				prevs = append(prevs, prev)
+			}
+			rootBucket.mutex.Unlock()
+			if delta != 0 {
+				t.addSize(bucketIdx, delta)
+			}
+
+			for i, p := range pending[start:end] {
+				f(p.idx, prevs[i])
+				prevs[i] = nil
+			}
+			prevs = prevs[:0]
+			start = end
+		}
+
+		if len(retry) > 0 {
+			m.waitForResize()
+			pending = retry
+			continue
+		}
+
+		m.growIfNeeded(t)
+		return
+	}
+}
+
+// SetIf stores the node if f returns true for the current node of the key or nil if there is no such node.
+// f is called under the bucket lock, so the check and the store are atomic.
+//
+// Returns the current node and whether the node was stored.
+func (m *Map[K, V]) SetIf(n *node.Node[K, V], f func(current *node.Node[K, V]) bool) (*node.Node[K, V], bool) {
+	for {
+		t := (*table[K])(atomic.LoadPointer(&m.table))
+		m.migrateKey(t, n.Key())
+		hash := t.calcShiftHash(n.Key())
+		bucketIdx := hash & t.mask
+		rootBucket := &t.buckets[bucketIdx]
+		rootBucket.mutex.Lock()
+		// the following two checks must go in reverse to what's
+		// in the resize method.
+		if m.resizeInProgress() {
+			// resize is in progress. wait, then go for another attempt.
+			rootBucket.mutex.Unlock()
+			m.waitForResize()
+			continue
+		}
+		if m.newerTableExists(t) {
+			// someone resized the table, go for another attempt.
+			rootBucket.mutex.Unlock()
+			continue
+		}
+		current := findLocked[K, V](rootBucket, hash, n.Key())
+		if !f(current) {
+			rootBucket.mutex.Unlock()
+			return current, false
+		}
+		m.stamp(n)
+		setLocked(t, rootBucket, hash, n)
+		rootBucket.mutex.Unlock()
+		if current == nil {
+			t.addSize(bucketIdx, 1)
+			m.growIfNeeded(t)
+		}
+		return current, true
+	}
+}
+
+// stamp sets the next write sequence number to the node, it must be called under the bucket lock.
+func (m *Map[K, V]) stamp(n *node.Node[K, V]) {
+	if m.sequenced {
+		n.SetSequence(m.sequence.Add(1))
+	}
+}
+
+func (m *Map[K, V]) growIfNeeded(t *table[K]) {
+	growThreshold := float64(len(t.buckets)) * bucketSize * m.loadFactor
+	if t.totalSize() > int64(growThreshold) {
+		m.resize(t, growHint)
+	}
+}
+
+// findLocked returns the node for the key from the bucket chain.
+//
+// NOTE: the root bucket mutex must be held.
+func findLocked[K comparable, V any](root *paddedBucket, hash uint64, key K) *node.Node[K, V] {
+	b := root
+	for {
+		for i := 0; i < bucketSize; i++ {
+			if b.hashes[i] != hash {
+				continue
+			}
+			current := (*node.Node[K, V])(b.nodes[i])
+			if key == current.Key() {
+				return current
+			}
+		}
+		if b.next == nil {
+			return nil
+		}
+		b = (*paddedBucket)(b.next)
+	}
+}
+
+// setLocked stores the node in the bucket chain of t and returns the replaced node.
+//
+// NOTE: the root bucket mutex must be held.
+func setLocked[K comparable, V any](t *table[K], root *paddedBucket, hash uint64, n *node.Node[K, V]) *node.Node[K, V] {
+	var (
+		emptyBucket *paddedBucket
+		emptyIdx    int
+	)
+	b := root
+	chainLen := int64(1)
+	for {
+		for i := 0; i < bucketSize; i++ {
+			h := b.hashes[i]
+			if h == uint64(0) {
+				if emptyBucket == nil {
+					emptyBucket = b
+					emptyIdx = i
+				}
+				continue
+			}
+			if h != hash {
+				continue
+			}
+			prev := (*node.Node[K, V])(b.nodes[i])
+			if n.Key() != prev.Key() {
+				continue
+			}
+			atomic.StorePointer(&b.nodes[i], unsafe.Pointer(n))
+			return prev
+		}
+		if b.next == nil {
+			if emptyBucket != nil {
+				// first we update the hash, then the entry.
+				atomic.StoreUint64(&emptyBucket.hashes[emptyIdx], hash)
+				atomic.StorePointer(&emptyBucket.nodes[emptyIdx], unsafe.Pointer(n))
+				return nil
+			}
+			newBucket := &paddedBucket{}
+			newBucket.hashes[0] = hash
+			newBucket.nodes[0] = unsafe.Pointer(n)
+			atomic.StorePointer(&b.next, unsafe.Pointer(newBucket))
+			t.extendChain(chainLen + 1)
+			return nil
+		}
+		b = (*paddedBucket)(b.next)
+		chainLen++
+	}
+}
+
+// deleteLocked deletes the node for the key from the bucket chain and returns it.
+//
+// NOTE: the root bucket mutex must be held.
+func deleteLocked[K comparable, V any](root *paddedBucket, hash uint64, key K) *node.Node[K, V] {
+	b := root
+	for {
+		for i := 0; i < bucketSize; i++ {
+			if b.hashes[i] != hash {
+				continue
+			}
+			current := (*node.Node[K, V])(b.nodes[i])
+			if key != current.Key() {
+				continue
+			}
+			// first we update the hash, then the node.
+			atomic.StoreUint64(&b.hashes[i], uint64(0))
+			atomic.StorePointer(&b.nodes[i], nil)
+			return current
+		}
+		if b.next == nil {
+			return nil
+		}
+		b = (*paddedBucket)(b.next)
+	}
+}
+
+// resize publishes the new table right away, and the nodes are migrated into it incrementally:
+// the writers migrate the bucket of the key before changing it, and the rest is migrated in the background
+// or, without the background migration, a few buckets by each write.
+// The table isn't grown or shrunk again until the migration is finished.
+// Hence, the writers are never blocked by rehashing of the whole table.
 func (m *Map[K, V]) resize(known *table[K], hint resizeHint) {
 	knownTableLen := len(known.buckets)
 	// fast path for shrink attempts.
 	if hint == shrinkHint {
 		shrinkThreshold := int64((knownTableLen * bucketSize) / shrinkFraction)
-		if knownTableLen == minBucketCount || known.sumSize() > shrinkThreshold {
+		if knownTableLen == minBucketCount || known.totalSize() > shrinkThreshold {
 			return
 		}
 	}
@@ -402,66 +889,167 @@ func (m *Map[K, V]) resize(known *table[K], hint resizeHint) {
 		m.waitForResize()
 		return
 	}
-	var nt *table[K]
 	t := (*table[K])(atomic.LoadPointer(&m.table))
+	if hint == clearHint {
+		// stop the migration of the dropped table.
+		atomic.StorePointer(&t.prev, nil)
+		atomic.StorePointer(&m.table, unsafe.Pointer(newTable(minBucketCount, m.shardCount, t.hasher)))
+		m.endResize()
+		return
+	}
+	if hint == growHint && t != known {
+		// someone else has already grown the table.
+		m.endResize()
+		return
+	}
+	// only one migration at a time, so the previous one is either awaited by the next grow or shrink,
+	// or finished by the explicit compaction.
+	if hint != compactHint && t.prevTable() != nil {
+		m.endResize()
+		return
+	}
+	m.finishMigration(t)
+	t.foldSize()
 	tableLen := len(t.buckets)
+	var bucketCount int
 	switch hint {
 	case growHint:
-		// grow the table with factor of 2.
-		nt = newTable(tableLen<<1, t.hasher)
+		// grow the table with the growth factor.
+		bucketCount = tableLen << m.growthShift
 	case shrinkHint:
 		shrinkThreshold := int64((tableLen * bucketSize) / shrinkFraction)
-		if tableLen > minBucketCount && t.sumSize() <= shrinkThreshold {
+		if tableLen > minBucketCount && t.totalSize() <= shrinkThreshold {
 			// shrink the table with factor of 2.
-			nt = newTable(tableLen>>1, t.hasher)
-		} else {
-			// no need to shrink, wake up all waiters and give up.
-			m.resizeMutex.Lock()
-			m.resizing.Store(0)
-			m.resizeCond.Broadcast()
-			m.resizeMutex.Unlock()
-			return
+			bucketCount = tableLen >> 1
+		}
+	case compactHint:
+		if compactedLen := m.compactedLen(t); compactedLen < tableLen {
+			bucketCount = compactedLen
 		}
-	case clearHint:
-		nt = newTable(minBucketCount, t.hasher)
 	default:
 		panic(fmt.Sprintf("unexpected resize hint: %d", hint))
 	}
-	// copy the data only if we're not clearing the hashtable.
-	if hint != clearHint {
-		for i := 0; i < tableLen; i++ {
-			copied := m.copyBuckets(&t.buckets[i], nt)
-			nt.addSizePlain(uint64(i), copied)
-		}
+	if bucketCount == 0 {
+		// no need to resize, wake up all waiters and give up.
+		m.endResize()
+		return
 	}
+	nt := newTable(bucketCount, m.shardCount, t.hasher)
+	t.migrated = make([]uint32, tableLen)
+	nt.prev = unsafe.Pointer(t)
+	prevSize := t.size
+	nt.prevSize = unsafe.Pointer(&prevSize)
 	// publish the new table and wake up all waiters.
 	atomic.StorePointer(&m.table, unsafe.Pointer(nt))
+	m.resizes.Add(1)
+	m.endResize()
+	if m.spawn != nil {
+		m.spawn(func() {
+			m.migrate(nt, t)
+		})
+	}
+}
+
+func (m *Map[K, V]) endResize() {
 	m.resizeMutex.Lock()
 	m.resizing.Store(0)
 	m.resizeCond.Broadcast()
 	m.resizeMutex.Unlock()
 }
 
-func (m *Map[K, V]) copyBuckets(b *paddedBucket, dest *table[K]) (copied int) {
-	rootBucket := b
+// migrate migrates the nodes of prev into t bucket by bucket, until the migration is finished or the table is cleared.
+func (m *Map[K, V]) migrate(t, prev *table[K]) {
+	for t.prevTable() == prev {
+		if !m.migrateNext(t, prev) {
+			return
+		}
+	}
+}
+
+// migrateNext migrates the next root bucket of prev which hasn't been taken by another migrating goroutine
+// and reports whether there was one.
+func (m *Map[K, V]) migrateNext(t, prev *table[K]) bool {
+	bucketIdx := atomic.AddInt64(&prev.migrationCursor, 1) - 1
+	if bucketIdx >= int64(len(prev.buckets)) {
+		return false
+	}
+	m.migrateBucket(t, prev, uint64(bucketIdx))
+	return true
+}
+
+// finishMigration migrates the rest of the nodes of the previous table of t.
+func (m *Map[K, V]) finishMigration(t *table[K]) {
+	prev := t.prevTable()
+	if prev == nil {
+		return
+	}
+	for i := range prev.buckets {
+		m.migrateBucket(t, prev, uint64(i))
+	}
+	atomic.StorePointer(&t.prev, nil)
+}
+
+// migrateKey migrates the bucket of the previous table of t which holds the key, so the key can be changed in t.
+func (m *Map[K, V]) migrateKey(t *table[K], key K) {
+	prev := t.prevTable()
+	if prev == nil {
+		return
+	}
+	bucketIdx := prev.calcShiftHash(key) & prev.mask
+	m.migrateBucket(t, prev, bucketIdx)
+	if m.spawn == nil {
+		for i := 0; i < migrationStep; i++ {
+			if !m.migrateNext(t, prev) {
+				break
+			}
+		}
+	}
+}
+
+// migrateBucket copies the nodes of the root bucket of prev into t, unless it is already migrated.
+//
+// The previous bucket is locked before the buckets of t, and the writers of t never hold
+// a lock of t while migrating, so there are no deadlocks.
+func (m *Map[K, V]) migrateBucket(t, prev *table[K], bucketIdx uint64) {
+	if atomic.LoadUint32(&prev.migrated[bucketIdx]) == 1 {
+		return
+	}
+	rootBucket := &prev.buckets[bucketIdx]
 	rootBucket.mutex.Lock()
-	for {
+	if prev.migrated[bucketIdx] == 1 {
+		rootBucket.mutex.Unlock()
+		return
+	}
+	for b := rootBucket; b != nil; b = (*paddedBucket)(b.next) {
 		for i := 0; i < bucketSize; i++ {
 			if b.nodes[i] == nil {
 				continue
 			}
 			n := (*node.Node[K, V])(b.nodes[i])
-			hash := dest.calcShiftHash(n.Key())
-			bucketIdx := hash & dest.mask
-			dest.buckets[bucketIdx].add(hash, b.nodes[i])
-			copied++
+			hash := t.calcShiftHash(n.Key())
+			destIdx := hash & t.mask
+			dest := &t.buckets[destIdx]
+			dest.mutex.Lock()
+			setLocked(t, dest, hash, n)
+			dest.mutex.Unlock()
 		}
-		if b.next == nil {
-			rootBucket.mutex.Unlock()
-			return copied
-		}
-		b = (*paddedBucket)(b.next)
 	}
+	// the nodes are left in place, since the concurrent lookups of the previous table may still read them.
+	atomic.StoreUint32(&prev.migrated[bucketIdx], 1)
+	rootBucket.mutex.Unlock()
+	if atomic.AddInt64(&prev.migratedCount, 1) == int64(len(prev.buckets)) {
+		atomic.CompareAndSwapPointer(&t.prev, unsafe.Pointer(prev), nil)
+	}
+}
+
+// compactedLen returns the number of buckets of the compacted table t.
+// The compacted table is at most half full of the load factor, so it isn't grown right after compaction.
+func (m *Map[K, V]) compactedLen(t *table[K]) int {
+	bucketCount := m.bucketCountFor(2 * int(t.totalSize()))
+	if bucketCount < m.minTableLen {
+		bucketCount = m.minTableLen
+	}
+	return bucketCount
 }
 
 func (m *Map[K, V]) newerTableExists(table *table[K]) bool {
@@ -497,25 +1085,17 @@ func (m *Map[K, V]) Range(f func(*node.Node[K, V]) bool) {
 	var zeroPtr unsafe.Pointer
 	// Pre-allocate array big enough to fit nodes for most hash tables.
 	buffer := make([]unsafe.Pointer, 0, 16*bucketSize)
-	tp := atomic.LoadPointer(&m.table)
-	t := *(*table[K])(tp)
-	for i := range t.buckets {
-		rootBucket := &t.buckets[i]
-		b := rootBucket
-		// Prevent concurrent modifications and copy all nodes into
-		// the intermediate slice.
-		rootBucket.mutex.Lock()
-		for {
-			for i := 0; i < bucketSize; i++ {
-				if b.nodes[i] != nil {
-					buffer = append(buffer, b.nodes[i])
-				}
-			}
-			if b.next == nil {
-				rootBucket.mutex.Unlock()
-				break
-			}
-			b = (*paddedBucket)(b.next)
+	r := newTableReader[K, V]((*table[K])(atomic.LoadPointer(&m.table)))
+	prevLen := 0
+	if r.prev != nil {
+		prevLen = len(r.prev.buckets)
+	}
+	// the buckets of the previous table go first, so the nodes migrated from them are skipped in the table.
+	for i := 0; i < prevLen+len(r.t.buckets); i++ {
+		if i < prevLen {
+			buffer = r.appendPrevBucket(uint64(i), buffer)
+		} else {
+			buffer = r.appendBucket(uint64(i-prevLen), buffer)
 		}
 		// Call the function for all copied nodes.
 		for j := range buffer {
@@ -530,14 +1110,265 @@ func (m *Map[K, V]) Range(f func(*node.Node[K, V]) bool) {
 	}
 }
 
+// Sample calls f for at most n random nodes of the map which match pred.
+//
+// Every set of n matching nodes is equally likely to be chosen: the slots of the buckets are read at random,
+// including the slots of the overflow buckets which the chains may not have, and an empty slot,
+// a node which doesn't match pred or a node chosen before are rejected. The expected number of the read slots
+// is n times the ratio of the slots to the matching nodes, so Sample is cheap when most of the nodes match.
+// When the matching nodes are too sparse for that, Sample falls back to a single pass over the map,
+// so it never costs much more than Range.
+func (m *Map[K, V]) Sample(n int, pred func(*node.Node[K, V]) bool, f func(*node.Node[K, V])) {
+	if n <= 0 {
+		return
+	}
+
+	r := newTableReader[K, V]((*table[K])(atomic.LoadPointer(&m.table)))
+	// while the nodes are migrated, the buckets of both tables are read. The buckets of the previous table
+	// which are already migrated are rejected, since their nodes are in the table now.
+	bucketCount := uint64(len(r.t.buckets))
+	prevCount := uint64(0)
+	chainLen := atomic.LoadInt64(&r.t.chainLen)
+	if r.prev != nil {
+		prevCount = uint64(len(r.prev.buckets))
+		if prevChainLen := atomic.LoadInt64(&r.prev.chainLen); prevChainLen > chainLen {
+			chainLen = prevChainLen
+		}
+	}
+	// the attempts are bounded by the number of the buckets, so a sparse sample costs about as much as Range.
+	attempts := (bucketCount + prevCount) * uint64(chainLen)
+	sampled := make([]*node.Node[K, V], 0, n)
+	seen := make(map[*node.Node[K, V]]struct{}, n)
+	for ; attempts > 0 && len(sampled) < n; attempts-- {
+		bucketIdx := (uint64(xruntime.Fastrand())<<32 | uint64(xruntime.Fastrand())) % (bucketCount + prevCount)
+		depth := int64(xruntime.Fastrand() % uint32(chainLen))
+		slot := int(xruntime.Fastrand() % bucketSize)
+		var got *node.Node[K, V]
+		if bucketIdx < bucketCount {
+			got = (*node.Node[K, V])(r.nodeAt(r.t, bucketIdx, depth, slot))
+		} else {
+			got = (*node.Node[K, V])(r.nodeAt(r.prev, bucketIdx-bucketCount, depth, slot))
+		}
+		if got == nil || !pred(got) {
+			continue
+		}
+		if _, ok := seen[got]; ok {
+			continue
+		}
+		seen[got] = struct{}{}
+		sampled = append(sampled, got)
+	}
+
+	if len(sampled) < n {
+		// too few nodes match, so the sample is chosen by reservoir sampling of all of them.
+		sampled = sampled[:0]
+		count := 0
+		m.Range(func(got *node.Node[K, V]) bool {
+			if !pred(got) {
+				return true
+			}
+			count++
+			if len(sampled) < n {
+				sampled = append(sampled, got)
+			} else if j := int((uint64(xruntime.Fastrand())<<32 | uint64(xruntime.Fastrand())) % uint64(count)); j < n {
+				sampled[j] = got
+			}
+			return true
+		})
+	}
+	for _, got := range sampled {
+		f(got)
+	}
+}
+
+// tableReader copies the nodes of a table while the nodes of its previous table may be migrated into it.
+//
+// The buckets of the previous table which aren't migrated yet are read from the previous table,
+// and the nodes of the table which were migrated from the buckets already read are skipped,
+// so no node is read twice, and Range and Sample don't have to wait for the rest of the migration.
+type tableReader[K comparable, V any] struct {
+	t    *table[K]
+	prev *table[K]
+	// the buckets of prev which were read before their migration
+	readPrev map[uint64]struct{}
+}
+
+func newTableReader[K comparable, V any](t *table[K]) *tableReader[K, V] {
+	return &tableReader[K, V]{
+		t:    t,
+		prev: t.prevTable(),
+	}
+}
+
+// appendBucket appends the nodes of the bucket of the table with the given index to buffer.
+func (r *tableReader[K, V]) appendBucket(bucketIdx uint64, buffer []unsafe.Pointer) []unsafe.Pointer {
+	rootBucket := &r.t.buckets[bucketIdx]
+	// Prevent concurrent modifications and copy all nodes into the buffer.
+	rootBucket.mutex.Lock()
+	for b := rootBucket; b != nil; b = (*paddedBucket)(b.next) {
+		for i := 0; i < bucketSize; i++ {
+			if b.nodes[i] == nil {
+				continue
+			}
+			if len(r.readPrev) > 0 {
+				// the tables have different seeds, so the bucket of prev is found by the key.
+				n := (*node.Node[K, V])(b.nodes[i])
+				if _, ok := r.readPrev[r.prev.calcShiftHash(n.Key())&r.prev.mask]; ok {
+					continue
+				}
+			}
+			buffer = append(buffer, b.nodes[i])
+		}
+	}
+	rootBucket.mutex.Unlock()
+	return buffer
+}
+
+// nodeAt returns the node in the slot of the bucket of the chain of the root bucket with the given index in t,
+// which is either the table or the previous table, or nil if there is no such node.
+//
+// nil is returned for the buckets of the previous table which are already migrated.
+func (r *tableReader[K, V]) nodeAt(t *table[K], bucketIdx uint64, depth int64, slot int) unsafe.Pointer {
+	rootBucket := &t.buckets[bucketIdx]
+	rootBucket.mutex.Lock()
+	defer rootBucket.mutex.Unlock()
+	if t == r.prev && t.migrated[bucketIdx] == 1 {
+		return nil
+	}
+	b := rootBucket
+	for ; depth > 0 && b != nil; depth-- {
+		b = (*paddedBucket)(b.next)
+	}
+	if b == nil {
+		return nil
+	}
+	return b.nodes[slot]
+}
+
+// appendPrevBucket appends the nodes of the bucket of the previous table with the given index to buffer,
+// unless the bucket is already migrated.
+func (r *tableReader[K, V]) appendPrevBucket(bucketIdx uint64, buffer []unsafe.Pointer) []unsafe.Pointer {
+	rootBucket := &r.prev.buckets[bucketIdx]
+	rootBucket.mutex.Lock()
+	if r.prev.migrated[bucketIdx] == 0 {
+		if r.readPrev == nil {
+			r.readPrev = make(map[uint64]struct{})
+		}
+		r.readPrev[bucketIdx] = struct{}{}
+		for b := rootBucket; b != nil; b = (*paddedBucket)(b.next) {
+			for i := 0; i < bucketSize; i++ {
+				if b.nodes[i] != nil {
+					buffer = append(buffer, b.nodes[i])
+				}
+			}
+		}
+	}
+	rootBucket.mutex.Unlock()
+	return buffer
+}
+
 // Clear deletes all keys and values currently stored in the map.
 func (m *Map[K, V]) Clear() {
 	table := (*table[K])(atomic.LoadPointer(&m.table))
 	m.resize(table, clearHint)
 }
 
+// Compact shrinks the table to the smallest size which holds twice the current nodes under the load factor,
+// but not below the initial size of the map. It's useful after mass deletions,
+// since deletions shrink the table only when it is almost empty.
+//
+// The running migration of the last resize is finished by Compact first.
+//
+// Compact returns true if the table was shrunk.
+func (m *Map[K, V]) Compact() bool {
+	t := (*table[K])(atomic.LoadPointer(&m.table))
+	if m.compactedLen(t) >= len(t.buckets) {
+		return false
+	}
+	m.resize(t, compactHint)
+	return (*table[K])(atomic.LoadPointer(&m.table)) != t
+}
+
 // Size returns current size of the map.
 func (m *Map[K, V]) Size() int {
 	table := (*table[K])(atomic.LoadPointer(&m.table))
-	return int(table.sumSize())
+	return int(table.totalSize())
+}
+
+// MemoryUsage returns the estimated number of bytes used by the buckets and the size counters of the table.
+// The nodes aren't included.
+//
+// The previous table is included while its nodes are being migrated.
+func (m *Map[K, V]) MemoryUsage() int64 {
+	t := (*table[K])(atomic.LoadPointer(&m.table))
+	usage := t.memoryUsage()
+	if prev := t.prevTable(); prev != nil {
+		usage += prev.memoryUsage()
+	}
+	return usage
+}
+
+func (t *table[K]) memoryUsage() int64 {
+	bucketCount := len(t.buckets)
+	for i := range t.buckets {
+		for b := atomic.LoadPointer(&t.buckets[i].next); b != nil; b = atomic.LoadPointer(&(*paddedBucket)(b).next) {
+			bucketCount++
+		}
+	}
+	return int64(bucketCount)*int64(unsafe.Sizeof(paddedBucket{})) +
+		int64(len(t.size))*int64(unsafe.Sizeof(paddedCounter{})) +
+		int64(len(t.migrated))*int64(unsafe.Sizeof(uint32(0)))
+}
+
+// Info describes the state of the map's table.
+type Info struct {
+	// BucketCount is the number of buckets in the table.
+	BucketCount int
+	// CounterSizes contains values of the sharded size counters.
+	CounterSizes []int
+	// Size is the number of nodes in the table.
+	Size int
+	// Load is the ratio of the number of nodes to the number of the slots of the root buckets.
+	Load float64
+	// LoadFactor is the fraction of the slots which can be occupied before the table grows.
+	LoadFactor float64
+	// GrowthFactor is the factor by which the table grows.
+	GrowthFactor int
+	// Resizes is the number of grows and shrinks of the table.
+	Resizes int64
+	// Migrating is the number of buckets of the previous table which aren't migrated yet after the last resize.
+	Migrating int
+}
+
+// Info returns the current state of the map's table.
+func (m *Map[K, V]) Info() Info {
+	table := (*table[K])(atomic.LoadPointer(&m.table))
+	sizes := make([]int, 0, len(table.size))
+	size := 0
+	for i := range table.size {
+		c := int(atomic.LoadInt64(&table.size[i].c))
+		sizes = append(sizes, c)
+		size += c
+	}
+	// the counters of the previous table are folded into the counters of the table.
+	prevCounters := table.prevCounters()
+	for i := range prevCounters {
+		c := int(atomic.LoadInt64(&prevCounters[i].c))
+		sizes[i%len(sizes)] += c
+		size += c
+	}
+	migrating := 0
+	if prev := table.prevTable(); prev != nil {
+		migrating = len(prev.buckets) - int(atomic.LoadInt64(&prev.migratedCount))
+	}
+	return Info{
+		BucketCount:  len(table.buckets),
+		CounterSizes: sizes,
+		Size:         size,
+		Load:         float64(size) / float64(len(table.buckets)*bucketSize),
+		LoadFactor:   m.loadFactor,
+		GrowthFactor: 1 << m.growthShift,
+		Resizes:      m.resizes.Load(),
+		Migrating:    migrating,
+	}
 }
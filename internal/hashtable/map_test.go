@@ -23,6 +23,9 @@ package hashtable
 
 import (
 	"math/rand"
+	"reflect"
+	"runtime"
+	"sort"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -45,6 +48,310 @@ func TestMap_PaddedBucketSize(t *testing.T) {
 	}
 }
 
+func TestMap_ShardCount(t *testing.T) {
+	m := NewWithShardCount[string, int](0, 3)
+	for i := 0; i < 10000; i++ {
+		m.Set(newNode(strconv.Itoa(i), i))
+	}
+
+	info := m.Info()
+	if len(info.CounterSizes) != 4 {
+		t.Fatalf("number of counters should be rounded up to 4, but got %d", len(info.CounterSizes))
+	}
+	sum := 0
+	for _, size := range info.CounterSizes {
+		sum += size
+	}
+	if sum != m.Size() {
+		t.Fatalf("sum of counters should be equal to the size: %d != %d", sum, m.Size())
+	}
+}
+
+func TestMap_Config(t *testing.T) {
+	const size = 10000
+	m := NewWithConfig[string, int](Config{Size: size, LoadFactor: 0.5, GrowthFactor: 3})
+	for i := 0; i < size; i++ {
+		m.Set(newNode(strconv.Itoa(i), i))
+	}
+
+	info := m.Info()
+	if info.Resizes != 0 {
+		t.Fatalf("presized table shouldn't be resized, but got %d resizes", info.Resizes)
+	}
+	if info.Load > 0.5 || info.LoadFactor != 0.5 || info.GrowthFactor != 4 || info.Size != size {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	buckets := info.BucketCount
+	for i := size; i < 2*size; i++ {
+		m.Set(newNode(strconv.Itoa(i), i))
+	}
+	info = m.Info()
+	if info.Resizes != 1 || info.BucketCount != 4*buckets {
+		t.Fatalf("table should grow once by the growth factor, but got %+v", info)
+	}
+}
+
+func TestMap_Compact(t *testing.T) {
+	const size = 100000
+	m := NewWithSize[string, int](1000)
+	for i := 0; i < size; i++ {
+		m.Set(newNode(strconv.Itoa(i), i))
+	}
+	grown := m.Info().BucketCount
+
+	if m.Compact() {
+		t.Fatal("full table shouldn't be compacted")
+	}
+
+	for i := 0; i < size-size/10; i++ {
+		m.Delete(strconv.Itoa(i))
+	}
+	if m.Info().BucketCount != grown {
+		t.Fatal("table shouldn't be shrunk until it is almost empty")
+	}
+
+	if !m.Compact() {
+		t.Fatal("table should be compacted")
+	}
+	info := m.Info()
+	if info.BucketCount > grown/4 || info.Load > info.LoadFactor/2 || info.Size != size/10 {
+		t.Fatalf("unexpected info after compaction %+v", info)
+	}
+	for i := size - size/10; i < size; i++ {
+		if _, ok := m.Get(strconv.Itoa(i)); !ok {
+			t.Fatalf("node %d should be present after compaction", i)
+		}
+	}
+
+	m = NewWithSize[string, int](size)
+	initial := m.Info().BucketCount
+	m.Set(newNode("1", 1))
+	if m.Compact() || m.Info().BucketCount != initial {
+		t.Fatal("table shouldn't be compacted below the initial size")
+	}
+}
+
+func TestMap_IncrementalResize(t *testing.T) {
+	const size = 100000
+	m := New[int, int]()
+	for i := 0; i < size; i++ {
+		m.Set(newNode(i, i))
+	}
+
+	// the nodes are readable and writable right after the resize, while the migration may be in progress.
+	for i := 0; i < size; i += 2 {
+		if n, ok := m.Get(i); !ok || n.Value() != i {
+			t.Fatalf("node %d should be found during the migration", i)
+		}
+		if m.Delete(i) == nil {
+			t.Fatalf("node %d should be deleted during the migration", i)
+		}
+	}
+	if got := m.Size(); got != size/2 {
+		t.Fatalf("size should be %d, but got %d", size/2, got)
+	}
+
+	for deadline := time.Now().Add(time.Minute); m.Info().Migrating > 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("migration should be finished")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < size; i++ {
+		if _, ok := m.Get(i); ok != (i%2 == 1) {
+			t.Fatalf("node %d should be found: %v", i, i%2 == 1)
+		}
+	}
+	if info := m.Info(); info.Size != size/2 {
+		t.Fatalf("size should be %d, but got %+v", size/2, info)
+	}
+}
+
+func TestMap_AmortizedMigration(t *testing.T) {
+	before := runtime.NumGoroutine()
+	m := New[int, int]()
+	i := 0
+	for ; m.Info().Migrating == 0; i++ {
+		m.Set(newNode(i, i))
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("migration shouldn't start goroutines, but got %d -> %d", before, after)
+	}
+
+	// the writes migrate the rest of the buckets.
+	for ; m.Info().Migrating > 0; i++ {
+		m.Set(newNode(i, i))
+	}
+	for j := 0; j < i; j++ {
+		if n, ok := m.Get(j); !ok || n.Value() != j {
+			t.Fatalf("node %d should be found after the migration", j)
+		}
+	}
+}
+
+func TestMap_BackgroundMigration(t *testing.T) {
+	const size = 100000
+	var wg sync.WaitGroup
+	m := NewWithConfig[int, int](Config{
+		Go: func(f func()) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				f()
+			}()
+		},
+	})
+	for i := 0; i < size; i++ {
+		m.Set(newNode(i, i))
+	}
+
+	wg.Wait()
+	if info := m.Info(); info.Resizes == 0 || info.Migrating > 0 {
+		t.Fatalf("migration should be finished by the background goroutines, but got %+v", info)
+	}
+}
+
+func TestMap_NoResizeDuringMigration(t *testing.T) {
+	// the background migration never runs, so only the writers migrate the buckets of their keys.
+	m := NewWithConfig[int, int](Config{
+		Size: 1 << 15,
+		Go:   func(func()) {},
+	})
+	i := 0
+	for ; m.Info().Resizes == 0; i++ {
+		m.Set(newNode(i, i))
+	}
+
+	// the writes beyond the grow threshold of the new table neither grow it nor finish the migration,
+	// since the writers hardly hit every bucket of the large previous table.
+	for limit := 3 * i; i < limit; i++ {
+		m.Set(newNode(i, i))
+	}
+	if info := m.Info(); info.Resizes != 1 || info.Migrating == 0 {
+		t.Fatalf("table shouldn't be resized during the migration, but got %+v", info)
+	}
+	for j := 0; j < i; j++ {
+		if n, ok := m.Get(j); !ok || n.Value() != j {
+			t.Fatalf("node %d should be found during the migration", j)
+		}
+	}
+}
+
+func TestMap_RangeDuringMigration(t *testing.T) {
+	const size = 10000
+	m := New[int, int]()
+	for i := 0; i < size; i++ {
+		m.Set(newNode(i, i))
+	}
+	for i := 0; i < size; i += 2 {
+		m.Delete(i)
+	}
+
+	for _, resize := range []struct {
+		name string
+		do   func() int
+	}{
+		{name: "grow", do: func() int {
+			i := size
+			for ; m.Info().Migrating == 0; i++ {
+				m.Set(newNode(i, i))
+			}
+			return i
+		}},
+		{name: "shrink", do: func() int {
+			m.Compact()
+			return m.Size()
+		}},
+	} {
+		resize.do()
+		migrating := m.Info().Migrating
+		if migrating == 0 {
+			t.Fatalf("%s: migration should be in progress", resize.name)
+		}
+
+		seen := make(map[int]bool, m.Size())
+		m.Range(func(n *node.Node[int, int]) bool {
+			if seen[n.Key()] {
+				t.Fatalf("%s: key %d is visited twice", resize.name, n.Key())
+			}
+			seen[n.Key()] = true
+			return true
+		})
+		if len(seen) != m.Size() {
+			t.Fatalf("%s: all %d keys should be visited, but got %d", resize.name, m.Size(), len(seen))
+		}
+		for key := range seen {
+			if n, ok := m.Get(key); !ok || n.Value() != key {
+				t.Fatalf("%s: got unexpected key %d", resize.name, key)
+			}
+		}
+
+		sampled := make(map[int]bool, len(seen))
+		m.Sample(len(seen), func(*node.Node[int, int]) bool { return true }, func(n *node.Node[int, int]) {
+			if sampled[n.Key()] || !seen[n.Key()] {
+				t.Fatalf("%s: got unexpected sampled key %d", resize.name, n.Key())
+			}
+			sampled[n.Key()] = true
+		})
+		if len(sampled) != len(seen) {
+			t.Fatalf("%s: all %d keys should be sampled, but got %d", resize.name, len(seen), len(sampled))
+		}
+		if got := m.Info().Migrating; got != migrating {
+			t.Fatalf("%s: range and sample shouldn't migrate the buckets, but got %d -> %d", resize.name, migrating, got)
+		}
+	}
+}
+
+func TestMap_ParallelGetDuringResize(t *testing.T) {
+	const setters = 4
+	const nodes = 50_000
+	m := New[int, int]()
+
+	var (
+		wg       sync.WaitGroup
+		progress [setters]atomic.Int64
+		done     atomic.Bool
+	)
+	wg.Add(setters)
+	for i := 0; i < setters; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < nodes; j++ {
+				key := i*nodes + j
+				m.Set(newNode(key, key))
+				progress[i].Store(int64(j + 1))
+			}
+		}(i)
+	}
+
+	getterDone := make(chan struct{})
+	go func() {
+		defer close(getterDone)
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		for !done.Load() {
+			i := r.Intn(setters)
+			set := progress[i].Load()
+			if set == 0 {
+				continue
+			}
+			key := i*nodes + r.Intn(int(set))
+			if n, ok := m.Get(key); !ok || n.Value() != key {
+				t.Errorf("node %d should be found during the resize", key)
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	done.Store(true)
+	<-getterDone
+
+	if got := m.Size(); got != setters*nodes {
+		t.Fatalf("size should be %d, but got %d", setters*nodes, got)
+	}
+}
+
 func TestMap_EmptyStringKey(t *testing.T) {
 	m := New[string, string]()
 	m.Set(newNode[string, string]("", "foobar"))
@@ -86,6 +393,29 @@ func TestMap_Set(t *testing.T) {
 	}
 }
 
+func TestMap_Sequence(t *testing.T) {
+	m := NewWithConfig[int, int](Config{Sequence: true})
+	n1 := newNode(1, 1)
+	m.Set(n1)
+	if m.SetIfAbsent(newNode(1, 2)) == nil {
+		t.Fatal("the node of the present key should not be stored")
+	}
+	n2 := newNode(1, 3)
+	m.Set(n2)
+	n3 := newNode(2, 1)
+	if _, ok := m.SetIf(n3, func(current *node.Node[int, int]) bool { return current == nil }); !ok {
+		t.Fatal("the node of the absent key should be stored")
+	}
+	n4 := newNode(3, 1)
+	m.Apply([]Op[int, int]{{Key: 3, Node: n4}}, func(int, *node.Node[int, int]) {})
+
+	for i, n := range []*node.Node[int, int]{n1, n2, n3, n4} {
+		if n.Sequence() != uint64(i+1) {
+			t.Fatalf("the stored node %d should have sequence %d, but got %d", i, i+1, n.Sequence())
+		}
+	}
+}
+
 func TestMap_SetIfAbsent(t *testing.T) {
 	const numberOfNodes = 128
 	m := New[string, int]()
@@ -101,6 +431,9 @@ func TestMap_SetIfAbsent(t *testing.T) {
 		if res == nil {
 			t.Fatalf("set was not dropped. node that was set: %+v", res)
 		}
+		if res == n {
+			t.Fatalf("the current node should be returned. got: %+v", res)
+		}
 	}
 
 	for i := 0; i < numberOfNodes; i++ {
@@ -158,6 +491,187 @@ func TestMap_SetThenDelete(t *testing.T) {
 	}
 }
 
+func TestMap_Apply(t *testing.T) {
+	const numNodes = 10000
+	m := New[string, int]()
+	for i := 0; i < numNodes; i += 2 {
+		m.Set(newNode(strconv.Itoa(i), i))
+	}
+
+	// replace the even keys, insert the odd ones, then delete every fourth key.
+	ops := make([]Op[string, int], 0, numNodes+numNodes/4)
+	for i := 0; i < numNodes; i++ {
+		ops = append(ops, Op[string, int]{Key: strconv.Itoa(i), Node: newNode(strconv.Itoa(i), -i-1)})
+	}
+	for i := 0; i < numNodes; i += 4 {
+		ops = append(ops, Op[string, int]{Key: strconv.Itoa(i)})
+	}
+
+	var replaced, deleted int
+	called := make([]bool, len(ops))
+	m.Apply(ops, func(i int, prev *node.Node[string, int]) {
+		called[i] = true
+		if prev == nil {
+			return
+		}
+		if ops[i].Node == nil {
+			deleted++
+			if prev.Value() >= 0 {
+				t.Fatalf("the set of the key %s should be applied before its delete", ops[i].Key)
+			}
+		} else {
+			replaced++
+		}
+	})
+
+	for i, ok := range called {
+		if !ok {
+			t.Fatalf("callback was not called for op %d", i)
+		}
+	}
+	if replaced != numNodes/2 || deleted != numNodes/4 {
+		t.Fatalf("replaced %d and deleted %d nodes, but expected %d and %d", replaced, deleted, numNodes/2, numNodes/4)
+	}
+	if m.Size() != numNodes-numNodes/4 {
+		t.Fatalf("size should be %d, but got %d", numNodes-numNodes/4, m.Size())
+	}
+	for i := 0; i < numNodes; i++ {
+		n, ok := m.Get(strconv.Itoa(i))
+		if i%4 == 0 {
+			if ok {
+				t.Fatalf("key %d should be deleted", i)
+			}
+			continue
+		}
+		if !ok || n.Value() != -i-1 {
+			t.Fatalf("value for key %d should be %d", i, -i-1)
+		}
+	}
+}
+
+func TestMap_GetAll(t *testing.T) {
+	const numNodes = 10000
+	m := New[string, int]()
+	for i := 0; i < numNodes; i += 2 {
+		m.Set(newNode(strconv.Itoa(i), i))
+	}
+
+	keys := make([]string, 0, numNodes)
+	for i := 0; i < numNodes; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	for _, parallelism := range []int{1, 8} {
+		nodes := make([]*node.Node[string, int], len(keys))
+		m.GetAll(keys, nodes, parallelism)
+		for i, n := range nodes {
+			if i%2 == 1 {
+				if n != nil {
+					t.Fatalf("key %s shouldn't be found with the parallelism %d", keys[i], parallelism)
+				}
+				continue
+			}
+			if n == nil || n.Key() != keys[i] || n.Value() != i {
+				t.Fatalf("node of the key %s isn't found with the parallelism %d", keys[i], parallelism)
+			}
+		}
+	}
+}
+
+func TestMap_Sample(t *testing.T) {
+	const (
+		numNodes   = 1000
+		sampleSize = 10
+		trials     = 20000
+	)
+	m := New[string, int]()
+	for i := 0; i < numNodes; i++ {
+		m.Set(newNode(strconv.Itoa(i), i))
+	}
+	tb := (*table[string])(atomic.LoadPointer(&m.table))
+
+	counts := make(map[string]int, numNodes)
+	totalSpan := 0
+	samePairs := 0
+	for i := 0; i < trials; i++ {
+		seen := make(map[string]bool, sampleSize)
+		buckets := make([]int, 0, sampleSize)
+		m.Sample(sampleSize, func(n *node.Node[string, int]) bool {
+			return n.Value()%2 == 0
+		}, func(n *node.Node[string, int]) {
+			if seen[n.Key()] || n.Value()%2 != 0 {
+				t.Fatalf("got unexpected node %s", n.Key())
+			}
+			seen[n.Key()] = true
+			counts[n.Key()]++
+			buckets = append(buckets, int(tb.calcShiftHash(n.Key())&tb.mask))
+		})
+		if len(seen) != sampleSize {
+			t.Fatalf("got %d nodes, want %d", len(seen), sampleSize)
+		}
+
+		// the span of the sampled buckets is the table length without the largest gap between them.
+		sort.Ints(buckets)
+		for j := 1; j < len(buckets); j++ {
+			for k := j - 1; k >= 0 && buckets[k] == buckets[j]; k-- {
+				samePairs++
+			}
+		}
+		maxGap := buckets[0] + len(tb.buckets) - buckets[len(buckets)-1]
+		for j := 1; j < len(buckets); j++ {
+			if gap := buckets[j] - buckets[j-1]; gap > maxGap {
+				maxGap = gap
+			}
+		}
+		totalSpan += len(tb.buckets) - maxGap
+	}
+
+	// every matching node is expected to be sampled trials*sampleSize/(numNodes/2) = 400 times.
+	if len(counts) != numNodes/2 {
+		t.Fatalf("all %d matching nodes should be sampled, but got %d", numNodes/2, len(counts))
+	}
+	for key, count := range counts {
+		if count < 200 || count > 600 {
+			t.Fatalf("node %s is sampled %d times, want about 400", key, count)
+		}
+	}
+	// the nodes of a contiguous run of buckets would span only a few buckets.
+	if avgSpan := totalSpan / trials; avgSpan < len(tb.buckets)/2 {
+		t.Fatalf("sampled nodes span %d of %d buckets on average", avgSpan, len(tb.buckets))
+	}
+	// a uniform sample takes two nodes of one bucket as often as any other two nodes.
+	bucketNodes := make(map[uint64]int)
+	for i := 0; i < numNodes; i += 2 {
+		bucketNodes[tb.calcShiftHash(strconv.Itoa(i))&tb.mask]++
+	}
+	pairs := 0
+	for _, count := range bucketNodes {
+		pairs += count * (count - 1) / 2
+	}
+	matching := numNodes / 2
+	expected := float64(trials) * sampleSize * (sampleSize - 1) / 2 * float64(pairs) / float64(matching*(matching-1)/2)
+	if float64(samePairs) > 1.3*expected || float64(samePairs) < 0.7*expected {
+		t.Fatalf("got %d pairs of nodes of one bucket, want about %.0f", samePairs, expected)
+	}
+
+	// the matching nodes are too sparse for the random slots, so all of them are sampled.
+	for i := 0; i < 100; i++ {
+		var sparse []int
+		m.Sample(3, func(n *node.Node[string, int]) bool {
+			return n.Value() < 3
+		}, func(n *node.Node[string, int]) {
+			sparse = append(sparse, n.Value())
+		})
+		sort.Ints(sparse)
+		if !reflect.DeepEqual(sparse, []int{0, 1, 2}) {
+			t.Fatalf("got %v, want all the matching nodes", sparse)
+		}
+	}
+
+	m.Sample(0, func(*node.Node[string, int]) bool { return true }, func(*node.Node[string, int]) {
+		t.Fatal("nothing should be sampled")
+	})
+}
+
 func TestMap_Range(t *testing.T) {
 	const numNodes = 1000
 	m := New[string, int]()
@@ -19,14 +19,12 @@ import (
 	"sync/atomic"
 	"unsafe"
 
+	"github.com/maypok86/otter/internal/xmath"
 	"github.com/maypok86/otter/internal/xruntime"
 )
 
-const (
-	// The maximum number of elements per buffer.
-	capacity = 16
-	mask     = uint64(capacity - 1)
-)
+// DefaultCapacity is the default maximum number of elements per buffer.
+const DefaultCapacity = 16
 
 // PolicyBuffers is the set of buffers returned by the lossy buffer.
 type PolicyBuffers[T any] struct {
@@ -55,16 +53,24 @@ type Buffer[T any] struct {
 	returnedPadding      [xruntime.CacheLineSize - 8]byte
 	policyBuffers        unsafe.Pointer
 	returnedSlicePadding [xruntime.CacheLineSize - 8]byte
-	buffer               [capacity]unsafe.Pointer
+	dropped              atomic.Uint64
+	droppedPadding       [xruntime.CacheLineSize - unsafe.Sizeof(atomic.Uint64{})]byte
+	capacity             uint64
+	mask                 uint64
+	buffer               []unsafe.Pointer
 }
 
-// New creates a new lossy Buffer.
-func New[T any]() *Buffer[T] {
+// New creates a new lossy Buffer with the given capacity rounded up to a power of two.
+func New[T any](capacity int) *Buffer[T] {
+	roundedCapacity := uint64(xmath.RoundUpPowerOf2(uint32(capacity)))
 	pb := &PolicyBuffers[T]{
-		Returned: make([]*T, 0, capacity),
+		Returned: make([]*T, 0, roundedCapacity),
 	}
 	b := &Buffer[T]{
 		policyBuffers: unsafe.Pointer(pb),
+		capacity:      roundedCapacity,
+		mask:          roundedCapacity - 1,
+		buffer:        make([]unsafe.Pointer, roundedCapacity),
 	}
 	b.returned = b.policyBuffers
 	return b
@@ -72,29 +78,30 @@ func New[T any]() *Buffer[T] {
 
 // Add lazily publishes the item to the consumer.
 //
-// item may be lost due to contention.
-func (b *Buffer[T]) Add(item *T) *PolicyBuffers[T] {
+// item may be lost due to contention. The second result is false if the item was dropped.
+func (b *Buffer[T]) Add(item *T) (*PolicyBuffers[T], bool) {
 	head := b.head.Load()
 	tail := b.tail.Load()
 	size := tail - head
-	if size >= capacity {
+	if size >= b.capacity {
 		// full buffer
-		return nil
+		b.dropped.Add(1)
+		return nil, false
 	}
 	if b.tail.CompareAndSwap(tail, tail+1) {
 		// success
-		index := int(tail & mask)
+		index := int(tail & b.mask)
 		atomic.StorePointer(&b.buffer[index], unsafe.Pointer(item))
-		if size == capacity-1 {
+		if size == b.capacity-1 {
 			// try return new buffer
 			if !atomic.CompareAndSwapPointer(&b.returned, b.policyBuffers, nil) {
 				// somebody already get buffer
-				return nil
+				return nil, true
 			}
 
 			pb := (*PolicyBuffers[T])(b.policyBuffers)
-			for i := 0; i < capacity; i++ {
-				index := int(head & mask)
+			for i := uint64(0); i < b.capacity; i++ {
+				index := int(head & b.mask)
 				v := (*T)(atomic.LoadPointer(&b.buffer[index]))
 				if v != nil {
 					// published
@@ -106,12 +113,47 @@ func (b *Buffer[T]) Add(item *T) *PolicyBuffers[T] {
 			}
 
 			b.head.Store(head)
-			return pb
+			return pb, true
 		}
+
+		return nil, true
 	}
 
 	// failed
-	return nil
+	b.dropped.Add(1)
+	return nil, false
+}
+
+// Size returns the approximate number of items in the buffer.
+func (b *Buffer[T]) Size() int {
+	head := b.head.Load()
+	tail := b.tail.Load()
+	if tail < head {
+		// concurrent clear
+		return 0
+	}
+	return int(tail - head)
+}
+
+// Written returns the number of items added to the buffer since it was created or cleared.
+func (b *Buffer[T]) Written() uint64 {
+	return b.tail.Load()
+}
+
+// Dropped returns the number of items dropped by the buffer.
+func (b *Buffer[T]) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+// Capacity returns the maximum number of items in the buffer.
+func (b *Buffer[T]) Capacity() int {
+	return int(b.capacity)
+}
+
+// MemoryUsage returns the estimated number of bytes used by the buffer.
+func (b *Buffer[T]) MemoryUsage() int64 {
+	// the ring and the slice of the returned elements.
+	return int64(unsafe.Sizeof(*b)) + 2*int64(b.capacity)*int64(unsafe.Sizeof(unsafe.Pointer(nil)))
 }
 
 // Free returns the processed buffer back and also clears it.
@@ -129,7 +171,7 @@ func (b *Buffer[T]) Clear() {
 	for !atomic.CompareAndSwapPointer(&b.returned, b.policyBuffers, nil) {
 		runtime.Gosched()
 	}
-	for i := 0; i < capacity; i++ {
+	for i := range b.buffer {
 		atomic.StorePointer(&b.buffer[i], nil)
 	}
 	b.Free()
@@ -15,6 +15,8 @@
 package node
 
 import (
+	"sync/atomic"
+
 	"github.com/maypok86/otter/internal/unixtime"
 )
 
@@ -23,7 +25,14 @@ const (
 	smallQueueType
 	mainQueueType
 
-	maxFrequency uint8 = 3
+	// MaxFrequency is the maximum frequency of the node.
+	MaxFrequency uint8 = 3
+
+	// readsExhausted marks the node whose last allowed read has been consumed.
+	readsExhausted = ^uint32(0)
+
+	// MaxReads is the maximum number of reads which can be allowed by SetMaxReads.
+	MaxReads = readsExhausted - 1
 )
 
 // Node is an entry in the cache containing the key, value, cost, access and write metadata.
@@ -32,10 +41,19 @@ type Node[K comparable, V any] struct {
 	value      V
 	prev       *Node[K, V]
 	next       *Node[K, V]
+	prevExp    *Node[K, V]
+	nextExp    *Node[K, V]
+	sequence   uint64
 	expiration uint32
-	cost       uint32
-	frequency  uint8
-	queueType  uint8
+	// accessExpiration, hits, lastAccess and readsLeft are updated by readers, so they must be accessed atomically.
+	accessExpiration uint32
+	hits             uint32
+	lastAccess       uint32
+	lastWrite        uint32
+	readsLeft        uint32
+	cost             uint32
+	frequency        uint8
+	queueType        uint8
 }
 
 // New creates a new Node.
@@ -60,7 +78,97 @@ func (n *Node[K, V]) Value() V {
 
 // IsExpired returns true if node is expired.
 func (n *Node[K, V]) IsExpired() bool {
-	return n.expiration > 0 && n.expiration < unixtime.Now()
+	return n.IsExpiredAt(unixtime.Now())
+}
+
+// IsExpiredAt returns true if node is expired at the given time.
+func (n *Node[K, V]) IsExpiredAt(now uint32) bool {
+	if n.expiration > 0 && n.expiration < now {
+		return true
+	}
+
+	accessExpiration := atomic.LoadUint32(&n.accessExpiration)
+	return accessExpiration > 0 && accessExpiration < now
+}
+
+// AccessExpiration returns the expiration time after the last access.
+func (n *Node[K, V]) AccessExpiration() uint32 {
+	return atomic.LoadUint32(&n.accessExpiration)
+}
+
+// SetAccessExpiration sets the expiration time after the last access.
+func (n *Node[K, V]) SetAccessExpiration(accessExpiration uint32) {
+	// avoid writes to the shared cache line when the value doesn't change.
+	if atomic.LoadUint32(&n.accessExpiration) != accessExpiration {
+		atomic.StoreUint32(&n.accessExpiration, accessExpiration)
+	}
+}
+
+// RecordAccess increments the number of hits and sets the time of the last access.
+func (n *Node[K, V]) RecordAccess(now uint32) {
+	atomic.AddUint32(&n.hits, 1)
+	if atomic.LoadUint32(&n.lastAccess) != now {
+		atomic.StoreUint32(&n.lastAccess, now)
+	}
+}
+
+// Hits returns the number of recorded hits.
+func (n *Node[K, V]) Hits() uint32 {
+	return atomic.LoadUint32(&n.hits)
+}
+
+// LastAccess returns the time of the last recorded access.
+func (n *Node[K, V]) LastAccess() uint32 {
+	return atomic.LoadUint32(&n.lastAccess)
+}
+
+// SetLastWrite sets the time of the write which created the node.
+// It is stored shifted by one, so zero means that the time hasn't been recorded.
+func (n *Node[K, V]) SetLastWrite(now uint32) {
+	n.lastWrite = now + 1
+}
+
+// LastWrite returns the time of the write which created the node.
+//
+// The ok result is false if the time hasn't been recorded.
+func (n *Node[K, V]) LastWrite() (now uint32, ok bool) {
+	return n.lastWrite - 1, n.lastWrite > 0
+}
+
+// SetMaxReads limits the number of reads of the node, zero means no limit.
+//
+// NOTE: must be called before the node is published.
+func (n *Node[K, V]) SetMaxReads(maxReads uint32) {
+	n.readsLeft = maxReads
+}
+
+// ConsumeRead consumes one of the reads allowed for the node.
+//
+// The ok result is false if all the allowed reads have already been consumed,
+// and the last result is true if the consumed read was the last one.
+func (n *Node[K, V]) ConsumeRead() (ok, last bool) {
+	for {
+		left := atomic.LoadUint32(&n.readsLeft)
+		switch left {
+		case 0:
+			return true, false
+		case readsExhausted:
+			return false, false
+		}
+
+		next := left - 1
+		if next == 0 {
+			next = readsExhausted
+		}
+		if atomic.CompareAndSwapUint32(&n.readsLeft, left, next) {
+			return true, next == readsExhausted
+		}
+	}
+}
+
+// ReadsExhausted returns true if all the allowed reads of the node have been consumed.
+func (n *Node[K, V]) ReadsExhausted() bool {
+	return atomic.LoadUint32(&n.readsLeft) == readsExhausted
 }
 
 // Expiration returns the expiration time.
@@ -73,6 +181,36 @@ func (n *Node[K, V]) Cost() uint32 {
 	return n.cost
 }
 
+// PrevExp returns the previous node in the expiration policy.
+func (n *Node[K, V]) PrevExp() *Node[K, V] {
+	return n.prevExp
+}
+
+// SetPrevExp sets the previous node in the expiration policy.
+func (n *Node[K, V]) SetPrevExp(v *Node[K, V]) {
+	n.prevExp = v
+}
+
+// NextExp returns the next node in the expiration policy.
+func (n *Node[K, V]) NextExp() *Node[K, V] {
+	return n.nextExp
+}
+
+// SetNextExp sets the next node in the expiration policy.
+func (n *Node[K, V]) SetNextExp(v *Node[K, V]) {
+	n.nextExp = v
+}
+
+// Sequence returns the write sequence number of the node.
+func (n *Node[K, V]) Sequence() uint64 {
+	return n.sequence
+}
+
+// SetSequence sets the write sequence number of the node.
+func (n *Node[K, V]) SetSequence(sequence uint64) {
+	n.sequence = sequence
+}
+
 // Frequency returns the frequency of the node.
 func (n *Node[K, V]) Frequency() uint8 {
 	return n.frequency
@@ -80,7 +218,7 @@ func (n *Node[K, V]) Frequency() uint8 {
 
 // IncrementFrequency increments the frequency of the node.
 func (n *Node[K, V]) IncrementFrequency() {
-	n.frequency = minUint8(n.frequency+1, maxFrequency)
+	n.frequency = minUint8(n.frequency+1, MaxFrequency)
 }
 
 // DecrementFrequency decrements the frequency of the node.
@@ -88,6 +226,11 @@ func (n *Node[K, V]) DecrementFrequency() {
 	n.frequency--
 }
 
+// SetFrequency sets the frequency capped at MaxFrequency.
+func (n *Node[K, V]) SetFrequency(frequency uint8) {
+	n.frequency = minUint8(frequency, MaxFrequency)
+}
+
 // ResetFrequency resets the frequency.
 func (n *Node[K, V]) ResetFrequency() {
 	n.frequency = 0
@@ -47,6 +47,15 @@ func TestNode(t *testing.T) {
 		t.Fatalf("n.Cost() = %d, want %d", n.Cost(), cost)
 	}
 
+	// sequence
+	if n.Sequence() != 0 {
+		t.Fatalf("n.Sequence() = %d, want %d", n.Sequence(), 0)
+	}
+	n.SetSequence(42)
+	if n.Sequence() != 42 {
+		t.Fatalf("n.Sequence() = %d, want %d", n.Sequence(), 42)
+	}
+
 	// frequency
 	for i := uint8(0); i < 10; i++ {
 		if i < 4 {
@@ -101,3 +110,29 @@ func TestNode(t *testing.T) {
 		t.Fatalf("queueType should be unknown")
 	}
 }
+
+func TestNode_ConsumeRead(t *testing.T) {
+	n := New[int, int](1, 2, 0, 1)
+	for i := 0; i < 3; i++ {
+		if ok, last := n.ConsumeRead(); !ok || last {
+			t.Fatalf("reads of the node without limit should be allowed, but got %v %v", ok, last)
+		}
+	}
+
+	n.SetMaxReads(2)
+	if ok, last := n.ConsumeRead(); !ok || last {
+		t.Fatalf("the first read should be allowed, but got %v %v", ok, last)
+	}
+	if n.ReadsExhausted() {
+		t.Fatal("reads shouldn't be exhausted before the last one")
+	}
+	if ok, last := n.ConsumeRead(); !ok || !last {
+		t.Fatalf("the second read should be the last one, but got %v %v", ok, last)
+	}
+	if !n.ReadsExhausted() {
+		t.Fatal("reads should be exhausted after the last one")
+	}
+	if ok, last := n.ConsumeRead(); ok || last {
+		t.Fatalf("reads after the last one shouldn't be allowed, but got %v %v", ok, last)
+	}
+}
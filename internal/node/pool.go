@@ -0,0 +1,63 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import "sync"
+
+// Pool is a pool of nodes.
+//
+// Only nodes that have never been published to other goroutines may be returned to the pool,
+// since the cache reads nodes without locks and there is no way to know
+// when a removed node is no longer used by readers.
+//
+// A nil Pool is valid and allocates a new node each time.
+type Pool[K comparable, V any] struct {
+	p sync.Pool
+}
+
+// NewPool creates a new Pool.
+func NewPool[K comparable, V any]() *Pool[K, V] {
+	return &Pool[K, V]{
+		p: sync.Pool{
+			New: func() any {
+				return &Node[K, V]{}
+			},
+		},
+	}
+}
+
+// Get returns a node with the given parameters, reusing a node from the pool if possible.
+func (p *Pool[K, V]) Get(key K, value V, expiration, cost uint32) *Node[K, V] {
+	if p == nil {
+		return New(key, value, expiration, cost)
+	}
+
+	n := p.p.Get().(*Node[K, V])
+	n.key = key
+	n.value = value
+	n.expiration = expiration
+	n.cost = cost
+	return n
+}
+
+// Put returns the unpublished node to the pool.
+func (p *Pool[K, V]) Put(n *Node[K, V]) {
+	if p == nil {
+		return
+	}
+
+	*n = Node[K, V]{}
+	p.p.Put(n)
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import "testing"
+
+func TestPool(t *testing.T) {
+	for _, p := range []*Pool[int, int]{nil, NewPool[int, int]()} {
+		n := p.Get(1, 2, 3, 4)
+		n.SetSequence(5)
+		n.IncrementFrequency()
+		if n.Key() != 1 || n.Value() != 2 || n.Expiration() != 3 || n.Cost() != 4 {
+			t.Fatalf("got unexpected node: %+v", n)
+		}
+		p.Put(n)
+
+		n = p.Get(6, 7, 0, 1)
+		if n.Key() != 6 || n.Value() != 7 || n.Expiration() != 0 || n.Cost() != 1 {
+			t.Fatalf("got unexpected node: %+v", n)
+		}
+		if n.Sequence() != 0 || n.Frequency() != 0 || n.IsSmall() || n.IsMain() {
+			t.Fatalf("reused node should be reset: %+v", n)
+		}
+	}
+}
@@ -45,6 +45,10 @@ func (q *Queue[K, V]) Push(n *Node[K, V]) {
 	q.len++
 }
 
+func (q *Queue[K, V]) Head() *Node[K, V] {
+	return q.head
+}
+
 func (q *Queue[K, V]) Pop() *Node[K, V] {
 	if q.IsEmpty() {
 		return nil
@@ -80,6 +84,14 @@ func (q *Queue[K, V]) Remove(n *Node[K, V]) {
 	q.len--
 }
 
+func (q *Queue[K, V]) Range(f func(n *Node[K, V]) bool) {
+	for n := q.head; n != nil; n = n.next {
+		if !f(n) {
+			return
+		}
+	}
+}
+
 func (q *Queue[K, V]) Clear() {
 	for !q.IsEmpty() {
 		q.Pop()
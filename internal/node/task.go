@@ -23,6 +23,8 @@ const (
 	updateReason
 	clearReason
 	closeReason
+	batchReason
+	syncReason
 )
 
 // WriteTask is a set of information to update the cache:
@@ -30,7 +32,10 @@ const (
 type WriteTask[K comparable, V any] struct {
 	n           *Node[K, V]
 	oldNode     *Node[K, V]
+	batch       *[]WriteTask[K, V]
 	writeReason reason
+	restore     bool
+	forceAdmit  bool
 }
 
 // NewAddTask creates a task to add a node to policies.
@@ -41,6 +46,25 @@ func NewAddTask[K comparable, V any](n *Node[K, V]) WriteTask[K, V] {
 	}
 }
 
+// NewForceAdmitTask creates a task to add a node to policies bypassing the admission.
+func NewForceAdmitTask[K comparable, V any](n *Node[K, V]) WriteTask[K, V] {
+	return WriteTask[K, V]{
+		n:           n,
+		writeReason: addReason,
+		forceAdmit:  true,
+	}
+}
+
+// NewRestoreTask creates a task to add a node to the queue it is marked with,
+// keeping its frequency and bypassing the admission.
+func NewRestoreTask[K comparable, V any](n *Node[K, V]) WriteTask[K, V] {
+	return WriteTask[K, V]{
+		n:           n,
+		writeReason: addReason,
+		restore:     true,
+	}
+}
+
 // NewDeleteTask creates a task to delete a node from policies.
 func NewDeleteTask[K comparable, V any](n *Node[K, V]) WriteTask[K, V] {
 	return WriteTask[K, V]{
@@ -58,6 +82,21 @@ func NewUpdateTask[K comparable, V any](n, oldNode *Node[K, V]) WriteTask[K, V]
 	}
 }
 
+// NewBatchTask creates a task combining the given tasks, so they are inserted into the write buffer at once.
+func NewBatchTask[K comparable, V any](tasks []WriteTask[K, V]) WriteTask[K, V] {
+	return WriteTask[K, V]{
+		batch:       &tasks,
+		writeReason: batchReason,
+	}
+}
+
+// NewSyncTask creates a task to signal that all tasks inserted before it have been applied.
+func NewSyncTask[K comparable, V any]() WriteTask[K, V] {
+	return WriteTask[K, V]{
+		writeReason: syncReason,
+	}
+}
+
 // NewClearTask creates a task to clear policies.
 func NewClearTask[K comparable, V any]() WriteTask[K, V] {
 	return WriteTask[K, V]{
@@ -82,11 +121,34 @@ func (t *WriteTask[K, V]) OldNode() *Node[K, V] {
 	return t.oldNode
 }
 
+// Batch returns the tasks combined by the batch task.
+func (t *WriteTask[K, V]) Batch() []WriteTask[K, V] {
+	if t.batch == nil {
+		return nil
+	}
+	return *t.batch
+}
+
+// IsBatch returns true if this is a batch task.
+func (t *WriteTask[K, V]) IsBatch() bool {
+	return t.writeReason == batchReason
+}
+
 // IsAdd returns true if this is an add task.
 func (t *WriteTask[K, V]) IsAdd() bool {
 	return t.writeReason == addReason
 }
 
+// IsRestore returns true if this is an add task restoring the policy state of the node.
+func (t *WriteTask[K, V]) IsRestore() bool {
+	return t.restore
+}
+
+// IsForceAdmit returns true if this is an add task bypassing the admission.
+func (t *WriteTask[K, V]) IsForceAdmit() bool {
+	return t.forceAdmit
+}
+
 // IsDelete returns true if this is a delete task.
 func (t *WriteTask[K, V]) IsDelete() bool {
 	return t.writeReason == deleteReason
@@ -102,6 +164,11 @@ func (t *WriteTask[K, V]) IsClear() bool {
 	return t.writeReason == clearReason
 }
 
+// IsSync returns true if this is a sync task.
+func (t *WriteTask[K, V]) IsSync() bool {
+	return t.writeReason == syncReason
+}
+
 // IsClose returns true if this is a close task.
 func (t *WriteTask[K, V]) IsClose() bool {
 	return t.writeReason == closeReason
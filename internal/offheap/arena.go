@@ -0,0 +1,174 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package offheap stores serialized values in memory which isn't managed by the Go garbage collector.
+package offheap
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/maypok86/otter/internal/xmath"
+	"github.com/maypok86/otter/internal/xruntime"
+)
+
+// minRingSize is the minimal size of a ring, so small arenas don't get split into many tiny rings.
+const minRingSize = 1 << 20
+
+// ErrClosed means that the arena has already been closed.
+var ErrClosed = errors.New("arena is closed")
+
+// Handle refers to the data stored in the arena. It contains no pointers, so the garbage collector doesn't scan it.
+type Handle struct {
+	pos    uint64
+	length uint32
+	ring   uint32
+}
+
+// Len returns the length of the data.
+func (h Handle) Len() int {
+	return int(h.length)
+}
+
+// ring is a circular buffer which overwrites the oldest data when it is full.
+//
+// Positions are absolute, so the data is intact as long as its position isn't older than the tail.
+type ring struct {
+	mutex sync.RWMutex
+	buf   []byte
+	// head is the position of the next write.
+	head uint64
+	// tail is the position of the oldest data which hasn't been overwritten.
+	tail uint64
+}
+
+func (r *ring) put(data []byte) (uint64, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	size := uint64(len(r.buf))
+	length := uint64(len(data))
+	if r.buf == nil || length > size {
+		return 0, false
+	}
+
+	// the data never wraps around, so it can be read with a single copy.
+	if offset := r.head % size; offset+length > size {
+		r.head += size - offset
+	}
+	pos := r.head
+	copy(r.buf[pos%size:], data)
+	r.head += length
+	if r.head > size && r.head-size > r.tail {
+		r.tail = r.head - size
+	}
+	return pos, true
+}
+
+func (r *ring) get(pos uint64, length uint32) ([]byte, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.buf == nil || pos < r.tail {
+		return nil, false
+	}
+
+	offset := pos % uint64(len(r.buf))
+	data := make([]byte, length)
+	copy(data, r.buf[offset:offset+uint64(length)])
+	return data, true
+}
+
+func (r *ring) close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.buf == nil {
+		return ErrClosed
+	}
+	err := munmap(r.buf)
+	r.buf = nil
+	return err
+}
+
+// Arena is a set of rings allocated outside of the Go heap.
+//
+// The data is overwritten in FIFO order when the arena is full, so Get may fail for any handle.
+type Arena struct {
+	rings []*ring
+	mask  uint32
+}
+
+// New allocates an arena of the given size in bytes.
+func New(size int) (*Arena, error) {
+	count := int(xmath.RoundUpPowerOf2(xruntime.Parallelism()))
+	for count > 1 && size/count < minRingSize {
+		count /= 2
+	}
+
+	a := &Arena{
+		rings: make([]*ring, 0, count),
+		mask:  uint32(count - 1),
+	}
+	for i := 0; i < count; i++ {
+		buf, err := mmap(size / count)
+		if err != nil {
+			_ = a.Close()
+			return nil, err
+		}
+		a.rings = append(a.rings, &ring{buf: buf})
+	}
+	return a, nil
+}
+
+// MaxLen returns the maximum length of the data which can be stored in the arena.
+func (a *Arena) MaxLen() int {
+	return len(a.rings[0].buf)
+}
+
+// Put copies the data into the arena.
+//
+// It returns false if the data doesn't fit into the arena or the arena is closed.
+func (a *Arena) Put(data []byte) (Handle, bool) {
+	i := xruntime.Fastrand() & a.mask
+	pos, ok := a.rings[i].put(data)
+	if !ok {
+		return Handle{}, false
+	}
+	return Handle{
+		pos:    pos,
+		length: uint32(len(data)),
+		ring:   i,
+	}, true
+}
+
+// Get returns a copy of the data referred by the handle.
+//
+// It returns false if the data has already been overwritten or the arena is closed.
+func (a *Arena) Get(h Handle) ([]byte, bool) {
+	return a.rings[h.ring].get(h.pos, h.length)
+}
+
+// Close releases the memory of the arena.
+//
+// NOTE: the arena must not be used after Close.
+func (a *Arena) Close() error {
+	var err error
+	for _, r := range a.rings {
+		if closeErr := r.close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offheap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestArena_PutAndGet(t *testing.T) {
+	a, err := New(minRingSize)
+	if err != nil {
+		t.Fatalf("can not create arena: %v", err)
+	}
+	defer a.Close()
+
+	data := []byte("value")
+	h, ok := a.Put(data)
+	if !ok || h.Len() != len(data) {
+		t.Fatalf("data should be stored, but got %v %v", h, ok)
+	}
+	got, ok := a.Get(h)
+	if !ok || !bytes.Equal(got, data) {
+		t.Fatalf("should get %q, but got %q %v", data, got, ok)
+	}
+
+	if _, ok := a.Put(make([]byte, a.MaxLen()+1)); ok {
+		t.Fatal("data larger than a ring shouldn't be stored")
+	}
+}
+
+func TestArena_Overwrite(t *testing.T) {
+	a, err := New(minRingSize)
+	if err != nil {
+		t.Fatalf("can not create arena: %v", err)
+	}
+	defer a.Close()
+
+	const length = 1000
+	handles := make([]Handle, 0, 3*minRingSize/length)
+	for i := 0; i < cap(handles); i++ {
+		h, ok := a.Put(bytes.Repeat([]byte{byte(i)}, length))
+		if !ok {
+			t.Fatalf("data should be stored")
+		}
+		handles = append(handles, h)
+	}
+
+	for i, h := range handles {
+		got, ok := a.Get(h)
+		// only the last ring of data may be intact.
+		if i < len(handles)-minRingSize/length {
+			if ok {
+				t.Fatalf("data %d should be overwritten", i)
+			}
+			continue
+		}
+		if !ok || !bytes.Equal(got, bytes.Repeat([]byte{byte(i)}, length)) {
+			t.Fatalf("data %d should be intact, but got %v", i, ok)
+		}
+	}
+}
+
+func TestArena_Close(t *testing.T) {
+	a, err := New(minRingSize)
+	if err != nil {
+		t.Fatalf("can not create arena: %v", err)
+	}
+	h, _ := a.Put([]byte("value"))
+	if err := a.Close(); err != nil {
+		t.Fatalf("can not close arena: %v", err)
+	}
+
+	if _, ok := a.Get(h); ok {
+		t.Fatal("closed arena shouldn't return data")
+	}
+	if _, ok := a.Put([]byte("value")); ok {
+		t.Fatal("closed arena shouldn't store data")
+	}
+}
@@ -38,8 +38,8 @@ type MPSC[T any] struct {
 	sleep        chan struct{}
 	head         atomic.Uint64
 	headPadding  [xruntime.CacheLineSize - unsafe.Sizeof(atomic.Uint64{})]byte
-	tail         uint64
-	tailPadding  [xruntime.CacheLineSize - 8]byte
+	tail         atomic.Uint64
+	tailPadding  [xruntime.CacheLineSize - unsafe.Sizeof(atomic.Uint64{})]byte
 	isSleep      atomic.Uint64
 	sleepPadding [xruntime.CacheLineSize - unsafe.Sizeof(atomic.Uint64{})]byte
 	slots        []slot[T]
@@ -62,14 +62,18 @@ func NewMPSC[T any](capacity int) *MPSC[T] {
 
 // Insert inserts the given item into the queue.
 // Blocks, if the queue is full.
-func (q *MPSC[T]) Insert(item T) {
+//
+// Returns true if the producer had to wait for a free slot.
+func (q *MPSC[T]) Insert(item T) bool {
 	head := q.head.Add(1) - 1
 	q.wakeUpConsumer()
 
 	slot := &q.slots[q.idx(head)]
 	turn := q.turn(head) * 2
 	retries := 0
+	contended := false
 	for slot.turn.Load() != turn {
+		contended = true
 		if retries == maxRetries {
 			q.wakeUpConsumer()
 			retries = 0
@@ -81,12 +85,13 @@ func (q *MPSC[T]) Insert(item T) {
 
 	slot.item = item
 	slot.turn.Store(turn + 1)
+	return contended
 }
 
 // Remove retrieves and removes the item from the head of the queue.
 // Blocks, if the queue is empty.
 func (q *MPSC[T]) Remove() T {
-	tail := q.tail
+	tail := q.tail.Load()
 	slot := &q.slots[q.idx(tail)]
 	turn := 2*q.turn(tail) + 1
 	retries := 0
@@ -102,7 +107,7 @@ func (q *MPSC[T]) Remove() T {
 	item := slot.item
 	slot.item = zeroValue[T]()
 	slot.turn.Store(turn + 1)
-	q.tail++
+	q.tail.Store(tail + 1)
 	return item
 }
 
@@ -113,6 +118,21 @@ func (q *MPSC[T]) Clear() {
 	}
 }
 
+// Size returns the approximate number of items in the queue.
+func (q *MPSC[T]) Size() int {
+	head := q.head.Load()
+	tail := q.tail.Load()
+	if head <= tail {
+		return 0
+	}
+	size := head - tail
+	if size > q.capacity {
+		// producers waiting for a free slot.
+		return int(q.capacity)
+	}
+	return int(size)
+}
+
 // Capacity returns capacity of the queue.
 func (q *MPSC[T]) Capacity() int {
 	return int(q.capacity)
@@ -128,11 +148,16 @@ func (q *MPSC[T]) wakeUpConsumer() {
 func (q *MPSC[T]) sleepConsumer() {
 	// if the queue's been empty for too long, we fall asleep.
 	q.isSleep.Store(1)
+	// a producer may have taken a slot before the flag was set and won't wake us up,
+	// so recheck the queue. If the CAS fails, the producer is already waking us up.
+	if !q.isEmpty() && q.isSleep.CompareAndSwap(1, 0) {
+		return
+	}
 	<-q.sleep
 }
 
 func (q *MPSC[T]) isEmpty() bool {
-	return q.tail == q.head.Load()
+	return q.tail.Load() == q.head.Load()
 }
 
 func (q *MPSC[T]) idx(i uint64) uint64 {
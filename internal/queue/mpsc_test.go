@@ -41,15 +41,20 @@ func TestMPSC_InsertRemove(t *testing.T) {
 
 func TestMPSC_InsertBlocksOnFull(t *testing.T) {
 	q := NewMPSC[string](1)
-	q.Insert("foo")
+	if q.Insert("foo") {
+		t.Fatal("insert on empty queue shouldn't wait")
+	}
 
 	done := make(chan struct{})
 	flag := int32(0)
 	go func() {
-		q.Insert("bar")
+		contended := q.Insert("bar")
 		if atomic.LoadInt32(&flag) == 0 {
 			t.Error("insert on full queue didn't wait for remove")
 		}
+		if !contended {
+			t.Error("insert on full queue should report contention")
+		}
 		done <- struct{}{}
 	}()
 
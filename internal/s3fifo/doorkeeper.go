@@ -0,0 +1,100 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3fifo
+
+import (
+	"github.com/maypok86/otter/internal/xmath"
+)
+
+const (
+	// bitsPerKey gives about 2% false positives with four hash functions.
+	bitsPerKey   = 8
+	hashCount    = 4
+	maxKeyCount  = 1 << 22
+	minKeyCount  = 64
+	bitsPerBlock = 64
+)
+
+// doorkeeper is a bloom filter that remembers the keys seen since the last reset,
+// so keys accessed only once can be rejected.
+type doorkeeper struct {
+	bits     []uint64
+	mask     uint64
+	count    uint32
+	maxCount uint32
+}
+
+// newDoorkeeper creates a filter which is reset after resetInterval distinct keys.
+func newDoorkeeper(resetInterval uint32) *doorkeeper {
+	keyCount := resetInterval
+	if keyCount > maxKeyCount {
+		keyCount = maxKeyCount
+	}
+	if keyCount < minKeyCount {
+		keyCount = minKeyCount
+	}
+
+	bitCount := xmath.RoundUpPowerOf2(keyCount * bitsPerKey)
+	return &doorkeeper{
+		bits:     make([]uint64, bitCount/bitsPerBlock),
+		mask:     uint64(bitCount - 1),
+		maxCount: resetInterval,
+	}
+}
+
+// insert adds the hash to the filter and reports whether it was already present.
+//
+// The filter is reset when the number of inserted hashes reaches the key count,
+// so it only remembers the recent keys.
+func (d *doorkeeper) insert(h uint64) bool {
+	if d.contains(h) {
+		return true
+	}
+
+	if d.count >= d.maxCount {
+		d.clear()
+	}
+	d.count++
+	d.iterate(h, func(block int, bit uint64) {
+		d.bits[block] |= bit
+	})
+	return false
+}
+
+func (d *doorkeeper) contains(h uint64) bool {
+	present := true
+	d.iterate(h, func(block int, bit uint64) {
+		if d.bits[block]&bit == 0 {
+			present = false
+		}
+	})
+	return present
+}
+
+// iterate calls f for each bit of the hash using double hashing: the i-th index is h1 + i*h2.
+func (d *doorkeeper) iterate(h uint64, f func(block int, bit uint64)) {
+	h1, h2 := h, h>>32|h<<32|1
+	for i := uint64(0); i < hashCount; i++ {
+		idx := (h1 + i*h2) & d.mask
+		f(int(idx/bitsPerBlock), uint64(1)<<(idx%bitsPerBlock))
+	}
+}
+
+func (d *doorkeeper) clear() {
+	for i := range d.bits {
+		d.bits[i] = 0
+	}
+	d.count = 0
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3fifo
+
+import (
+	"testing"
+)
+
+func TestDoorkeeper_ResetInterval(t *testing.T) {
+	d := newDoorkeeper(2)
+
+	if d.insert(1) || d.insert(2) {
+		t.Fatal("new hashes should not be present")
+	}
+	if !d.insert(1) || !d.insert(2) {
+		t.Fatal("inserted hashes should be present")
+	}
+
+	// the third distinct hash resets the filter.
+	if d.insert(3) || !d.insert(3) {
+		t.Fatal("the hash inserted after the reset should be remembered")
+	}
+	if d.insert(1) {
+		t.Fatal("hashes inserted before the reset should be forgotten")
+	}
+}
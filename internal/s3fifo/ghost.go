@@ -22,24 +22,30 @@ import (
 	"github.com/maypok86/otter/internal/node"
 )
 
+// ghost is the queue of the hashes of the keys recently evicted from the small queue.
+// Its index is allocated on the first eviction, so the policies which never evict don't pay for it.
 type ghost[K comparable, V any] struct {
 	q      *deque.Deque[uint64]
 	m      *swiss.Map[uint64, struct{}]
 	main   *main[K, V]
 	small  *small[K, V]
 	hasher maphash.Hasher[K]
+	factor float64
 }
 
 func newGhost[K comparable, V any](main *main[K, V]) *ghost[K, V] {
 	return &ghost[K, V]{
 		q:      deque.New[uint64](),
-		m:      swiss.NewMap[uint64, struct{}](64),
 		main:   main,
 		hasher: maphash.NewHasher[K](),
+		factor: 1,
 	}
 }
 
 func (g *ghost[K, V]) isGhost(n *node.Node[K, V]) bool {
+	if g.m == nil {
+		return false
+	}
 	_, ok := g.m.Get(g.hasher.Hash(n.Key()))
 	return ok
 }
@@ -49,11 +55,14 @@ func (g *ghost[K, V]) insert(deleted []*node.Node[K, V], n *node.Node[K, V]) []*
 
 	h := g.hasher.Hash(n.Key())
 
+	if g.m == nil {
+		g.m = swiss.NewMap[uint64, struct{}](64)
+	}
 	if _, ok := g.m.Get(h); ok {
 		return deleted
 	}
 
-	maxLength := g.small.length() + g.main.length()
+	maxLength := int(float64(g.small.length()+g.main.length()) * g.factor)
 	if maxLength == 0 {
 		return deleted
 	}
@@ -69,7 +78,19 @@ func (g *ghost[K, V]) insert(deleted []*node.Node[K, V], n *node.Node[K, V]) []*
 	return deleted
 }
 
+// memoryUsage returns the estimated number of bytes used by the ghost queue and its index.
+func (g *ghost[K, V]) memoryUsage() int64 {
+	if g.m == nil {
+		return 0
+	}
+	// the swiss map keeps its load factor below 7/8 and spends a control byte per slot.
+	slots := (g.m.Count() + g.m.Capacity()) * 8 / 7
+	return int64(g.q.Cap())*8 + int64(slots)*9
+}
+
 func (g *ghost[K, V]) clear() {
 	g.q.Clear()
-	g.m.Clear()
+	if g.m != nil {
+		g.m.Clear()
+	}
 }
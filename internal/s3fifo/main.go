@@ -18,12 +18,18 @@ import (
 	"github.com/maypok86/otter/internal/node"
 )
 
-const maxReinsertions = 20
+const (
+	maxReinsertions = 20
+	// maxCandidates is the number of eviction candidates compared by the retention.
+	maxCandidates = 8
+)
 
 type main[K comparable, V any] struct {
 	q       *node.Queue[K, V]
 	cost    uint32
 	maxCost uint32
+	// retention estimates the value of keeping the node in the cache, nil means plain FIFO order.
+	retention func(n *node.Node[K, V]) float64
 }
 
 func newMain[K comparable, V any](maxCost uint32) *main[K, V] {
@@ -40,6 +46,10 @@ func (m *main[K, V]) insert(n *node.Node[K, V]) {
 }
 
 func (m *main[K, V]) evict(deleted []*node.Node[K, V]) []*node.Node[K, V] {
+	if m.retention != nil {
+		return m.evictByRetention(deleted)
+	}
+
 	reinsertions := 0
 	for m.cost > 0 {
 		n := m.q.Pop()
@@ -64,6 +74,60 @@ func (m *main[K, V]) evict(deleted []*node.Node[K, V]) []*node.Node[K, V] {
 	return deleted
 }
 
+// evictByRetention collects several eviction candidates in the S3-FIFO order
+// and evicts the one with the lowest retention. The other candidates are moved to the tail of the queue.
+func (m *main[K, V]) evictByRetention(deleted []*node.Node[K, V]) []*node.Node[K, V] {
+	var candidates [maxCandidates]*node.Node[K, V]
+	count := 0
+	reinsertions := 0
+	for count < maxCandidates && !m.q.IsEmpty() {
+		n := m.q.Pop()
+
+		if n.IsExpired() {
+			// expired nodes are the best victims.
+			m.reinsert(candidates[:count])
+			n.Unmark()
+			m.cost -= n.Cost()
+			return append(deleted, n)
+		}
+
+		if n.Frequency() == 0 || reinsertions >= maxReinsertions {
+			candidates[count] = n
+			count++
+			continue
+		}
+
+		reinsertions++
+		m.q.Push(n)
+		n.DecrementFrequency()
+	}
+	if count == 0 {
+		return deleted
+	}
+
+	victim := 0
+	minRetention := m.retention(candidates[0])
+	for i := 1; i < count; i++ {
+		if r := m.retention(candidates[i]); r < minRetention {
+			victim = i
+			minRetention = r
+		}
+	}
+
+	n := candidates[victim]
+	candidates[victim] = candidates[count-1]
+	m.reinsert(candidates[:count-1])
+	n.Unmark()
+	m.cost -= n.Cost()
+	return append(deleted, n)
+}
+
+func (m *main[K, V]) reinsert(nodes []*node.Node[K, V]) {
+	for _, n := range nodes {
+		m.q.Push(n)
+	}
+}
+
 func (m *main[K, V]) remove(n *node.Node[K, V]) {
 	m.cost -= n.Cost()
 	n.Unmark()
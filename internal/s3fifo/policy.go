@@ -15,42 +15,175 @@
 package s3fifo
 
 import (
+	"sync/atomic"
+
 	"github.com/maypok86/otter/internal/node"
 )
 
+// Admission decides whether new keys are admitted into the policy when it is full.
+//
+// Its methods are called under the eviction lock, so implementations don't need to be thread-safe.
+type Admission[K comparable] interface {
+	// Record records an access of the key.
+	Record(key K)
+	// Admit reports whether the candidate should be admitted at the cost of evicting the victim.
+	Admit(candidate, victim K) bool
+}
+
 // Policy is an eviction policy based on S3-FIFO eviction algorithm
 // from the following paper: https://dl.acm.org/doi/10.1145/3600006.3613147.
 type Policy[K comparable, V any] struct {
 	small                *small[K, V]
 	main                 *main[K, V]
 	ghost                *ghost[K, V]
+	doorkeeper           *doorkeeper
+	admission            Admission[K]
 	maxCost              uint32
-	maxAvailableNodeCost uint32
+	maxAvailableNodeCost atomic.Uint32
+	smallQueueRatio      uint32
+	lowWatermark         uint32
+	highWatermark        uint32
+	lowCost              uint32
+	highCost             uint32
+	maxEvictions         int
+	evictions            int
+	admissionDisabled    bool
+	rejected             uint64
+	evictingAdmissions   uint64
 }
 
+// DefaultSmallQueueRatio is the default share of the small queue in percent of the max cost.
+const DefaultSmallQueueRatio = 10
+
 // NewPolicy creates a new Policy.
 func NewPolicy[K comparable, V any](maxCost uint32) *Policy[K, V] {
-	smallMaxCost := maxCost / 10
-	mainMaxCost := maxCost - smallMaxCost
-
-	main := newMain[K, V](mainMaxCost)
+	main := newMain[K, V](0)
 	ghost := newGhost(main)
-	small := newSmall(smallMaxCost, main, ghost)
+	small := newSmall(0, main, ghost)
 	ghost.small = small
 
-	return &Policy[K, V]{
-		small:                small,
-		main:                 main,
-		ghost:                ghost,
-		maxCost:              maxCost,
-		maxAvailableNodeCost: smallMaxCost,
+	p := &Policy[K, V]{
+		small:   small,
+		main:    main,
+		ghost:   ghost,
+		maxCost: maxCost,
+	}
+	p.SetSmallQueueRatio(DefaultSmallQueueRatio)
+	p.updateWatermarks()
+	return p
+}
+
+// SetSmallQueueRatio sets the share of the small queue in percent of the max cost.
+//
+// NOTE: must be called before the policy is used.
+func (p *Policy[K, V]) SetSmallQueueRatio(percent uint32) {
+	p.smallQueueRatio = percent
+	p.updateQueueCosts()
+}
+
+// updateQueueCosts splits the max cost between the queues according to the share of the small queue.
+func (p *Policy[K, V]) updateQueueCosts() {
+	smallMaxCost := uint32(uint64(p.maxCost) * uint64(p.smallQueueRatio) / 100)
+	p.small.maxCost = smallMaxCost
+	p.main.maxCost = p.maxCost - smallMaxCost
+	p.maxAvailableNodeCost.Store(smallMaxCost)
+}
+
+// SetWatermarks makes the policy start the eviction when the total cost exceeds the high watermark
+// and evict the nodes in a batch until it drops to the low watermark. Both are in percent of the max cost.
+//
+// NOTE: must be called before the policy is used.
+func (p *Policy[K, V]) SetWatermarks(low, high uint32) {
+	p.lowWatermark = low
+	p.highWatermark = high
+	p.updateWatermarks()
+}
+
+func (p *Policy[K, V]) updateWatermarks() {
+	p.lowCost = p.maxCost
+	p.highCost = p.maxCost
+	if p.highWatermark > 0 {
+		p.lowCost = uint32(uint64(p.maxCost) * uint64(p.lowWatermark) / 100)
+		p.highCost = uint32(uint64(p.maxCost) * uint64(p.highWatermark) / 100)
+	}
+}
+
+// SetMaxEvictions limits the number of nodes evicted by a single Write or Resize call, zero means no limit.
+// The nodes which don't fit into the policy after that are evicted by the following calls.
+//
+// NOTE: must be called before the policy is used.
+func (p *Policy[K, V]) SetMaxEvictions(maxEvictions int) {
+	p.maxEvictions = maxEvictions
+}
+
+// SetRetention makes the main queue evict the node with the lowest retention among several candidates
+// instead of the first one, which gives cost-aware eviction similar to GreedyDual-Size.
+//
+// NOTE: must be called before the policy is used.
+func (p *Policy[K, V]) SetRetention(retention func(n *node.Node[K, V]) float64) {
+	p.main.retention = retention
+}
+
+// SetGhostQueueFactor sets the max length of the ghost queue relative to the number of nodes in the policy.
+//
+// NOTE: must be called before the policy is used.
+func (p *Policy[K, V]) SetGhostQueueFactor(factor float64) {
+	p.ghost.factor = factor
+}
+
+// EnableDoorkeeper makes the policy reject new keys seen for the first time when the policy is full,
+// so one-hit wonders don't pollute the small queue.
+//
+// The doorkeeper forgets all keys after resetInterval distinct keys, zero means the max cost of the policy.
+func (p *Policy[K, V]) EnableDoorkeeper(resetInterval uint32) {
+	if resetInterval == 0 {
+		resetInterval = p.maxCost
 	}
+	p.doorkeeper = newDoorkeeper(resetInterval)
+}
+
+// SetAdmissionEnabled turns the doorkeeper and the admission policy on or off, so all new nodes are admitted
+// while they are off. The keys are still recorded, so the admission has the history once it is turned back on.
+func (p *Policy[K, V]) SetAdmissionEnabled(enabled bool) {
+	p.admissionDisabled = !enabled
+}
+
+// TakeAdmissions returns the number of new nodes rejected by the admission
+// and the number of new nodes admitted at the cost of evicting other nodes since the previous call.
+func (p *Policy[K, V]) TakeAdmissions() (rejected, evicting uint64) {
+	rejected, evicting = p.rejected, p.evictingAdmissions
+	p.rejected, p.evictingAdmissions = 0, 0
+	return rejected, evicting
+}
+
+// SetAdmission sets the admission policy consulted for new keys when the policy is full.
+func (p *Policy[K, V]) SetAdmission(admission Admission[K]) {
+	p.admission = admission
+}
+
+// Resize sets the max cost of the policy keeping the share of the small queue
+// and evicts the nodes which don't fit into it.
+//
+// Unlike the setters, it may be called while the policy is used, under the same lock as Write,
+// and MaxAvailableCost may be read concurrently with it.
+func (p *Policy[K, V]) Resize(deleted []*node.Node[K, V], maxCost uint32) []*node.Node[K, V] {
+	p.maxCost = maxCost
+	p.updateQueueCosts()
+	p.updateWatermarks()
+	p.evictions = 0
+	if p.isFull() {
+		deleted = p.evictToLowWatermark(deleted)
+	}
+	return deleted
 }
 
 // Read updates the eviction policy based on node accesses.
 func (p *Policy[K, V]) Read(nodes []*node.Node[K, V]) {
 	for _, n := range nodes {
 		n.IncrementFrequency()
+		if p.admission != nil {
+			p.admission.Record(n.Key())
+		}
 	}
 }
 
@@ -62,23 +195,92 @@ func (p *Policy[K, V]) insert(deleted []*node.Node[K, V], n *node.Node[K, V]) []
 		p.small.insert(n)
 	}
 
-	for p.isFull() {
-		deleted = p.evict(deleted)
+	if p.isFull() {
+		deleted = p.evictToLowWatermark(deleted)
 	}
 
 	return deleted
 }
 
+// restore inserts the node into the queue it has been marked with, keeping its frequency.
+func (p *Policy[K, V]) restore(deleted []*node.Node[K, V], n *node.Node[K, V]) []*node.Node[K, V] {
+	if n.IsMain() {
+		p.main.insert(n)
+	} else {
+		p.small.insert(n)
+	}
+
+	if p.isFull() {
+		deleted = p.evictToLowWatermark(deleted)
+	}
+
+	return deleted
+}
+
+// admit reports whether the new node should be inserted into the policy.
+// The forced node is always admitted, but its key is recorded as usual.
+func (p *Policy[K, V]) admit(n *node.Node[K, V], force bool) bool {
+	if p.admission != nil {
+		p.admission.Record(n.Key())
+	}
+	if p.doorkeeper == nil && p.admission == nil {
+		return true
+	}
+
+	// remember all keys, but reject only when the insertion would evict other nodes.
+	seen := true
+	if p.doorkeeper != nil {
+		seen = p.doorkeeper.insert(p.ghost.hasher.Hash(n.Key()))
+	}
+	if force || p.admissionDisabled || p.small.cost+p.main.cost+n.Cost() <= p.highCost || p.ghost.isGhost(n) {
+		return true
+	}
+	if !seen {
+		return false
+	}
+	if p.admission != nil {
+		if victim := p.victim(); victim != nil {
+			return p.admission.Admit(n.Key(), victim.Key())
+		}
+	}
+	return true
+}
+
+// victim returns the node which is going to be evicted next.
+func (p *Policy[K, V]) victim() *node.Node[K, V] {
+	if p.small.cost >= p.small.maxCost || p.main.q.IsEmpty() {
+		return p.small.q.Head()
+	}
+	return p.main.q.Head()
+}
+
 func (p *Policy[K, V]) evict(deleted []*node.Node[K, V]) []*node.Node[K, V] {
-	if p.small.cost >= p.maxCost/10 {
+	// below the low watermark the small queue can be under its max cost while the main queue is empty.
+	if p.small.cost >= p.small.maxCost || p.main.cost == 0 {
 		return p.small.evict(deleted)
 	}
 
 	return p.main.evict(deleted)
 }
 
+// evictToLowWatermark evicts the nodes until the total cost drops to the low watermark
+// or the limit of the evictions is reached.
+func (p *Policy[K, V]) evictToLowWatermark(deleted []*node.Node[K, V]) []*node.Node[K, V] {
+	for p.small.cost+p.main.cost > p.lowCost {
+		if p.maxEvictions > 0 && p.evictions >= p.maxEvictions {
+			break
+		}
+
+		// promotions from the small queue to the main one don't evict anything.
+		before := len(deleted)
+		deleted = p.evict(deleted)
+		p.evictions += len(deleted) - before
+	}
+	return deleted
+}
+
 func (p *Policy[K, V]) isFull() bool {
-	return p.small.cost+p.main.cost > p.maxCost
+	return p.small.cost+p.main.cost > p.highCost
 }
 
 // Write updates the eviction policy based on node updates.
@@ -86,6 +288,12 @@ func (p *Policy[K, V]) Write(
 	deleted []*node.Node[K, V],
 	tasks []node.WriteTask[K, V],
 ) []*node.Node[K, V] {
+	p.evictions = 0
+	if p.isFull() {
+		// the nodes left over by the previous calls go first.
+		deleted = p.evictToLowWatermark(deleted)
+	}
+
 	for _, task := range tasks {
 		n := task.Node()
 
@@ -95,10 +303,21 @@ func (p *Policy[K, V]) Write(
 			continue
 		}
 
+		if task.IsRestore() {
+			deleted = p.restore(deleted, n)
+			continue
+		}
+
 		if task.IsUpdate() {
 			// delete old node
 			p.delete(task.OldNode())
 			// insert new node
+		} else if !p.admit(n, task.IsForceAdmit()) {
+			p.rejected++
+			deleted = append(deleted, n)
+			continue
+		} else if p.small.cost+p.main.cost+n.Cost() > p.highCost {
+			p.evictingAdmissions++
 		}
 
 		// add
@@ -125,13 +344,84 @@ func (p *Policy[K, V]) delete(n *node.Node[K, V]) {
 	}
 }
 
+// QueueInfo describes the state of a policy queue.
+type QueueInfo struct {
+	Length  int
+	Cost    uint32
+	MaxCost uint32
+	// Frequencies is the number of nodes with each frequency value.
+	Frequencies [node.MaxFrequency + 1]int
+}
+
+// Info describes the state of the eviction policy.
+type Info struct {
+	Small       QueueInfo
+	Main        QueueInfo
+	GhostLength int
+}
+
+// Info returns the current state of the eviction policy.
+//
+// It iterates over all nodes in the policy, so it should only be used for debugging.
+func (p *Policy[K, V]) Info() Info {
+	return Info{
+		Small: QueueInfo{
+			Length:      p.small.length(),
+			Cost:        p.small.cost,
+			MaxCost:     p.small.maxCost,
+			Frequencies: frequencies(p.small.q),
+		},
+		Main: QueueInfo{
+			Length:      p.main.length(),
+			Cost:        p.main.cost,
+			MaxCost:     p.main.maxCost,
+			Frequencies: frequencies(p.main.q),
+		},
+		GhostLength: p.ghost.q.Len(),
+	}
+}
+
+func frequencies[K comparable, V any](q *node.Queue[K, V]) [node.MaxFrequency + 1]int {
+	var result [node.MaxFrequency + 1]int
+	q.Range(func(n *node.Node[K, V]) bool {
+		result[n.Frequency()]++
+		return true
+	})
+	return result
+}
+
+// Cost returns the total cost of the nodes in the policy.
+func (p *Policy[K, V]) Cost() uint32 {
+	return p.small.cost + p.main.cost
+}
+
+// MemoryUsage returns the estimated number of bytes used by the ghost queue and the doorkeeper.
+// The nodes are owned by the cache, so they aren't included.
+func (p *Policy[K, V]) MemoryUsage() int64 {
+	usage := p.ghost.memoryUsage()
+	if p.doorkeeper != nil {
+		usage += int64(len(p.doorkeeper.bits)) * 8
+	}
+	return usage
+}
+
+// MaxCost returns the maximum total cost of the nodes in the policy.
+func (p *Policy[K, V]) MaxCost() uint32 {
+	return p.maxCost
+}
+
 // MaxAvailableCost returns the maximum available cost of the node.
+//
+// It is safe to call without the lock of the policy.
 func (p *Policy[K, V]) MaxAvailableCost() uint32 {
-	return p.maxAvailableNodeCost
+	return p.maxAvailableNodeCost.Load()
 }
 
 // Clear clears the eviction policy and returns it to the default state.
 func (p *Policy[K, V]) Clear() {
+	if p.doorkeeper != nil {
+		p.doorkeeper.clear()
+	}
 	p.ghost.clear()
 	p.main.clear()
 	p.small.clear()
@@ -98,6 +98,104 @@ func TestPolicy_OneHitWonders(t *testing.T) {
 	}
 }
 
+func TestPolicy_Doorkeeper(t *testing.T) {
+	p := NewPolicy[int, int](10)
+	p.EnableDoorkeeper(0)
+
+	nodes := make([]*node.Node[int, int], 0, 10)
+	for i := 0; i < cap(nodes); i++ {
+		nodes = append(nodes, newNode(i))
+	}
+	if deleted := p.Write(nil, nodesToAddTasks(nodes)); len(deleted) != 0 {
+		t.Fatalf("nodes should be admitted while the policy isn't full, but got deleted: %v", deleted)
+	}
+
+	n := newNode(100)
+	deleted := p.Write(nil, nodesToAddTasks([]*node.Node[int, int]{n}))
+	if len(deleted) != 1 || deleted[0] != n || n.IsSmall() || n.IsMain() {
+		t.Fatalf("new key should be rejected, but got deleted: %v", deleted)
+	}
+
+	n = newNode(100)
+	deleted = p.Write(nil, nodesToAddTasks([]*node.Node[int, int]{n}))
+	if !n.IsSmall() || len(deleted) != 1 || deleted[0].Key() == 100 {
+		t.Fatalf("key seen twice should be admitted, but got deleted: %v", deleted)
+	}
+}
+
+func TestPolicy_TakeAdmissions(t *testing.T) {
+	p := NewPolicy[int, int](10)
+	p.EnableDoorkeeper(0)
+
+	nodes := make([]*node.Node[int, int], 0, 10)
+	for i := 0; i < cap(nodes); i++ {
+		nodes = append(nodes, newNode(i))
+	}
+	p.Write(nil, nodesToAddTasks(nodes))
+	if rejected, evicting := p.TakeAdmissions(); rejected != 0 || evicting != 0 {
+		t.Fatalf("admissions without evictions shouldn't be counted, but got %d and %d", rejected, evicting)
+	}
+
+	p.Write(nil, nodesToAddTasks([]*node.Node[int, int]{newNode(100)}))
+	p.Write(nil, nodesToAddTasks([]*node.Node[int, int]{newNode(100)}))
+	if rejected, evicting := p.TakeAdmissions(); rejected != 1 || evicting != 1 {
+		t.Fatalf("got %d rejected and %d evicting admissions, want 1 and 1", rejected, evicting)
+	}
+	if rejected, evicting := p.TakeAdmissions(); rejected != 0 || evicting != 0 {
+		t.Fatalf("counters should be reset after take, but got %d and %d", rejected, evicting)
+	}
+}
+
+func TestPolicy_QueueSettings(t *testing.T) {
+	p := NewPolicy[int, int](100)
+	p.SetSmallQueueRatio(50)
+	p.SetGhostQueueFactor(0.5)
+
+	if info := p.Info(); info.Small.MaxCost != 50 || info.Main.MaxCost != 50 {
+		t.Fatalf("got small max cost %d and main max cost %d, want 50 and 50", info.Small.MaxCost, info.Main.MaxCost)
+	}
+
+	nodes := make([]*node.Node[int, int], 0, 200)
+	for i := 0; i < cap(nodes); i++ {
+		nodes = append(nodes, newNode(i))
+	}
+	p.Write(nil, nodesToAddTasks(nodes))
+	// the ghost queue is limited by half of the resident nodes.
+	if info := p.Info(); info.GhostLength != 50 {
+		t.Fatalf("got ghost length %d, want 50", info.GhostLength)
+	}
+}
+
+func TestPolicy_Retention(t *testing.T) {
+	p := NewPolicy[int, int](100)
+	// nodes with even keys are expensive to refetch.
+	p.SetRetention(func(n *node.Node[int, int]) float64 {
+		if n.Key()%2 == 0 {
+			return 100
+		}
+		return 1
+	})
+
+	nodes := make([]*node.Node[int, int], 0, 8)
+	for i := 0; i < cap(nodes); i++ {
+		n := newNode(i)
+		p.main.insert(n)
+		nodes = append(nodes, n)
+	}
+
+	deleted := p.main.evict(nil)
+	if len(deleted) != 1 || deleted[0].Key() != 1 {
+		t.Fatalf("the first cheap node should be evicted, but got %v", deleted)
+	}
+	deleted = p.main.evict(nil)
+	if len(deleted) != 1 || deleted[0].Key()%2 != 1 {
+		t.Fatalf("cheap node should be evicted, but got %v", deleted)
+	}
+	if p.main.length() != len(nodes)-2 {
+		t.Fatalf("got main length %d, want %d", p.main.length(), len(nodes)-2)
+	}
+}
+
 func TestPolicy_Update(t *testing.T) {
 	p := NewPolicy[int, int](100)
 
@@ -132,3 +230,121 @@ func TestPolicy_Update(t *testing.T) {
 		t.Fatalf("updated node should be evicted: %+v", n3)
 	}
 }
+
+func TestPolicy_Restore(t *testing.T) {
+	p := NewPolicy[int, int](10)
+	p.EnableDoorkeeper(0)
+
+	hot := newNode(1)
+	hot.MarkMain()
+	hot.SetFrequency(2)
+	cold := newNode(2)
+	cold.MarkSmall()
+	p.Write(nil, []node.WriteTask[int, int]{node.NewRestoreTask(hot), node.NewRestoreTask(cold)})
+
+	if !hot.IsMain() || hot.Frequency() != 2 {
+		t.Fatalf("restored node should keep its queue and frequency: %+v", hot)
+	}
+	if !cold.IsSmall() {
+		t.Fatalf("restored node should keep its queue: %+v", cold)
+	}
+	if info := p.Info(); info.Main.Length != 1 || info.Small.Length != 1 {
+		t.Fatalf("got %+v, want one node in each queue", info)
+	}
+}
+
+func TestPolicy_Watermarks(t *testing.T) {
+	const size = 100
+	p := NewPolicy[int, int](size)
+	p.SetWatermarks(80, 100)
+	nodes := make([]*node.Node[int, int], 0, size+20)
+	for i := 0; i < size+20; i++ {
+		nodes = append(nodes, newNode(i))
+	}
+	if deleted := p.Write(nil, nodesToAddTasks(nodes[:size])); len(deleted) != 0 {
+		t.Fatalf("policy shouldn't evict nodes below the high watermark, but evicted %d", len(deleted))
+	}
+
+	// exceeding the high watermark evicts the nodes down to the low watermark at once.
+	deleted := p.Write(nil, nodesToAddTasks(nodes[size:size+1]))
+	if len(deleted) != size+1-80 || p.Cost() != 80 {
+		t.Fatalf("policy should evict %d nodes, but evicted %d and has cost %d", size+1-80, len(deleted), p.Cost())
+	}
+
+	if deleted := p.Write(nil, nodesToAddTasks(nodes[size+1:])); len(deleted) != 0 || p.Cost() != 99 {
+		t.Fatalf("policy shouldn't evict nodes until the high watermark, but evicted %d", len(deleted))
+	}
+}
+
+func TestPolicy_MaxEvictions(t *testing.T) {
+	const size = 100
+	p := NewPolicy[int, int](size)
+	p.SetMaxEvictions(5)
+	nodes := make([]*node.Node[int, int], 0, size+20)
+	for i := 0; i < size+20; i++ {
+		nodes = append(nodes, newNode(i))
+	}
+	if deleted := p.Write(nil, nodesToAddTasks(nodes[:size])); len(deleted) != 0 {
+		t.Fatalf("policy shouldn't evict nodes, but evicted %d", len(deleted))
+	}
+
+	deleted := p.Write(nil, nodesToAddTasks(nodes[size:]))
+	if len(deleted) != 5 || p.Cost() != size+15 {
+		t.Fatalf("policy should evict 5 nodes per call, but evicted %d and has cost %d", len(deleted), p.Cost())
+	}
+
+	// the following calls evict the rest.
+	for i := 0; i < 3; i++ {
+		p.Write(nil, nil)
+	}
+	if p.Cost() != size {
+		t.Fatalf("policy should evict the rest of the nodes, but has cost %d", p.Cost())
+	}
+}
+
+func TestPolicy_Resize(t *testing.T) {
+	const size = 100
+	p := NewPolicy[int, int](size)
+	nodes := make([]*node.Node[int, int], 0, size)
+	for i := 0; i < size; i++ {
+		nodes = append(nodes, newNode(i))
+	}
+	if deleted := p.Write(nil, nodesToAddTasks(nodes)); len(deleted) != 0 {
+		t.Fatalf("policy shouldn't evict nodes, but evicted %d", len(deleted))
+	}
+
+	deleted := p.Resize(nil, size/2)
+	if len(deleted) != size/2 || p.Cost() != size/2 {
+		t.Fatalf("policy should evict %d nodes, but evicted %d and has cost %d", size/2, len(deleted), p.Cost())
+	}
+	if info := p.Info(); info.Small.MaxCost != size/20 || info.Main.MaxCost != size/2-size/20 {
+		t.Fatalf("queues should keep their shares, but got %+v", info)
+	}
+	if got := p.MaxAvailableCost(); got != size/20 {
+		t.Fatalf("max available cost should follow the small queue, but got %d", got)
+	}
+
+	if deleted := p.Resize(nil, size); len(deleted) != 0 {
+		t.Fatalf("growing policy shouldn't evict nodes, but evicted %d", len(deleted))
+	}
+	if got := p.MaxAvailableCost(); got != size/10 {
+		t.Fatalf("max available cost should be restored, but got %d", got)
+	}
+}
+
+func TestPolicy_LazyGhost(t *testing.T) {
+	p := NewPolicy[int, int](100)
+	nodes := make([]*node.Node[int, int], 0, 100)
+	for i := 0; i < cap(nodes); i++ {
+		nodes = append(nodes, newNode(i))
+	}
+	p.Write(nil, nodesToAddTasks(nodes))
+	if got := p.MemoryUsage(); got != 0 {
+		t.Fatalf("the ghost queue shouldn't be allocated before the first eviction, but got %d bytes", got)
+	}
+
+	p.Write(nil, nodesToAddTasks([]*node.Node[int, int]{newNode(100)}))
+	if got := p.MemoryUsage(); got == 0 {
+		t.Fatal("the ghost queue should be allocated after the eviction")
+	}
+}
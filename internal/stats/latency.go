@@ -0,0 +1,154 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// every power of two is divided into 2^subBucketBits sub-buckets,
+	// so the relative error of quantiles doesn't exceed 12.5%.
+	subBucketBits  = 3
+	subBuckets     = 1 << subBucketBits
+	subBucketMask  = subBuckets - 1
+	histogramSize  = (64 - subBucketBits + 1) * subBuckets
+	operationCount = 4
+)
+
+// Operation is a cache operation whose latency is measured.
+type Operation uint8
+
+const (
+	// GetOperation is the read operation.
+	GetOperation Operation = iota
+	// SetOperation is the write operation.
+	SetOperation
+	// DeleteOperation is the delete operation.
+	DeleteOperation
+	// HasOperation is the existence check.
+	HasOperation
+)
+
+// histogram is a thread-safe log-linear histogram of durations in nanoseconds.
+type histogram struct {
+	buckets [histogramSize]int64
+}
+
+func bucketIndex(v uint64) int {
+	if v < subBuckets {
+		return int(v)
+	}
+
+	e := bits.Len64(v) - 1
+	sub := (v >> (e - subBucketBits)) & subBucketMask
+	return (e-subBucketBits+1)*subBuckets + int(sub)
+}
+
+func bucketUpperBound(idx int) uint64 {
+	if idx < subBuckets {
+		return uint64(idx)
+	}
+
+	e := idx/subBuckets + subBucketBits - 1
+	sub := uint64(idx % subBuckets)
+	lower := (subBuckets + sub) << (e - subBucketBits)
+	return lower + (1 << (e - subBucketBits)) - 1
+}
+
+func (h *histogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	atomic.AddInt64(&h.buckets[bucketIndex(uint64(d))], 1)
+}
+
+func (h *histogram) quantile(q float64) time.Duration {
+	var counts [histogramSize]int64
+	total := int64(0)
+	for i := range h.buckets {
+		counts[i] = atomic.LoadInt64(&h.buckets[i])
+		total += counts[i]
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := int64(math.Ceil(q * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	cumulative := int64(0)
+	for i, c := range counts {
+		cumulative += c
+		if cumulative >= rank {
+			upper := bucketUpperBound(i)
+			if upper > math.MaxInt64 {
+				return math.MaxInt64
+			}
+			return time.Duration(upper)
+		}
+	}
+	return time.Duration(bucketUpperBound(histogramSize - 1))
+}
+
+func (h *histogram) reset() {
+	for i := range h.buckets {
+		atomic.StoreInt64(&h.buckets[i], 0)
+	}
+}
+
+// Latencies is a thread-safe collector of cache operation latencies.
+type Latencies struct {
+	histograms [operationCount]histogram
+}
+
+// NewLatencies creates a new Latencies collector.
+func NewLatencies() *Latencies {
+	return &Latencies{}
+}
+
+// Record records the latency of the operation.
+func (l *Latencies) Record(op Operation, d time.Duration) {
+	if l == nil {
+		return
+	}
+
+	l.histograms[op].record(d)
+}
+
+// Quantile returns the approximate q-quantile of the operation latency.
+func (l *Latencies) Quantile(op Operation, q float64) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	return l.histograms[op].quantile(q)
+}
+
+// Clear resets all collected latencies.
+func (l *Latencies) Clear() {
+	if l == nil {
+		return
+	}
+
+	for i := range l.histograms {
+		l.histograms[i].reset()
+	}
+}
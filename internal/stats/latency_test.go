@@ -0,0 +1,81 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBucketIndex(t *testing.T) {
+	prev := -1
+	for _, v := range []uint64{0, 1, 7, 8, 9, 15, 16, 17, 1000, 1 << 20, 1<<20 + 1, math.MaxUint64} {
+		idx := bucketIndex(v)
+		if idx < prev || idx >= histogramSize {
+			t.Fatalf("got unexpected bucket index %d for %d", idx, v)
+		}
+		if upper := bucketUpperBound(idx); upper < v {
+			t.Fatalf("upper bound of bucket %d is %d, but it contains %d", idx, upper, v)
+		}
+		if idx > 0 && bucketUpperBound(idx-1) >= v {
+			t.Fatalf("previous bucket of %d should contain only smaller values", v)
+		}
+		prev = idx
+	}
+}
+
+func TestLatencies_Nil(t *testing.T) {
+	var l *Latencies
+	l.Record(GetOperation, time.Second)
+	if q := l.Quantile(GetOperation, 0.5); q != 0 {
+		t.Fatalf("quantile for nil latencies should always be 0, but got %v", q)
+	}
+	l.Clear()
+}
+
+func TestLatencies_Quantile(t *testing.T) {
+	l := NewLatencies()
+	if q := l.Quantile(SetOperation, 0.99); q != 0 {
+		t.Fatalf("quantile without records should be 0, but got %v", q)
+	}
+
+	for i := 1; i <= 100; i++ {
+		l.Record(SetOperation, time.Duration(i)*time.Microsecond)
+	}
+
+	for _, tt := range []struct {
+		q        float64
+		expected time.Duration
+	}{
+		{q: 0.5, expected: 50 * time.Microsecond},
+		{q: 0.95, expected: 95 * time.Microsecond},
+		{q: 0.99, expected: 99 * time.Microsecond},
+	} {
+		got := l.Quantile(SetOperation, tt.q)
+		if got < tt.expected || float64(got) > float64(tt.expected)*1.125 {
+			t.Fatalf("quantile %v should be close to %v, but got %v", tt.q, tt.expected, got)
+		}
+	}
+
+	if q := l.Quantile(GetOperation, 0.5); q != 0 {
+		t.Fatalf("latencies of different operations should be separated, but got %v", q)
+	}
+
+	l.Clear()
+	if q := l.Quantile(SetOperation, 0.5); q != 0 {
+		t.Fatalf("quantile after clear should be 0, but got %v", q)
+	}
+}
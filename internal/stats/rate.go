@@ -0,0 +1,72 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// rateWindows are the time constants of the exponentially weighted moving averages of the hit rate.
+var rateWindows = [3]time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// rates tracks the exponentially weighted moving averages of the number of hits per second.
+//
+// The averages are updated lazily when they are read, assuming that the hits were spread evenly
+// since the previous read, so frequent reads give the same result as a periodic sampling.
+type rates struct {
+	mutex    sync.Mutex
+	since    time.Time
+	last     time.Time
+	lastHits int64
+	hitRates [3]float64
+}
+
+func newRates(now time.Time) *rates {
+	return &rates{
+		since: now,
+		last:  now,
+	}
+}
+
+func (r *rates) update(now time.Time, hits int64) [3]float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	elapsed := now.Sub(r.last).Seconds()
+	if elapsed <= 0 {
+		return r.hitRates
+	}
+
+	rate := float64(hits-r.lastHits) / elapsed
+	for i, window := range rateWindows {
+		alpha := 1 - math.Exp(-elapsed/window.Seconds())
+		r.hitRates[i] += alpha * (rate - r.hitRates[i])
+	}
+	r.last = now
+	r.lastHits = hits
+	return r.hitRates
+}
+
+func (r *rates) reset(now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.since = now
+	r.last = now
+	r.lastHits = 0
+	r.hitRates = [3]float64{}
+}
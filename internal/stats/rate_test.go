@@ -0,0 +1,39 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRates_Update(t *testing.T) {
+	now := time.Now()
+	r := newRates(now)
+
+	// a constant rate should be reached by all averages over a long enough time.
+	var hits int64
+	var got [3]float64
+	for i := 1; i <= 2*60*60; i++ {
+		hits += 10
+		got = r.update(now.Add(time.Duration(i)*time.Second), hits)
+	}
+	for i, rate := range got {
+		if math.Abs(rate-10) > 0.01 {
+			t.Fatalf("rate %d should be close to 10, but got %v", i, rate)
+		}
+	}
+}
@@ -14,27 +14,140 @@
 
 package stats
 
+import "time"
+
+// ReadOperation is a kind of read whose hits and misses are also counted separately.
+type ReadOperation uint8
+
+const (
+	// GetRead is a lookup of the value, e.g. Get.
+	GetRead ReadOperation = iota
+	// HasRead is an existence check.
+	HasRead
+	// LoadRead is a lookup of the loading cache.
+	LoadRead
+)
+
 // Stats is a thread-safe statistics collector.
 type Stats struct {
-	hits   *counter
-	misses *counter
+	hits                   *counter
+	misses                 *counter
+	getHits                *counter
+	getMisses              *counter
+	hasHits                *counter
+	hasMisses              *counter
+	loadHits               *counter
+	loadMisses             *counter
+	throttledTime          *counter
+	readBufferDrops        *counter
+	writeBufferContentions *counter
+	droppedEvents          *counter
+	rejectedSets           *counter
+	evictions              *counter
+	rejectedAdmissions     *counter
+	evictingAdmissions     *counter
+	created                time.Time
+	rates                  *rates
+	lifetimes              *histogram
+	hitAges                *histogram
 }
 
 // New creates a new Stats collector.
 func New() *Stats {
+	now := time.Now()
 	return &Stats{
-		hits:   newCounter(),
-		misses: newCounter(),
+		hits:                   newCounter(),
+		misses:                 newCounter(),
+		getHits:                newCounter(),
+		getMisses:              newCounter(),
+		hasHits:                newCounter(),
+		hasMisses:              newCounter(),
+		loadHits:               newCounter(),
+		loadMisses:             newCounter(),
+		throttledTime:          newCounter(),
+		readBufferDrops:        newCounter(),
+		writeBufferContentions: newCounter(),
+		droppedEvents:          newCounter(),
+		rejectedSets:           newCounter(),
+		evictions:              newCounter(),
+		rejectedAdmissions:     newCounter(),
+		evictingAdmissions:     newCounter(),
+		created:                now,
+		rates:                  newRates(now),
+		lifetimes:              &histogram{},
+		hitAges:                &histogram{},
 	}
 }
 
-// IncHits increments the hits counter.
-func (s *Stats) IncHits() {
+// IncReadHits increments the hits counter and the hits counter of the operation.
+func (s *Stats) IncReadHits(op ReadOperation) {
 	if s == nil {
 		return
 	}
 
 	s.hits.increment()
+	switch op {
+	case GetRead:
+		s.getHits.increment()
+	case HasRead:
+		s.hasHits.increment()
+	case LoadRead:
+		s.loadHits.increment()
+	}
+}
+
+// IncReadMisses increments the misses counter and the misses counter of the operation.
+func (s *Stats) IncReadMisses(op ReadOperation) {
+	if s == nil {
+		return
+	}
+
+	s.misses.increment()
+	switch op {
+	case GetRead:
+		s.getMisses.increment()
+	case HasRead:
+		s.hasMisses.increment()
+	case LoadRead:
+		s.loadMisses.increment()
+	}
+}
+
+// ReadHits returns the number of hits of the operation.
+func (s *Stats) ReadHits(op ReadOperation) int64 {
+	if s == nil {
+		return 0
+	}
+
+	switch op {
+	case HasRead:
+		return s.hasHits.value()
+	case LoadRead:
+		return s.loadHits.value()
+	default:
+		return s.getHits.value()
+	}
+}
+
+// ReadMisses returns the number of misses of the operation.
+func (s *Stats) ReadMisses(op ReadOperation) int64 {
+	if s == nil {
+		return 0
+	}
+
+	switch op {
+	case HasRead:
+		return s.hasMisses.value()
+	case LoadRead:
+		return s.loadMisses.value()
+	default:
+		return s.getMisses.value()
+	}
+}
+
+// IncHits increments the hits counter of the lookups of values.
+func (s *Stats) IncHits() {
+	s.IncReadHits(GetRead)
 }
 
 // Hits returns the number of cache hits.
@@ -46,25 +159,221 @@ func (s *Stats) Hits() int64 {
 	return s.hits.value()
 }
 
-// IncMisses increments the misses counter.
+// IncMisses increments the misses counter of the lookups of values.
 func (s *Stats) IncMisses() {
+	s.IncReadMisses(GetRead)
+}
+
+// Misses returns the number of cache misses.
+func (s *Stats) Misses() int64 {
+	if s == nil {
+		return 0
+	}
+
+	return s.misses.value()
+}
+
+// AddThrottledTime adds the time for which the maintenance was throttled.
+func (s *Stats) AddThrottledTime(d time.Duration) {
 	if s == nil {
 		return
 	}
 
-	s.misses.increment()
+	s.throttledTime.add(int64(d))
 }
 
-// Misses returns the number of cache misses.
-func (s *Stats) Misses() int64 {
+// ThrottledTime returns the total time for which the maintenance was throttled.
+func (s *Stats) ThrottledTime() time.Duration {
 	if s == nil {
 		return 0
 	}
 
-	return s.misses.value()
+	return time.Duration(s.throttledTime.value())
+}
+
+// IncReadBufferDrops increments the counter of records dropped by the read buffers.
+func (s *Stats) IncReadBufferDrops() {
+	if s == nil {
+		return
+	}
+
+	s.readBufferDrops.increment()
+}
+
+// ReadBufferDrops returns the number of records dropped by the read buffers.
+func (s *Stats) ReadBufferDrops() int64 {
+	if s == nil {
+		return 0
+	}
+
+	return s.readBufferDrops.value()
+}
+
+// IncWriteBufferContentions increments the counter of writes that had to wait for a free slot in the write buffer.
+func (s *Stats) IncWriteBufferContentions() {
+	if s == nil {
+		return
+	}
+
+	s.writeBufferContentions.increment()
+}
+
+// WriteBufferContentions returns the number of writes that had to wait for a free slot in the write buffer.
+func (s *Stats) WriteBufferContentions() int64 {
+	if s == nil {
+		return 0
+	}
+
+	return s.writeBufferContentions.value()
+}
+
+// IncDroppedEvents increments the counter of events dropped because the events buffer was full.
+func (s *Stats) IncDroppedEvents() {
+	if s == nil {
+		return
+	}
+
+	s.droppedEvents.increment()
+}
+
+// DroppedEvents returns the number of events dropped because the events buffer was full.
+func (s *Stats) DroppedEvents() int64 {
+	if s == nil {
+		return 0
+	}
+
+	return s.droppedEvents.value()
+}
+
+// IncRejectedSets increments the counter of items rejected because of their cost.
+func (s *Stats) IncRejectedSets() {
+	if s == nil {
+		return
+	}
+
+	s.rejectedSets.increment()
+}
+
+// RejectedSets returns the number of items rejected because of their cost.
+func (s *Stats) RejectedSets() int64 {
+	if s == nil {
+		return 0
+	}
+
+	return s.rejectedSets.value()
+}
+
+// IncEvictions increments the counter of items evicted by the eviction policy.
+func (s *Stats) IncEvictions() {
+	if s == nil {
+		return
+	}
+
+	s.evictions.increment()
+}
+
+// Evictions returns the number of items evicted by the eviction policy.
+func (s *Stats) Evictions() int64 {
+	if s == nil {
+		return 0
+	}
+
+	return s.evictions.value()
+}
+
+// AddAdmissions adds the numbers of new items rejected by the admission
+// and admitted at the cost of evicting other items.
+func (s *Stats) AddAdmissions(rejected, evicting uint64) {
+	if s == nil {
+		return
+	}
+
+	s.rejectedAdmissions.add(int64(rejected))
+	s.evictingAdmissions.add(int64(evicting))
+}
+
+// RejectedAdmissions returns the number of new items rejected by the admission.
+func (s *Stats) RejectedAdmissions() int64 {
+	if s == nil {
+		return 0
+	}
+
+	return s.rejectedAdmissions.value()
+}
+
+// EvictingAdmissions returns the number of new items admitted at the cost of evicting other items.
+func (s *Stats) EvictingAdmissions() int64 {
+	if s == nil {
+		return 0
+	}
+
+	return s.evictingAdmissions.value()
+}
+
+// Uptime returns the time elapsed since the creation of the collector.
+func (s *Stats) Uptime() time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	return time.Since(s.created)
+}
+
+// RequestRate returns the average number of hits and misses per second since the creation of the collector
+// or the last Clear.
+func (s *Stats) RequestRate() float64 {
+	if s == nil {
+		return 0.0
+	}
+
+	elapsed := time.Since(s.rates.since).Seconds()
+	if elapsed <= 0 {
+		return 0.0
+	}
+	return float64(s.hits.value()+s.misses.value()) / elapsed
+}
+
+// HitRates returns the 1, 5 and 15 minute exponentially weighted moving averages of the number of hits per second.
+func (s *Stats) HitRates() [3]float64 {
+	if s == nil {
+		return [3]float64{}
+	}
+
+	return s.rates.update(time.Now(), s.hits.value())
+}
+
+// RecordRemoval records the lifetime of an evicted or expired item and its age at the last hit.
+// Items without hits are recorded only in the lifetimes.
+func (s *Stats) RecordRemoval(lifetime, lastHitAge time.Duration, hit bool) {
+	if s == nil {
+		return
+	}
+
+	s.lifetimes.record(lifetime)
+	if hit {
+		s.hitAges.record(lastHitAge)
+	}
+}
+
+// LifetimeQuantile returns the approximate q-quantile of the lifetimes of evicted and expired items.
+func (s *Stats) LifetimeQuantile(q float64) time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	return s.lifetimes.quantile(q)
+}
+
+// HitAgeQuantile returns the approximate q-quantile of the ages of evicted and expired items at their last hit.
+func (s *Stats) HitAgeQuantile(q float64) time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	return s.hitAges.quantile(q)
 }
 
-// Ratio returns the cache hit ratio.
+// Ratio returns the cache hit ratio of all the read operations.
 func (s *Stats) Ratio() float64 {
 	if s == nil {
 		return 0.0
@@ -85,4 +394,21 @@ func (s *Stats) Clear() {
 
 	s.hits.reset()
 	s.misses.reset()
+	s.getHits.reset()
+	s.getMisses.reset()
+	s.hasHits.reset()
+	s.hasMisses.reset()
+	s.loadHits.reset()
+	s.loadMisses.reset()
+	s.throttledTime.reset()
+	s.readBufferDrops.reset()
+	s.writeBufferContentions.reset()
+	s.droppedEvents.reset()
+	s.rejectedSets.reset()
+	s.evictions.reset()
+	s.rejectedAdmissions.reset()
+	s.evictingAdmissions.reset()
+	s.rates.reset(time.Now())
+	s.lifetimes.reset()
+	s.hitAges.reset()
 }
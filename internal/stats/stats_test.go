@@ -58,9 +58,29 @@ func TestStats_Nil(t *testing.T) {
 			t.Fatalf("hits and misses for nil stats should always be %d", expected)
 		}
 	}
+	if s.ThrottledTime() != 0 {
+		t.Fatalf("throttled time for nil stats should always be %d", expected)
+	}
+	s.AddThrottledTime(time.Second)
 	s.Clear()
 }
 
+func TestStats_ThrottledTime(t *testing.T) {
+	s := New()
+	s.AddThrottledTime(time.Second)
+	s.AddThrottledTime(time.Millisecond)
+
+	expected := time.Second + time.Millisecond
+	if throttled := s.ThrottledTime(); throttled != expected {
+		t.Fatalf("throttled time should be %v, but got %v", expected, throttled)
+	}
+
+	s.Clear()
+	if throttled := s.ThrottledTime(); throttled != 0 {
+		t.Fatalf("throttled time after clear should be 0, but got %v", throttled)
+	}
+}
+
 func TestStats_Hits(t *testing.T) {
 	expected := generateCount(t)
 
@@ -139,3 +159,132 @@ func TestStats_Clear(t *testing.T) {
 		t.Fatalf("hits and misses after clear should be 0, but got hits: %d and misses: %d", hits, misses)
 	}
 }
+
+func TestStats_BufferCounters(t *testing.T) {
+	s := New()
+
+	drops := generateCount(t)
+	for i := int64(0); i < drops; i++ {
+		s.IncReadBufferDrops()
+	}
+	contentions := generateCount(t)
+	for i := int64(0); i < contentions; i++ {
+		s.IncWriteBufferContentions()
+	}
+
+	if got := s.ReadBufferDrops(); got != drops {
+		t.Fatalf("number of read buffer drops should be %d, but got %d", drops, got)
+	}
+	if got := s.WriteBufferContentions(); got != contentions {
+		t.Fatalf("number of write buffer contentions should be %d, but got %d", contentions, got)
+	}
+
+	s.Clear()
+
+	if s.ReadBufferDrops() != 0 || s.WriteBufferContentions() != 0 {
+		t.Fatalf("buffer counters after clear should be 0, but got drops: %d and contentions: %d",
+			s.ReadBufferDrops(), s.WriteBufferContentions())
+	}
+}
+
+func TestStats_Evictions(t *testing.T) {
+	s := New()
+
+	evictions := generateCount(t)
+	for i := int64(0); i < evictions; i++ {
+		s.IncEvictions()
+	}
+
+	if got := s.Evictions(); got != evictions {
+		t.Fatalf("number of evictions should be %d, but got %d", evictions, got)
+	}
+
+	s.Clear()
+
+	if got := s.Evictions(); got != 0 {
+		t.Fatalf("number of evictions after clear should be 0, but got %d", got)
+	}
+}
+
+func TestStats_Rates(t *testing.T) {
+	s := New()
+
+	for i := 0; i < 10; i++ {
+		s.IncHits()
+		s.IncMisses()
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if s.Uptime() < 10*time.Millisecond {
+		t.Fatalf("uptime should be at least 10ms, but got %v", s.Uptime())
+	}
+	if rate := s.RequestRate(); rate <= 0 || rate > 2000 {
+		t.Fatalf("request rate should be in (0, 2000], but got %v", rate)
+	}
+	rates := s.HitRates()
+	if !(rates[0] > rates[1] && rates[1] > rates[2] && rates[2] > 0) {
+		t.Fatalf("shorter windows should react faster to the hits, but got %v", rates)
+	}
+
+	s.Clear()
+	if s.RequestRate() != 0 || s.HitRates() != [3]float64{} {
+		t.Fatalf("rates after clear should be 0, but got %v and %v", s.RequestRate(), s.HitRates())
+	}
+}
+
+func TestStats_RecordRemoval(t *testing.T) {
+	s := New()
+
+	for i := 1; i <= 100; i++ {
+		s.RecordRemoval(time.Duration(i)*time.Second, time.Duration(i)*time.Millisecond, i%2 == 0)
+	}
+
+	if got := s.LifetimeQuantile(0.5); got < 50*time.Second || got > 57*time.Second {
+		t.Fatalf("median lifetime should be about 50s, but got %v", got)
+	}
+	if got := s.HitAgeQuantile(1); got < 100*time.Millisecond || got > 113*time.Millisecond {
+		t.Fatalf("max hit age should be about 100ms, but got %v", got)
+	}
+	if got := s.HitAgeQuantile(0); got < 2*time.Millisecond || got > 3*time.Millisecond {
+		t.Fatalf("items without hits shouldn't be recorded in hit ages, but got min %v", got)
+	}
+
+	s.Clear()
+	if s.LifetimeQuantile(0.5) != 0 || s.HitAgeQuantile(0.5) != 0 {
+		t.Fatal("histograms after clear should be empty")
+	}
+}
+
+func TestStats_ReadOperations(t *testing.T) {
+	s := New()
+
+	s.IncHits()
+	s.IncReadHits(GetRead)
+	s.IncReadMisses(GetRead)
+	s.IncReadHits(HasRead)
+	s.IncReadMisses(HasRead)
+	s.IncReadMisses(HasRead)
+	s.IncReadMisses(LoadRead)
+
+	for _, tt := range []struct {
+		op     ReadOperation
+		hits   int64
+		misses int64
+	}{
+		{op: GetRead, hits: 2, misses: 1},
+		{op: HasRead, hits: 1, misses: 2},
+		{op: LoadRead, hits: 0, misses: 1},
+	} {
+		if hits, misses := s.ReadHits(tt.op), s.ReadMisses(tt.op); hits != tt.hits || misses != tt.misses {
+			t.Fatalf("operation %d: got %d hits and %d misses, want %d and %d", tt.op, hits, misses, tt.hits, tt.misses)
+		}
+	}
+	if s.Hits() != 3 || s.Misses() != 4 {
+		t.Fatalf("totals should include all operations, but got %d hits and %d misses", s.Hits(), s.Misses())
+	}
+
+	s.Clear()
+	if s.ReadHits(HasRead) != 0 || s.ReadMisses(LoadRead) != 0 {
+		t.Fatal("operation counters after clear should be 0")
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topk
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Counter is an estimated number of occurrences of the key.
+//
+// The true count is in the range [Count-Error, Count].
+type Counter[K comparable] struct {
+	Key   K
+	Count uint64
+	Error uint64
+}
+
+// SpaceSaving finds the heavy hitters of a stream of keys with a fixed amount of memory
+// using the Space-Saving algorithm.
+// https://www.cs.ucsb.edu/sites/default/files/documents/2005-23.pdf
+//
+// It is not safe for concurrent use.
+type SpaceSaving[K comparable] struct {
+	capacity int
+	index    map[K]int
+	counters counterHeap[K]
+}
+
+// New creates a new SpaceSaving that tracks at most capacity keys.
+func New[K comparable](capacity int) *SpaceSaving[K] {
+	s := &SpaceSaving[K]{
+		capacity: capacity,
+		index:    make(map[K]int, capacity),
+	}
+	s.counters.index = s.index
+	return s
+}
+
+// Add records an occurrence of the key.
+func (s *SpaceSaving[K]) Add(key K) {
+	if i, ok := s.index[key]; ok {
+		s.counters.items[i].Count++
+		heap.Fix(&s.counters, i)
+		return
+	}
+
+	if len(s.counters.items) < s.capacity {
+		heap.Push(&s.counters, Counter[K]{Key: key, Count: 1})
+		return
+	}
+
+	// replace the key with the minimum count.
+	victim := &s.counters.items[0]
+	delete(s.index, victim.Key)
+	victim.Key = key
+	victim.Error = victim.Count
+	victim.Count++
+	s.index[key] = 0
+	heap.Fix(&s.counters, 0)
+}
+
+// Top returns at most k counters with the largest counts, ordered by the count descending.
+func (s *SpaceSaving[K]) Top(k int) []Counter[K] {
+	top := make([]Counter[K], len(s.counters.items))
+	copy(top, s.counters.items)
+	sort.Slice(top, func(i, j int) bool {
+		return top[i].Count > top[j].Count
+	})
+	if len(top) > k {
+		top = top[:k]
+	}
+	return top
+}
+
+// Clear removes all counters.
+func (s *SpaceSaving[K]) Clear() {
+	for k := range s.index {
+		delete(s.index, k)
+	}
+	s.counters.items = s.counters.items[:0]
+}
+
+// counterHeap is a min-heap of counters that keeps the positions of the keys up to date.
+type counterHeap[K comparable] struct {
+	items []Counter[K]
+	index map[K]int
+}
+
+func (h *counterHeap[K]) Len() int {
+	return len(h.items)
+}
+
+func (h *counterHeap[K]) Less(i, j int) bool {
+	return h.items[i].Count < h.items[j].Count
+}
+
+func (h *counterHeap[K]) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.index[h.items[i].Key] = i
+	h.index[h.items[j].Key] = j
+}
+
+func (h *counterHeap[K]) Push(x any) {
+	c := x.(Counter[K])
+	h.index[c.Key] = len(h.items)
+	h.items = append(h.items, c)
+}
+
+func (h *counterHeap[K]) Pop() any {
+	n := len(h.items)
+	c := h.items[n-1]
+	h.items = h.items[:n-1]
+	delete(h.index, c.Key)
+	return c
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topk
+
+import (
+	"testing"
+)
+
+func TestSpaceSaving(t *testing.T) {
+	s := New[int](3)
+	// key i occurs 10*i times, noise keys occur once.
+	for i := 1; i <= 5; i++ {
+		for j := 0; j < 10*i; j++ {
+			s.Add(i)
+			if j%5 == 0 {
+				s.Add(100 + 10*i + j)
+			}
+		}
+	}
+
+	top := s.Top(2)
+	if len(top) != 2 || top[0].Key != 5 || top[1].Key != 4 {
+		t.Fatalf("got unexpected top keys: %+v", top)
+	}
+	for _, c := range top {
+		if trueCount := uint64(10 * c.Key); c.Count < trueCount || c.Count-c.Error > trueCount {
+			t.Fatalf("true count %d of key %d should be in [%d, %d]", trueCount, c.Key, c.Count-c.Error, c.Count)
+		}
+	}
+	if len(s.Top(10)) != 3 {
+		t.Fatalf("at most 3 keys should be tracked, but got %+v", s.Top(10))
+	}
+
+	s.Clear()
+	if len(s.Top(10)) != 0 {
+		t.Fatalf("counters should be cleared, but got %+v", s.Top(10))
+	}
+	s.Add(1)
+	if top := s.Top(1); len(top) != 1 || top[0] != (Counter[int]{Key: 1, Count: 1}) {
+		t.Fatalf("got unexpected top keys after clear: %+v", top)
+	}
+}
@@ -24,16 +24,23 @@ var (
 	// We need this package because time.Now() is slower, allocates memory,
 	// and we don't need a more precise time for the expiry time (and most other operations).
 	now uint32
+	// startTimeUnix is the unix time in seconds at which the timer was started.
+	startTimeUnix int64
+	// backwardJumps is the number of times the wall clock has gone backwards.
+	backwardJumps uint64
+
+	// lazy is 1 while there are only lazy instances, so Now reads the wall clock itself.
+	lazy int32
 
 	mutex         sync.Mutex
 	countInstance int
+	countTimer    int
 	done          chan struct{}
 )
 
 func startTimer() {
 	done = make(chan struct{})
-	startTime := time.Now().Unix()
-	atomic.StoreUint32(&now, uint32(0))
+	startTime := atomic.LoadInt64(&startTimeUnix)
 
 	go func() {
 		ticker := time.NewTicker(time.Second)
@@ -41,7 +48,13 @@ func startTimer() {
 		for {
 			select {
 			case t := <-ticker.C:
-				atomic.StoreUint32(&now, uint32(t.Unix()-startTime))
+				elapsed := t.Unix() - startTime
+				if elapsed < int64(atomic.LoadUint32(&now)) {
+					// the time must not go backwards, otherwise items would expire too late or too early.
+					atomic.AddUint64(&backwardJumps, 1)
+					continue
+				}
+				atomic.StoreUint32(&now, uint32(elapsed))
 			case <-done:
 				return
 			}
@@ -51,29 +64,96 @@ func startTimer() {
 
 // Start should be called when the cache instance is created to initialize the timer.
 func Start() {
+	start(true)
+}
+
+// StartLazy initializes the timer without the background goroutine.
+// While there are no instances started by Start, Now reads the wall clock on every call.
+func StartLazy() {
+	start(false)
+}
+
+func start(withTimer bool) {
 	mutex.Lock()
 	defer mutex.Unlock()
 
 	if countInstance == 0 {
-		startTimer()
+		atomic.StoreInt64(&startTimeUnix, time.Now().Unix())
+		atomic.StoreUint32(&now, uint32(0))
 	}
-
 	countInstance++
+
+	if withTimer {
+		if countTimer == 0 {
+			startTimer()
+		}
+		countTimer++
+	}
+	updateLazy()
 }
 
 // Stop should be called when closing and stopping the cache instance to stop the timer.
 func Stop() {
+	stop(true)
+}
+
+// StopLazy should be called when closing the cache instance started by StartLazy.
+func StopLazy() {
+	stop(false)
+}
+
+func stop(withTimer bool) {
 	mutex.Lock()
 	defer mutex.Unlock()
 
 	countInstance--
-	if countInstance == 0 {
-		done <- struct{}{}
-		close(done)
+	if withTimer {
+		countTimer--
+		if countTimer == 0 {
+			done <- struct{}{}
+			close(done)
+		}
+	}
+	updateLazy()
+}
+
+func updateLazy() {
+	if countInstance > 0 && countTimer == 0 {
+		atomic.StoreInt32(&lazy, 1)
+		return
 	}
+	atomic.StoreInt32(&lazy, 0)
 }
 
 // Now returns time as a Unix time, the number of seconds elapsed since program start.
 func Now() uint32 {
+	if atomic.LoadInt32(&lazy) == 1 {
+		return refresh()
+	}
 	return atomic.LoadUint32(&now)
 }
+
+// refresh advances the time by the wall clock, it never goes backwards.
+func refresh() uint32 {
+	elapsed := time.Now().Unix() - atomic.LoadInt64(&startTimeUnix)
+	for {
+		current := atomic.LoadUint32(&now)
+		if elapsed <= int64(current) {
+			return current
+		}
+		if atomic.CompareAndSwapUint32(&now, current, uint32(elapsed)) {
+			return uint32(elapsed)
+		}
+	}
+}
+
+// BackwardJumps returns the number of times the wall clock has gone backwards.
+// The time returned by Now doesn't go backwards in this case, it stops until the wall clock catches up.
+func BackwardJumps() uint64 {
+	return atomic.LoadUint64(&backwardJumps)
+}
+
+// StartTime returns the unix time in seconds at which the timer was started.
+func StartTime() int64 {
+	return atomic.LoadInt64(&startTimeUnix)
+}
@@ -42,3 +42,14 @@ func TestNow(t *testing.T) {
 		t.Fatal("timer should have stopped")
 	}
 }
+
+func TestNow_Lazy(t *testing.T) {
+	StartLazy()
+	defer StopLazy()
+
+	start := Now()
+	time.Sleep(2 * time.Second)
+	if got := Now(); got-start < 1 {
+		t.Fatalf("lazy time should advance without the timer; got %d; start %d", got, start)
+	}
+}
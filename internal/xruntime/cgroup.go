@@ -0,0 +1,112 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xruntime
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupCPULimit returns the CPU limit of the current process rounded up to a whole CPU
+// or zero if the process isn't limited. root is the root of the file system.
+//
+// Both cgroup v2 (cpu.max) and v1 (cpu.cfs_quota_us and cpu.cfs_period_us) are supported.
+func cgroupCPULimit(root string) uint32 {
+	f, err := os.Open(filepath.Join(root, "proc", "self", "cgroup"))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		if parts[0] == "0" && parts[1] == "" {
+			if limit := cgroupV2CPULimit(filepath.Join(root, "sys", "fs", "cgroup"), parts[2]); limit > 0 {
+				return limit
+			}
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller != "cpu" {
+				continue
+			}
+			if limit := cgroupV1CPULimit(filepath.Join(root, "sys", "fs", "cgroup", parts[1]), parts[2]); limit > 0 {
+				return limit
+			}
+			if limit := cgroupV1CPULimit(filepath.Join(root, "sys", "fs", "cgroup", "cpu"), parts[2]); limit > 0 {
+				return limit
+			}
+		}
+	}
+	return 0
+}
+
+// cgroupV2CPULimit reads cpu.max from the cgroup directory or, if it is not mounted in a container,
+// from the root of the cgroup file system.
+func cgroupV2CPULimit(mount, path string) uint32 {
+	for _, dir := range []string{filepath.Join(mount, path), mount} {
+		data, err := os.ReadFile(filepath.Join(dir, "cpu.max"))
+		if err != nil {
+			continue
+		}
+		// $MAX $PERIOD, where $MAX is "max" if there is no limit.
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0
+		}
+		return cpuQuota(fields[0], fields[1])
+	}
+	return 0
+}
+
+// cgroupV1CPULimit reads the cfs quota and period from the cgroup directory or, if it is not mounted in a container,
+// from the root of the controller hierarchy.
+func cgroupV1CPULimit(mount, path string) uint32 {
+	for _, dir := range []string{filepath.Join(mount, path), mount} {
+		quota, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_quota_us"))
+		if err != nil {
+			continue
+		}
+		period, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_period_us"))
+		if err != nil {
+			continue
+		}
+		// the quota is -1 if there is no limit.
+		return cpuQuota(string(bytes.TrimSpace(quota)), string(bytes.TrimSpace(period)))
+	}
+	return 0
+}
+
+func cpuQuota(quota, period string) uint32 {
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil || q <= 0 {
+		return 0
+	}
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil || p <= 0 {
+		return 0
+	}
+	return uint32((q + p - 1) / p)
+}
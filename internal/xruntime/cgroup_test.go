@@ -0,0 +1,104 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xruntime
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCgroupCPULimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  uint32
+	}{
+		{
+			name: "v2",
+			files: map[string]string{
+				"proc/self/cgroup":          "0::/pod\n",
+				"sys/fs/cgroup/pod/cpu.max": "150000 100000\n",
+			},
+			want: 2,
+		},
+		{
+			name: "v2 without limit",
+			files: map[string]string{
+				"proc/self/cgroup":      "0::/\n",
+				"sys/fs/cgroup/cpu.max": "max 100000\n",
+			},
+			want: 0,
+		},
+		{
+			name: "v1",
+			files: map[string]string{
+				"proc/self/cgroup": "2:cpuacct:/\n1:cpu,cpuacct:/pod\n",
+				"sys/fs/cgroup/cpu,cpuacct/pod/cpu.cfs_quota_us":  "400000\n",
+				"sys/fs/cgroup/cpu,cpuacct/pod/cpu.cfs_period_us": "100000\n",
+			},
+			want: 4,
+		},
+		{
+			name: "v1 without limit",
+			files: map[string]string{
+				"proc/self/cgroup":                    "1:cpu:/\n",
+				"sys/fs/cgroup/cpu/cpu.cfs_quota_us":  "-1\n",
+				"sys/fs/cgroup/cpu/cpu.cfs_period_us": "100000\n",
+			},
+			want: 0,
+		},
+		{
+			name:  "no cgroup",
+			files: map[string]string{},
+			want:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for path, data := range tt.files {
+				writeFile(t, filepath.Join(root, path), data)
+			}
+			if got := cgroupCPULimit(root); got != tt.want {
+				t.Fatalf("cgroupCPULimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetParallelism(t *testing.T) {
+	defer SetParallelism(0)
+
+	SetParallelism(3)
+	if p := Parallelism(); p != 3 {
+		t.Fatalf("parallelism should be overridden to 3, but got %d", p)
+	}
+
+	SetParallelism(0)
+	if p := Parallelism(); p == 0 {
+		t.Fatal("parallelism should be detected")
+	}
+}
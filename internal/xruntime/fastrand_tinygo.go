@@ -0,0 +1,32 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build tinygo
+
+package xruntime
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// TinyGo doesn't provide runtime.fastrand, so it is replaced with wyrand.
+var fastrandState uint64
+
+// Fastrand returns a pseudo-random number.
+func Fastrand() uint32 {
+	s := atomic.AddUint64(&fastrandState, 0xa0761d6478bd642f)
+	hi, lo := bits.Mul64(s, s^0xe7037ed1a0b428db)
+	return uint32(hi ^ lo)
+}
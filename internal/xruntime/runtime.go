@@ -16,7 +16,8 @@ package xruntime
 
 import (
 	"runtime"
-	_ "unsafe"
+	"sync"
+	"sync/atomic"
 )
 
 const (
@@ -24,16 +25,38 @@ const (
 	CacheLineSize = 64
 )
 
+var (
+	parallelismOverride atomic.Uint32
+
+	cpuLimitOnce sync.Once
+	cpuLimit     uint32
+)
+
 // Parallelism returns the maximum possible number of concurrently running goroutines.
+//
+// It accounts for the cgroup CPU quota, so a container limited to 2 CPUs on a 64-core node gets 2.
 func Parallelism() uint32 {
+	if p := parallelismOverride.Load(); p > 0 {
+		return p
+	}
+
 	maxProcs := uint32(runtime.GOMAXPROCS(0))
 	numCPU := uint32(runtime.NumCPU())
-	if maxProcs < numCPU {
-		return maxProcs
+	p := numCPU
+	if maxProcs < p {
+		p = maxProcs
+	}
+
+	cpuLimitOnce.Do(func() {
+		cpuLimit = cgroupCPULimit("/")
+	})
+	if cpuLimit > 0 && cpuLimit < p {
+		p = cpuLimit
 	}
-	return numCPU
+	return p
 }
 
-//go:noescape
-//go:linkname Fastrand runtime.fastrand
-func Fastrand() uint32
+// SetParallelism overrides the result of Parallelism, zero restores the detection.
+func SetParallelism(p uint32) {
+	parallelismOverride.Store(p)
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/maypok86/otter/internal/core"
+	"github.com/maypok86/otter/internal/node"
+)
+
+// ErrFrozen means that the cache has been frozen by Freeze, so the mutations can't be applied.
+var ErrFrozen = errors.New("cache is frozen")
+
+type journalOp uint8
+
+const (
+	journalSet journalOp = iota + 1
+	journalDelete
+	// journalClear is written by every Clear, so the replay removes the items set before it.
+	journalClear
+)
+
+// journalRecord is a single mutation written to the journal.
+type journalRecord[K comparable, V any] struct {
+	Op    journalOp
+	Key   K
+	Value V
+	// Time is the time of the mutation in unix nanoseconds.
+	Time int64
+	// Expiration is the expiration time of the item in unix seconds or 0 if the item doesn't expire.
+	Expiration int64
+	// Sequence is the write sequence number of the set item or of the deleted one.
+	// The records are written after the writes, so the concurrent writes of the same key can be written
+	// out of order, and the sequence numbers restore it. Zero means that the order is unknown.
+	Sequence uint64
+	// Policy is the state of the item in the eviction policy. It is written only to snapshots.
+	Policy *journalPolicy
+}
+
+// journalVersion is the latest replayed write of a key.
+type journalVersion struct {
+	sequence uint64
+	deleted  bool
+}
+
+// isStale returns true if the record is older than the latest replayed write of its key.
+// The set and the delete of the same item have the same sequence number, and the delete goes after the set.
+func (v journalVersion) isStale(sequence uint64, deleted bool) bool {
+	if sequence != v.sequence {
+		return sequence < v.sequence
+	}
+	return v.deleted || !deleted
+}
+
+// journalPolicy is the state of an item in the eviction policy, so a restored cache doesn't have to re-learn it.
+type journalPolicy struct {
+	Frequency uint8
+	Main      bool
+}
+
+type journal[K comparable, V any] struct {
+	mutex   sync.Mutex
+	encoder *gob.Encoder
+}
+
+func newJournal[K comparable, V any](w io.Writer) *journal[K, V] {
+	return &journal[K, V]{
+		encoder: gob.NewEncoder(w),
+	}
+}
+
+func (j *journal[K, V]) emit(kind core.EventKind, n *node.Node[K, V]) bool {
+	r, ok := newJournalRecord(kind, n)
+	if !ok {
+		// evictions and expirations are local decisions of every cache.
+		return true
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.encoder.Encode(r) == nil
+}
+
+// clear writes the record of Clear.
+func (j *journal[K, V]) clear() {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	_ = j.encoder.Encode(journalRecord[K, V]{
+		Op:   journalClear,
+		Time: time.Now().UnixNano(),
+	})
+}
+
+// reset makes the journal write to w starting with a new gob stream.
+func (j *journal[K, V]) reset(w io.Writer) {
+	j.encoder = gob.NewEncoder(w)
+}
+
+func newJournalRecord[K comparable, V any](kind core.EventKind, n *node.Node[K, V]) (journalRecord[K, V], bool) {
+	var r journalRecord[K, V]
+	switch kind {
+	case core.InsertEvent, core.UpdateEvent:
+		e := newEntry(n)
+		r = journalRecord[K, V]{
+			Op:         journalSet,
+			Key:        e.Key(),
+			Value:      e.Value(),
+			Expiration: e.Expiration(),
+		}
+	case core.DeleteEvent:
+		r = journalRecord[K, V]{
+			Op:  journalDelete,
+			Key: n.Key(),
+		}
+	default:
+		// the items removed by Clear are covered by its own record.
+		return r, false
+	}
+	r.Time = time.Now().UnixNano()
+	r.Sequence = n.Sequence()
+	return r, true
+}
+
+// ReplayJournal applies the mutations from the journal written by a cache built with Builder.Journal.
+//
+// Items that have already expired are skipped, the other items keep their original expiration time.
+// The cache's own eviction policy still applies, so the replayed items can be evicted.
+// Items of the snapshots written by Builder.WAL also keep their frequency and queue in the eviction policy.
+//
+// The concurrent writes of the same key can be written to the journal out of order,
+// so the records older than the already replayed write of their key are skipped.
+//
+// If the cache is built with a journal, then the replayed mutations are written to it.
+func (bs baseCache[K, V]) ReplayJournal(r io.Reader) error {
+	if bs.core().IsFrozen() {
+		return ErrFrozen
+	}
+
+	decoder := gob.NewDecoder(r)
+	latest := make(map[K]journalVersion)
+	for {
+		var record journalRecord[K, V]
+		if err := decoder.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("otter: replay journal: %w", err)
+		}
+
+		if record.Sequence != 0 {
+			deleted := record.Op == journalDelete
+			if v, ok := latest[record.Key]; ok && v.isStale(record.Sequence, deleted) {
+				continue
+			}
+			latest[record.Key] = journalVersion{sequence: record.Sequence, deleted: deleted}
+		}
+
+		switch record.Op {
+		case journalSet:
+			bs.replaySet(record)
+		case journalDelete:
+			bs.core().Delete(record.Key)
+		case journalClear:
+			bs.Clear()
+			latest = make(map[K]journalVersion)
+		default:
+			return fmt.Errorf("otter: replay journal: unknown operation %d", record.Op)
+		}
+	}
+}
+
+func (bs baseCache[K, V]) replaySet(record journalRecord[K, V]) {
+	var ttl time.Duration
+	if record.Expiration != 0 && bs.core().WithExpiration() {
+		ttl = time.Duration(record.Expiration-time.Now().Unix()) * time.Second
+		if ttl <= 0 {
+			// the latest value has already expired.
+			bs.core().Delete(record.Key)
+			return
+		}
+	}
+
+	switch {
+	case record.Policy != nil:
+		bs.core().Restore(record.Key, record.Value, ttl, record.Policy.Frequency, record.Policy.Main)
+	case ttl == 0:
+		bs.core().Set(record.Key, record.Value)
+	default:
+		bs.core().SetWithTTL(record.Key, record.Value, ttl)
+	}
+}
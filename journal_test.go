@@ -0,0 +1,202 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache_Journal(t *testing.T) {
+	const size = 100
+
+	var buf bytes.Buffer
+	c, err := MustBuilder[int, int](size).WithVariableTTL().Journal(&buf).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+
+	for i := 0; i < size; i++ {
+		c.Set(i, i, time.Hour)
+	}
+	for i := 0; i < size; i += 2 {
+		c.Delete(i)
+	}
+	c.Set(1, 100, time.Hour)
+	c.Close()
+
+	replayed, err := MustBuilder[int, int](size).WithVariableTTL().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer replayed.Close()
+
+	if err := replayed.ReplayJournal(&buf); err != nil {
+		t.Fatalf("failed to replay journal: %v", err)
+	}
+	if replayed.Size() != size/2 {
+		t.Fatalf("replayed.Size() = %d, want = %d", replayed.Size(), size/2)
+	}
+	for i := 0; i < size; i++ {
+		v, ok := replayed.Get(i)
+		switch {
+		case i%2 == 0 && ok:
+			t.Fatalf("deleted key %d should not be replayed", i)
+		case i%2 == 1 && !ok:
+			t.Fatalf("key %d should be replayed", i)
+		case i == 1 && v != 100:
+			t.Fatalf("the latest value of key 1 should be replayed, but got %d", v)
+		}
+	}
+	e, ok := replayed.GetEntry(3)
+	if !ok || e.TTL() <= 59*time.Minute {
+		t.Fatalf("replayed item should keep its expiration time, but got %v", e.TTL())
+	}
+}
+
+func TestCache_JournalConcurrentWrites(t *testing.T) {
+	const (
+		keys       = 2
+		goroutines = 8
+		writes     = 1000
+	)
+
+	var buf bytes.Buffer
+	// the slow writer makes the writers queue up for the journal, so their records are reordered.
+	c, err := MustBuilder[int, int](100).Journal(yieldingWriter{w: &buf}).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				key := i % keys
+				if (i+g)%5 == 0 {
+					c.Delete(key)
+				} else {
+					c.Set(key, g*writes+i)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	replayed, err := MustBuilder[int, int](100).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer replayed.Close()
+
+	if err := replayed.ReplayJournal(&buf); err != nil {
+		t.Fatalf("failed to replay journal: %v", err)
+	}
+	for key := 0; key < keys; key++ {
+		want, wantOK := c.Get(key)
+		got, ok := replayed.Get(key)
+		if got != want || ok != wantOK {
+			t.Fatalf("key %d: replayed = %d, %v, want = %d, %v", key, got, ok, want, wantOK)
+		}
+	}
+	c.Close()
+}
+
+func TestCache_ReplayJournalOutOfOrder(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := gob.NewEncoder(&buf)
+	records := []journalRecord[int, int]{
+		{Op: journalSet, Key: 1, Value: 2, Sequence: 2},
+		{Op: journalSet, Key: 1, Value: 1, Sequence: 1},
+		{Op: journalDelete, Key: 2, Sequence: 3},
+		{Op: journalSet, Key: 2, Value: 3, Sequence: 3},
+		{Op: journalDelete, Key: 3, Sequence: 4},
+		{Op: journalSet, Key: 3, Value: 5, Sequence: 5},
+	}
+	for _, r := range records {
+		if err := encoder.Encode(r); err != nil {
+			t.Fatalf("failed to encode record: %v", err)
+		}
+	}
+
+	c, err := MustBuilder[int, int](10).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.ReplayJournal(&buf); err != nil {
+		t.Fatalf("failed to replay journal: %v", err)
+	}
+	if v, ok := c.Get(1); !ok || v != 2 {
+		t.Fatalf("the set with the latest sequence should win, but got %d, %v", v, ok)
+	}
+	if c.Has(2) {
+		t.Fatal("the delete of an item should win over its set")
+	}
+	if v, ok := c.Get(3); !ok || v != 5 {
+		t.Fatalf("the set after the delete should be replayed, but got %d, %v", v, ok)
+	}
+}
+
+type yieldingWriter struct {
+	w io.Writer
+}
+
+func (w yieldingWriter) Write(p []byte) (int, error) {
+	time.Sleep(time.Microsecond)
+	return w.w.Write(p)
+}
+
+func TestCache_ReplayJournalExpired(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := gob.NewEncoder(&buf)
+	records := []journalRecord[int, int]{
+		{Op: journalSet, Key: 1, Value: 1, Expiration: time.Now().Add(time.Hour).Unix()},
+		{Op: journalSet, Key: 1, Value: 2, Expiration: time.Now().Add(-time.Hour).Unix()},
+		{Op: journalSet, Key: 2, Value: 2},
+	}
+	for _, r := range records {
+		if err := encoder.Encode(r); err != nil {
+			t.Fatalf("failed to encode record: %v", err)
+		}
+	}
+
+	c, err := MustBuilder[int, int](10).WithTTL(time.Hour).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.ReplayJournal(&buf); err != nil {
+		t.Fatalf("failed to replay journal: %v", err)
+	}
+	if c.Has(1) {
+		t.Fatal("expired item should not be replayed")
+	}
+	if !c.Has(2) {
+		t.Fatal("item without expiration should be replayed")
+	}
+
+	if err := c.ReplayJournal(bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Fatal("replay of a corrupted journal should fail")
+	}
+}
@@ -0,0 +1,560 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNilLoader means that a nil loader has been passed to the NewLoadingCache.
+	ErrNilLoader = errors.New("loader should not be nil")
+	// ErrIllegalRefreshAhead means that invalid parameters have been passed to the WithRefreshAhead.
+	ErrIllegalRefreshAhead = errors.New("refresh ahead window should be positive and min frequency should be in [0, 3]")
+	// ErrIllegalErrorTTL means that a non-positive ttl has been passed to the WithCacheErrorsFor.
+	ErrIllegalErrorTTL = errors.New("error ttl should be positive")
+	// ErrIllegalLoadRetry means that invalid parameters have been passed to the WithLoadRetry.
+	ErrIllegalLoadRetry = errors.New("load attempts should be positive and backoff should not be negative")
+	// ErrIllegalLoadTimeout means that a non-positive timeout has been passed to the WithLoadTimeout.
+	ErrIllegalLoadTimeout = errors.New("load timeout should be positive")
+	// ErrIllegalBatchWindow means that an invalid window has been passed to the WithBatchWindow
+	// or the option has been used without a BulkLoader.
+	ErrIllegalBatchWindow = errors.New("batch window should be positive and used only with a bulk loader")
+	// ErrNotLoaded means that the BulkLoader has not returned a value for the requested key.
+	ErrNotLoaded = errors.New("value has not been loaded")
+	// ErrNilTracer means that a nil Tracer has been passed to the WithTracing.
+	ErrNilTracer = errors.New("tracer should not be nil")
+)
+
+// PanicError is returned by the LoadingCache when the Loader panics.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the goroutine at the time of the panic.
+	Stack []byte
+}
+
+func newPanicError(value any) *PanicError {
+	return &PanicError{
+		Value: value,
+		Stack: debug.Stack(),
+	}
+}
+
+// Error implements the error interface.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("loader panicked: %v\n\n%s", e.Value, e.Stack)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// Loader computes or retrieves the value corresponding to the key.
+type Loader[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// LoadingOption configures a LoadingCache created by NewLoadingCache.
+//
+// Options are immutable, so they can be reused across caches and shared between goroutines.
+type LoadingOption func(o *loadingOptions)
+
+type loadingOptions struct {
+	refreshWindow       time.Duration
+	refreshMinFrequency int
+	errorTTL            time.Duration
+	withErrorTTL        bool
+	loadAttempts        int
+	loadBackoff         time.Duration
+	loadTimeout         time.Duration
+	withLoadTimeout     bool
+	batchWindow         time.Duration
+	tracer              Tracer
+	withTracing         bool
+	remote              any
+	withRemote          bool
+}
+
+func (o *loadingOptions) validate() error {
+	if o.refreshWindow < 0 || o.refreshMinFrequency < 0 || o.refreshMinFrequency > maxFrequency {
+		return newConfigError("WithRefreshAhead", []any{o.refreshWindow, o.refreshMinFrequency}, ErrIllegalRefreshAhead)
+	}
+	if o.withErrorTTL && o.errorTTL <= 0 {
+		return newConfigError("WithCacheErrorsFor", o.errorTTL, ErrIllegalErrorTTL)
+	}
+	if o.loadAttempts < 0 || o.loadBackoff < 0 {
+		return newConfigError("WithLoadRetry", []any{o.loadAttempts, o.loadBackoff}, ErrIllegalLoadRetry)
+	}
+	if o.withLoadTimeout && o.loadTimeout <= 0 {
+		return newConfigError("WithLoadTimeout", o.loadTimeout, ErrIllegalLoadTimeout)
+	}
+	if o.batchWindow < 0 {
+		return newConfigError("WithBatchWindow", o.batchWindow, ErrIllegalBatchWindow)
+	}
+	if o.withTracing && o.tracer == nil {
+		return newConfigError("WithTracing", nil, ErrNilTracer)
+	}
+	return nil
+}
+
+// maxFrequency is the maximum access frequency of an item tracked by the eviction policy.
+const maxFrequency = 3
+
+// WithRefreshAhead makes the cache reload hot items in the background before they expire,
+// so they are always warm. An item is reloaded when it is read during the last window of its lifetime
+// and its access frequency estimated by the eviction policy is at least minFrequency.
+// The frequency is in the range [0, 3].
+//
+// While the item is being reloaded, the old value is served. If the reload fails, the old value is kept.
+func WithRefreshAhead(window time.Duration, minFrequency int) LoadingOption {
+	return func(o *loadingOptions) {
+		o.refreshWindow = window
+		o.refreshMinFrequency = minFrequency
+		if window == 0 {
+			// zero window would silently disable the refresh.
+			o.refreshWindow = -1
+		}
+	}
+}
+
+// WithCacheErrorsFor makes the cache remember loader errors for the given ttl, so Get returns the cached error
+// instead of calling the Loader again and a failing backend isn't hammered by retry storms.
+// The ttl is rounded up to seconds. The number of cached errors is limited by the capacity of the cache.
+//
+// Errors of background reloads are not cached, since the old value is kept.
+// Neither are context.Canceled and context.DeadlineExceeded, since they don't tell anything about the backend.
+func WithCacheErrorsFor(ttl time.Duration) LoadingOption {
+	return func(o *loadingOptions) {
+		o.errorTTL = ttl
+		o.withErrorTTL = true
+	}
+}
+
+// WithLoadRetry makes the cache retry failed loads up to the given number of attempts in total.
+// The delay before the next attempt starts with backoff and doubles after each failure.
+//
+// Retries are made inside the coalesced load, so concurrent callers wait for a single retry loop.
+// Panics of the Loader are not retried, and retrying stops once the context of the load is done.
+func WithLoadRetry(attempts int, backoff time.Duration) LoadingOption {
+	return func(o *loadingOptions) {
+		o.loadAttempts = attempts
+		o.loadBackoff = backoff
+		if attempts == 0 {
+			// zero attempts would silently disable the loads.
+			o.loadAttempts = -1
+		}
+	}
+}
+
+// WithLoadTimeout bounds the duration of a load, including its retries.
+//
+// A load is shared by all the callers waiting for the key, so it isn't canceled with their contexts:
+// a caller whose context is done stops waiting, and the load goes on for the others.
+// By default, a load isn't bounded.
+func WithLoadTimeout(timeout time.Duration) LoadingOption {
+	return func(o *loadingOptions) {
+		o.loadTimeout = timeout
+		o.withLoadTimeout = true
+	}
+}
+
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// LoadingCache is a cache that loads missing values with the Loader.
+// Concurrent loads of the same key are coalesced into a single call of the Loader.
+type LoadingCache[K comparable, V any] struct {
+	cache   Interface[K, V]
+	errors  *Cache[K, error]
+	loader  Loader[K, V]
+	options loadingOptions
+	mutex   sync.Mutex
+	calls   map[K]*call[V]
+	loads   sync.WaitGroup
+	tracer  *loadTracer[K]
+	remote  *remoteTier[K, V]
+}
+
+// NewLoadingCache creates a cache that loads missing values into the given cache with the loader.
+//
+// Loaded values are stored with the ttl configured when the cache was built.
+func NewLoadingCache[K comparable, V any](
+	cache Interface[K, V],
+	loader Loader[K, V],
+	opts ...LoadingOption,
+) (*LoadingCache[K, V], error) {
+	if loader == nil {
+		return nil, ErrNilLoader
+	}
+
+	o, err := applyLoadingOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if o.batchWindow != 0 {
+		return nil, ErrIllegalBatchWindow
+	}
+
+	return newLoadingCache(cache, loader, o)
+}
+
+func applyLoadingOptions(opts []LoadingOption) (loadingOptions, error) {
+	var o loadingOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.validate(); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func newLoadingCache[K comparable, V any](
+	cache Interface[K, V],
+	loader Loader[K, V],
+	o loadingOptions,
+) (*LoadingCache[K, V], error) {
+	lc := &LoadingCache[K, V]{
+		cache:   cache,
+		loader:  loader,
+		options: o,
+		calls:   make(map[K]*call[V]),
+	}
+	if o.withErrorTTL {
+		errs, err := MustBuilder[K, error](cache.Capacity()).WithTTL(o.errorTTL).Build()
+		if err != nil {
+			return nil, err
+		}
+		lc.errors = &errs
+	}
+	if o.withTracing {
+		lc.tracer = newLoadTracer[K](o.tracer)
+	}
+	if o.withRemote {
+		remote, err := newRemoteTier[K, V](o)
+		if err != nil {
+			return nil, err
+		}
+		lc.remote = remote
+	}
+	return lc, nil
+}
+
+// Cache returns the underlying cache.
+func (lc *LoadingCache[K, V]) Cache() Interface[K, V] {
+	return lc.cache
+}
+
+// Get returns the value associated with the key in this cache.
+// If the value is missing, it is loaded with the Loader and stored in the cache.
+//
+// Concurrent loads of the same key are coalesced into a single call of the Loader, and all callers wait for the result.
+// The load isn't canceled with the context of any caller, only bounded by WithLoadTimeout: if the context
+// of a caller is done, then Get returns the context's error, but the load goes on for the others.
+//
+// If the Loader panics, the panic is recovered and all callers get a *PanicError.
+//
+// If the cache has been built with AllowStale, an expired item is served while it is being reloaded in the background.
+func (lc *LoadingCache[K, V]) Get(ctx context.Context, key K) (V, error) {
+	if lc.tracer == nil {
+		v, _, err := lc.get(ctx, key)
+		return v, err
+	}
+
+	ctx, span := lc.tracer.start(ctx, "otter.Get", key)
+	v, hit, err := lc.get(ctx, key)
+	span.SetHit(hit)
+	span.End(err)
+	return v, err
+}
+
+func (lc *LoadingCache[K, V]) get(ctx context.Context, key K) (value V, hit bool, err error) {
+	if sc, ok := lc.cache.(interface {
+		getStale(key K) (Entry[K, V], bool, bool)
+	}); ok {
+		if e, stale, ok := sc.getStale(key); ok {
+			if stale {
+				lc.refresh(ctx, key)
+			} else if lc.options.refreshWindow > 0 {
+				lc.maybeRefresh(ctx, e)
+			}
+			return e.Value(), true, nil
+		}
+	} else if lc.options.refreshWindow > 0 {
+		if e, ok := lc.cache.GetEntry(key); ok {
+			lc.maybeRefresh(ctx, e)
+			return e.Value(), true, nil
+		}
+	} else if v, ok := lc.cache.Get(key); ok {
+		return v, true, nil
+	}
+
+	if lc.errors != nil {
+		if err, ok := lc.errors.Get(key); ok {
+			return value, true, err
+		}
+	}
+
+	value, err = lc.load(ctx, key)
+	return value, false, err
+}
+
+func (lc *LoadingCache[K, V]) load(ctx context.Context, key K) (V, error) {
+	c, isOwner := lc.acquire(key)
+	if isOwner {
+		lc.loads.Add(1)
+		go func() {
+			defer lc.loads.Done()
+			lc.run(ctx, key, c, false)
+		}()
+	}
+
+	select {
+	case <-c.done:
+		return c.value, c.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// acquire returns the in-flight call for the key or registers a new one owned by the caller.
+func (lc *LoadingCache[K, V]) acquire(key K) (c *call[V], isOwner bool) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	if c, ok := lc.calls[key]; ok {
+		return c, false
+	}
+
+	c = &call[V]{done: make(chan struct{})}
+	lc.calls[key] = c
+	return c, true
+}
+
+// run loads the value of the call. The load is shared, so it is detached from the cancellation of ctx,
+// only its values are kept, so the load is traced as a part of the caller's trace.
+//
+// A reload skips the remote cache and its errors aren't cached, since the old value is kept.
+func (lc *LoadingCache[K, V]) run(ctx context.Context, key K, c *call[V], reload bool) {
+	defer func() {
+		lc.mutex.Lock()
+		delete(lc.calls, key)
+		lc.mutex.Unlock()
+		close(c.done)
+	}()
+
+	ctx = detachedContext{parent: ctx}
+	if lc.options.withLoadTimeout {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, lc.options.loadTimeout)
+		defer cancel()
+	}
+
+	if !reload && lc.remote != nil {
+		if value, ok := lc.remote.get(ctx, key); ok {
+			c.value = value
+			lc.cache.SetWithDefaultTTL(key, c.value)
+			return
+		}
+	}
+
+	c.value, c.err = lc.loadWithRetry(ctx, key)
+	if c.err == nil {
+		lc.cache.SetWithDefaultTTL(key, c.value)
+		if lc.errors != nil {
+			lc.errors.Delete(key)
+		}
+		if lc.remote != nil {
+			lc.remote.set(ctx, key, c.value)
+		}
+	} else if !reload && lc.errors != nil && !isContextError(c.err) {
+		lc.errors.Set(key, c.err)
+	}
+}
+
+// detachedContext keeps the values of the parent context, but is never canceled.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key any) any {
+	return c.parent.Value(key)
+}
+
+// isContextError reports whether err means that the load has been canceled or timed out
+// rather than failed in the backend.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (lc *LoadingCache[K, V]) loadWithRetry(ctx context.Context, key K) (V, error) {
+	value, err := lc.traceLoader(ctx, key)
+	backoff := lc.options.loadBackoff
+	for attempt := 1; attempt < lc.options.loadAttempts && err != nil; attempt++ {
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) {
+			break
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return value, err
+		case <-timer.C:
+		}
+		backoff *= 2
+
+		value, err = lc.traceLoader(ctx, key)
+	}
+	return value, err
+}
+
+func (lc *LoadingCache[K, V]) traceLoader(ctx context.Context, key K) (V, error) {
+	if lc.tracer == nil {
+		return lc.callLoader(ctx, key)
+	}
+
+	ctx, span := lc.tracer.start(ctx, "otter.Load", key)
+	value, err := lc.callLoader(ctx, key)
+	span.End(err)
+	return value, err
+}
+
+// callLoader calls the loader and turns its panic into a PanicError.
+func (lc *LoadingCache[K, V]) callLoader(ctx context.Context, key K) (value V, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var zero V
+			value = zero
+			err = newPanicError(r)
+		}
+	}()
+
+	return lc.loader(ctx, key)
+}
+
+func (lc *LoadingCache[K, V]) maybeRefresh(ctx context.Context, e Entry[K, V]) {
+	ttl := e.TTL()
+	if ttl < 0 || ttl > lc.options.refreshWindow {
+		return
+	}
+
+	if fc, ok := lc.cache.(interface{ frequency(key K) (uint8, bool) }); ok {
+		if frequency, ok := fc.frequency(e.Key()); !ok || int(frequency) < lc.options.refreshMinFrequency {
+			return
+		}
+	}
+
+	lc.refresh(ctx, e.Key())
+}
+
+// Refresh asynchronously reloads the value associated with the key with the Loader.
+// The old value is served until the reload completes, and if the reload fails, the old value is kept.
+//
+// If the value is already being loaded, then Refresh does nothing.
+func (lc *LoadingCache[K, V]) Refresh(key K) {
+	lc.refresh(context.Background(), key)
+}
+
+// Prefetch asynchronously loads the values associated with the keys that are likely to be requested soon.
+// Keys already present in the cache or being loaded are skipped, and Prefetch never blocks on the loads.
+//
+// With the WithBatchWindow option the prefetched keys are batched into bulk loads as usual.
+func (lc *LoadingCache[K, V]) Prefetch(keys []K) {
+	for _, key := range keys {
+		if lc.has(key) {
+			continue
+		}
+		if lc.errors != nil {
+			if _, ok := lc.errors.peek(key); ok {
+				continue
+			}
+		}
+		lc.refresh(context.Background(), key)
+	}
+}
+
+// has reports whether the key is present without recording the lookup in the statistics and the eviction policy,
+// since a prefetch isn't an access of the key.
+func (lc *LoadingCache[K, V]) has(key K) bool {
+	if pc, ok := lc.cache.(interface{ peek(key K) (V, bool) }); ok {
+		_, ok := pc.peek(key)
+		return ok
+	}
+	return lc.cache.Has(key)
+}
+
+// refresh reloads the value in the background if it isn't already being loaded.
+func (lc *LoadingCache[K, V]) refresh(ctx context.Context, key K) {
+	c, isOwner := lc.acquire(key)
+	if !isOwner {
+		return
+	}
+
+	lc.loads.Add(1)
+	go func() {
+		defer lc.loads.Done()
+		lc.run(ctx, key, c, true)
+	}()
+}
+
+// Invalidate deletes the value associated with the key from this cache and from the remote cache
+// configured by WithRemote, so the next Get calls the Loader.
+//
+// Returns the error of the remote cache.
+func (lc *LoadingCache[K, V]) Invalidate(ctx context.Context, key K) error {
+	lc.cache.Delete(key)
+	if lc.errors != nil {
+		lc.errors.Delete(key)
+	}
+	if lc.remote != nil {
+		return lc.remote.delete(ctx, key)
+	}
+	return nil
+}
+
+// Close waits for the loads and closes the underlying cache.
+func (lc *LoadingCache[K, V]) Close() {
+	lc.loads.Wait()
+	lc.cache.Close()
+	if lc.errors != nil {
+		lc.errors.Close()
+	}
+}
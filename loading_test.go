@@ -0,0 +1,448 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestLoadingCache(t *testing.T, loader Loader[int, int], opts ...LoadingOption) *LoadingCache[int, int] {
+	t.Helper()
+
+	c, err := MustBuilder[int, int](100).WithTTL(time.Hour).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	lc, err := NewLoadingCache[int, int](c, loader, opts...)
+	if err != nil {
+		t.Fatalf("can not create loading cache: %v", err)
+	}
+	return lc
+}
+
+func TestLoadingCache_Get(t *testing.T) {
+	var calls atomic.Int64
+	lc := newTestLoadingCache(t, func(ctx context.Context, key int) (int, error) {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		if key < 0 {
+			return 0, errors.New("negative key")
+		}
+		return key * 10, nil
+	})
+	defer lc.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := lc.Get(context.Background(), 1); err != nil || v != 10 {
+				t.Errorf("lc.Get(1) = %d/%v, want 10/nil", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("concurrent loads should be coalesced, but loader was called %d times", got)
+	}
+
+	if v, err := lc.Get(context.Background(), 1); err != nil || v != 10 || calls.Load() != 1 {
+		t.Fatalf("value should be served from the cache, but got %d/%v", v, err)
+	}
+
+	if _, err := lc.Get(context.Background(), -1); err == nil {
+		t.Fatal("loader error should be returned")
+	}
+	if lc.Cache().Has(-1) {
+		t.Fatal("failed load should not be cached")
+	}
+
+	// wait for the load started by another call.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lc.Get(context.Background(), 2)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := lc.Get(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("should fail with an error %v, but got %v", context.DeadlineExceeded, err)
+	}
+	<-done
+	if v, ok := lc.Cache().Get(2); !ok || v != 20 {
+		t.Fatalf("load should not be canceled, but got %d/%v", v, ok)
+	}
+}
+
+func TestLoadingCache_RefreshAhead(t *testing.T) {
+	var calls atomic.Int64
+	loader := func(ctx context.Context, key int) (int, error) {
+		return int(calls.Add(1)), nil
+	}
+
+	lc := newTestLoadingCache(t, loader, WithRefreshAhead(2*time.Hour, 0))
+	defer lc.Close()
+
+	if v, _ := lc.Get(context.Background(), 1); v != 1 {
+		t.Fatalf("got %d, want 1", v)
+	}
+	// the item is within the refresh window, so the old value is served and the reload is started.
+	if v, _ := lc.Get(context.Background(), 1); v != 1 {
+		t.Fatalf("old value should be served during the refresh, but got %d", v)
+	}
+	waitForValue(t, lc, 1, 2)
+
+	calls.Store(0)
+	cold := newTestLoadingCache(t, loader, WithRefreshAhead(2*time.Hour, 3))
+	defer cold.Close()
+
+	cold.Get(context.Background(), 1)
+	cold.Get(context.Background(), 1)
+	time.Sleep(10 * time.Millisecond)
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("cold item should not be refreshed, but loader was called %d times", got)
+	}
+}
+
+func TestLoadingCache_Refresh(t *testing.T) {
+	var (
+		calls atomic.Int64
+		fail  atomic.Bool
+	)
+	release := make(chan struct{})
+	lc := newTestLoadingCache(t, func(ctx context.Context, key int) (int, error) {
+		n := calls.Add(1)
+		if n > 1 {
+			<-release
+		}
+		if fail.Load() {
+			return 0, errors.New("backend is down")
+		}
+		return int(n), nil
+	})
+	defer lc.Close()
+
+	lc.Get(context.Background(), 1)
+	lc.Refresh(1)
+	// the old value is served while the reload is in flight.
+	if v, err := lc.Get(context.Background(), 1); err != nil || v != 1 {
+		t.Fatalf("lc.Get(1) = %d/%v, want 1/nil", v, err)
+	}
+	release <- struct{}{}
+	waitForValue(t, lc, 1, 2)
+
+	fail.Store(true)
+	lc.Refresh(1)
+	release <- struct{}{}
+	lc.loads.Wait()
+	if v, ok := lc.Cache().Get(1); !ok || v != 2 {
+		t.Fatalf("failed reload should keep the previous value, but got %d/%v", v, ok)
+	}
+}
+
+func TestLoadingCache_Prefetch(t *testing.T) {
+	var (
+		mutex sync.Mutex
+		calls = make(map[int]int)
+	)
+	release := make(chan struct{})
+	c, err := MustBuilder[int, int](100).WithTTL(time.Hour).CollectStats().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	lc, err := NewLoadingCache[int, int](c, func(ctx context.Context, key int) (int, error) {
+		mutex.Lock()
+		calls[key]++
+		mutex.Unlock()
+		<-release
+		return key, nil
+	})
+	if err != nil {
+		t.Fatalf("can not create loading cache: %v", err)
+	}
+	defer lc.Close()
+
+	lc.Cache().SetWithDefaultTTL(1, 1)
+	// the loads are blocked, so Prefetch must not wait for them.
+	lc.Prefetch([]int{1, 2, 2, 3})
+	lc.Prefetch([]int{2})
+	close(release)
+	lc.loads.Wait()
+
+	// prefetching isn't an access, so it must not skew the hit ratio or the eviction policy.
+	if s := c.Stats(); s.Hits() != 0 || s.Misses() != 0 {
+		t.Fatalf("prefetch should not be recorded, but got %d hits and %d misses", s.Hits(), s.Misses())
+	}
+	if frequency, ok := c.frequency(1); !ok || frequency != 0 {
+		t.Fatalf("prefetch should not update the eviction policy, but got frequency %d", frequency)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if calls[1] != 0 || calls[2] != 1 || calls[3] != 1 {
+		t.Fatalf("present keys should be skipped and in-flight loads deduplicated, but got calls %v", calls)
+	}
+	for _, k := range []int{2, 3} {
+		if v, ok := lc.Cache().Get(k); !ok || v != k {
+			t.Fatalf("prefetched key %d should be loaded, but got %d/%v", k, v, ok)
+		}
+	}
+}
+
+func TestLoadingCache_CacheErrorsFor(t *testing.T) {
+	var (
+		calls atomic.Int64
+		fail  atomic.Bool
+	)
+	errBackend := errors.New("backend is unavailable")
+	fail.Store(true)
+	lc := newTestLoadingCache(t, func(ctx context.Context, key int) (int, error) {
+		calls.Add(1)
+		if fail.Load() {
+			return 0, errBackend
+		}
+		return key, nil
+	}, WithCacheErrorsFor(time.Second))
+	defer lc.Close()
+
+	for i := 0; i < 10; i++ {
+		if _, err := lc.Get(context.Background(), 1); !errors.Is(err, errBackend) {
+			t.Fatalf("should fail with an error %v, but got %v", errBackend, err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("error should be cached, but loader was called %d times", got)
+	}
+
+	fail.Store(false)
+	time.Sleep(2500 * time.Millisecond)
+	if v, err := lc.Get(context.Background(), 1); err != nil || v != 1 {
+		t.Fatalf("lc.Get(1) = %d/%v, want 1/nil", v, err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("loader should be called after the error expired, but was called %d times", got)
+	}
+}
+
+func TestLoadingCache_OwnerCanceled(t *testing.T) {
+	var calls atomic.Int64
+	release := make(chan struct{})
+	lc := newTestLoadingCache(t, func(ctx context.Context, key int) (int, error) {
+		calls.Add(1)
+		select {
+		case <-release:
+			return key * 10, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}, WithCacheErrorsFor(time.Minute))
+	defer lc.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	owner := make(chan error, 1)
+	go func() {
+		_, err := lc.Get(ctx, 1)
+		owner <- err
+	}()
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-owner; !errors.Is(err, context.Canceled) {
+		t.Fatalf("should fail with an error %v, but got %v", context.Canceled, err)
+	}
+
+	// the load is shared, so it goes on after the owner is gone.
+	waiter := make(chan error, 1)
+	go func() {
+		v, err := lc.Get(context.Background(), 1)
+		if err == nil && v != 10 {
+			err = errors.New("unexpected value")
+		}
+		waiter <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if err := <-waiter; err != nil {
+		t.Fatalf("second caller should get the loaded value, but got %v", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("loader should be called once, but was called %d times", got)
+	}
+}
+
+func TestLoadingCache_ContextErrorsNotCached(t *testing.T) {
+	var calls atomic.Int64
+	lc := newTestLoadingCache(t, func(ctx context.Context, key int) (int, error) {
+		if calls.Add(1) == 1 {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		return key, nil
+	}, WithCacheErrorsFor(time.Minute), WithLoadTimeout(10*time.Millisecond))
+	defer lc.Close()
+
+	if _, err := lc.Get(context.Background(), 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("should fail with an error %v, but got %v", context.DeadlineExceeded, err)
+	}
+	if v, err := lc.Get(context.Background(), 1); err != nil || v != 1 {
+		t.Fatalf("timed out load should not be cached, but got %d/%v", v, err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("loader should be called twice, but was called %d times", got)
+	}
+}
+
+func TestLoadingCache_LoaderPanic(t *testing.T) {
+	errPanic := errors.New("boom")
+	var calls atomic.Int64
+	lc := newTestLoadingCache(t, func(ctx context.Context, key int) (int, error) {
+		if calls.Add(1) == 1 {
+			panic(errPanic)
+		}
+		return key, nil
+	})
+	defer lc.Close()
+
+	_, err := lc.Get(context.Background(), 1)
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || !errors.Is(err, errPanic) || len(panicErr.Stack) == 0 {
+		t.Fatalf("panic should be turned into an error, but got %v", err)
+	}
+
+	// the in-flight load should be cleaned up.
+	if v, err := lc.Get(context.Background(), 1); err != nil || v != 1 {
+		t.Fatalf("lc.Get(1) = %d/%v, want 1/nil", v, err)
+	}
+}
+
+func TestLoadingCache_LoadRetry(t *testing.T) {
+	errBackend := errors.New("backend is unavailable")
+	var calls atomic.Int64
+	lc := newTestLoadingCache(t, func(ctx context.Context, key int) (int, error) {
+		if calls.Add(1) < 3 {
+			return 0, errBackend
+		}
+		return key, nil
+	}, WithLoadRetry(3, 10*time.Millisecond))
+	defer lc.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := lc.Get(context.Background(), 1); err != nil || v != 1 {
+				t.Errorf("lc.Get(1) = %d/%v, want 1/nil", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("loader should be called 3 times, but was called %d times", got)
+	}
+
+	calls.Store(-10)
+	if _, err := lc.Get(context.Background(), 2); !errors.Is(err, errBackend) {
+		t.Fatalf("should fail with an error %v after all attempts, but got %v", errBackend, err)
+	}
+	if got := calls.Load(); got != -7 {
+		t.Fatalf("loader should be called 3 times, but was called %d times", got+10)
+	}
+}
+
+func TestLoadingCache_AllowStale(t *testing.T) {
+	c, err := MustBuilder[int, int](100).WithTTL(time.Second).AllowStale(time.Hour).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	var calls atomic.Int64
+	lc, err := NewLoadingCache[int, int](c, func(ctx context.Context, key int) (int, error) {
+		return int(calls.Add(1)), nil
+	})
+	if err != nil {
+		t.Fatalf("can not create loading cache: %v", err)
+	}
+	defer lc.Close()
+
+	if v, err := lc.Get(context.Background(), 1); err != nil || v != 1 {
+		t.Fatalf("lc.Get(1) = %d/%v, want 1/nil", v, err)
+	}
+
+	time.Sleep(2500 * time.Millisecond)
+	if c.Has(1) {
+		t.Fatal("stale item should not be visible to regular reads")
+	}
+	if v, err := lc.Get(context.Background(), 1); err != nil || v != 1 {
+		t.Fatalf("stale value should be served, but got %d/%v", v, err)
+	}
+	waitForValue(t, lc, 1, 2)
+
+	if _, err := MustBuilder[int, int](100).WithTTL(time.Second).AllowStale(0).Build(); !errors.Is(err, ErrIllegalTTL) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalTTL, err)
+	}
+}
+
+func waitForValue(t *testing.T, lc *LoadingCache[int, int], key, value int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if v, ok := lc.Cache().Get(key); ok && v == value {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("value of key %d should become %d", key, value)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNewLoadingCache_Errors(t *testing.T) {
+	c, err := MustBuilder[int, int](100).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := NewLoadingCache[int, int](c, nil); !errors.Is(err, ErrNilLoader) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrNilLoader, err)
+	}
+	loader := func(ctx context.Context, key int) (int, error) {
+		return key, nil
+	}
+	if _, err := NewLoadingCache[int, int](c, loader, WithRefreshAhead(0, 0)); !errors.Is(err, ErrIllegalRefreshAhead) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalRefreshAhead, err)
+	}
+	if _, err := NewLoadingCache[int, int](c, loader, WithRefreshAhead(time.Second, 4)); !errors.Is(err, ErrIllegalRefreshAhead) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalRefreshAhead, err)
+	}
+	if _, err := NewLoadingCache[int, int](c, loader, WithCacheErrorsFor(0)); !errors.Is(err, ErrIllegalErrorTTL) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalErrorTTL, err)
+	}
+	if _, err := NewLoadingCache[int, int](c, loader, WithLoadRetry(0, time.Second)); !errors.Is(err, ErrIllegalLoadRetry) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalLoadRetry, err)
+	}
+	if _, err := NewLoadingCache[int, int](c, loader, WithLoadTimeout(0)); !errors.Is(err, ErrIllegalLoadTimeout) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalLoadTimeout, err)
+	}
+}
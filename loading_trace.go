@@ -0,0 +1,64 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"context"
+
+	"github.com/dolthub/maphash"
+)
+
+// Tracer starts the spans of the LoadingCache operations, so backend calls made by the cache show up in traces.
+//
+// The ottertrace module implements it with OpenTelemetry, so otter itself doesn't depend on a tracing library.
+type Tracer interface {
+	// Start starts a span of the operation, "otter.Get" or "otter.Load", on the key with the given hash.
+	// The returned context carries the span, so the spans started by the Loader become its children.
+	Start(ctx context.Context, operation string, keyHash uint64) (context.Context, Span)
+}
+
+// Span is a span started by the Tracer.
+type Span interface {
+	// SetHit records whether the value was found in the cache. It is only called for "otter.Get".
+	SetHit(hit bool)
+	// End ends the span. A non-nil err means that the operation failed.
+	End(err error)
+}
+
+// WithTracing makes the cache start a span around each Get and each call of the Loader.
+//
+// Keys are passed to the tracer only as hashes, since they may contain sensitive data.
+func WithTracing(tracer Tracer) LoadingOption {
+	return func(o *loadingOptions) {
+		o.tracer = tracer
+		o.withTracing = true
+	}
+}
+
+type loadTracer[K comparable] struct {
+	tracer Tracer
+	hasher maphash.Hasher[K]
+}
+
+func newLoadTracer[K comparable](tracer Tracer) *loadTracer[K] {
+	return &loadTracer[K]{
+		tracer: tracer,
+		hasher: maphash.NewHasher[K](),
+	}
+}
+
+func (t *loadTracer[K]) start(ctx context.Context, operation string, key K) (context.Context, Span) {
+	return t.tracer.Start(ctx, operation, t.hasher.Hash(key))
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedSpan struct {
+	id        int
+	operation string
+	keyHash   uint64
+	parent    int
+	hit       bool
+	err       error
+	ended     bool
+}
+
+func (s *recordedSpan) SetHit(hit bool) {
+	s.hit = hit
+}
+
+func (s *recordedSpan) End(err error) {
+	s.err = err
+	s.ended = true
+}
+
+type spanKey struct{}
+
+type recordingTracer struct {
+	mutex sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, operation string, keyHash uint64) (context.Context, Span) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	s := &recordedSpan{
+		id:        len(t.spans) + 1,
+		operation: operation,
+		keyHash:   keyHash,
+	}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		s.parent = parent.id
+	}
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (t *recordingTracer) reset() []*recordedSpan {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	spans := t.spans
+	t.spans = nil
+	return spans
+}
+
+func TestLoadingCache_Tracing(t *testing.T) {
+	errBackend := errors.New("backend is unavailable")
+	tracer := &recordingTracer{}
+	lc := newTestLoadingCache(t, func(ctx context.Context, key int) (int, error) {
+		if key < 0 {
+			return 0, errBackend
+		}
+		return key, nil
+	}, WithTracing(tracer))
+	defer lc.Close()
+
+	lc.Get(context.Background(), 1)
+	spans := tracer.reset()
+	if len(spans) != 2 || spans[0].operation != "otter.Get" || spans[1].operation != "otter.Load" {
+		t.Fatalf("Get and Load spans should be started, but got %d spans", len(spans))
+	}
+	get, load := spans[0], spans[1]
+	if load.parent != get.id {
+		t.Fatal("Load span should be a child of the Get span")
+	}
+	if get.hit {
+		t.Fatal("Get span should record a miss")
+	}
+	if get.keyHash != load.keyHash {
+		t.Fatal("spans should have the same key hash")
+	}
+	if !get.ended || !load.ended {
+		t.Fatal("spans should be ended")
+	}
+
+	lc.Get(context.Background(), 1)
+	spans = tracer.reset()
+	if len(spans) != 1 || !spans[0].hit {
+		t.Fatalf("hit should be traced without a Load span, but got %d spans", len(spans))
+	}
+
+	lc.Get(context.Background(), -1)
+	spans = tracer.reset()
+	if len(spans) != 2 || !errors.Is(spans[0].err, errBackend) || !errors.Is(spans[1].err, errBackend) {
+		t.Fatal("loader error should be recorded")
+	}
+
+	_, err := NewLoadingCache[int, int](lc.Cache(), lc.loader, WithTracing(nil))
+	var cfgErr *ConfigError
+	if !errors.Is(err, ErrNilTracer) || !errors.As(err, &cfgErr) || cfgErr.Field != "WithTracing" {
+		t.Fatalf("should fail with a config error %v, but got %v", ErrNilTracer, err)
+	}
+}
+
+func TestLoadingCache_TracingRefresh(t *testing.T) {
+	tracer := &recordingTracer{}
+	c, err := MustBuilder[int, int](100).WithTTL(time.Second).AllowStale(time.Hour).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	lc, err := NewLoadingCache[int, int](c, func(ctx context.Context, key int) (int, error) {
+		return key, nil
+	}, WithTracing(tracer))
+	if err != nil {
+		t.Fatalf("can not create loading cache: %v", err)
+	}
+	defer lc.Close()
+
+	lc.Get(context.Background(), 1)
+	time.Sleep(2500 * time.Millisecond)
+	tracer.reset()
+
+	lc.Get(context.Background(), 1)
+	lc.loads.Wait()
+	spans := tracer.reset()
+	if len(spans) != 2 || spans[1].operation != "otter.Load" {
+		t.Fatalf("background reload should be traced, but got %d spans", len(spans))
+	}
+	if spans[1].parent != spans[0].id {
+		t.Fatal("background reload should be traced as a part of the caller's trace")
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.19
+
+package otter
+
+import (
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+)
+
+// SoftMemoryLimitPressure returns a func for the Builder.MemoryPressure which reports the pressure
+// when the memory used by the Go runtime exceeds the given fraction of the soft memory limit set by debug.SetMemoryLimit.
+//
+// It never reports the pressure if the limit isn't set.
+func SoftMemoryLimitPressure(threshold float64) func() bool {
+	return func() bool {
+		limit := debug.SetMemoryLimit(-1)
+		if limit == math.MaxInt64 {
+			return false
+		}
+
+		// the soft memory limit applies to all memory mapped by the runtime minus the released heap.
+		samples := []metrics.Sample{
+			{Name: "/memory/classes/total:bytes"},
+			{Name: "/memory/classes/heap/released:bytes"},
+		}
+		metrics.Read(samples)
+		used := samples[0].Value.Uint64() - samples[1].Value.Uint64()
+		return float64(used) > threshold*float64(limit)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"context"
+	"io"
+)
+
+type noop[K comparable, V any] struct{}
+
+// Noop returns a cache that stores nothing: all reads miss and all writes are dropped.
+//
+// It can be used to disable caching via configuration without nil checks.
+func Noop[K comparable, V any]() Interface[K, V] {
+	return noop[K, V]{}
+}
+
+func (n noop[K, V]) Has(key K) bool {
+	return false
+}
+
+func (n noop[K, V]) Get(key K) (V, bool) {
+	var zero V
+	return zero, false
+}
+
+func (n noop[K, V]) GetEntry(key K) (Entry[K, V], bool) {
+	return Entry[K, V]{}, false
+}
+
+func (n noop[K, V]) Entries() []Entry[K, V] {
+	return nil
+}
+
+func (n noop[K, V]) Sample(int) []Entry[K, V] {
+	return nil
+}
+
+func (n noop[K, V]) GetEntries(keys []K) map[K]Entry[K, V] {
+	return make(map[K]Entry[K, V])
+}
+
+func (n noop[K, V]) Hottest(int) []Entry[K, V] {
+	return nil
+}
+
+func (n noop[K, V]) TopKeys(int) []KeyCount[K] {
+	return nil
+}
+
+func (n noop[K, V]) GetAll(keys []K) (found map[K]V, missing []K) {
+	if len(keys) == 0 {
+		return make(map[K]V), nil
+	}
+	missing = make([]K, len(keys))
+	copy(missing, keys)
+	return make(map[K]V), missing
+}
+
+func (n noop[K, V]) SetWithDefaultTTL(key K, value V) bool {
+	return false
+}
+
+func (n noop[K, V]) SetIfAbsentWithDefaultTTL(key K, value V) bool {
+	return false
+}
+
+func (n noop[K, V]) Delete(key K) {
+}
+
+func (n noop[K, V]) DeleteAndGet(key K) (value V, ok bool) {
+	return value, false
+}
+
+func (n noop[K, V]) DeleteByFunc(f func(key K, value V) bool) {
+}
+
+func (n noop[K, V]) Range(f func(key K, value V) bool) {
+}
+
+func (n noop[K, V]) RangeWhile(pred func(key K, value V) bool, f func(key K, value V) bool) {
+}
+
+func (n noop[K, V]) RangeSnapshot(f func(key K, value V) bool) {
+}
+
+func (n noop[K, V]) CopyTo(dst Interface[K, V], keepHotness bool) {
+}
+
+func (n noop[K, V]) Clear(opts ...ClearOption) {
+}
+
+func (n noop[K, V]) Close() {
+}
+
+func (n noop[K, V]) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (n noop[K, V]) Events() <-chan Event[K, V] {
+	return nil
+}
+
+func (n noop[K, V]) ReplayJournal(r io.Reader) error {
+	return nil
+}
+
+func (n noop[K, V]) Size() int {
+	return 0
+}
+
+func (n noop[K, V]) EstimatedSize() int {
+	return 0
+}
+
+func (n noop[K, V]) CostUsed() uint64 {
+	return 0
+}
+
+func (n noop[K, V]) Utilization() float64 {
+	return 0
+}
+
+func (n noop[K, V]) Capacity() int {
+	return 0
+}
+
+func (n noop[K, V]) Stats() Stats {
+	return Stats{}
+}
+
+func (n noop[K, V]) Dump(w io.Writer) error {
+	_, err := io.WriteString(w, n.DebugString())
+	return err
+}
+
+func (n noop[K, V]) DebugString() string {
+	return "noop cache\n"
+}
+
+func (n noop[K, V]) ReadOnly() ReadCache[K, V] {
+	return readOnly[K, V]{cache: n}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNoop(t *testing.T) {
+	c := Noop[int, int]()
+	defer c.Close()
+
+	if c.SetWithDefaultTTL(1, 1) || c.SetIfAbsentWithDefaultTTL(1, 1) {
+		t.Fatal("writes should be dropped")
+	}
+	if _, ok := c.Get(1); ok || c.Has(1) {
+		t.Fatal("reads should miss")
+	}
+	found, missing := c.GetAll([]int{1, 2})
+	if len(found) != 0 || len(missing) != 2 {
+		t.Fatalf("got %v found and %v missing keys", found, missing)
+	}
+	if c.Size() != 0 || c.Stats().Hits() != 0 {
+		t.Fatal("noop cache should be empty")
+	}
+
+	lc, err := NewLoadingCache[int, int](c, func(ctx context.Context, key int) (int, error) {
+		return key, nil
+	})
+	if err != nil {
+		t.Fatalf("can not create loading cache: %v", err)
+	}
+	if v, err := lc.Get(context.Background(), 2); err != nil || v != 2 {
+		t.Fatalf("lc.Get(2) = %d/%v, want 2/nil", v, err)
+	}
+}
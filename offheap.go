@@ -0,0 +1,243 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"github.com/maypok86/otter/internal/offheap"
+)
+
+// Codec encodes values to bytes and decodes them back.
+type Codec[V any] interface {
+	Encode(value V) ([]byte, error)
+	Decode(data []byte) (V, error)
+}
+
+// offHeapItem is the pointer-free value stored in the cache in place of the encoded value.
+type offHeapItem struct {
+	handle offheap.Handle
+	cost   uint32
+}
+
+// OffHeapCache is a cache keeping the encoded values in memory allocated outside of the Go heap,
+// so the garbage collector doesn't scan them and only small fixed-size headers stay on the heap.
+//
+// The memory is split into ring buffers which overwrite the oldest values when they are full,
+// such values are treated as absent, so the cache holds at most size bytes of encoded values
+// in addition to its capacity limit.
+type OffHeapCache[K comparable, V any] struct {
+	cache    Cache[K, offHeapItem]
+	arena    *offheap.Arena
+	codec    Codec[V]
+	costFunc func(key K, value V) uint32
+}
+
+func newOffHeapCache[K comparable, V any](o *baseOptions[K, V], size int, codec Codec[V]) (*OffHeapCache[K, V], error) {
+	if size <= 0 {
+		return nil, newConfigError("BuildOffHeap", size, ErrIllegalOffHeapSize)
+	}
+	if codec == nil {
+		return nil, newConfigError("BuildOffHeap", nil, ErrNilCodec)
+	}
+	// the values are encoded outside of the heap, so the options which need the values on the heap are rejected.
+	switch {
+	case o.eventsCapacity > 0:
+		return nil, newConfigError("Events", o.eventsCapacity, ErrIllegalOffHeapOption)
+	case o.journal != nil:
+		return nil, newConfigError("Journal", nil, ErrIllegalOffHeapOption)
+	case o.withWAL:
+		return nil, newConfigError("WAL", o.walDir, ErrIllegalOffHeapOption)
+	case o.weakValues:
+		return nil, newConfigError("WeakValues", o.weakValues, ErrIllegalOffHeapOption)
+	case o.withFetchCost:
+		return nil, newConfigError("CostAwareEviction", nil, ErrIllegalOffHeapOption)
+	}
+
+	// the cost is computed from the value before it is encoded and kept next to the handle.
+	itemOptions := baseOptions[K, offHeapItem]{
+		capacity:        o.capacity,
+		initialCapacity: o.initialCapacity,
+		statsEnabled:    o.statsEnabled,
+		costFunc: func(key K, item offHeapItem) uint32 {
+			return item.cost
+		},
+		maintenanceRate:     o.maintenanceRate,
+		stableRange:         o.stableRange,
+		latencies:           o.latencies,
+		shardCount:          o.shardCount,
+		nodePooling:         o.nodePooling,
+		backpressure:        o.backpressure,
+		synchronous:         o.synchronous,
+		ignoreHas:           o.ignoreHas,
+		accessTTL:           o.accessTTL,
+		withAccessTTL:       o.withAccessTTL,
+		staleTTL:            o.staleTTL,
+		withStaleTTL:        o.withStaleTTL,
+		entryStats:          o.entryStats,
+		topKeys:             o.topKeys,
+		doorkeeper:          o.doorkeeper,
+		admission:           o.admission,
+		smallQueueRatio:     o.smallQueueRatio,
+		ghostQueueFactor:    o.ghostQueueFactor,
+		withQueueRatio:      o.withQueueRatio,
+		lowWatermark:        o.lowWatermark,
+		highWatermark:       o.highWatermark,
+		withWatermarks:      o.withWatermarks,
+		evictionBatch:       o.evictionBatch,
+		withEvictionBatch:   o.withEvictionBatch,
+		hashLoadFactor:      o.hashLoadFactor,
+		hashGrowthFactor:    o.hashGrowthFactor,
+		withHashTuning:      o.withHashTuning,
+		withGhostFactor:     o.withGhostFactor,
+		soonestExpiring:     o.soonestExpiring,
+		doorkeeperReset:     o.doorkeeperReset,
+		withDoorkeeperReset: o.withDoorkeeperReset,
+		logger:              o.logger,
+		maxEntryCost:        o.maxEntryCost,
+		withMaxEntryCost:    o.withMaxEntryCost,
+		versioned:           o.versioned,
+		precise:             o.precise,
+		expirationStrategy:  o.expirationStrategy,
+		memoryPressure:      o.memoryPressure,
+		withMemoryPressure:  o.withMemoryPressure,
+		internKey:           o.internKey,
+		withInternKeys:      o.withInternKeys,
+		readBuffersCount:    o.readBuffersCount,
+		readBufferCapacity:  o.readBufferCapacity,
+		withReadBuffers:     o.withReadBuffers,
+		minReadBuffers:      o.minReadBuffers,
+		maxReadBuffers:      o.maxReadBuffers,
+		withScaling:         o.withScaling,
+		amortized:           o.amortized,
+		parallelGets:        o.parallelGets,
+		withParallelGets:    o.withParallelGets,
+	}
+
+	arena, err := offheap.New(size)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := newCache(itemOptions.toConfig(), &itemOptions)
+	if err != nil {
+		_ = arena.Close()
+		return nil, err
+	}
+	return &OffHeapCache[K, V]{
+		cache:    cache,
+		arena:    arena,
+		codec:    codec,
+		costFunc: o.costFunc,
+	}, nil
+}
+
+// Has checks if there is an item with the given key in the cache.
+func (c *OffHeapCache[K, V]) Has(key K) bool {
+	_, ok := c.get(key)
+	return ok
+}
+
+// Get returns the decoded value associated with the key in this cache.
+//
+// The error is returned if the value can't be decoded.
+func (c *OffHeapCache[K, V]) Get(key K) (V, bool, error) {
+	data, ok := c.get(key)
+	if !ok {
+		var zero V
+		return zero, false, nil
+	}
+
+	value, err := c.codec.Decode(data)
+	if err != nil {
+		return value, false, err
+	}
+	return value, true, nil
+}
+
+func (c *OffHeapCache[K, V]) get(key K) ([]byte, bool) {
+	item, ok := c.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	data, ok := c.arena.Get(item.handle)
+	if !ok {
+		c.deleteOverwritten(key, item)
+		return nil, false
+	}
+	return data, true
+}
+
+// deleteOverwritten deletes the item whose value has been overwritten in the arena unless it has already been replaced.
+func (c *OffHeapCache[K, V]) deleteOverwritten(key K, item offHeapItem) {
+	unlock := c.cache.LockKey(key)
+	defer unlock()
+
+	if current, ok := c.cache.cache.Peek(key); ok && current == item {
+		c.cache.Delete(key)
+	}
+}
+
+// Set encodes the value and associates it with the key in this cache.
+//
+// If it returns false, then the key-value item had too much cost or the encoded value is larger
+// than a ring buffer and the Set was dropped. The error is returned if the value can't be encoded.
+func (c *OffHeapCache[K, V]) Set(key K, value V) (bool, error) {
+	data, err := c.codec.Encode(value)
+	if err != nil {
+		return false, err
+	}
+	cost := c.costFunc(key, value)
+
+	unlock := c.cache.LockKey(key)
+	defer unlock()
+
+	handle, ok := c.arena.Put(data)
+	if !ok {
+		return false, nil
+	}
+	return c.cache.Set(key, offHeapItem{handle: handle, cost: cost}), nil
+}
+
+// Delete removes the association for this key from the cache.
+func (c *OffHeapCache[K, V]) Delete(key K) {
+	c.cache.Delete(key)
+}
+
+// Clear removes all items, their encoded values stay in the off-heap memory until the next sets overwrite them.
+func (c *OffHeapCache[K, V]) Clear() {
+	c.cache.Clear()
+}
+
+// Close clears the hash table, releases the off-heap memory and stops all goroutines.
+//
+// NOTE: this operation must be performed when no requests are made to the cache otherwise the behavior is undefined.
+func (c *OffHeapCache[K, V]) Close() {
+	c.cache.Close()
+	_ = c.arena.Close()
+}
+
+// Size returns the current number of items in the cache.
+func (c *OffHeapCache[K, V]) Size() int {
+	return c.cache.Size()
+}
+
+// Capacity returns the cache capacity.
+func (c *OffHeapCache[K, V]) Capacity() int {
+	return c.cache.Capacity()
+}
+
+// Stats returns a current snapshot of this cache's cumulative statistics.
+func (c *OffHeapCache[K, V]) Stats() Stats {
+	return c.cache.Stats()
+}
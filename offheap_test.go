@@ -0,0 +1,119 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type stringCodec struct{}
+
+func (stringCodec) Encode(value string) ([]byte, error) {
+	return []byte(value), nil
+}
+
+func (stringCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
+
+func TestOffHeapCache(t *testing.T) {
+	const size = 100
+	c, err := MustBuilder[int, string](size).CollectStats().BuildOffHeap(1<<20, stringCodec{})
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < size; i++ {
+		if ok, err := c.Set(i, strconv.Itoa(i)); !ok || err != nil {
+			t.Fatalf("set should succeed, but got %v %v", ok, err)
+		}
+	}
+	for i := 0; i < size; i++ {
+		v, ok, err := c.Get(i)
+		if !ok || err != nil || v != strconv.Itoa(i) {
+			t.Fatalf("should get %d, but got %q %v %v", i, v, ok, err)
+		}
+	}
+
+	c.Delete(0)
+	if c.Has(0) {
+		t.Fatal("deleted key should be absent")
+	}
+	if hits := c.Stats().Hits(); hits != size {
+		t.Fatalf("hits should be %d, but got %d", size, hits)
+	}
+}
+
+func TestOffHeapCache_Overwritten(t *testing.T) {
+	const (
+		size   = 1000
+		length = 4096
+	)
+	// the values of all items don't fit into the off-heap memory.
+	c, err := MustBuilder[int, string](size).SynchronousEviction().BuildOffHeap(1<<20, stringCodec{})
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	value := string(make([]byte, length))
+	for i := 0; i < size; i++ {
+		c.Set(i, value)
+	}
+
+	if _, ok, _ := c.Get(0); ok {
+		t.Fatal("overwritten value should be absent")
+	}
+	if v, ok, _ := c.Get(size - 1); !ok || v != value {
+		t.Fatal("the latest value should be present")
+	}
+	if c.Size() != size-1 {
+		t.Fatalf("item with the overwritten value should be deleted, but got size %d", c.Size())
+	}
+}
+
+func TestBuilder_BuildOffHeap(t *testing.T) {
+	_, err := MustBuilder[int, string](100).BuildOffHeap(0, stringCodec{})
+	if !errors.Is(err, ErrIllegalOffHeapSize) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalOffHeapSize, err)
+	}
+
+	_, err = MustBuilder[int, string](100).BuildOffHeap(1<<20, nil)
+	if !errors.Is(err, ErrNilCodec) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrNilCodec, err)
+	}
+
+	illegal := []struct {
+		field string
+		b     *Builder[int, string]
+	}{
+		{field: "Events", b: MustBuilder[int, string](100).Events(10)},
+		{field: "Journal", b: MustBuilder[int, string](100).Journal(io.Discard)},
+		{field: "WAL", b: MustBuilder[int, string](100).WAL(t.TempDir(), time.Minute)},
+		{field: "CostAwareEviction", b: MustBuilder[int, string](100).CostAwareEviction(func(int, string) uint32 { return 1 })},
+	}
+	for _, tt := range illegal {
+		_, err = tt.b.BuildOffHeap(1<<20, stringCodec{})
+		var cfgErr *ConfigError
+		if !errors.Is(err, ErrIllegalOffHeapOption) || !errors.As(err, &cfgErr) || cfgErr.Field != tt.field {
+			t.Fatalf("%s should fail with a config error %v, but got %v", tt.field, ErrIllegalOffHeapOption, err)
+		}
+	}
+}
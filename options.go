@@ -0,0 +1,630 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/maypok86/otter/internal/core"
+)
+
+// These errors are reported as a *ConfigError by the functions creating a cache from the options.
+var (
+	// ErrMismatchedCostFunc means that the cost func passed to WithCost or WithCostAwareEviction
+	// doesn't match the key and value types of the cache.
+	ErrMismatchedCostFunc = errors.New("cost func doesn't match the key and value types of the cache")
+	// ErrMismatchedAdmission means that the admission policy passed to WithAdmission or WithSharedAdmission
+	// doesn't match the key type of the cache.
+	ErrMismatchedAdmission = errors.New("admission policy doesn't match the key type of the cache")
+)
+
+// Option configures a cache created by New.
+//
+// Options are immutable, so they can be reused across caches and shared between goroutines.
+type Option func(o *options)
+
+type options struct {
+	initialCapacity     int
+	statsEnabled        bool
+	latencies           bool
+	withTTL             bool
+	ttl                 time.Duration
+	costFunc            any
+	costByLen           bool
+	costByLenWithKeys   bool
+	maintenanceRate     int
+	stableRange         bool
+	eventsCapacity      int
+	shardCount          int
+	nodePooling         bool
+	synchronous         bool
+	ignoreHas           bool
+	journal             io.Writer
+	entryStats          bool
+	topKeys             int
+	doorkeeper          bool
+	admission           any
+	withAdmission       bool
+	smallQueueRatio     int
+	withQueueRatio      bool
+	ghostQueueFactor    float64
+	withGhostFactor     bool
+	fetchCostFunc       any
+	withFetchCost       bool
+	doorkeeperReset     int
+	withDoorkeeperReset bool
+	walDir              string
+	walInterval         time.Duration
+	withWAL             bool
+	maxEntryCost        uint32
+	withMaxEntryCost    bool
+	versioned           bool
+	memoryPressure      func() bool
+	withMemoryPressure  bool
+	readBuffersCount    int
+	readBufferCapacity  int
+	withReadBuffers     bool
+	minReadBuffers      int
+	maxReadBuffers      int
+	withScaling         bool
+	amortized           bool
+	parallelGets        int
+	withParallelGets    bool
+	lowWatermark        int
+	highWatermark       int
+	withWatermarks      bool
+	evictionBatch       int
+	withEvictionBatch   bool
+	hashLoadFactor      float64
+	hashGrowthFactor    int
+	withHashTuning      bool
+	backpressure        Backpressure
+	logger              core.Logger
+	weakValues          bool
+	internKeys          bool
+	accessTTL           time.Duration
+	withAccessTTL       bool
+	staleTTL            time.Duration
+	withStaleTTL        bool
+	soonestExpiring     bool
+	expirationStrategy  ExpirationStrategy
+	precise             bool
+	defaultTTL          time.Duration
+	withDefaultTTL      bool
+	minTTL              time.Duration
+	maxTTL              time.Duration
+	timerWheel          bool
+}
+
+// WithInitialCapacity is the functional equivalent of Builder.InitialCapacity.
+func WithInitialCapacity(initialCapacity int) Option {
+	return func(o *options) {
+		o.initialCapacity = initialCapacity
+	}
+}
+
+// WithStats is the functional equivalent of Builder.CollectStats.
+func WithStats() Option {
+	return func(o *options) {
+		o.statsEnabled = true
+	}
+}
+
+// WithLatencies is the functional equivalent of Builder.CollectLatencies.
+func WithLatencies() Option {
+	return func(o *options) {
+		o.latencies = true
+	}
+}
+
+// WithTTL is the functional equivalent of Builder.WithTTL.
+//
+// It can't be used with NewWithVariableTTL.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.withTTL = true
+		o.ttl = ttl
+	}
+}
+
+// WithCost is the functional equivalent of Builder.Cost.
+//
+// If the key and value types of costFunc don't match the cache, then New returns ErrMismatchedCostFunc.
+func WithCost[K comparable, V any](costFunc func(key K, value V) uint32) Option {
+	return func(o *options) {
+		o.costFunc = costFunc
+		o.costByLen = false
+	}
+}
+
+// WithCostByLen is the functional equivalent of Builder.CostByLen.
+func WithCostByLen(withKeys bool) Option {
+	return func(o *options) {
+		o.costByLen = true
+		o.costByLenWithKeys = withKeys
+		o.costFunc = nil
+	}
+}
+
+// WithMaintenanceRate is the functional equivalent of Builder.MaintenanceRate.
+func WithMaintenanceRate(opsPerSecond int) Option {
+	return func(o *options) {
+		o.maintenanceRate = opsPerSecond
+	}
+}
+
+// WithStableRange is the functional equivalent of Builder.StableRange.
+func WithStableRange() Option {
+	return func(o *options) {
+		o.stableRange = true
+	}
+}
+
+// WithEvents is the functional equivalent of Builder.Events.
+func WithEvents(capacity int) Option {
+	return func(o *options) {
+		o.eventsCapacity = capacity
+	}
+}
+
+// WithShardCount is the functional equivalent of Builder.ShardCount.
+func WithShardCount(n int) Option {
+	return func(o *options) {
+		o.shardCount = n
+	}
+}
+
+// WithNodePooling is the functional equivalent of Builder.NodePooling.
+func WithNodePooling() Option {
+	return func(o *options) {
+		o.nodePooling = true
+	}
+}
+
+// WithSynchronousEviction is the functional equivalent of Builder.SynchronousEviction.
+func WithSynchronousEviction() Option {
+	return func(o *options) {
+		o.synchronous = true
+	}
+}
+
+// WithIgnoreHasInStats is the functional equivalent of Builder.IgnoreHasInStats.
+func WithIgnoreHasInStats() Option {
+	return func(o *options) {
+		o.ignoreHas = true
+	}
+}
+
+// WithJournal is the functional equivalent of Builder.Journal.
+func WithJournal(w io.Writer) Option {
+	return func(o *options) {
+		o.journal = w
+	}
+}
+
+// WithEntryStats is the functional equivalent of Builder.CollectEntryStats.
+func WithEntryStats() Option {
+	return func(o *options) {
+		o.entryStats = true
+	}
+}
+
+// WithTopKeys is the functional equivalent of Builder.TrackTopKeys.
+func WithTopKeys(capacity int) Option {
+	return func(o *options) {
+		o.topKeys = capacity
+	}
+}
+
+// WithDoorkeeper is the functional equivalent of Builder.Doorkeeper.
+func WithDoorkeeper() Option {
+	return func(o *options) {
+		o.doorkeeper = true
+	}
+}
+
+// WithAdmission is the functional equivalent of Builder.Admission.
+//
+// If the key type of admission doesn't match the cache, then New returns ErrMismatchedAdmission.
+func WithAdmission[K comparable](admission Admission[K]) Option {
+	return func(o *options) {
+		o.admission = admission
+		o.withAdmission = true
+	}
+}
+
+// WithSharedAdmission is the functional equivalent of Builder.SharedAdmission.
+//
+// If the key type of admission doesn't match the cache, then New returns ErrMismatchedAdmission.
+func WithSharedAdmission[K comparable](admission *SharedAdmission[K]) Option {
+	return func(o *options) {
+		// avoid a non-nil interface holding a nil pointer.
+		var a Admission[K]
+		if admission != nil {
+			a = admission
+		}
+		o.admission = a
+		o.withAdmission = true
+	}
+}
+
+// WithSmallQueueRatio is the functional equivalent of Builder.SmallQueueRatio.
+func WithSmallQueueRatio(percent int) Option {
+	return func(o *options) {
+		o.smallQueueRatio = percent
+		o.withQueueRatio = true
+	}
+}
+
+// WithGhostQueueFactor is the functional equivalent of Builder.GhostQueueFactor.
+func WithGhostQueueFactor(factor float64) Option {
+	return func(o *options) {
+		o.ghostQueueFactor = factor
+		o.withGhostFactor = true
+	}
+}
+
+// WithCostAwareEviction is the functional equivalent of Builder.CostAwareEviction.
+//
+// If the key and value types of fetchCost don't match the cache, then New returns ErrMismatchedCostFunc.
+func WithCostAwareEviction[K comparable, V any](fetchCost func(key K, value V) uint32) Option {
+	return func(o *options) {
+		o.fetchCostFunc = fetchCost
+		o.withFetchCost = true
+	}
+}
+
+// WithDoorkeeperResetInterval is the functional equivalent of Builder.DoorkeeperResetInterval.
+func WithDoorkeeperResetInterval(keys int) Option {
+	return func(o *options) {
+		o.doorkeeperReset = keys
+		o.withDoorkeeperReset = true
+	}
+}
+
+// WithWAL is the functional equivalent of Builder.WAL.
+func WithWAL(dir string, compactionInterval time.Duration) Option {
+	return func(o *options) {
+		o.walDir = dir
+		o.walInterval = compactionInterval
+		o.withWAL = true
+	}
+}
+
+// WithMaxEntryCost is the functional equivalent of Builder.MaxEntryCost.
+func WithMaxEntryCost(c uint32) Option {
+	return func(o *options) {
+		o.maxEntryCost = c
+		o.withMaxEntryCost = true
+	}
+}
+
+// WithVersions is the functional equivalent of Builder.Versioned.
+func WithVersions() Option {
+	return func(o *options) {
+		o.versioned = true
+	}
+}
+
+// WithMemoryPressure is the functional equivalent of Builder.MemoryPressure.
+func WithMemoryPressure(pressured func() bool) Option {
+	return func(o *options) {
+		o.memoryPressure = pressured
+		o.withMemoryPressure = true
+	}
+}
+
+// WithReadBuffers is the functional equivalent of Builder.ReadBuffers.
+func WithReadBuffers(count, capacity int) Option {
+	return func(o *options) {
+		o.readBuffersCount = count
+		o.readBufferCapacity = capacity
+		o.withReadBuffers = true
+	}
+}
+
+// WithReadBufferScaling is the functional equivalent of Builder.ScaleReadBuffers.
+func WithReadBufferScaling(minCount, maxCount int) Option {
+	return func(o *options) {
+		o.minReadBuffers = minCount
+		o.maxReadBuffers = maxCount
+		o.withScaling = true
+	}
+}
+
+// WithAmortizedMaintenance is the functional equivalent of Builder.AmortizedMaintenance.
+func WithAmortizedMaintenance() Option {
+	return func(o *options) {
+		o.amortized = true
+	}
+}
+
+// WithParallelGetThreshold is the functional equivalent of Builder.ParallelGetThreshold.
+func WithParallelGetThreshold(threshold int) Option {
+	return func(o *options) {
+		o.parallelGets = threshold
+		o.withParallelGets = true
+	}
+}
+
+// WithEvictionWatermarks is the functional equivalent of Builder.EvictionWatermarks.
+func WithEvictionWatermarks(lowPercent, highPercent int) Option {
+	return func(o *options) {
+		o.lowWatermark = lowPercent
+		o.highWatermark = highPercent
+		o.withWatermarks = true
+	}
+}
+
+// WithEvictionBatchSize is the functional equivalent of Builder.EvictionBatchSize.
+func WithEvictionBatchSize(size int) Option {
+	return func(o *options) {
+		o.evictionBatch = size
+		o.withEvictionBatch = true
+	}
+}
+
+// WithHashTableTuning is the functional equivalent of Builder.HashTableTuning.
+func WithHashTableTuning(loadFactor float64, growthFactor int) Option {
+	return func(o *options) {
+		o.hashLoadFactor = loadFactor
+		o.hashGrowthFactor = growthFactor
+		o.withHashTuning = true
+	}
+}
+
+// WithWriteBackpressure is the functional equivalent of Builder.WriteBackpressure.
+func WithWriteBackpressure(mode Backpressure) Option {
+	return func(o *options) {
+		o.backpressure = mode
+	}
+}
+
+// WithExpireAfterAccess is the functional equivalent of ConstTTLBuilder.ExpireAfterAccess
+// and VariableTTLBuilder.ExpireAfterAccess. It requires a ttl.
+func WithExpireAfterAccess(ttl time.Duration) Option {
+	return func(o *options) {
+		o.accessTTL = ttl
+		o.withAccessTTL = true
+	}
+}
+
+// WithAllowStale is the functional equivalent of ConstTTLBuilder.AllowStale
+// and VariableTTLBuilder.AllowStale. It requires a ttl.
+func WithAllowStale(d time.Duration) Option {
+	return func(o *options) {
+		o.staleTTL = d
+		o.withStaleTTL = true
+	}
+}
+
+// WithEvictSoonestExpiringFirst is the functional equivalent of ConstTTLBuilder.EvictSoonestExpiringFirst
+// and VariableTTLBuilder.EvictSoonestExpiringFirst. It requires a ttl.
+func WithEvictSoonestExpiringFirst() Option {
+	return func(o *options) {
+		o.soonestExpiring = true
+	}
+}
+
+// WithExpirationStrategy is the functional equivalent of ConstTTLBuilder.ExpirationStrategy
+// and VariableTTLBuilder.ExpirationStrategy. It requires a ttl.
+func WithExpirationStrategy(strategy ExpirationStrategy) Option {
+	return func(o *options) {
+		o.expirationStrategy = strategy
+	}
+}
+
+// WithPreciseExpiration is the functional equivalent of ConstTTLBuilder.PreciseExpiration
+// and VariableTTLBuilder.PreciseExpiration. It requires a ttl.
+func WithPreciseExpiration() Option {
+	return func(o *options) {
+		o.precise = true
+	}
+}
+
+// WithDefaultTTL is the functional equivalent of VariableTTLBuilder.DefaultTTL.
+// It can only be used with NewWithVariableTTL.
+func WithDefaultTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.defaultTTL = ttl
+		o.withDefaultTTL = true
+	}
+}
+
+// WithMinTTL is the functional equivalent of VariableTTLBuilder.MinTTL.
+// It can only be used with NewWithVariableTTL.
+func WithMinTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.minTTL = ttl
+	}
+}
+
+// WithMaxTTL is the functional equivalent of VariableTTLBuilder.MaxTTL.
+// It can only be used with NewWithVariableTTL.
+func WithMaxTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.maxTTL = ttl
+	}
+}
+
+// WithTimerWheel is the functional equivalent of VariableTTLBuilder.TimerWheel.
+// It can only be used with NewWithVariableTTL.
+func WithTimerWheel() Option {
+	return func(o *options) {
+		o.timerWheel = true
+	}
+}
+
+// New creates a cache with the given capacity configured by the given options.
+// It is an alternative to the Builder for code that composes the configuration programmatically.
+//
+// Returns an error if invalid parameters were passed.
+func New[K comparable, V any](capacity int, opts ...Option) (Cache[K, V], error) {
+	return newWithOptions[K, V](capacity, applyOptions(opts))
+}
+
+// NewWithVariableTTL creates a cache with the given capacity and the variable ttl configured by the given options.
+// It is the functional equivalent of Builder.WithVariableTTL.
+//
+// Returns an error if invalid parameters were passed.
+func NewWithVariableTTL[K comparable, V any](capacity int, opts ...Option) (CacheWithVariableTTL[K, V], error) {
+	o := applyOptions(opts)
+	if o.withTTL {
+		return CacheWithVariableTTL[K, V]{}, newConfigError("WithTTL", o.ttl, ErrMismatchedExpiration)
+	}
+	b, err := newBuilderWithOptions[K, V](capacity, o)
+	if err != nil {
+		return CacheWithVariableTTL[K, V]{}, err
+	}
+
+	return b.WithVariableTTL().Build()
+}
+
+func applyOptions(opts []Option) options {
+	o := options{
+		initialCapacity: unsetCapacity,
+		shardCount:      unsetShardCount,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func newWithOptions[K comparable, V any](capacity int, o options) (Cache[K, V], error) {
+	b, err := newBuilderWithOptions[K, V](capacity, o)
+	if err != nil {
+		return Cache[K, V]{}, err
+	}
+
+	if o.withTTL {
+		return b.WithTTL(o.ttl).Build()
+	}
+	return b.Build()
+}
+
+// newBuilderWithOptions returns a builder with all the options applied except the ttl,
+// which selects the type of the builder.
+func newBuilderWithOptions[K comparable, V any](capacity int, o options) (*Builder[K, V], error) {
+	b, err := NewBuilder[K, V](capacity)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.costFunc != nil {
+		costFunc, ok := o.costFunc.(func(key K, value V) uint32)
+		if !ok {
+			return nil, newConfigError("WithCost", fmt.Sprintf("%T", o.costFunc), ErrMismatchedCostFunc)
+		}
+		b.setCostFunc(costFunc)
+	}
+	if o.costByLen {
+		b.setCostByLen(o.costByLenWithKeys)
+	}
+	if o.withFetchCost {
+		fetchCost, ok := o.fetchCostFunc.(func(key K, value V) uint32)
+		if !ok && o.fetchCostFunc != nil {
+			return nil, newConfigError("WithCostAwareEviction", fmt.Sprintf("%T", o.fetchCostFunc), ErrMismatchedCostFunc)
+		}
+		b.setFetchCostFunc(fetchCost)
+	}
+	if o.withAdmission {
+		admission, ok := o.admission.(Admission[K])
+		if !ok && o.admission != nil {
+			return nil, newConfigError("WithAdmission", fmt.Sprintf("%T", o.admission), ErrMismatchedAdmission)
+		}
+		b.setAdmission(admission)
+	}
+	b.setInitialCapacity(o.initialCapacity)
+	b.statsEnabled = o.statsEnabled
+	b.latencies = o.latencies
+	b.setMaintenanceRate(o.maintenanceRate)
+	b.stableRange = o.stableRange
+	b.setEventsCapacity(o.eventsCapacity)
+	b.setShardCount(o.shardCount)
+	b.nodePooling = o.nodePooling
+	b.synchronous = o.synchronous
+	b.ignoreHas = o.ignoreHas
+	b.setJournal(o.journal)
+	b.entryStats = o.entryStats
+	b.trackTopKeys(o.topKeys)
+	b.doorkeeper = o.doorkeeper
+	if o.withQueueRatio {
+		b.setSmallQueueRatio(o.smallQueueRatio)
+	}
+	if o.withGhostFactor {
+		b.setGhostQueueFactor(o.ghostQueueFactor)
+	}
+	if o.withDoorkeeperReset {
+		b.setDoorkeeperResetInterval(o.doorkeeperReset)
+	}
+	if o.withWAL {
+		b.setWAL(o.walDir, o.walInterval)
+	}
+	if o.withMaxEntryCost {
+		b.setMaxEntryCost(o.maxEntryCost)
+	}
+	b.versioned = o.versioned
+	if o.withMemoryPressure {
+		b.setMemoryPressure(o.memoryPressure)
+	}
+	if o.withReadBuffers {
+		b.setReadBuffers(o.readBuffersCount, o.readBufferCapacity)
+	}
+	if o.withScaling {
+		b.setReadBuffersScaling(o.minReadBuffers, o.maxReadBuffers)
+	}
+	b.amortized = o.amortized
+	if o.withParallelGets {
+		b.setParallelGetThreshold(o.parallelGets)
+	}
+	if o.withWatermarks {
+		b.setWatermarks(o.lowWatermark, o.highWatermark)
+	}
+	if o.withEvictionBatch {
+		b.setEvictionBatchSize(o.evictionBatch)
+	}
+	if o.withHashTuning {
+		b.setHashTableTuning(o.hashLoadFactor, o.hashGrowthFactor)
+	}
+	b.setBackpressure(o.backpressure)
+	b.setLogger(o.logger)
+	b.weakValues = o.weakValues
+	if o.internKeys {
+		// InternKeys and WithInternKeys are only available since Go 1.23.
+		if interner, ok := any(b).(interface{ InternKeys() *Builder[K, V] }); ok {
+			interner.InternKeys()
+		}
+	}
+	if o.withAccessTTL {
+		b.setExpireAfterAccess(o.accessTTL)
+	}
+	if o.withStaleTTL {
+		b.setAllowStale(o.staleTTL)
+	}
+	b.soonestExpiring = o.soonestExpiring
+	b.setExpirationStrategy(o.expirationStrategy)
+	b.precise = o.precise
+	if o.withDefaultTTL {
+		b.setDefaultTTL(o.defaultTTL)
+	}
+	b.minTTL = o.minTTL
+	b.maxTTL = o.maxTTL
+	b.timerWheel = o.timerWheel
+	return b, nil
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	opts := []Option{
+		WithStats(),
+		WithTTL(time.Hour),
+		WithCost(func(key int, value int) uint32 {
+			return 2
+		}),
+	}
+
+	// options are reusable.
+	for i := 0; i < 2; i++ {
+		c, err := New[int, int](100, opts...)
+		if err != nil {
+			t.Fatalf("can not create cache: %v", err)
+		}
+
+		c.Set(1, 1)
+		e, ok := c.GetEntry(1)
+		if !ok {
+			t.Fatal("key 1 should be present")
+		}
+		if e.Cost() != 2 {
+			t.Fatalf("e.Cost() = %d, want = 2", e.Cost())
+		}
+		if ttl := e.TTL(); ttl <= 0 || ttl > time.Hour+time.Second {
+			t.Fatalf("got unexpected ttl: %v", ttl)
+		}
+		if hits := c.Stats().Hits(); hits != 1 {
+			t.Fatalf("c.Stats().Hits() = %d, want = 1", hits)
+		}
+		c.Close()
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	if _, err := New[int, int](0); !errors.Is(err, ErrIllegalCapacity) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalCapacity, err)
+	}
+	if _, err := New[int, int](10, WithTTL(-time.Second)); !errors.Is(err, ErrIllegalTTL) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalTTL, err)
+	}
+	if _, err := New[int, int](10, WithShardCount(0)); !errors.Is(err, ErrIllegalShardCount) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalShardCount, err)
+	}
+
+	mismatched := WithCost(func(key string, value int) uint32 {
+		return 1
+	})
+	_, err := New[int, int](10, mismatched)
+	var configErr *ConfigError
+	if !errors.Is(err, ErrMismatchedCostFunc) || !errors.As(err, &configErr) || configErr.Field != "WithCost" {
+		t.Fatalf("should fail with a config error %v, but got %v", ErrMismatchedCostFunc, err)
+	}
+	if _, err := New[int, int](10, WithAdmission[string](nil)); err != nil {
+		t.Fatalf("nil admission should be accepted, but got %v", err)
+	}
+	if _, err := New[int, int](10, WithSharedAdmission(NewSharedAdmission[string](nil))); !errors.Is(err, ErrMismatchedAdmission) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrMismatchedAdmission, err)
+	}
+
+	mismatchedExpiration := []struct {
+		name string
+		new  func() error
+	}{
+		{
+			name: "access ttl without ttl",
+			new: func() error {
+				_, err := New[int, int](10, WithExpireAfterAccess(time.Minute))
+				return err
+			},
+		},
+		{
+			name: "default ttl with constant ttl",
+			new: func() error {
+				_, err := New[int, int](10, WithTTL(time.Minute), WithDefaultTTL(time.Minute))
+				return err
+			},
+		},
+		{
+			name: "constant ttl with variable ttl",
+			new: func() error {
+				_, err := NewWithVariableTTL[int, int](10, WithTTL(time.Minute))
+				return err
+			},
+		},
+	}
+	for _, tt := range mismatchedExpiration {
+		if err := tt.new(); !errors.Is(err, ErrMismatchedExpiration) {
+			t.Fatalf("%s: should fail with an error %v, but got %v", tt.name, ErrMismatchedExpiration, err)
+		}
+	}
+}
+
+func TestNewWithVariableTTL(t *testing.T) {
+	c, err := NewWithVariableTTL[int, int](100,
+		WithDefaultTTL(time.Hour),
+		WithMaxTTL(2*time.Hour),
+		WithTimerWheel(),
+	)
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	c.SetWithDefaultTTL(1, 1)
+	c.Set(2, 2, 10*time.Hour)
+	for k, want := range map[int]time.Duration{1: time.Hour, 2: 2 * time.Hour} {
+		e, ok := c.GetEntry(k)
+		if !ok {
+			t.Fatalf("key %d should be present", k)
+		}
+		if ttl := e.TTL(); ttl <= want-time.Minute || ttl > want {
+			t.Fatalf("got unexpected ttl of key %d: %v, want about %v", k, ttl, want)
+		}
+	}
+}
+
+// builderOptionNames returns the names of the options of all the builders.
+func builderOptionNames() map[string]bool {
+	terminal := map[string]bool{
+		"Build":        true,
+		"BuildOffHeap": true,
+		"Clone":        true,
+		"Validate":     true,
+	}
+	names := make(map[string]bool)
+	for _, b := range []any{
+		&Builder[int, int]{},
+		&ConstTTLBuilder[int, int]{},
+		&VariableTTLBuilder[int, int]{},
+	} {
+		typ := reflect.TypeOf(b)
+		for i := 0; i < typ.NumMethod(); i++ {
+			if name := typ.Method(i).Name; !terminal[name] {
+				names[name] = true
+			}
+		}
+	}
+	return names
+}
+
+func TestOptions_Coverage(t *testing.T) {
+	// the functional equivalents which aren't named With<method>.
+	equivalents := map[string]string{
+		"CollectStats":      "WithStats",
+		"CollectLatencies":  "WithLatencies",
+		"CollectEntryStats": "WithEntryStats",
+		"TrackTopKeys":      "WithTopKeys",
+		"Versioned":         "WithVersions",
+		"ScaleReadBuffers":  "WithReadBufferScaling",
+		"WithTTL":           "WithTTL",
+		"WithVariableTTL":   "NewWithVariableTTL",
+		"WithLogger":        "WithLogger",
+	}
+
+	// the options of the build-tagged files are found even if the current toolchain doesn't build them.
+	pkgs, err := parser.ParseDir(token.NewFileSet(), ".", func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatalf("can not parse the package: %v", err)
+	}
+	funcs := make(map[string]bool)
+	for _, file := range pkgs["otter"].Files {
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+				funcs[fn.Name.Name] = true
+			}
+		}
+	}
+
+	for name := range builderOptionNames() {
+		want, ok := equivalents[name]
+		if !ok {
+			want = "With" + name
+		}
+		if !funcs[want] {
+			t.Errorf("builder option %s has no functional equivalent %s", name, want)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+module github.com/maypok86/otter/ottermemcache
+
+go 1.21
+
+require github.com/maypok86/otter v0.0.0-00010101000000-000000000000
+
+require (
+	github.com/bradfitz/gomemcache v0.0.0-20230905024940-24af94b03874
+	github.com/dolthub/maphash v0.1.0 // indirect
+	github.com/dolthub/swiss v0.2.1 // indirect
+	github.com/gammazero/deque v0.2.1 // indirect
+)
+
+replace github.com/maypok86/otter => ../
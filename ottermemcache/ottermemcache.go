@@ -0,0 +1,92 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ottermemcache provides an otter.RemoteCache backed by Memcached.
+//
+// It lives in a separate module, so otter itself doesn't depend on gomemcache.
+package ottermemcache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/maypok86/otter"
+)
+
+// maxRelativeExpiration is the max expiration that Memcached treats as relative,
+// longer expirations should be passed as a unix time.
+const maxRelativeExpiration = 30 * 24 * time.Hour
+
+// Remote is an otter.RemoteCache backed by a Memcached client.
+//
+// Memcached keys are limited to 250 bytes without whitespace and control characters,
+// so keys should be encoded accordingly.
+type Remote struct {
+	client *memcache.Client
+	prefix string
+}
+
+// New creates a Remote that stores values with the given client, prefixing each key with the given prefix.
+func New(client *memcache.Client, prefix string) *Remote {
+	return &Remote{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Get returns the value associated with the key.
+//
+// The client doesn't support contexts, so ctx is ignored and the client's timeout is used.
+func (r *Remote) Get(_ context.Context, key string) ([]byte, bool, error) {
+	item, err := r.client.Get(r.prefix + key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return item.Value, true, nil
+}
+
+// Set associates the value with the key for the given ttl. The ttl is rounded up to seconds.
+func (r *Remote) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(&memcache.Item{
+		Key:        r.prefix + key,
+		Value:      value,
+		Expiration: expiration(ttl),
+	})
+}
+
+// Delete removes the key.
+func (r *Remote) Delete(_ context.Context, key string) error {
+	err := r.client.Delete(r.prefix + key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil
+	}
+	return err
+}
+
+func expiration(ttl time.Duration) int32 {
+	if ttl <= 0 {
+		return 0
+	}
+	if ttl > maxRelativeExpiration {
+		return int32(time.Now().Add(ttl).Unix())
+	}
+	return int32((ttl + time.Second - 1) / time.Second)
+}
+
+var _ otter.RemoteCache = (*Remote)(nil)
@@ -0,0 +1,205 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ottermemcache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/maypok86/otter"
+)
+
+// fakeServer implements the get, set and delete commands of the Memcached text protocol.
+type fakeServer struct {
+	mutex sync.Mutex
+	items map[string][]byte
+}
+
+func newFakeServer(t *testing.T) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("can not listen: %v", err)
+	}
+	t.Cleanup(func() {
+		lis.Close()
+	})
+
+	s := &fakeServer{
+		items: make(map[string][]byte),
+	}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return lis.Addr().String()
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return
+		}
+
+		s.mutex.Lock()
+		switch fields[0] {
+		case "gets", "get":
+			for _, key := range fields[1:] {
+				if v, ok := s.items[key]; ok {
+					fmt.Fprintf(rw, "VALUE %s 0 %d 0\r\n%s\r\n", key, len(v), v)
+				}
+			}
+			rw.WriteString("END\r\n")
+		case "set":
+			size, _ := strconv.Atoi(fields[4])
+			data := make([]byte, size+2)
+			if _, err := io.ReadFull(rw, data); err != nil {
+				s.mutex.Unlock()
+				return
+			}
+			s.items[fields[1]] = data[:size]
+			rw.WriteString("STORED\r\n")
+		case "delete":
+			if _, ok := s.items[fields[1]]; ok {
+				delete(s.items, fields[1])
+				rw.WriteString("DELETED\r\n")
+			} else {
+				rw.WriteString("NOT_FOUND\r\n")
+			}
+		default:
+			rw.WriteString("ERROR\r\n")
+		}
+		s.mutex.Unlock()
+		rw.Flush()
+	}
+}
+
+func TestRemote(t *testing.T) {
+	client := memcache.New(newFakeServer(t))
+	ctx := context.Background()
+	r := New(client, "users:")
+
+	if _, ok, err := r.Get(ctx, "1"); ok || err != nil {
+		t.Fatalf("missing key should not be found, but got %v/%v", ok, err)
+	}
+	if err := r.Set(ctx, "1", []byte("alice"), time.Minute); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if v, ok, err := r.Get(ctx, "1"); !ok || err != nil || string(v) != "alice" {
+		t.Fatalf("r.Get(1) = %s/%v/%v, want alice/true/nil", v, ok, err)
+	}
+
+	if err := r.Delete(ctx, "1"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := r.Delete(ctx, "1"); err != nil {
+		t.Fatalf("delete of a missing key failed: %v", err)
+	}
+	if _, ok, _ := r.Get(ctx, "1"); ok {
+		t.Fatal("deleted value should not be found")
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	if got := expiration(0); got != 0 {
+		t.Fatalf("zero ttl should mean no expiration, but got %d", got)
+	}
+	if got := expiration(1500 * time.Millisecond); got != 2 {
+		t.Fatalf("ttl should be rounded up to seconds, but got %d", got)
+	}
+	if got := expiration(60 * 24 * time.Hour); int64(got) < time.Now().Unix() {
+		t.Fatalf("long ttl should be passed as a unix time, but got %d", got)
+	}
+}
+
+func TestRemote_LoadingCache(t *testing.T) {
+	client := memcache.New(newFakeServer(t))
+
+	var calls atomic.Int64
+	loader := func(ctx context.Context, key int) (string, error) {
+		calls.Add(1)
+		return "user" + strconv.Itoa(key), nil
+	}
+	remote := New(client, "users:")
+	newLoadingCache := func() *otter.LoadingCache[int, string] {
+		c, err := otter.MustBuilder[int, string](100).Build()
+		if err != nil {
+			t.Fatalf("can not create cache: %v", err)
+		}
+		lc, err := otter.NewLoadingCache[int, string](c, loader,
+			otter.WithRemote[int, string](remote, strconv.Itoa, stringCodec{}, time.Minute))
+		if err != nil {
+			t.Fatalf("can not create loading cache: %v", err)
+		}
+		return lc
+	}
+
+	ctx := context.Background()
+	first := newLoadingCache()
+	defer first.Close()
+	if v, err := first.Get(ctx, 1); err != nil || v != "user1" {
+		t.Fatalf("first.Get(1) = %s/%v, want user1/nil", v, err)
+	}
+	if v, ok, err := remote.Get(ctx, "1"); !ok || err != nil || string(v) != "user1" {
+		t.Fatalf("loaded value should be written to memcached, but got %s/%v/%v", v, ok, err)
+	}
+
+	second := newLoadingCache()
+	defer second.Close()
+	if v, err := second.Get(ctx, 1); err != nil || v != "user1" || calls.Load() != 1 {
+		t.Fatalf("second.Get(1) = %s/%v, want user1/nil read from memcached", v, err)
+	}
+
+	if err := second.Invalidate(ctx, 1); err != nil {
+		t.Fatalf("invalidate failed: %v", err)
+	}
+	if _, ok, _ := remote.Get(ctx, "1"); ok {
+		t.Fatal("invalidated value should be deleted from memcached")
+	}
+}
+
+type stringCodec struct{}
+
+func (stringCodec) Encode(value string) ([]byte, error) {
+	return []byte(value), nil
+}
+
+func (stringCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
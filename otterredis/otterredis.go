@@ -0,0 +1,65 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otterredis provides an otter.RemoteCache backed by Redis.
+//
+// It lives in a separate module, so otter itself doesn't depend on go-redis.
+package otterredis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/maypok86/otter"
+	"github.com/redis/go-redis/v9"
+)
+
+// Remote is an otter.RemoteCache backed by a Redis client.
+type Remote struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// New creates a Remote that stores values with the given client, prefixing each key with the given prefix.
+func New(client redis.UniversalClient, prefix string) *Remote {
+	return &Remote{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Get returns the value associated with the key.
+func (r *Remote) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := r.client.Get(ctx, r.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set associates the value with the key for the given ttl.
+func (r *Remote) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, r.prefix+key, value, ttl).Err()
+}
+
+// Delete removes the key.
+func (r *Remote) Delete(ctx context.Context, key string) error {
+	return r.client.Del(ctx, r.prefix+key).Err()
+}
+
+var _ otter.RemoteCache = (*Remote)(nil)
@@ -0,0 +1,122 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otterredis
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/maypok86/otter"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRemote(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+
+	ctx := context.Background()
+	r := New(client, "users:")
+	if _, ok, err := r.Get(ctx, "1"); ok || err != nil {
+		t.Fatalf("missing key should not be found, but got %v/%v", ok, err)
+	}
+
+	if err := r.Set(ctx, "1", []byte("alice"), time.Minute); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if v, ok, err := r.Get(ctx, "1"); !ok || err != nil || string(v) != "alice" {
+		t.Fatalf("r.Get(1) = %s/%v/%v, want alice/true/nil", v, ok, err)
+	}
+	if !s.Exists("users:1") || s.TTL("users:1") != time.Minute {
+		t.Fatal("value should be stored under the prefixed key with the ttl")
+	}
+
+	s.FastForward(2 * time.Minute)
+	if _, ok, _ := r.Get(ctx, "1"); ok {
+		t.Fatal("expired value should not be found")
+	}
+
+	r.Set(ctx, "2", []byte("bob"), 0)
+	if err := r.Delete(ctx, "2"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := r.Delete(ctx, "2"); err != nil {
+		t.Fatalf("delete of a missing key failed: %v", err)
+	}
+	if _, ok, _ := r.Get(ctx, "2"); ok {
+		t.Fatal("deleted value should not be found")
+	}
+}
+
+func TestRemote_LoadingCache(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+
+	var calls atomic.Int64
+	loader := func(ctx context.Context, key int) (string, error) {
+		calls.Add(1)
+		return "user" + strconv.Itoa(key), nil
+	}
+	newLoadingCache := func() *otter.LoadingCache[int, string] {
+		c, err := otter.MustBuilder[int, string](100).Build()
+		if err != nil {
+			t.Fatalf("can not create cache: %v", err)
+		}
+		lc, err := otter.NewLoadingCache[int, string](c, loader,
+			otter.WithRemote[int, string](New(client, "users:"), strconv.Itoa, stringCodec{}, time.Minute))
+		if err != nil {
+			t.Fatalf("can not create loading cache: %v", err)
+		}
+		return lc
+	}
+
+	ctx := context.Background()
+	first := newLoadingCache()
+	defer first.Close()
+	if v, err := first.Get(ctx, 1); err != nil || v != "user1" {
+		t.Fatalf("first.Get(1) = %s/%v, want user1/nil", v, err)
+	}
+	if v, err := s.Get("users:1"); err != nil || v != "user1" || s.TTL("users:1") != time.Minute {
+		t.Fatalf("loaded value should be written to redis, but got %s/%v", v, err)
+	}
+
+	second := newLoadingCache()
+	defer second.Close()
+	if v, err := second.Get(ctx, 1); err != nil || v != "user1" || calls.Load() != 1 {
+		t.Fatalf("second.Get(1) = %s/%v, want user1/nil read from redis", v, err)
+	}
+
+	if err := second.Invalidate(ctx, 1); err != nil {
+		t.Fatalf("invalidate failed: %v", err)
+	}
+	if s.Exists("users:1") {
+		t.Fatal("invalidated value should be deleted from redis")
+	}
+}
+
+type stringCodec struct{}
+
+func (stringCodec) Encode(value string) ([]byte, error) {
+	return []byte(value), nil
+}
+
+func (stringCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
@@ -0,0 +1,464 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ottertest contains helpers for testing code that uses otter caches.
+package ottertest
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/maypok86/otter"
+)
+
+// ErrNotSupported is returned by the methods of Fake that can't be emulated.
+var ErrNotSupported = errors.New("operation is not supported by the fake cache")
+
+type item[K comparable, V any] struct {
+	key      K
+	value    V
+	deadline time.Duration
+}
+
+// Fake is a deterministic in-memory implementation of otter.Interface for unit tests.
+//
+// It evicts items in the order of insertion when the capacity is exceeded, and its time is logical:
+// it only moves forward when Advance is called. Fake is safe for concurrent use.
+type Fake[K comparable, V any] struct {
+	mutex    sync.Mutex
+	capacity int
+	ttl      time.Duration
+	epoch    time.Time
+	now      time.Duration
+	items    map[K]*list.Element
+	order    *list.List
+	hits     int64
+	misses   int64
+}
+
+// NewFake creates a Fake with the given capacity. A positive ttl is applied to all written items.
+func NewFake[K comparable, V any](capacity int, ttl time.Duration) *Fake[K, V] {
+	return &Fake[K, V]{
+		capacity: capacity,
+		ttl:      ttl,
+		epoch:    time.Now(),
+		items:    make(map[K]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Advance moves the logical time of the fake forward.
+func (f *Fake[K, V]) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.now += d
+}
+
+// Hits returns the number of cache hits.
+func (f *Fake[K, V]) Hits() int64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.hits
+}
+
+// Misses returns the number of cache misses.
+func (f *Fake[K, V]) Misses() int64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.misses
+}
+
+// get returns the live item and removes the expired one.
+//
+// NOTE: must be called under the mutex.
+func (f *Fake[K, V]) get(key K) (*item[K, V], bool) {
+	e, ok := f.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	it := e.Value.(*item[K, V])
+	if f.isExpired(it) {
+		f.remove(e)
+		return nil, false
+	}
+	return it, true
+}
+
+func (f *Fake[K, V]) isExpired(it *item[K, V]) bool {
+	return it.deadline > 0 && it.deadline <= f.now
+}
+
+func (f *Fake[K, V]) remove(e *list.Element) {
+	delete(f.items, e.Value.(*item[K, V]).key)
+	f.order.Remove(e)
+}
+
+func (f *Fake[K, V]) lookup(key K) (*item[K, V], bool) {
+	it, ok := f.get(key)
+	if ok {
+		f.hits++
+	} else {
+		f.misses++
+	}
+	return it, ok
+}
+
+func (f *Fake[K, V]) entry(it *item[K, V]) otter.Entry[K, V] {
+	var expiration int64
+	if it.deadline > 0 {
+		expiration = f.epoch.Add(it.deadline).Unix()
+	}
+	return otter.NewEntry(it.key, it.value, expiration, 1)
+}
+
+// Has checks if there is an item with the given key in the cache.
+func (f *Fake[K, V]) Has(key K) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	_, ok := f.lookup(key)
+	return ok
+}
+
+// Get returns the value associated with the key in this cache.
+func (f *Fake[K, V]) Get(key K) (V, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	it, ok := f.lookup(key)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return it.value, true
+}
+
+// GetEntry returns the entry associated with the key in this cache.
+//
+// Entry.TTL is computed with the wall clock, so it doesn't reflect Advance.
+func (f *Fake[K, V]) GetEntry(key K) (otter.Entry[K, V], bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	it, ok := f.lookup(key)
+	if !ok {
+		return otter.Entry[K, V]{}, false
+	}
+	return f.entry(it), true
+}
+
+// Entries returns the entries of all items in the order of insertion.
+func (f *Fake[K, V]) Entries() []otter.Entry[K, V] {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	entries := make([]otter.Entry[K, V], 0, f.order.Len())
+	for e := f.order.Front(); e != nil; e = e.Next() {
+		if it := e.Value.(*item[K, V]); !f.isExpired(it) {
+			entries = append(entries, f.entry(it))
+		}
+	}
+	return entries
+}
+
+// Sample returns the entries of at most n items. To stay deterministic, the fake returns
+// the oldest items in the order of insertion instead of random ones.
+func (f *Fake[K, V]) Sample(n int) []otter.Entry[K, V] {
+	if n <= 0 {
+		return nil
+	}
+
+	entries := f.Entries()
+	if n < len(entries) {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// GetEntries returns the entries associated with the given keys in this cache.
+func (f *Fake[K, V]) GetEntries(keys []K) map[K]otter.Entry[K, V] {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	entries := make(map[K]otter.Entry[K, V], len(keys))
+	for _, key := range keys {
+		if it, ok := f.lookup(key); ok {
+			entries[key] = f.entry(it)
+		}
+	}
+	return entries
+}
+
+// Hottest always returns nil, since the fake doesn't collect per-entry statistics.
+func (f *Fake[K, V]) Hottest(n int) []otter.Entry[K, V] {
+	return nil
+}
+
+// TopKeys always returns nil, since the fake doesn't track hot keys.
+func (f *Fake[K, V]) TopKeys(k int) []otter.KeyCount[K] {
+	return nil
+}
+
+// GetAll returns the values associated with the given keys and the keys missing from the cache.
+func (f *Fake[K, V]) GetAll(keys []K) (found map[K]V, missing []K) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	found = make(map[K]V, len(keys))
+	for _, key := range keys {
+		if it, ok := f.lookup(key); ok {
+			found[key] = it.value
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	return found, missing
+}
+
+// SetWithDefaultTTL associates the value with the key in this cache.
+func (f *Fake[K, V]) SetWithDefaultTTL(key K, value V) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.set(key, value)
+	return true
+}
+
+// SetIfAbsentWithDefaultTTL associates the value with the key in this cache if the key is absent.
+func (f *Fake[K, V]) SetIfAbsentWithDefaultTTL(key K, value V) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.get(key); ok {
+		return false
+	}
+	f.set(key, value)
+	return true
+}
+
+func (f *Fake[K, V]) set(key K, value V) {
+	var deadline time.Duration
+	if f.ttl > 0 {
+		deadline = f.now + f.ttl
+	}
+
+	if e, ok := f.items[key]; ok {
+		f.remove(e)
+	}
+	f.items[key] = f.order.PushBack(&item[K, V]{
+		key:      key,
+		value:    value,
+		deadline: deadline,
+	})
+
+	for f.order.Len() > f.capacity {
+		f.remove(f.order.Front())
+	}
+}
+
+// Delete removes the association for this key from the cache.
+func (f *Fake[K, V]) Delete(key K) {
+	f.DeleteAndGet(key)
+}
+
+// DeleteAndGet removes the association for this key from the cache and returns the removed value.
+func (f *Fake[K, V]) DeleteAndGet(key K) (value V, ok bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	it, ok := f.get(key)
+	if !ok {
+		return value, false
+	}
+	f.remove(f.items[key])
+	return it.value, true
+}
+
+// DeleteByFunc removes the association for this key from the cache when the given function returns true.
+func (f *Fake[K, V]) DeleteByFunc(fn func(key K, value V) bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for e := f.order.Front(); e != nil; {
+		next := e.Next()
+		it := e.Value.(*item[K, V])
+		if f.isExpired(it) || fn(it.key, it.value) {
+			f.remove(e)
+		}
+		e = next
+	}
+}
+
+// Range iterates over all items in the cache in the order of insertion.
+//
+// Iteration stops early when the given function returns false.
+// The function is called on a snapshot, so it may call the cache.
+func (f *Fake[K, V]) Range(fn func(key K, value V) bool) {
+	for _, it := range f.snapshot() {
+		if !fn(it.key, it.value) {
+			return
+		}
+	}
+}
+
+// RangeWhile calls fn for the items matching pred in the order of insertion until fn returns false.
+func (f *Fake[K, V]) RangeWhile(pred func(key K, value V) bool, fn func(key K, value V) bool) {
+	for _, it := range f.snapshot() {
+		if pred(it.key, it.value) && !fn(it.key, it.value) {
+			return
+		}
+	}
+}
+
+// RangeSnapshot is the same as Range.
+func (f *Fake[K, V]) RangeSnapshot(fn func(key K, value V) bool) {
+	f.Range(fn)
+}
+
+// CopyTo sets all items of the fake into dst with the default ttl of dst. keepHotness is ignored,
+// since the fake doesn't have an eviction policy state.
+func (f *Fake[K, V]) CopyTo(dst otter.Interface[K, V], keepHotness bool) {
+	for _, it := range f.snapshot() {
+		dst.SetWithDefaultTTL(it.key, it.value)
+	}
+}
+
+func (f *Fake[K, V]) snapshot() []item[K, V] {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	items := make([]item[K, V], 0, f.order.Len())
+	for e := f.order.Front(); e != nil; e = e.Next() {
+		if it := e.Value.(*item[K, V]); !f.isExpired(it) {
+			items = append(items, *it)
+		}
+	}
+	return items
+}
+
+// Clear removes all items from the cache. The fake doesn't publish events, so the options are ignored.
+func (f *Fake[K, V]) Clear(opts ...otter.ClearOption) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.items = make(map[K]*list.Element)
+	f.order.Init()
+}
+
+// Close clears the cache.
+func (f *Fake[K, V]) Close() {
+	f.Clear()
+}
+
+// Shutdown clears the cache.
+func (f *Fake[K, V]) Shutdown(ctx context.Context) error {
+	f.Clear()
+	return nil
+}
+
+// Events returns nil, since the fake doesn't publish events.
+func (f *Fake[K, V]) Events() <-chan otter.Event[K, V] {
+	return nil
+}
+
+// ReplayJournal always returns ErrNotSupported.
+func (f *Fake[K, V]) ReplayJournal(r io.Reader) error {
+	return ErrNotSupported
+}
+
+// Size returns the current number of items in the cache, including expired ones which haven't been removed yet.
+func (f *Fake[K, V]) Size() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.order.Len()
+}
+
+// EstimatedSize is the same as Size.
+func (f *Fake[K, V]) EstimatedSize() int {
+	return f.Size()
+}
+
+// CostUsed returns the number of items, since every item of the fake costs one.
+func (f *Fake[K, V]) CostUsed() uint64 {
+	return uint64(f.Size())
+}
+
+// Utilization returns the ratio of the number of items to the capacity.
+func (f *Fake[K, V]) Utilization() float64 {
+	if f.capacity <= 0 {
+		return 0
+	}
+	return float64(f.Size()) / float64(f.capacity)
+}
+
+// Capacity returns the cache capacity.
+func (f *Fake[K, V]) Capacity() int {
+	return f.capacity
+}
+
+// Stats returns empty statistics, use Hits and Misses of the fake instead.
+func (f *Fake[K, V]) Stats() otter.Stats {
+	return otter.Stats{}
+}
+
+// Dump writes the debug string of the fake to w.
+func (f *Fake[K, V]) Dump(w io.Writer) error {
+	_, err := io.WriteString(w, f.DebugString())
+	return err
+}
+
+// DebugString returns the size, the capacity and the logical time of the fake.
+func (f *Fake[K, V]) DebugString() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return fmt.Sprintf("fake cache: size %d, capacity %d, now %v\n", f.order.Len(), f.capacity, f.now)
+}
+
+// ReadOnly returns a read-only view of the cache.
+func (f *Fake[K, V]) ReadOnly() otter.ReadCache[K, V] {
+	return readOnly[K, V]{fake: f}
+}
+
+type readOnly[K comparable, V any] struct {
+	fake *Fake[K, V]
+}
+
+func (r readOnly[K, V]) Has(key K) bool {
+	return r.fake.Has(key)
+}
+
+func (r readOnly[K, V]) Get(key K) (V, bool) {
+	return r.fake.Get(key)
+}
+
+func (r readOnly[K, V]) Range(f func(key K, value V) bool) {
+	r.fake.Range(f)
+}
+
+func (r readOnly[K, V]) Stats() otter.Stats {
+	return r.fake.Stats()
+}
+
+var _ otter.Interface[int, int] = (*Fake[int, int])(nil)
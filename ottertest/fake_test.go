@@ -0,0 +1,63 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ottertest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/maypok86/otter"
+)
+
+func TestFake(t *testing.T) {
+	var cache otter.Interface[int, int] = NewFake[int, int](2, time.Minute)
+	f := cache.(*Fake[int, int])
+
+	cache.SetWithDefaultTTL(1, 1)
+	cache.SetWithDefaultTTL(2, 2)
+	cache.SetWithDefaultTTL(3, 3)
+	if cache.Has(1) || !cache.Has(2) || !cache.Has(3) {
+		t.Fatal("the oldest item should be evicted")
+	}
+	if f.Hits() != 2 || f.Misses() != 1 {
+		t.Fatalf("got %d hits and %d misses, want 2 and 1", f.Hits(), f.Misses())
+	}
+
+	f.Advance(30 * time.Second)
+	if cache.SetIfAbsentWithDefaultTTL(2, 20) || !cache.SetIfAbsentWithDefaultTTL(1, 1) {
+		t.Fatal("SetIfAbsentWithDefaultTTL should store only absent keys")
+	}
+	f.Advance(30 * time.Second)
+	var getter otter.Getter[int, int] = cache
+	if _, ok := getter.Get(3); ok {
+		t.Fatal("item should expire after the ttl")
+	}
+	if v, ok := getter.Get(1); !ok || v != 1 {
+		t.Fatalf("got %d/%v for key 1, want 1/true", v, ok)
+	}
+
+	var keys []int
+	cache.ReadOnly().Range(func(key, value int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != 1 || keys[0] != 1 {
+		t.Fatalf("got keys %v, want [1]", keys)
+	}
+
+	if err := cache.ReplayJournal(nil); err != ErrNotSupported {
+		t.Fatalf("should fail with an error %v, but got %v", ErrNotSupported, err)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/maypok86/otter"
+	"github.com/maypok86/otter/internal/xmath"
+	"github.com/maypok86/otter/internal/xruntime"
+)
+
+// ttlTolerance is the maximum delay of expiration in the real cache.
+//
+// The real cache rounds ttl up to seconds and uses a clock that is updated once per second.
+const ttlTolerance = 2 * time.Second
+
+// OpKind is the kind of operation applied to both the real cache and the model.
+type OpKind uint8
+
+const (
+	// OpGet calls Get.
+	OpGet OpKind = iota
+	// OpSet calls Set.
+	OpSet
+	// OpSetIfAbsent calls SetIfAbsent.
+	OpSetIfAbsent
+	// OpDelete calls Delete.
+	OpDelete
+
+	numberOfOpKinds
+)
+
+// String returns the name of the operation.
+func (k OpKind) String() string {
+	switch k {
+	case OpGet:
+		return "Get"
+	case OpSet:
+		return "Set"
+	case OpSetIfAbsent:
+		return "SetIfAbsent"
+	case OpDelete:
+		return "Delete"
+	default:
+		return fmt.Sprintf("OpKind(%d)", uint8(k))
+	}
+}
+
+// Op is a single cache operation.
+//
+// TTL is used only for Set and SetIfAbsent and is ignored if it is not positive.
+type Op[K comparable, V any] struct {
+	Kind  OpKind
+	Key   K
+	Value V
+	TTL   time.Duration
+}
+
+// Target is the subset of the cache API required for differential testing.
+type Target[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Set(key K, value V, ttl time.Duration) bool
+	SetIfAbsent(key K, value V, ttl time.Duration) bool
+	Delete(key K)
+	Size() int
+	Capacity() int
+}
+
+type constTTLTarget[K comparable, V any] struct {
+	otter.Cache[K, V]
+}
+
+func (t constTTLTarget[K, V]) Set(key K, value V, _ time.Duration) bool {
+	return t.Cache.Set(key, value)
+}
+
+func (t constTTLTarget[K, V]) SetIfAbsent(key K, value V, _ time.Duration) bool {
+	return t.Cache.SetIfAbsent(key, value)
+}
+
+// FromCache adapts otter.Cache to Target. The ttl of operations is ignored.
+func FromCache[K comparable, V any](c otter.Cache[K, V]) Target[K, V] {
+	return constTTLTarget[K, V]{Cache: c}
+}
+
+// FromCacheWithVariableTTL adapts otter.CacheWithVariableTTL to Target.
+func FromCacheWithVariableTTL[K comparable, V any](c otter.CacheWithVariableTTL[K, V]) Target[K, V] {
+	return c
+}
+
+// Options controls the property checks performed by Check.
+type Options struct {
+	// TTL is the const ttl of the checked cache. It is ignored if it is not positive.
+	TTL time.Duration
+	// SizeSlack is the number of items by which the size of the real cache may exceed its capacity,
+	// since the eviction policy is applied asynchronously. If it is not positive, the default value is used.
+	SizeSlack int
+}
+
+func defaultSizeSlack() int {
+	// the size of the write buffer plus the size of the batch processed by the policy.
+	roundedParallelism := int(xmath.RoundUpPowerOf2(xruntime.Parallelism()))
+	return 128*roundedParallelism + 64
+}
+
+type written[V any] struct {
+	value    V
+	deadline time.Time
+	deleted  bool
+}
+
+// Check applies ops to both the target and a fresh model and verifies the following properties:
+//
+//   - a hit in the target always returns the latest value written for the key;
+//   - a deleted key is never returned by the target until it is set again;
+//   - an expired key is never returned by the target (with the tolerance of the real clock);
+//   - the size of the target never exceeds its capacity by more than Options.SizeSlack;
+//   - the size of the model never exceeds its capacity.
+//
+// The target is expected to be empty and must not be used concurrently during the check.
+// Check returns an error describing the first violated property.
+func Check[K comparable, V comparable](target Target[K, V], ops []Op[K, V], opts Options) error {
+	capacity := target.Capacity()
+	m := New[K, V](capacity, opts.TTL, nil)
+	slack := opts.SizeSlack
+	if slack <= 0 {
+		slack = defaultSizeSlack()
+	}
+
+	history := make(map[K]written[V])
+	for i, op := range ops {
+		ttl := op.TTL
+		if opts.TTL > 0 {
+			ttl = opts.TTL
+		}
+
+		switch op.Kind {
+		case OpGet:
+			got, ok := target.Get(op.Key)
+			m.Get(op.Key)
+			if !ok {
+				break
+			}
+			w, found := history[op.Key]
+			switch {
+			case !found:
+				return fmt.Errorf("op %d: %s(%v) returned %v for a key that was never set", i, op.Kind, op.Key, got)
+			case w.deleted:
+				return fmt.Errorf("op %d: %s(%v) returned %v for a deleted key", i, op.Kind, op.Key, got)
+			case got != w.value:
+				return fmt.Errorf("op %d: %s(%v) returned %v, but the latest value is %v", i, op.Kind, op.Key, got, w.value)
+			case !w.deadline.IsZero() && time.Now().After(w.deadline):
+				return fmt.Errorf("op %d: %s(%v) returned %v for an expired key", i, op.Kind, op.Key, got)
+			}
+		case OpSet, OpSetIfAbsent:
+			var ok bool
+			if op.Kind == OpSet {
+				ok = target.Set(op.Key, op.Value, ttl)
+				m.SetWithTTL(op.Key, op.Value, ttl)
+			} else {
+				ok = target.SetIfAbsent(op.Key, op.Value, ttl)
+				m.SetIfAbsentWithTTL(op.Key, op.Value, ttl)
+			}
+			if ok {
+				w := written[V]{value: op.Value}
+				if ttl > 0 {
+					w.deadline = time.Now().Add(ttl + time.Second + ttlTolerance)
+				}
+				history[op.Key] = w
+			}
+		case OpDelete:
+			target.Delete(op.Key)
+			m.Delete(op.Key)
+			if w, ok := history[op.Key]; ok {
+				w.deleted = true
+				history[op.Key] = w
+			}
+		default:
+			return fmt.Errorf("op %d: unknown operation %s", i, op.Kind)
+		}
+
+		if size := target.Size(); size > capacity+slack {
+			return fmt.Errorf("op %d: size of the cache is %d, but capacity is %d (slack %d)", i, size, capacity, slack)
+		}
+		if size := m.Size(); size > capacity {
+			return fmt.Errorf("op %d: size of the model is %d, but capacity is %d", i, size, capacity)
+		}
+	}
+
+	return nil
+}
+
+// DecodeOps decodes an arbitrary byte sequence into a sequence of operations over small integer keys.
+// It is intended to be used with native go fuzzing.
+//
+// Every operation takes three bytes: kind, key and value. The key space is limited by keySpace
+// to increase the number of collisions. Trailing bytes are ignored.
+func DecodeOps(data []byte, keySpace uint8) []Op[int, int] {
+	if keySpace == 0 {
+		keySpace = 1
+	}
+
+	ops := make([]Op[int, int], 0, len(data)/3)
+	for len(data) >= 3 {
+		ops = append(ops, Op[int, int]{
+			Kind:  OpKind(data[0] % uint8(numberOfOpKinds)),
+			Key:   int(data[1] % keySpace),
+			Value: int(data[2]),
+		})
+		data = data[3:]
+	}
+	return ops
+}
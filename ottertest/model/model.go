@@ -0,0 +1,202 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package model contains deterministic single-threaded reference implementations of otter caches
+// and helpers for differential testing of the real caches against them.
+package model
+
+import (
+	"time"
+
+	"github.com/maypok86/otter/internal/node"
+	"github.com/maypok86/otter/internal/s3fifo"
+)
+
+// Model is a deterministic single-threaded cache model.
+//
+// It uses a plain map instead of the concurrent hash table and applies the eviction policy synchronously
+// on every write, so the same sequence of operations always leads to the same state.
+// Time is logical and only moves forward when Advance is called.
+type Model[K comparable, V any] struct {
+	policy    *s3fifo.Policy[K, V]
+	nodes     map[K]*node.Node[K, V]
+	deadlines map[K]time.Duration
+	deleted   []*node.Node[K, V]
+	costFunc  func(key K, value V) uint32
+	capacity  int
+	ttl       time.Duration
+	now       time.Duration
+}
+
+// New creates a model of a cache with the given capacity.
+//
+// A positive ttl makes the model behave like a cache with const TTL.
+// A nil costFunc means that the cost of every item is 1.
+func New[K comparable, V any](capacity int, ttl time.Duration, costFunc func(key K, value V) uint32) *Model[K, V] {
+	if costFunc == nil {
+		costFunc = func(key K, value V) uint32 {
+			return 1
+		}
+	}
+
+	return &Model[K, V]{
+		policy:    s3fifo.NewPolicy[K, V](uint32(capacity)),
+		nodes:     make(map[K]*node.Node[K, V]),
+		deadlines: make(map[K]time.Duration),
+		deleted:   make([]*node.Node[K, V], 0, 16),
+		costFunc:  costFunc,
+		capacity:  capacity,
+		ttl:       ttl,
+	}
+}
+
+// Get returns the value associated with the key in the model.
+func (m *Model[K, V]) Get(key K) (V, bool) {
+	n, ok := m.nodes[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+
+	if m.isExpired(key) {
+		m.remove(n)
+		var zero V
+		return zero, false
+	}
+
+	m.policy.Read([]*node.Node[K, V]{n})
+	return n.Value(), true
+}
+
+// Set associates the value with the key using the default ttl of the model.
+func (m *Model[K, V]) Set(key K, value V) bool {
+	return m.set(key, value, m.ttl, false)
+}
+
+// SetWithTTL associates the value with the key and sets the custom ttl for this key-value item.
+func (m *Model[K, V]) SetWithTTL(key K, value V, ttl time.Duration) bool {
+	return m.set(key, value, ttl, false)
+}
+
+// SetIfAbsent associates the value with the key only if the key is not already associated with a value.
+func (m *Model[K, V]) SetIfAbsent(key K, value V) bool {
+	return m.set(key, value, m.ttl, true)
+}
+
+// SetIfAbsentWithTTL is like SetIfAbsent but sets the custom ttl for this key-value item.
+func (m *Model[K, V]) SetIfAbsentWithTTL(key K, value V, ttl time.Duration) bool {
+	return m.set(key, value, ttl, true)
+}
+
+func (m *Model[K, V]) set(key K, value V, ttl time.Duration, onlyIfAbsent bool) bool {
+	cost := m.costFunc(key, value)
+	if cost > m.policy.MaxAvailableCost() {
+		return false
+	}
+
+	old, ok := m.nodes[key]
+	if ok && m.isExpired(key) {
+		m.remove(old)
+		old, ok = nil, false
+	}
+	if ok && onlyIfAbsent {
+		return false
+	}
+
+	// expiration is tracked by the model itself using the logical clock.
+	n := node.New(key, value, 0, cost)
+	m.nodes[key] = n
+	if ttl > 0 {
+		m.deadlines[key] = m.now + ttl
+	} else {
+		delete(m.deadlines, key)
+	}
+
+	task := node.NewAddTask(n)
+	if ok {
+		task = node.NewUpdateTask(n, old)
+	}
+	m.deleted = m.policy.Write(m.deleted, []node.WriteTask[K, V]{task})
+	for i, d := range m.deleted {
+		m.forget(d)
+		m.deleted[i] = nil
+	}
+	m.deleted = m.deleted[:0]
+
+	return true
+}
+
+// Delete removes the association for this key from the model.
+func (m *Model[K, V]) Delete(key K) {
+	if n, ok := m.nodes[key]; ok {
+		m.remove(n)
+	}
+}
+
+// Advance moves the logical clock of the model forward and removes all expired items.
+func (m *Model[K, V]) Advance(d time.Duration) {
+	m.now += d
+	for key, deadline := range m.deadlines {
+		if deadline <= m.now {
+			m.remove(m.nodes[key])
+		}
+	}
+}
+
+// Now returns the current logical time of the model.
+func (m *Model[K, V]) Now() time.Duration {
+	return m.now
+}
+
+// Size returns the current number of items in the model.
+func (m *Model[K, V]) Size() int {
+	return len(m.nodes)
+}
+
+// Capacity returns the model capacity.
+func (m *Model[K, V]) Capacity() int {
+	return m.capacity
+}
+
+// Range iterates over all items in the model.
+//
+// Iteration stops early when the given function returns false.
+func (m *Model[K, V]) Range(f func(key K, value V) bool) {
+	for key, n := range m.nodes {
+		if m.isExpired(key) {
+			continue
+		}
+
+		if !f(key, n.Value()) {
+			return
+		}
+	}
+}
+
+func (m *Model[K, V]) isExpired(key K) bool {
+	deadline, ok := m.deadlines[key]
+	return ok && deadline <= m.now
+}
+
+func (m *Model[K, V]) remove(n *node.Node[K, V]) {
+	m.policy.Delete([]*node.Node[K, V]{n})
+	m.forget(n)
+}
+
+func (m *Model[K, V]) forget(n *node.Node[K, V]) {
+	if current, ok := m.nodes[n.Key()]; ok && current == n {
+		delete(m.nodes, n.Key())
+		delete(m.deadlines, n.Key())
+	}
+}
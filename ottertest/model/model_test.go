@@ -0,0 +1,151 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/maypok86/otter"
+)
+
+func TestModel_Eviction(t *testing.T) {
+	const capacity = 10
+	m := New[int, int](capacity, 0, nil)
+
+	for i := 0; i < 10*capacity; i++ {
+		m.Set(i, i)
+		if size := m.Size(); size > capacity {
+			t.Fatalf("m.Size() = %d, want <= %d", size, capacity)
+		}
+	}
+
+	m.Range(func(key, value int) bool {
+		if key != value {
+			t.Fatalf("got unexpected key/value: %d/%d", key, value)
+		}
+		return true
+	})
+}
+
+func TestModel_Deterministic(t *testing.T) {
+	ops := DecodeOps([]byte("the same sequence of operations always leads to the same state"), 16)
+
+	run := func() map[int]int {
+		m := New[int, int](8, 0, nil)
+		for _, op := range ops {
+			switch op.Kind {
+			case OpGet:
+				m.Get(op.Key)
+			case OpSet:
+				m.Set(op.Key, op.Value)
+			case OpSetIfAbsent:
+				m.SetIfAbsent(op.Key, op.Value)
+			case OpDelete:
+				m.Delete(op.Key)
+			}
+		}
+
+		state := make(map[int]int, m.Size())
+		m.Range(func(key, value int) bool {
+			state[key] = value
+			return true
+		})
+		return state
+	}
+
+	expected := run()
+	for i := 0; i < 10; i++ {
+		got := run()
+		if len(got) != len(expected) {
+			t.Fatalf("got %d items, want %d", len(got), len(expected))
+		}
+		for k, v := range expected {
+			if got[k] != v {
+				t.Fatalf("got %d for key %d, want %d", got[k], k, v)
+			}
+		}
+	}
+}
+
+func TestModel_TTL(t *testing.T) {
+	m := New[int, int](100, time.Minute, nil)
+
+	m.Set(1, 1)
+	m.SetWithTTL(2, 2, time.Hour)
+	m.Advance(time.Minute - time.Nanosecond)
+	if _, ok := m.Get(1); !ok {
+		t.Fatal("key 1 should not be expired yet")
+	}
+
+	m.Advance(time.Nanosecond)
+	if _, ok := m.Get(1); ok {
+		t.Fatal("key 1 should be expired")
+	}
+	if !m.SetIfAbsent(1, 10) {
+		t.Fatal("SetIfAbsent should succeed for an expired key")
+	}
+	if v, ok := m.Get(2); !ok || v != 2 {
+		t.Fatalf("got %d/%v for key 2, want 2/true", v, ok)
+	}
+
+	m.Advance(time.Hour)
+	if size := m.Size(); size != 0 {
+		t.Fatalf("m.Size() = %d, want = 0", size)
+	}
+}
+
+func TestCheck_Violation(t *testing.T) {
+	c, err := otter.MustBuilder[int, int](10).WithVariableTTL().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	target := FromCacheWithVariableTTL(c)
+	ops := []Op[int, int]{
+		{Kind: OpSet, Key: 1, Value: 1},
+		{Kind: OpGet, Key: 1},
+	}
+	if err := Check[int, int](broken{Target: target}, ops, Options{}); err == nil {
+		t.Fatal("check should detect a stale value")
+	}
+}
+
+type broken struct {
+	Target[int, int]
+}
+
+func (b broken) Get(key int) (int, bool) {
+	v, ok := b.Target.Get(key)
+	return v + 1, ok
+}
+
+func FuzzCheck(f *testing.F) {
+	f.Add([]byte{1, 1, 1, 0, 1, 0, 3, 1, 0, 0, 1, 0})
+	f.Add([]byte("set get delete set-if-absent and so on"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c, err := otter.MustBuilder[int, int](16).Build()
+		if err != nil {
+			t.Fatalf("can not create cache: %v", err)
+		}
+		defer c.Close()
+
+		if err := Check(FromCache(c), DecodeOps(data, 32), Options{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
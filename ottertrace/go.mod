@@ -0,0 +1,17 @@
+module github.com/maypok86/otter/ottertrace
+
+go 1.18
+
+require (
+	github.com/maypok86/otter v0.0.0-00010101000000-000000000000
+	go.opentelemetry.io/otel v1.10.0
+	go.opentelemetry.io/otel/trace v1.10.0
+)
+
+require (
+	github.com/dolthub/maphash v0.1.0 // indirect
+	github.com/dolthub/swiss v0.2.1 // indirect
+	github.com/gammazero/deque v0.2.1 // indirect
+)
+
+replace github.com/maypok86/otter => ../
@@ -0,0 +1,72 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ottertrace provides an otter.Tracer backed by OpenTelemetry.
+//
+// It lives in a separate module, so otter itself doesn't depend on OpenTelemetry.
+package ottertrace
+
+import (
+	"context"
+
+	"github.com/maypok86/otter"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/maypok86/otter"
+
+// Tracer is an otter.Tracer which starts OpenTelemetry spans.
+//
+// Spans are annotated with the cache name, the hash of the key and whether the lookup was a hit.
+type Tracer struct {
+	tracer    trace.Tracer
+	cacheName attribute.KeyValue
+}
+
+// New creates a Tracer that starts spans with the given provider, annotating them with the given cache name.
+func New(provider trace.TracerProvider, cacheName string) *Tracer {
+	return &Tracer{
+		tracer:    provider.Tracer(tracerName),
+		cacheName: attribute.String("otter.cache.name", cacheName),
+	}
+}
+
+// Start starts a span of the operation on the key with the given hash.
+func (t *Tracer) Start(ctx context.Context, operation string, keyHash uint64) (context.Context, otter.Span) {
+	ctx, span := t.tracer.Start(ctx, operation, trace.WithAttributes(
+		t.cacheName,
+		attribute.Int64("otter.key.hash", int64(keyHash)),
+	))
+	return ctx, spanAdapter{span: span}
+}
+
+type spanAdapter struct {
+	span trace.Span
+}
+
+func (s spanAdapter) SetHit(hit bool) {
+	s.span.SetAttributes(attribute.Bool("otter.cache.hit", hit))
+}
+
+func (s spanAdapter) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+var _ otter.Tracer = (*Tracer)(nil)
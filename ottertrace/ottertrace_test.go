@@ -0,0 +1,149 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ottertrace
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maypok86/otter"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type recordedSpan struct {
+	trace.Span
+	name   string
+	parent trace.SpanContext
+	attrs  map[attribute.Key]attribute.Value
+	err    error
+	status codes.Code
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...attribute.KeyValue) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) RecordError(err error, _ ...trace.EventOption) {
+	s.err = err
+}
+
+func (s *recordedSpan) SetStatus(code codes.Code, _ string) {
+	s.status = code
+}
+
+func (s *recordedSpan) End(_ ...trace.SpanEndOption) {
+	s.ended = true
+}
+
+type recordingProvider struct {
+	mutex sync.Mutex
+	spans []*recordedSpan
+}
+
+func (p *recordingProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return p
+}
+
+func (p *recordingProvider) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{byte(len(p.spans) + 1)},
+	})
+	s := &recordedSpan{
+		Span:   trace.SpanFromContext(trace.ContextWithSpanContext(context.Background(), sc)),
+		name:   name,
+		parent: trace.SpanContextFromContext(ctx),
+		attrs:  make(map[attribute.Key]attribute.Value),
+	}
+	config := trace.NewSpanStartConfig(opts...)
+	s.SetAttributes(config.Attributes()...)
+	p.spans = append(p.spans, s)
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+func (p *recordingProvider) reset() []*recordedSpan {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	spans := p.spans
+	p.spans = nil
+	return spans
+}
+
+func TestTracer(t *testing.T) {
+	errBackend := errors.New("backend is unavailable")
+	provider := &recordingProvider{}
+	cache, err := otter.MustBuilder[int, int](100).WithTTL(time.Hour).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	lc, err := otter.NewLoadingCache[int, int](cache, func(ctx context.Context, key int) (int, error) {
+		if key < 0 {
+			return 0, errBackend
+		}
+		return key, nil
+	}, otter.WithTracing(New(provider, "users")))
+	if err != nil {
+		t.Fatalf("can not create loading cache: %v", err)
+	}
+	defer lc.Close()
+
+	lc.Get(context.Background(), 1)
+	spans := provider.reset()
+	if len(spans) != 2 || spans[0].name != "otter.Get" || spans[1].name != "otter.Load" {
+		t.Fatalf("Get and Load spans should be started, but got %d spans", len(spans))
+	}
+	get, load := spans[0], spans[1]
+	if load.parent.SpanID() != get.SpanContext().SpanID() {
+		t.Fatal("Load span should be a child of the Get span")
+	}
+	if get.attrs["otter.cache.hit"].AsBool() || get.attrs["otter.cache.name"].AsString() != "users" {
+		t.Fatalf("Get span has invalid attributes: %v", get.attrs)
+	}
+	if get.attrs["otter.key.hash"] != load.attrs["otter.key.hash"] {
+		t.Fatal("spans should have the same key hash")
+	}
+	if !get.ended || !load.ended {
+		t.Fatal("spans should be ended")
+	}
+
+	lc.Get(context.Background(), 1)
+	spans = provider.reset()
+	if len(spans) != 1 || !spans[0].attrs["otter.cache.hit"].AsBool() {
+		t.Fatalf("hit should be traced without a Load span, but got %d spans", len(spans))
+	}
+
+	lc.Get(context.Background(), -1)
+	spans = provider.reset()
+	if len(spans) != 2 {
+		t.Fatalf("failed load should be traced, but got %d spans", len(spans))
+	}
+	for _, s := range spans {
+		if !errors.Is(s.err, errBackend) || s.status != codes.Error {
+			t.Fatalf("loader error should be recorded in %s", s.name)
+		}
+	}
+}
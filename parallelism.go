@@ -0,0 +1,29 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import "github.com/maypok86/otter/internal/xruntime"
+
+// SetParallelism overrides the detected number of CPUs available to the process, which is used to size
+// the striped internal structures of the caches created afterwards, such as read buffers and counters.
+//
+// By default, it is the minimum of GOMAXPROCS, the number of CPUs and the cgroup CPU quota rounded up.
+// A non-positive value restores the detection.
+func SetParallelism(p int) {
+	if p < 0 {
+		p = 0
+	}
+	xruntime.SetParallelism(uint32(p))
+}
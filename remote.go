@@ -0,0 +1,118 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrIllegalRemote means that a nil remote cache, key func or codec or a negative ttl
+	// has been passed to the WithRemote.
+	ErrIllegalRemote = errors.New("remote cache, key func and codec should not be nil and ttl should not be negative")
+	// ErrMismatchedRemote means that the key func or the codec passed to the WithRemote
+	// doesn't match the key and value types of the cache.
+	ErrMismatchedRemote = errors.New("remote key func and codec don't match the key and value types of the cache")
+)
+
+// RemoteCache is a shared remote cache, such as Redis or Memcached, used as the second level
+// behind an in-process otter cache in near-cache deployments. See WithRemote.
+//
+// Values are opaque bytes, so encoding of keys and values is up to the caller.
+// Reference adapters are provided in the otterredis and ottermemcache modules.
+type RemoteCache interface {
+	// Get returns the value associated with the key. The ok result is false if the key is missing.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set associates the value with the key for the given ttl. Zero ttl means that the value never expires.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// WithRemote makes the LoadingCache use the remote cache as the second level: a missing value is looked up
+// in the remote cache before the Loader is called, and the values returned by the Loader are stored
+// in the remote cache for the given ttl, so the instances sharing the remote cache call the Loader once per key.
+//
+// The keys are encoded with the key func and the values with the codec. If the key and value types of them
+// don't match the cache, then NewLoadingCache returns ErrMismatchedRemote.
+//
+// The remote cache is a cache too, so its failures aren't returned: a failed or undecodable lookup
+// falls back to the Loader, and a failed store is skipped. Refresh and the refreshes of stale values
+// call the Loader directly, since a reload is expected to get a newer value than the cached ones.
+func WithRemote[K comparable, V any](remote RemoteCache, key func(key K) string, codec Codec[V], ttl time.Duration) LoadingOption {
+	return func(o *loadingOptions) {
+		o.withRemote = true
+		if remote == nil || key == nil || codec == nil || ttl < 0 {
+			o.remote = nil
+			return
+		}
+		o.remote = &remoteTier[K, V]{
+			remote: remote,
+			key:    key,
+			codec:  codec,
+			ttl:    ttl,
+		}
+	}
+}
+
+type remoteTier[K comparable, V any] struct {
+	remote RemoteCache
+	key    func(key K) string
+	codec  Codec[V]
+	ttl    time.Duration
+}
+
+func newRemoteTier[K comparable, V any](o loadingOptions) (*remoteTier[K, V], error) {
+	if o.remote == nil {
+		return nil, newConfigError("WithRemote", nil, ErrIllegalRemote)
+	}
+	r, ok := o.remote.(*remoteTier[K, V])
+	if !ok {
+		return nil, newConfigError("WithRemote", fmt.Sprintf("%T", o.remote), ErrMismatchedRemote)
+	}
+	return r, nil
+}
+
+// get returns the value of the key stored in the remote cache.
+func (r *remoteTier[K, V]) get(ctx context.Context, key K) (V, bool) {
+	var zero V
+	data, ok, err := r.remote.Get(ctx, r.key(key))
+	if err != nil || !ok {
+		return zero, false
+	}
+	value, err := r.codec.Decode(data)
+	if err != nil {
+		return zero, false
+	}
+	return value, true
+}
+
+// set stores the value of the key in the remote cache.
+func (r *remoteTier[K, V]) set(ctx context.Context, key K, value V) {
+	data, err := r.codec.Encode(value)
+	if err != nil {
+		return
+	}
+	// the remote cache is only a cache, so the value is loaded again if it isn't stored.
+	_ = r.remote.Set(ctx, r.key(key), data, r.ttl)
+}
+
+// delete removes the key from the remote cache.
+func (r *remoteTier[K, V]) delete(ctx context.Context, key K) error {
+	return r.remote.Delete(ctx, r.key(key))
+}
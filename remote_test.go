@@ -0,0 +1,169 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type mapRemote struct {
+	mutex sync.Mutex
+	items map[string][]byte
+	ttls  map[string]time.Duration
+	err   error
+}
+
+func newMapRemote() *mapRemote {
+	return &mapRemote{
+		items: make(map[string][]byte),
+		ttls:  make(map[string]time.Duration),
+	}
+}
+
+func (r *mapRemote) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil {
+		return nil, false, r.err
+	}
+	v, ok := r.items[key]
+	return v, ok, nil
+}
+
+func (r *mapRemote) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.items[key] = value
+	r.ttls[key] = ttl
+	return nil
+}
+
+func (r *mapRemote) Delete(ctx context.Context, key string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.items, key)
+	return nil
+}
+
+func (r *mapRemote) get(key string) (string, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	v, ok := r.items[key]
+	return string(v), ok
+}
+
+type intCodec struct{}
+
+func (intCodec) Encode(value int) ([]byte, error) {
+	return []byte(strconv.Itoa(value)), nil
+}
+
+func (intCodec) Decode(data []byte) (int, error) {
+	return strconv.Atoi(string(data))
+}
+
+func TestLoadingCache_Remote(t *testing.T) {
+	remote := newMapRemote()
+	var calls atomic.Int64
+	loader := func(ctx context.Context, key int) (int, error) {
+		calls.Add(1)
+		return key * 10, nil
+	}
+	withRemote := WithRemote[int, int](remote, strconv.Itoa, intCodec{}, time.Minute)
+	lc := newTestLoadingCache(t, loader, withRemote)
+	defer lc.Close()
+
+	// the loaded value is written through to the remote cache.
+	if v, err := lc.Get(context.Background(), 1); err != nil || v != 10 || calls.Load() != 1 {
+		t.Fatalf("lc.Get(1) = %d/%v, want 10/nil", v, err)
+	}
+	if v, ok := remote.get("1"); !ok || v != "10" || remote.ttls["1"] != time.Minute {
+		t.Fatalf("loaded value should be stored in the remote cache, but got %s/%v", v, ok)
+	}
+
+	// another instance reads the value through the remote cache without calling the loader.
+	other := newTestLoadingCache(t, loader, withRemote)
+	defer other.Close()
+	if v, err := other.Get(context.Background(), 1); err != nil || v != 10 || calls.Load() != 1 {
+		t.Fatalf("other.Get(1) = %d/%v, want 10/nil without a load", v, err)
+	}
+	if !other.Cache().Has(1) {
+		t.Fatal("remote value should be stored in the local cache")
+	}
+
+	// an undecodable value is loaded again.
+	remote.Set(context.Background(), "2", []byte("bad"), 0)
+	if v, err := lc.Get(context.Background(), 2); err != nil || v != 20 || calls.Load() != 2 {
+		t.Fatalf("lc.Get(2) = %d/%v, want 20/nil", v, err)
+	}
+
+	// a reload calls the loader even though the remote cache has the value.
+	lc.Refresh(1)
+	lc.loads.Wait()
+	if calls.Load() != 3 {
+		t.Fatalf("refresh should call the loader, but it was called %d times", calls.Load())
+	}
+
+	if err := lc.Invalidate(context.Background(), 1); err != nil {
+		t.Fatalf("invalidate failed: %v", err)
+	}
+	if _, ok := remote.get("1"); ok || lc.Cache().Has(1) {
+		t.Fatal("invalidated value should be deleted from both levels")
+	}
+
+	// the failures of the remote cache fall back to the loader.
+	remote.mutex.Lock()
+	remote.err = errors.New("remote is down")
+	remote.mutex.Unlock()
+	if v, err := lc.Get(context.Background(), 3); err != nil || v != 30 || calls.Load() != 4 {
+		t.Fatalf("lc.Get(3) = %d/%v, want 30/nil", v, err)
+	}
+}
+
+func TestLoadingCache_RemoteErrors(t *testing.T) {
+	c, err := MustBuilder[int, int](100).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+	loader := func(ctx context.Context, key int) (int, error) {
+		return key, nil
+	}
+
+	var cfgErr *ConfigError
+	_, err = NewLoadingCache[int, int](c, loader, WithRemote[int, int](nil, strconv.Itoa, intCodec{}, 0))
+	if !errors.Is(err, ErrIllegalRemote) || !errors.As(err, &cfgErr) || cfgErr.Field != "WithRemote" {
+		t.Fatalf("should fail with a config error %v, but got %v", ErrIllegalRemote, err)
+	}
+	_, err = NewLoadingCache[int, int](c, loader, WithRemote[int, int](newMapRemote(), strconv.Itoa, intCodec{}, -1))
+	if !errors.Is(err, ErrIllegalRemote) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalRemote, err)
+	}
+	_, err = NewLoadingCache[int, int](c, loader, WithRemote[string, int](newMapRemote(), func(key string) string {
+		return key
+	}, intCodec{}, 0))
+	if !errors.Is(err, ErrMismatchedRemote) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrMismatchedRemote, err)
+	}
+}
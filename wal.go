@@ -0,0 +1,316 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maypok86/otter/internal/core"
+	"github.com/maypok86/otter/internal/node"
+)
+
+const (
+	walSnapshotName  = "snapshot"
+	walSegmentPrefix = "journal-"
+	// walFlushInterval is how often buffered journal writes are flushed to the segment file.
+	walFlushInterval = time.Second
+)
+
+// wal persists the cache to a directory as a snapshot and the journal segments with the mutations made after it.
+// The snapshot also keeps the state of the items in the eviction policy.
+//
+// The compaction rotates the segment and writes a new snapshot while the writers append to the new segment,
+// so the cache is never blocked for the duration of a full dump. The snapshot may already contain some mutations
+// of the new segment, but replaying them again is harmless, since the segment has the latest mutation of every key.
+type wal[K comparable, V any] struct {
+	dir      string
+	interval time.Duration
+	journal  *journal[K, V]
+	cache    *core.Cache[K, V]
+	logger   core.Logger
+
+	// mutex serializes the compaction, flushing and closing.
+	mutex   sync.Mutex
+	segment *os.File
+	buffer  *bufio.Writer
+	seq     uint64
+	closed  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newWAL[K comparable, V any](dir string, interval time.Duration, logger core.Logger) *wal[K, V] {
+	return &wal[K, V]{
+		dir:      dir,
+		interval: interval,
+		// the journal is discarded until the persisted state is replayed.
+		journal: newJournal[K, V](io.Discard),
+		logger:  logger,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// open replays the persisted state into the cache and starts a new journal segment.
+func (w *wal[K, V]) open(bs baseCache[K, V]) error {
+	w.cache = bs.cache
+	if err := os.MkdirAll(w.dir, 0o755); err != nil {
+		return fmt.Errorf("otter: open wal: %w", err)
+	}
+
+	if err := w.replay(bs, filepath.Join(w.dir, walSnapshotName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	seqs, err := w.segments()
+	if err != nil {
+		return err
+	}
+	for _, seq := range seqs {
+		// the last mutation may be partially written if the process crashed.
+		if err := w.replay(bs, w.segmentPath(seq)); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+		w.seq = seq
+	}
+
+	segment, buffer, err := w.createSegment(w.seq + 1)
+	if err != nil {
+		return err
+	}
+	w.journal.mutex.Lock()
+	w.segment, w.buffer, w.seq = segment, buffer, w.seq+1
+	w.journal.reset(buffer)
+	w.journal.mutex.Unlock()
+
+	go w.run()
+	return nil
+}
+
+func (w *wal[K, V]) replay(bs baseCache[K, V], path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("otter: open wal: %w", err)
+	}
+	defer f.Close()
+
+	return bs.ReplayJournal(bufio.NewReader(f))
+}
+
+// segments returns the sequence numbers of the journal segments in ascending order.
+func (w *wal[K, V]) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, fmt.Errorf("otter: open wal: %w", err)
+	}
+
+	var seqs []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, walSegmentPrefix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimPrefix(name, walSegmentPrefix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool {
+		return seqs[i] < seqs[j]
+	})
+	return seqs, nil
+}
+
+func (w *wal[K, V]) segmentPath(seq uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%s%020d", walSegmentPrefix, seq))
+}
+
+func (w *wal[K, V]) createSegment(seq uint64) (*os.File, *bufio.Writer, error) {
+	f, err := os.OpenFile(w.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("otter: create wal segment: %w", err)
+	}
+	return f, bufio.NewWriter(f), nil
+}
+
+func (w *wal[K, V]) run() {
+	defer close(w.done)
+
+	flush := time.NewTicker(walFlushInterval)
+	defer flush.Stop()
+	compaction := time.NewTicker(w.interval)
+	defer compaction.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-flush.C:
+			if err := w.flush(); err != nil {
+				w.warn("otter: wal flush failed", err)
+			}
+		case <-compaction.C:
+			if err := w.compact(); err != nil {
+				w.warn("otter: wal compaction failed", err)
+			}
+		}
+	}
+}
+
+func (w *wal[K, V]) warn(msg string, err error) {
+	if w.logger != nil {
+		w.logger.Warn(msg, "dir", w.dir, "error", err)
+	}
+}
+
+func (w *wal[K, V]) flush() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return nil
+	}
+
+	w.journal.mutex.Lock()
+	defer w.journal.mutex.Unlock()
+
+	return w.buffer.Flush()
+}
+
+// compact replaces the persisted state with a snapshot of the cache and removes the replayed journal segments.
+func (w *wal[K, V]) compact() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return nil
+	}
+
+	seq := w.seq + 1
+	segment, buffer, err := w.createSegment(seq)
+	if err != nil {
+		return err
+	}
+	w.journal.mutex.Lock()
+	flushErr := w.buffer.Flush()
+	w.journal.reset(buffer)
+	w.journal.mutex.Unlock()
+
+	old := w.segment
+	w.segment, w.buffer, w.seq = segment, buffer, seq
+	if err := closeFile(old, flushErr); err != nil {
+		return fmt.Errorf("otter: close wal segment: %w", err)
+	}
+
+	if err := w.writeSnapshot(); err != nil {
+		return err
+	}
+
+	seqs, err := w.segments()
+	if err != nil {
+		return err
+	}
+	for _, s := range seqs {
+		if s >= seq {
+			break
+		}
+		if err := os.Remove(w.segmentPath(s)); err != nil {
+			return fmt.Errorf("otter: remove wal segment: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *wal[K, V]) writeSnapshot() error {
+	path := filepath.Join(w.dir, walSnapshotName)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("otter: write wal snapshot: %w", err)
+	}
+
+	buffer := bufio.NewWriter(f)
+	encoder := gob.NewEncoder(buffer)
+	var encodeErr error
+	w.cache.RangeNodes(func(n *node.Node[K, V], frequency uint8, main bool) bool {
+		r, _ := newJournalRecord(core.InsertEvent, n)
+		r.Policy = &journalPolicy{
+			Frequency: frequency,
+			Main:      main,
+		}
+		encodeErr = encoder.Encode(r)
+		return encodeErr == nil
+	})
+	if encodeErr == nil {
+		encodeErr = buffer.Flush()
+	}
+	if err := closeFile(f, encodeErr); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("otter: write wal snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("otter: write wal snapshot: %w", err)
+	}
+	return nil
+}
+
+// close flushes the journal and stops the background flushing and compaction.
+func (w *wal[K, V]) close() error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mutex.Unlock()
+
+	close(w.stop)
+	<-w.done
+
+	w.journal.mutex.Lock()
+	flushErr := w.buffer.Flush()
+	w.journal.reset(io.Discard)
+	w.journal.mutex.Unlock()
+
+	if err := closeFile(w.segment, flushErr); err != nil {
+		return fmt.Errorf("otter: close wal: %w", err)
+	}
+	return nil
+}
+
+// closeFile syncs and closes the file, returning the first error including the given one.
+func closeFile(f *os.File, err error) error {
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otter
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/maypok86/otter/internal/node"
+)
+
+func newTestWALCache(t *testing.T, dir string) Cache[int, int] {
+	t.Helper()
+
+	c, err := MustBuilder[int, int](1000).WithTTL(time.Hour).WAL(dir, time.Hour).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	return c
+}
+
+func TestWAL_Restore(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestWALCache(t, dir)
+	for i := 0; i < 100; i++ {
+		c.Set(i, i*10)
+	}
+	c.Delete(5)
+	c.Set(7, 700)
+	c.Close()
+
+	c = newTestWALCache(t, dir)
+	if got := c.Size(); got != 99 {
+		t.Fatalf("restored cache should contain 99 items, but got %d", got)
+	}
+	if c.Has(5) {
+		t.Fatal("deleted item should not be restored")
+	}
+	if v, ok := c.Get(7); !ok || v != 700 {
+		t.Fatalf("latest value should be restored, but got %d/%v", v, ok)
+	}
+	e, _ := c.GetEntry(1)
+	if ttl := e.TTL(); ttl <= 59*time.Minute {
+		t.Fatalf("restored item should keep its expiration, but got ttl %v", ttl)
+	}
+
+	// the writes made during the restore should not be persisted again.
+	c.Close()
+	segments, _ := filepath.Glob(filepath.Join(dir, walSegmentPrefix+"*"))
+	if len(segments) != 2 {
+		t.Fatalf("got %d segments, want 2", len(segments))
+	}
+	if fi, err := os.Stat(segments[1]); err != nil || fi.Size() != 0 {
+		t.Fatal("segment written during the restore should be empty")
+	}
+}
+
+func TestWAL_RestoreAfterClear(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestWALCache(t, dir)
+	for i := 0; i < 100; i++ {
+		c.Set(i, i)
+	}
+	c.Clear()
+	c.Set(1000, 1000)
+	c.Close()
+
+	c = newTestWALCache(t, dir)
+	defer c.Close()
+	if got := c.Size(); got != 1 {
+		t.Fatalf("restored cache should contain only the item set after Clear, but got %d items", got)
+	}
+	if !c.Has(1000) {
+		t.Fatal("item set after Clear should be restored")
+	}
+}
+
+func TestWAL_Compact(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestWALCache(t, dir)
+	for i := 0; i < 100; i++ {
+		c.Set(i, i)
+	}
+	if err := c.wal.compact(); err != nil {
+		t.Fatalf("compaction failed: %v", err)
+	}
+	c.Delete(1)
+	c.Set(2, 200)
+	c.Close()
+
+	segments, _ := filepath.Glob(filepath.Join(dir, walSegmentPrefix+"*"))
+	if len(segments) != 1 {
+		t.Fatalf("compaction should remove the old segments, but got %d segments", len(segments))
+	}
+	if _, err := os.Stat(filepath.Join(dir, walSnapshotName)); err != nil {
+		t.Fatalf("snapshot should be written: %v", err)
+	}
+
+	c = newTestWALCache(t, dir)
+	defer c.Close()
+	if got := c.Size(); got != 99 {
+		t.Fatalf("restored cache should contain 99 items, but got %d", got)
+	}
+	if v, ok := c.Get(2); !ok || v != 200 {
+		t.Fatalf("mutation made after the compaction should be restored, but got %d/%v", v, ok)
+	}
+}
+
+func TestWAL_TruncatedSegment(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestWALCache(t, dir)
+	for i := 0; i < 10; i++ {
+		c.Set(i, i)
+	}
+	c.Close()
+
+	segments, _ := filepath.Glob(filepath.Join(dir, walSegmentPrefix+"*"))
+	fi, err := os.Stat(segments[0])
+	if err != nil {
+		t.Fatalf("can not stat segment: %v", err)
+	}
+	if err := os.Truncate(segments[0], fi.Size()-2); err != nil {
+		t.Fatalf("can not truncate segment: %v", err)
+	}
+
+	c = newTestWALCache(t, dir)
+	defer c.Close()
+	if got := c.Size(); got != 9 {
+		t.Fatalf("all mutations but the partially written one should be restored, but got %d items", got)
+	}
+}
+
+func TestWAL_Errors(t *testing.T) {
+	for _, b := range []*Builder[int, int]{
+		MustBuilder[int, int](10).WAL("", time.Hour),
+		MustBuilder[int, int](10).WAL(t.TempDir(), 0),
+		MustBuilder[int, int](10).WAL(t.TempDir(), time.Hour).Journal(os.Stdout),
+	} {
+		if _, err := b.Build(); !errors.Is(err, ErrIllegalWAL) {
+			t.Fatalf("should fail with an error %v, but got %v", ErrIllegalWAL, err)
+		}
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatalf("can not create file: %v", err)
+	}
+	if _, err := MustBuilder[int, int](10).WAL(file, time.Hour).Build(); err == nil {
+		t.Fatal("file should not be used as the wal dir")
+	}
+}
+
+func TestWAL_PolicyState(t *testing.T) {
+	dir := t.TempDir()
+	c := newTestWALCache(t, dir)
+	c.cache.Restore(1, 1, 0, 3, true)
+	c.cache.Restore(2, 2, 0, 1, false)
+	if err := c.wal.compact(); err != nil {
+		t.Fatalf("compaction failed: %v", err)
+	}
+	c.Close()
+
+	c = newTestWALCache(t, dir)
+	defer c.Close()
+	got := make(map[int]journalPolicy)
+	c.cache.RangeNodes(func(n *node.Node[int, int], frequency uint8, main bool) bool {
+		got[n.Key()] = journalPolicy{Frequency: frequency, Main: main}
+		return true
+	})
+	want := map[int]journalPolicy{
+		1: {Frequency: 3, Main: true},
+		2: {Frequency: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("policy state should be restored, got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build js || wasip1
+
+package otter
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCache_WASM(t *testing.T) {
+	before := runtime.NumGoroutine()
+	c, err := MustBuilder[int, int](100).WithTTL(time.Minute).Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("cache shouldn't start goroutines on WebAssembly, but got %d -> %d", before, after)
+	}
+	c.Set(1, 1)
+	if v, ok := c.Get(1); !ok || v != 1 {
+		t.Fatalf("should get 1, but got %d %v", v, ok)
+	}
+
+	_, err = MustBuilder[int, int](100).ScaleReadBuffers(1, 4).Build()
+	if !errors.Is(err, ErrIllegalAmortizedMaintenance) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalAmortizedMaintenance, err)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.24
+
+package otter
+
+import (
+	"runtime"
+	"weak"
+)
+
+// Weak is a weak pointer to a value, which doesn't keep the value alive.
+//
+// Use it as the value type of a cache built with WeakValues to cache large values
+// as long as they are used somewhere else, for example, decoded assets.
+type Weak[T any] struct {
+	p weak.Pointer[T]
+}
+
+// MakeWeak creates a weak pointer to the given value.
+func MakeWeak[T any](value *T) Weak[T] {
+	return Weak[T]{p: weak.Make(value)}
+}
+
+// Value returns the pointer to the value or nil if the value has already been reclaimed by the garbage collector.
+func (w Weak[T]) Value() *T {
+	return w.p.Value()
+}
+
+func (w Weak[T]) onReclaim(f func()) {
+	value := w.p.Value()
+	if value == nil {
+		return
+	}
+	runtime.AddCleanup(value, func(f func()) {
+		f()
+	}, f)
+}
+
+// WeakValues makes the cache remove the items whose values have been reclaimed by the garbage collector,
+// the removals are reported as EventEvict. The value type of the cache must be Weak.
+//
+// The item may still be returned with a nil Weak.Value for a short time after its value has been reclaimed.
+// Node pooling is disabled in this mode.
+func (b *Builder[K, V]) WeakValues() *Builder[K, V] {
+	b.enableWeakValues()
+	return b
+}
+
+// WeakValues makes the cache remove the items whose values have been reclaimed by the garbage collector,
+// the removals are reported as EventEvict. The value type of the cache must be Weak.
+//
+// The item may still be returned with a nil Weak.Value for a short time after its value has been reclaimed.
+// Node pooling is disabled in this mode.
+func (b *ConstTTLBuilder[K, V]) WeakValues() *ConstTTLBuilder[K, V] {
+	b.enableWeakValues()
+	return b
+}
+
+// WeakValues makes the cache remove the items whose values have been reclaimed by the garbage collector,
+// the removals are reported as EventEvict. The value type of the cache must be Weak.
+//
+// The item may still be returned with a nil Weak.Value for a short time after its value has been reclaimed.
+// Node pooling is disabled in this mode.
+func (b *VariableTTLBuilder[K, V]) WeakValues() *VariableTTLBuilder[K, V] {
+	b.enableWeakValues()
+	return b
+}
+
+// WithWeakValues is the functional equivalent of Builder.WeakValues.
+func WithWeakValues() Option {
+	return func(o *options) {
+		o.weakValues = true
+	}
+}
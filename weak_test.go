@@ -0,0 +1,84 @@
+// Copyright (c) 2024 Alexey Mayshev. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.24
+
+package otter
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCache_WeakValues(t *testing.T) {
+	const size = 100
+	c, err := MustBuilder[int, Weak[[64]byte]](size).
+		WeakValues().
+		SynchronousEviction().
+		Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	defer c.Close()
+
+	kept := new([64]byte)
+	c.Set(0, MakeWeak(kept))
+	for i := 1; i < size; i++ {
+		c.Set(i, MakeWeak(new([64]byte)))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Size() > 1 && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if c.Size() != 1 {
+		t.Fatalf("reclaimed values should be removed, but got size %d", c.Size())
+	}
+	if v, ok := c.Get(0); !ok || v.Value() != kept {
+		t.Fatalf("referenced value should stay in the cache, but got %v %v", v.Value(), ok)
+	}
+	runtime.KeepAlive(kept)
+}
+
+func TestBuilder_WeakValues(t *testing.T) {
+	_, err := MustBuilder[int, int](100).WeakValues().Build()
+	if err == nil || !errors.Is(err, ErrIllegalWeakValues) {
+		t.Fatalf("should fail with an error %v, but got %v", ErrIllegalWeakValues, err)
+	}
+
+	c, err := MustBuilder[int, Weak[int]](100).WithTTL(time.Minute).WeakValues().Build()
+	if err != nil {
+		t.Fatalf("can not create cache: %v", err)
+	}
+	c.Close()
+
+	_, err = MustBuilder[int, Weak[int]](100).WeakValues().BuildOffHeap(1<<20, weakCodec{})
+	var cfgErr *ConfigError
+	if !errors.Is(err, ErrIllegalOffHeapOption) || !errors.As(err, &cfgErr) || cfgErr.Field != "WeakValues" {
+		t.Fatalf("should fail with a config error %v, but got %v", ErrIllegalOffHeapOption, err)
+	}
+}
+
+type weakCodec struct{}
+
+func (weakCodec) Encode(Weak[int]) ([]byte, error) {
+	return nil, nil
+}
+
+func (weakCodec) Decode([]byte) (Weak[int], error) {
+	return Weak[int]{}, nil
+}